@@ -0,0 +1,132 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// gitlabReportFile is the code quality report written by `--output gitlab`
+const gitlabReportFile = "gl-code-quality-report.json"
+
+// annotation describes a problem which should be reported inline by a CI system
+type annotation struct {
+	File    string
+	Line    int
+	Title   string
+	Message string
+}
+
+// runAnnotations returns annotations for any failures in the run report
+func runAnnotations(report runReport, migrationsDir string) []annotation {
+	if report.Err == nil {
+		return nil
+	}
+	if err, ok := report.Err.(lintError); ok {
+		return err.annotations()
+	}
+
+	a := annotation{
+		Title:   fmt.Sprintf("dbmate %s failed", report.Command),
+		Message: scrubSecrets(report.Err.Error()),
+	}
+	for _, m := range report.Migrations {
+		if m.Err != nil {
+			a.File = filepath.Join(migrationsDir, m.Filename)
+			a.Line = 1
+		}
+	}
+
+	return []annotation{a}
+}
+
+// annotationReporter emits CI annotations for failures in the given format
+func annotationReporter(format string, w io.Writer, migrationsDir string) (reporter, error) {
+	switch format {
+	case "github":
+		return func(report runReport) error {
+			return writeGitHubAnnotations(w, runAnnotations(report, migrationsDir))
+		}, nil
+	case "gitlab":
+		return func(report runReport) error {
+			return writeGitLabReport(gitlabReportFile, runAnnotations(report, migrationsDir))
+		}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported output format: %s", format)
+}
+
+// writeGitHubAnnotations prints GitHub Actions workflow commands
+func writeGitHubAnnotations(w io.Writer, as []annotation) error {
+	for _, a := range as {
+		props := []string{}
+		if a.File != "" {
+			props = append(props, "file="+githubEscapeProperty(a.File))
+			props = append(props, fmt.Sprintf("line=%d", a.Line))
+		}
+		props = append(props, "title="+githubEscapeProperty(a.Title))
+
+		_, err := fmt.Fprintf(w, "::error %s::%s\n", strings.Join(props, ","),
+			githubEscapeData(a.Message))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func githubEscapeData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func githubEscapeProperty(s string) string {
+	return strings.NewReplacer(":", "%3A", ",", "%2C").Replace(githubEscapeData(s))
+}
+
+// gitlabIssue is an entry in a GitLab code quality report
+type gitlabIssue struct {
+	Description string         `json:"description"`
+	CheckName   string         `json:"check_name"`
+	Fingerprint string         `json:"fingerprint"`
+	Severity    string         `json:"severity"`
+	Location    gitlabLocation `json:"location"`
+}
+
+type gitlabLocation struct {
+	Path  string      `json:"path"`
+	Lines gitlabLines `json:"lines"`
+}
+
+type gitlabLines struct {
+	Begin int `json:"begin"`
+}
+
+// writeGitLabReport writes a GitLab code quality report, which is shown inline
+// on merge requests when uploaded as a `codequality` artifact
+func writeGitLabReport(path string, as []annotation) error {
+	issues := []gitlabIssue{}
+	for _, a := range as {
+		issues = append(issues, gitlabIssue{
+			Description: fmt.Sprintf("%s: %s", a.Title, a.Message),
+			CheckName:   "dbmate",
+			Fingerprint: fmt.Sprintf("%x", sha1.Sum([]byte(a.File+a.Title+a.Message))),
+			Severity:    "major",
+			Location: gitlabLocation{
+				Path:  a.File,
+				Lines: gitlabLines{Begin: a.Line},
+			},
+		})
+	}
+
+	data, err := json.MarshalIndent(issues, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(data, '\n'), 0644)
+}
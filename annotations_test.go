@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunAnnotations(t *testing.T) {
+	as := runAnnotations(runReport{Command: "migrate"}, "db/migrations")
+	require.Len(t, as, 0)
+
+	report := testReport()
+	report.Migrations[2].Filename = "3_users.sql"
+	as = runAnnotations(report, "db/migrations")
+	require.Len(t, as, 1)
+	require.Equal(t, filepath.Join("db/migrations", "3_users.sql"), as[0].File)
+	require.Equal(t, 1, as[0].Line)
+	require.Equal(t, "dbmate migrate failed", as[0].Title)
+	require.Equal(t, "syntax error", as[0].Message)
+}
+
+func TestWriteGitHubAnnotations(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeGitHubAnnotations(&buf, []annotation{
+		{File: "db/migrations/1_a,b.sql", Line: 1, Title: "dbmate migrate failed", Message: "line one\nline 100%"},
+		{Title: "dbmate dump failed", Message: "boom"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "::error file=db/migrations/1_a%2Cb.sql,line=1,title=dbmate migrate failed::line one%0Aline 100%25\n"+
+		"::error title=dbmate dump failed::boom\n", buf.String())
+}
+
+func TestWriteGitLabReport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	path := filepath.Join(dir, gitlabReportFile)
+	err = writeGitLabReport(path, []annotation{
+		{File: "db/migrations/1_a.sql", Line: 1, Title: "dbmate migrate failed", Message: "boom"},
+	})
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	var issues []gitlabIssue
+	err = json.Unmarshal(data, &issues)
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	require.Equal(t, "dbmate migrate failed: boom", issues[0].Description)
+	require.Equal(t, "db/migrations/1_a.sql", issues[0].Location.Path)
+	require.Equal(t, 1, issues[0].Location.Lines.Begin)
+	require.Len(t, issues[0].Fingerprint, 40)
+
+	// reports are always written, so the artifact exists on success
+	err = writeGitLabReport(path, nil)
+	require.NoError(t, err)
+	data, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "[]\n", string(data))
+}
+
+func TestAnnotationReporter(t *testing.T) {
+	_, err := annotationReporter("teamcity", nil, "")
+	require.EqualError(t, err, "unsupported output format: teamcity")
+
+	var buf bytes.Buffer
+	r, err := annotationReporter("github", &buf, "db/migrations")
+	require.NoError(t, err)
+	report := testReport()
+	report.Migrations[2].Filename = "3_users.sql"
+	err = r(report)
+	require.NoError(t, err)
+	require.Equal(t, "::error file=db/migrations/3_users.sql,line=1,title=dbmate migrate failed::syntax error\n",
+		buf.String())
+}
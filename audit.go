@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// auditEntry is a single line in the audit log
+type auditEntry struct {
+	Time            time.Time `json:"time"`
+	Command         string    `json:"command"`
+	Args            []string  `json:"args"`
+	Driver          string    `json:"driver"`
+	DatabaseHost    string    `json:"database_host"`
+	Database        string    `json:"database"`
+	Versions        []string  `json:"versions"`
+	Status          string    `json:"status"`
+	Error           string    `json:"error,omitempty"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	User            string    `json:"user"`
+	Hostname        string    `json:"hostname"`
+}
+
+// newAuditEntry creates an audit log entry from a run report
+func newAuditEntry(report runReport, args []string) auditEntry {
+	entry := auditEntry{
+		Time:            report.StartedAt.UTC(),
+		Command:         report.Command,
+		Args:            args,
+		Driver:          report.Driver,
+		DatabaseHost:    report.DatabaseHost,
+		Database:        report.Database,
+		Versions:        []string{},
+		Status:          reportStatus(report),
+		DurationSeconds: report.Duration.Seconds(),
+		User:            report.User,
+		Hostname:        report.Hostname,
+	}
+
+	for _, m := range report.Migrations {
+		entry.Versions = append(entry.Versions, m.Version)
+	}
+	if report.Err != nil {
+		entry.Error = scrubSecrets(report.Err.Error())
+	}
+
+	return entry
+}
+
+// auditReporter appends a json line describing each invocation to the audit log
+func auditReporter(path string) reporter {
+	return func(report runReport) error {
+		data, err := json.Marshal(newAuditEntry(report, os.Args[1:]))
+		if err != nil {
+			return err
+		}
+
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("unable to write audit log: %s", err)
+		}
+		defer mustClose(f)
+
+		if _, err := f.Write(append(data, '\n')); err != nil {
+			return fmt.Errorf("unable to write audit log: %s", err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAuditEntry(t *testing.T) {
+	report := testReport()
+	report.Err = nil
+	report.User = "deploy"
+
+	entry := newAuditEntry(report, []string{"migrate"})
+	require.Equal(t, "migrate", entry.Command)
+	require.Equal(t, []string{"1", "2", "3"}, entry.Versions)
+	require.Equal(t, "success", entry.Status)
+	require.Equal(t, "", entry.Error)
+	require.Equal(t, 1.5, entry.DurationSeconds)
+	require.Equal(t, "deploy", entry.User)
+
+	entry = newAuditEntry(runReport{Command: "dump"}, nil)
+	require.Equal(t, []string{}, entry.Versions)
+}
+
+func TestAuditReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	path := filepath.Join(dir, "audit.jsonl")
+	rep := auditReporter(path)
+
+	err = rep(testReport())
+	require.NoError(t, err)
+	err = rep(runReport{Command: "dump"})
+	require.NoError(t, err)
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var entry auditEntry
+	err = json.Unmarshal([]byte(lines[0]), &entry)
+	require.NoError(t, err)
+	require.Equal(t, "failure", entry.Status)
+	require.Equal(t, "syntax error", entry.Error)
+}
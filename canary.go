@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// migrateCanary applies pending migrations to the canary database, verifies it,
+// and only then migrates the remaining targets
+func migrateCanary(db *dbmate.DB, c *cli.Context) error {
+	if c.String("canary") == "" {
+		return errors.New("please specify the canary database with --canary")
+	}
+	targets := c.StringSlice("target")
+	if len(targets) == 0 {
+		return errors.New("please specify the databases to migrate after the canary with --target")
+	}
+
+	// the schema is dumped from the canary database
+	canary, err := newShard(db, c.String("canary"), true)
+	if err != nil {
+		return err
+	}
+
+	run := &shardRun{db: db, strategy: c.String("strategy"), reportFile: c.String("report")}
+	for _, value := range targets {
+		target, err := newShard(db, value, false)
+		if err != nil {
+			return err
+		}
+		run.shards = append(run.shards, target)
+	}
+
+	return runCanary(canary, c.String("verify-query"), c.String("verify-command"), run)
+}
+
+// runCanary migrates and verifies the canary, then runs the target migrations
+func runCanary(canary *dbmate.DB, query, command string, targets *shardRun) error {
+	fmt.Fprintf(canary.Log, "Canary: %s\n", shardName(canary.DatabaseURL))
+	if err := canary.Migrate(); err != nil {
+		return fmt.Errorf("canary failed, targets were not migrated: %s", err)
+	}
+
+	if err := verifyCanary(canary, query, command); err != nil {
+		return fmt.Errorf("canary verification failed, targets were not migrated: %s", err)
+	}
+
+	return targets.migrate()
+}
+
+// verifyCanary runs the verification query and command (if any) against the
+// canary database
+func verifyCanary(canary *dbmate.DB, query, command string) error {
+	if query != "" {
+		fmt.Fprintf(canary.Log, "Verifying: %s\n", query)
+		if err := verifyQuery(canary, query); err != nil {
+			return err
+		}
+	}
+
+	if command != "" {
+		fmt.Fprintf(canary.Log, "Verifying: %s\n", command)
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(os.Environ(), "DBMATE_CANARY_URL="+canary.DatabaseURL.String())
+		cmd.Stdout = canary.Log
+		cmd.Stderr = canary.Log
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("verification command failed: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// verifyQuery fails if the query returns an error, no rows, or a first column
+// which is false, zero, or null
+func verifyQuery(canary *dbmate.DB, query string) error {
+	sqlDB, err := dbmate.GetDriverOpen(canary.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	var result sql.NullString
+	if err := sqlDB.QueryRow(query).Scan(&result); err == sql.ErrNoRows {
+		return errors.New("verification query returned no rows")
+	} else if err != nil {
+		return fmt.Errorf("verification query failed: %s", err)
+	}
+
+	switch result.String {
+	case "", "0", "f", "false", "FALSE":
+		return fmt.Errorf("verification query returned %q", result.String)
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCanary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.Mkdir(migrationsDir, 0755))
+	writeTestMigration(t, migrationsDir, "1_users.sql", "create table users (id integer);")
+
+	run, buf := testShardRun(t, dir, "lockstep")
+	canary, err := newShard(run.db, "sqlite:///"+filepath.Join(dir, "canary.sqlite3"), true)
+	require.NoError(t, err)
+	canaryName := "/" + filepath.Join(dir, "canary.sqlite3")
+
+	// verification failures stop the targets from being migrated
+	err = runCanary(canary, "select count(*) from users", "", run)
+	require.EqualError(t, err, "canary verification failed, targets were not migrated: "+
+		`verification query returned "0"`)
+	require.Equal(t, "Canary: "+canaryName+"\n"+
+		"Applying: 1_users.sql\n"+
+		"Verifying: select count(*) from users\n", buf.String())
+
+	buf.Reset()
+	err = runCanary(canary, "", "echo checking && exit 3", run)
+	require.EqualError(t, err, "canary verification failed, targets were not migrated: "+
+		"verification command failed: exit status 3")
+	require.Equal(t, "Canary: "+canaryName+"\n"+
+		"Verifying: echo checking && exit 3\n"+
+		"checking\n", buf.String())
+
+	err = runCanary(canary, "select id from users", "", run)
+	require.EqualError(t, err, "canary verification failed, targets were not migrated: "+
+		"verification query returned no rows")
+
+	// the targets are migrated after the canary is verified
+	buf.Reset()
+	err = runCanary(canary, "select count(*) = 0 from users", `test -n "$DBMATE_CANARY_URL"`, run)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "Verifying: select count(*) = 0 from users\n"+
+		"Verifying: test -n \"$DBMATE_CANARY_URL\"\n"+
+		"Version: 1\n")
+	require.Contains(t, buf.String(), "Migrated 2 shards\n")
+
+	// canary failures stop the targets from being migrated
+	writeTestMigration(t, migrationsDir, "2_fail.sql", "create table users (id integer);")
+	buf.Reset()
+	err = runCanary(canary, "", "", run)
+	require.EqualError(t, err, "canary failed, targets were not migrated: 2_fail.sql: statement 1, line 2: table users already exists")
+	require.NotContains(t, buf.String(), "Version:")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+// completionScripts are printed by the completion command. Each script calls
+// dbmate with --generate-bash-completion to list the candidates for the current
+// word, so that completions always match the installed version.
+var completionScripts = map[string]string{
+	"bash": `# bash completion for dbmate
+_dbmate_complete() {
+    local cur opts
+    COMPREPLY=()
+    cur="${COMP_WORDS[COMP_CWORD]}"
+    opts=$("${COMP_WORDS[@]:0:$COMP_CWORD}" --generate-bash-completion 2>/dev/null)
+    COMPREPLY=($(compgen -W "${opts}" -- "${cur}"))
+    return 0
+}
+
+complete -F _dbmate_complete dbmate
+`,
+	"zsh": `#compdef dbmate
+# zsh completion for dbmate
+_dbmate() {
+    local -a opts
+    opts=("${(@f)$(${words[1,CURRENT-1]} --generate-bash-completion 2>/dev/null)}")
+    compadd -- $opts
+}
+
+compdef _dbmate dbmate
+`,
+	"fish": `# fish completion for dbmate
+function __dbmate_complete
+    set -l args (commandline -opc)
+    command $args --generate-bash-completion 2>/dev/null
+end
+
+complete -c dbmate -f -a '(__dbmate_complete)'
+`,
+}
+
+// versionFlags are the flags which take a migration version
+var versionFlags = map[string]bool{
+	"--to":     true,
+	"--before": true,
+}
+
+// migrationVersionRegExp matches migration files, capturing the version
+var migrationVersionRegExp = regexp.MustCompile(`^(\d+).*\.sql$`)
+
+// printCompletionScript runs the completion command
+func printCompletionScript(c *cli.Context) error {
+	shell := c.Args().First()
+	script, ok := completionScripts[shell]
+	if !ok {
+		return fmt.Errorf("please specify a shell: bash, zsh, or fish")
+	}
+
+	_, err := fmt.Fprint(c.App.Writer, script)
+	return err
+}
+
+// setBashComplete sets the completion function for each command (and subcommand)
+// which does not define its own
+func setBashComplete(commands []cli.Command) {
+	for i := range commands {
+		if commands[i].BashComplete == nil {
+			commands[i].BashComplete = completeCommand
+		}
+		setBashComplete(commands[i].Subcommands)
+	}
+}
+
+// completeApp lists the commands and global flags
+func completeApp(c *cli.Context) {
+	for _, cmd := range c.App.Commands {
+		if !cmd.Hidden {
+			fmt.Fprintln(c.App.Writer, cmd.Name)
+		}
+	}
+	printFlagNames(c.App.Writer, c.App.Flags)
+}
+
+// completeCommand lists the migration versions after a flag which takes a
+// version, and otherwise the subcommands and flags of the command
+func completeCommand(c *cli.Context) {
+	if len(os.Args) > 2 && versionFlags[os.Args[len(os.Args)-2]] {
+		printMigrationVersions(c.App.Writer, migrationsDirs(c)[0])
+		return
+	}
+
+	// commands with subcommands run as a separate app
+	if c.Command.Name == "" {
+		completeApp(c)
+		return
+	}
+
+	for _, sub := range c.Command.Subcommands {
+		fmt.Fprintln(c.App.Writer, sub.Name)
+	}
+	printFlagNames(c.App.Writer, c.Command.Flags)
+}
+
+// completeVersions lists the migration versions, for commands which take a
+// version argument
+func completeVersions(c *cli.Context) {
+	printMigrationVersions(c.App.Writer, migrationsDirs(c)[0])
+}
+
+func printFlagNames(w io.Writer, flags []cli.Flag) {
+	for _, flag := range flags {
+		for _, name := range strings.Split(flag.GetName(), ",") {
+			name = strings.TrimSpace(name)
+			if len(name) > 1 && name != cli.BashCompletionFlag.GetName() {
+				fmt.Fprintln(w, "--"+name)
+			}
+		}
+	}
+}
+
+// printMigrationVersions lists the versions of the migration files in dir and
+// its subdirectories
+func printMigrationVersions(w io.Writer, dir string) {
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if match := migrationVersionRegExp.FindStringSubmatch(info.Name()); match != nil {
+			fmt.Fprintln(w, match[1])
+		}
+		return nil
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func TestPrintCompletionScript(t *testing.T) {
+	for _, shell := range []string{"bash", "zsh", "fish"} {
+		var buf bytes.Buffer
+		app := cli.NewApp()
+		app.Writer = &buf
+		set := flag.NewFlagSet("test", flag.ContinueOnError)
+		require.NoError(t, set.Parse([]string{shell}))
+
+		err := printCompletionScript(cli.NewContext(app, set, nil))
+		require.NoError(t, err)
+		require.Contains(t, buf.String(), "--generate-bash-completion")
+	}
+
+	set := flag.NewFlagSet("test", flag.ContinueOnError)
+	err := printCompletionScript(cli.NewContext(cli.NewApp(), set, nil))
+	require.EqualError(t, err, "please specify a shell: bash, zsh, or fish")
+}
+
+func TestPrintFlagNames(t *testing.T) {
+	var buf bytes.Buffer
+	printFlagNames(&buf, []cli.Flag{
+		cli.StringFlag{Name: "env, e"},
+		cli.BoolFlag{Name: "verbose"},
+		cli.BashCompletionFlag,
+	})
+	require.Equal(t, "--env\n--verbose\n", buf.String())
+}
+
+func TestPrintMigrationVersions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	for _, name := range []string{"20200101_users.sql", "20200202_posts.sql", "README.md"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte{}, 0644)
+		require.NoError(t, err)
+	}
+	err = os.Mkdir(filepath.Join(dir, "3_data.sql"), 0755)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "3_data.sql", "20200303_backfill.sql"), []byte{}, 0644)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	printMigrationVersions(&buf, dir)
+	require.Equal(t, "20200101\n20200202\n20200303\n", buf.String())
+
+	buf.Reset()
+	printMigrationVersions(&buf, filepath.Join(dir, "missing"))
+	require.Empty(t, buf.String())
+}
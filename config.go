@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// defaultConfigFile specifies the default location of the dbmate config file
+const defaultConfigFile = "dbmate.yml"
+
+// loadConfig reads the config file (if it exists) and applies its values to any
+// global flags which were not explicitly set on the command line.
+// Config keys correspond to global flag names, e.g. `migrations-dir: ./migrations`.
+func loadConfig(c *cli.Context) error {
+	path := c.GlobalString("config")
+
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) && !c.GlobalIsSet("config") {
+		// config file is optional unless specified explicitly
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("unable to read config file `%s`: %s", path, err)
+	}
+
+	config := map[string]interface{}{}
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("unable to parse config file `%s`: %s", path, err)
+	}
+
+	return applyConfig(c, config)
+}
+
+// applyConfig sets global flag values from a parsed config map
+func applyConfig(c *cli.Context, config map[string]interface{}) error {
+	known := map[string]bool{}
+	for _, name := range c.GlobalFlagNames() {
+		known[name] = true
+	}
+
+	for name, value := range config {
+		if !known[name] {
+			return fmt.Errorf("unknown config option: %s", name)
+		}
+
+		// command line flags take precedence
+		if c.GlobalIsSet(name) {
+			continue
+		}
+
+		// lists are applied one element at a time (for repeatable flags)
+		values, ok := value.([]interface{})
+		if !ok {
+			values = []interface{}{value}
+		}
+
+		for _, v := range values {
+			if err := c.GlobalSet(name, fmt.Sprint(v)); err != nil {
+				return fmt.Errorf("invalid config value for %s: %s", name, err)
+			}
+		}
+	}
+
+	return nil
+}
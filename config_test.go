@@ -0,0 +1,74 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApplyConfig(t *testing.T) {
+	u, err := url.Parse("foo://example.org/db")
+	require.NoError(t, err)
+	ctx := testContext(t, u)
+
+	err = ctx.GlobalSet("schema-file", "./cli/schema.sql")
+	require.NoError(t, err)
+
+	err = applyConfig(ctx, map[string]interface{}{
+		"migrations-dir": "./config/migrations",
+		"schema-file":    "./config/schema.sql",
+		"no-dump-schema": true,
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, []string{"./config/migrations"}, migrationsDirs(ctx))
+	require.Equal(t, "./cli/schema.sql", ctx.GlobalString("schema-file"))
+	require.True(t, ctx.GlobalBool("no-dump-schema"))
+}
+
+func TestApplyConfig_Unknown(t *testing.T) {
+	u, err := url.Parse("foo://example.org/db")
+	require.NoError(t, err)
+	ctx := testContext(t, u)
+
+	err = applyConfig(ctx, map[string]interface{}{"foo": "bar"})
+	require.EqualError(t, err, "unknown config option: foo")
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("foo://example.org/db")
+	require.NoError(t, err)
+	ctx := testContext(t, u)
+
+	// missing default config file is ignored
+	err = loadConfig(ctx)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "dbmate.yml")
+	err = ioutil.WriteFile(path, []byte("migrations-dir: ./foo\n"), 0644)
+	require.NoError(t, err)
+
+	err = ctx.GlobalSet("config", path)
+	require.NoError(t, err)
+	err = loadConfig(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []string{"./foo"}, migrationsDirs(ctx))
+
+	// explicitly specified config file must exist
+	err = ctx.GlobalSet("config", filepath.Join(dir, "missing.yml"))
+	require.NoError(t, err)
+	err = loadConfig(ctx)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to read config file")
+}
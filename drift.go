@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// errSchemaDrift is reported when the live schema differs from the schema file
+var errSchemaDrift = errors.New("schema drift detected")
+
+// driftMonitor compares the live database schema with the schema file
+type driftMonitor struct {
+	db        *dbmate.DB
+	newReport func() runReport
+	reporters []reporter
+
+	// checked and drifted record the result of the previous check
+	checked bool
+	drifted bool
+}
+
+// detectDrift checks the live schema once, or repeatedly if an interval is set
+func detectDrift(db *dbmate.DB, c *cli.Context) error {
+	interval := c.Duration("interval")
+	if interval == 0 {
+		diff, err := db.SchemaDiff()
+		if err != nil {
+			return err
+		}
+		if diff != "" {
+			fmt.Fprint(db.Log, diff)
+			return fmt.Errorf("%s: the database schema differs from %s", errSchemaDrift, db.SchemaFile)
+		}
+		fmt.Fprintf(db.Log, "No drift: the database schema matches %s\n", db.SchemaFile)
+		return nil
+	}
+
+	rs, err := reporters(c)
+	if err != nil {
+		return err
+	}
+
+	m := &driftMonitor{
+		db: db,
+		newReport: func() runReport {
+			return newRunReport(c, db.DatabaseURL)
+		},
+		reporters: rs,
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	fmt.Fprintf(db.Log, "Monitoring: %s every %s\n", db.SchemaFile, interval)
+	for {
+		if err := m.check(); err != nil {
+			fmt.Fprintf(db.Log, "Error: %s\n", err)
+		}
+
+		select {
+		case <-sig:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// check compares the schemas, and publishes a report when drift is first
+// detected or resolved
+func (m *driftMonitor) check() error {
+	diff, err := m.db.SchemaDiff()
+	if err != nil {
+		return err
+	}
+	drifted := diff != ""
+
+	changed := !m.checked || drifted != m.drifted
+	m.checked, m.drifted = true, drifted
+	if !changed {
+		return nil
+	}
+
+	report := m.newReport()
+	if drifted {
+		fmt.Fprintf(m.db.Log, "Drift: the database schema differs from %s\n", m.db.SchemaFile)
+		fmt.Fprint(m.db.Log, diff)
+		report.Err = errSchemaDrift
+	} else {
+		fmt.Fprintf(m.db.Log, "No drift: the database schema matches %s\n", m.db.SchemaFile)
+	}
+	report.Duration = time.Since(report.StartedAt)
+	publishReport(m.db.Log, m.reporters, report)
+
+	return nil
+}
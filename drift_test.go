@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+// driftTestDriver is a sqlite driver which returns a fixed schema dump
+type driftTestDriver struct {
+	dbmate.SQLiteDriver
+	schema string
+}
+
+func (drv *driftTestDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	return []byte(drv.schema), nil
+}
+
+func TestDriftMonitor(t *testing.T) {
+	drv := &driftTestDriver{schema: "CREATE TABLE users (id integer);\n"}
+	dbmate.RegisterDriver(drv, "sqlite-drift")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-drift:///" + filepath.Join(dir, "drift.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := dbmate.New(u)
+	db.Log = &buf
+	db.SchemaFile = filepath.Join(dir, "schema.sql")
+	err = ioutil.WriteFile(db.SchemaFile, []byte(drv.schema), 0644)
+	require.NoError(t, err)
+
+	var reported []runReport
+	m := &driftMonitor{
+		db: db,
+		newReport: func() runReport {
+			return runReport{Command: "drift"}
+		},
+		reporters: []reporter{func(r runReport) error {
+			reported = append(reported, r)
+			return nil
+		}},
+	}
+
+	// the first check is always reported
+	require.NoError(t, m.check())
+	require.Len(t, reported, 1)
+	require.NoError(t, reported[0].Err)
+
+	// drift is reported once, until it is resolved
+	drv.schema = "CREATE TABLE users (id integer, email text);\n"
+	require.NoError(t, m.check())
+	require.NoError(t, m.check())
+	require.Len(t, reported, 2)
+	require.Equal(t, errSchemaDrift, reported[1].Err)
+
+	drv.schema = "CREATE TABLE users (id integer);\n"
+	require.NoError(t, m.check())
+	require.Len(t, reported, 3)
+	require.NoError(t, reported[2].Err)
+
+	require.Equal(t, "No drift: the database schema matches "+db.SchemaFile+"\n"+
+		"Drift: the database schema differs from "+db.SchemaFile+"\n"+
+		"--- "+db.SchemaFile+"\n"+
+		"+++ database\n"+
+		"@@ -1 +1 @@\n"+
+		"-CREATE TABLE users (id integer);\n"+
+		"+CREATE TABLE users (id integer, email text);\n"+
+		"No drift: the database schema matches "+db.SchemaFile+"\n", buf.String())
+}
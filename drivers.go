@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// listDrivers runs the drivers command
+func listDrivers(c *cli.Context) error {
+	infos := dbmate.Drivers()
+	if c.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(infos)
+	}
+
+	printDrivers(os.Stdout, infos, exec.LookPath)
+
+	return nil
+}
+
+// printDrivers writes the supported drivers, marking binaries which lookPath
+// can't find
+func printDrivers(w io.Writer, infos []dbmate.DriverInfo, lookPath func(string) (string, error)) {
+	for i, info := range infos {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+
+		dump := "no"
+		if info.SchemaDump {
+			dump = "yes"
+		}
+
+		binaries := []string{}
+		for _, name := range info.Binaries {
+			if _, err := lookPath(name); err != nil {
+				name += " (not found)"
+			}
+			binaries = append(binaries, name)
+		}
+
+		fmt.Fprintln(w, info.Scheme)
+		fmt.Fprintf(w, "  schema dump: %s\n", dump)
+		fmt.Fprintf(w, "  binaries:    %s\n", listOrNone(binaries))
+		fmt.Fprintf(w, "  url options: %s\n", listOrNone(info.URLOptions))
+		fmt.Fprintf(w, "  features:    %s\n", listOrNone(info.Features))
+	}
+}
+
+func listOrNone(items []string) string {
+	if len(items) == 0 {
+		return "none"
+	}
+
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintDrivers(t *testing.T) {
+	infos := []dbmate.DriverInfo{
+		{
+			Scheme:     "postgres",
+			SchemaDump: true,
+			Binaries:   []string{"pg_dump", "psql"},
+			URLOptions: []string{"sslmode"},
+			Features:   []string{"backup", "console"},
+		},
+		{Scheme: "fake"},
+	}
+	lookPath := func(name string) (string, error) {
+		if name == "psql" {
+			return "", errors.New("not found")
+		}
+		return "/usr/bin/" + name, nil
+	}
+
+	var buf bytes.Buffer
+	printDrivers(&buf, infos, lookPath)
+	require.Equal(t, `postgres
+  schema dump: yes
+  binaries:    pg_dump, psql (not found)
+  url options: sslmode
+  features:    backup, console
+
+fake
+  schema dump: no
+  binaries:    none
+  url options: none
+  features:    none
+`, buf.String())
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// checkCommitted returns an error if the directory contains uncommitted or
+// untracked files. Directories outside of a git work tree are not checked.
+func checkCommitted(dir string) error {
+	if _, err := exec.LookPath("git"); err != nil {
+		return fmt.Errorf("--require-committed requires git: %s", err)
+	}
+
+	// rev-parse fails outside of a work tree
+	if _, err := gitOutput(dir, "rev-parse", "--is-inside-work-tree"); err != nil {
+		return nil
+	}
+
+	out, err := gitOutput(dir, "status", "--porcelain", "--untracked-files=all", "--", ".")
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		return nil
+	}
+
+	return fmt.Errorf("migrations directory `%s` has uncommitted changes:\n%s", dir, out)
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimRight(stdout.String(), "\n"), nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckCommitted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	migrations := filepath.Join(dir, "migrations")
+	require.NoError(t, os.Mkdir(migrations, 0755))
+	writeTestMigration(t, migrations, "1_users.sql", "create table users (id integer);")
+
+	// outside of a git repo
+	err = checkCommitted(migrations)
+	require.NoError(t, err)
+
+	git := func(args ...string) {
+		_, err := gitOutput(dir, append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"},
+			args...)...)
+		require.NoError(t, err)
+	}
+	git("init")
+
+	// untracked
+	err = checkCommitted(migrations)
+	require.EqualError(t, err, "migrations directory `"+migrations+"` has uncommitted changes:\n"+
+		"?? migrations/1_users.sql")
+
+	git("add", ".")
+	git("commit", "-m", "add users")
+	err = checkCommitted(migrations)
+	require.NoError(t, err)
+
+	// modified
+	writeTestMigration(t, migrations, "1_users.sql", "create table users (id bigint);")
+	err = checkCommitted(migrations)
+	require.EqualError(t, err, "migrations directory `"+migrations+"` has uncommitted changes:\n"+
+		" M migrations/1_users.sql")
+
+	// changes outside the migrations directory are ignored
+	git("commit", "-am", "change users")
+	err = ioutil.WriteFile(filepath.Join(dir, "README"), []byte("readme"), 0644)
+	require.NoError(t, err)
+	err = checkCommitted(migrations)
+	require.NoError(t, err)
+}
+
+func TestRequireCommitted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	err = os.Setenv("DATABASE_URL", "sqlite:///"+filepath.Join(dir, "committed.sqlite3"))
+	require.NoError(t, err)
+	defer func() {
+		err := os.Unsetenv("DATABASE_URL")
+		require.NoError(t, err)
+	}()
+
+	mainDir, sharedDir := filepath.Join(dir, "main"), filepath.Join(dir, "shared")
+	require.NoError(t, os.Mkdir(mainDir, 0755))
+	require.NoError(t, os.Mkdir(sharedDir, 0755))
+	writeTestMigration(t, mainDir, "1_users.sql", "create table users (id integer);")
+	_, err = gitOutput(dir, "init")
+	require.NoError(t, err)
+	_, err = gitOutput(dir, "add", "main")
+	require.NoError(t, err)
+	_, err = gitOutput(dir, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-m", "add users")
+	require.NoError(t, err)
+
+	// every migrations directory is checked, for each command which migrates
+	writeTestMigration(t, sharedDir, "2_posts.sql", "create table posts (id integer);")
+	for _, command := range []string{"migrate", "baseline", "load"} {
+		app := NewApp()
+		err = app.Run([]string{"dbmate", "--migrations-dir", mainDir + "," + sharedDir, "--require-committed", command})
+		require.EqualError(t, err, "migrations directory `"+sharedDir+"` has uncommitted changes:\n"+
+			"?? shared/2_posts.sql", command)
+	}
+}
@@ -1,14 +1,17 @@
 module github.com/amacneil/dbmate
 
-go 1.14
+go 1.16
 
 require (
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/go-sql-driver/mysql v1.4.1
 	github.com/joho/godotenv v1.3.0
 	github.com/lib/pq v1.1.1
-	github.com/mattn/go-sqlite3 v1.10.0
+	github.com/mattn/go-sqlite3 v1.14.9
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.3.0
 	github.com/urfave/cli v1.20.0
 	google.golang.org/appengine v1.6.0 // indirect
+	gopkg.in/yaml.v2 v2.2.2
+	modernc.org/sqlite v1.14.0
 )
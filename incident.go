@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	// pagerDutyEventsURL is the PagerDuty Events API v2 endpoint
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// defaultOpsgenieAPIURL is the Opsgenie API in the US region
+	defaultOpsgenieAPIURL = "https://api.opsgenie.com"
+	// opsgenieMaxMessageLength is the maximum length of an Opsgenie alert message
+	opsgenieMaxMessageLength = 130
+)
+
+// incidentKey identifies the incident for a database, so that repeated failures
+// are grouped into one incident, and a later successful run resolves it
+func incidentKey(report runReport) string {
+	return fmt.Sprintf("dbmate:%s:%s:%s", report.Driver, report.DatabaseHost, report.Database)
+}
+
+// incidentSummary describes a failed run in one line
+func incidentSummary(report runReport) string {
+	summary := fmt.Sprintf("dbmate %s failed on %s database %s", report.Command, report.Driver, report.Database)
+	if report.DatabaseHost != "" {
+		summary += " at " + report.DatabaseHost
+	}
+	for _, m := range report.Migrations {
+		if m.Err != nil {
+			summary += fmt.Sprintf(" (migration %s)", m.Version)
+		}
+	}
+
+	return summary
+}
+
+// incidentDetails returns the fields attached to an incident
+func incidentDetails(report runReport, environment string) map[string]string {
+	details := map[string]string{
+		"command":       report.Command,
+		"driver":        report.Driver,
+		"database_host": report.DatabaseHost,
+		"database":      report.Database,
+		"environment":   environment,
+		"hostname":      report.Hostname,
+		"user":          report.User,
+		"error":         scrubSecrets(report.Err.Error()),
+	}
+	for _, m := range report.Migrations {
+		if m.Err != nil {
+			details["version"] = m.Version
+			details["filename"] = m.Filename
+		}
+	}
+
+	return details
+}
+
+// pagerDutyReporter opens a PagerDuty incident when a command fails, and
+// resolves it when a later run against the same database succeeds
+func pagerDutyReporter(eventsURL, routingKey, environment string) reporter {
+	return func(report runReport) error {
+		if !notifyCommands[report.Command] {
+			return nil
+		}
+
+		event := map[string]interface{}{
+			"routing_key":  routingKey,
+			"event_action": "resolve",
+			"dedup_key":    incidentKey(report),
+		}
+		if report.Err != nil {
+			event["event_action"] = "trigger"
+			event["payload"] = map[string]interface{}{
+				"summary":        incidentSummary(report),
+				"source":         report.Hostname,
+				"severity":       "critical",
+				"component":      report.Database,
+				"group":          environment,
+				"class":          "migration",
+				"custom_details": incidentDetails(report, environment),
+			}
+		}
+
+		return sendIncident("pagerduty", eventsURL, "", event)
+	}
+}
+
+// opsgenieReporter opens an Opsgenie alert when a command fails, and closes it
+// when a later run against the same database succeeds
+func opsgenieReporter(apiURL, apiKey, environment string) reporter {
+	return func(report runReport) error {
+		if !notifyCommands[report.Command] {
+			return nil
+		}
+
+		alias := incidentKey(report)
+		if report.Err == nil {
+			closeURL := fmt.Sprintf("%s/v2/alerts/%s/close?identifierType=alias",
+				strings.TrimSuffix(apiURL, "/"), url.PathEscape(alias))
+			return sendIncident("opsgenie", closeURL, apiKey, map[string]string{"source": "dbmate"})
+		}
+
+		message := incidentSummary(report)
+		if len(message) > opsgenieMaxMessageLength {
+			message = message[:opsgenieMaxMessageLength-3] + "..."
+		}
+		alert := map[string]interface{}{
+			"message":     message,
+			"alias":       alias,
+			"description": scrubSecrets(report.Err.Error()),
+			"source":      "dbmate",
+			"tags":        []string{"dbmate", environment},
+			"details":     incidentDetails(report, environment),
+			"priority":    "P1",
+		}
+
+		return sendIncident("opsgenie", strings.TrimSuffix(apiURL, "/")+"/v2/alerts", apiKey, alert)
+	}
+}
+
+// sendIncident posts an incident event, authenticating with an Opsgenie API key if set
+func sendIncident(service, u, apiKey string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", u, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to send %s event: %s", service, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "GenieKey "+apiKey)
+	}
+
+	client := http.Client{Timeout: metricsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send %s event: %s", service, err)
+	}
+	defer mustClose(resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unable to send %s event: %s", service, resp.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testIncidentReport() runReport {
+	report := testReport()
+	report.Driver = "postgres"
+	report.DatabaseHost = "db.example.com"
+	report.Database = "app"
+	report.Hostname = "ci"
+	report.Migrations[2].Filename = "3_add_index.sql"
+
+	return report
+}
+
+func TestIncidentSummary(t *testing.T) {
+	require.Equal(t, "dbmate migrate failed on postgres database app at db.example.com (migration 3)",
+		incidentSummary(testIncidentReport()))
+
+	details := incidentDetails(testIncidentReport(), "production")
+	require.Equal(t, "3", details["version"])
+	require.Equal(t, "3_add_index.sql", details["filename"])
+	require.Equal(t, "syntax error", details["error"])
+	require.Equal(t, "production", details["environment"])
+}
+
+// incidentServer records the requests sent to it
+func incidentServer(t *testing.T) (*httptest.Server, *[]*http.Request, *[]map[string]interface{}) {
+	requests := []*http.Request{}
+	bodies := []map[string]interface{}{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		body := map[string]interface{}{}
+		require.NoError(t, json.Unmarshal(data, &body))
+
+		requests = append(requests, r)
+		bodies = append(bodies, body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+
+	return server, &requests, &bodies
+}
+
+func TestPagerDutyReporter(t *testing.T) {
+	server, requests, bodies := incidentServer(t)
+	defer server.Close()
+
+	r := pagerDutyReporter(server.URL, "routing-key", "production")
+	err := r(testIncidentReport())
+	require.NoError(t, err)
+	require.Len(t, *requests, 1)
+
+	event := (*bodies)[0]
+	require.Equal(t, "routing-key", event["routing_key"])
+	require.Equal(t, "trigger", event["event_action"])
+	require.Equal(t, "dbmate:postgres:db.example.com:app", event["dedup_key"])
+	payload := event["payload"].(map[string]interface{})
+	require.Equal(t, "critical", payload["severity"])
+	require.Equal(t, "3", payload["custom_details"].(map[string]interface{})["version"])
+
+	// a successful run resolves the incident
+	report := testIncidentReport()
+	report.Err = nil
+	report.Migrations = nil
+	err = r(report)
+	require.NoError(t, err)
+	require.Len(t, *requests, 2)
+	require.Equal(t, "resolve", (*bodies)[1]["event_action"])
+	require.Equal(t, "dbmate:postgres:db.example.com:app", (*bodies)[1]["dedup_key"])
+	require.Nil(t, (*bodies)[1]["payload"])
+
+	// other commands are ignored
+	report.Command = "status"
+	err = r(report)
+	require.NoError(t, err)
+	require.Len(t, *requests, 2)
+}
+
+func TestOpsgenieReporter(t *testing.T) {
+	server, requests, bodies := incidentServer(t)
+	defer server.Close()
+
+	r := opsgenieReporter(server.URL+"/", "api-key", "production")
+	err := r(testIncidentReport())
+	require.NoError(t, err)
+	require.Len(t, *requests, 1)
+	require.Equal(t, "/v2/alerts", (*requests)[0].URL.Path)
+	require.Equal(t, "GenieKey api-key", (*requests)[0].Header.Get("Authorization"))
+
+	alert := (*bodies)[0]
+	require.Equal(t, "dbmate migrate failed on postgres database app at db.example.com (migration 3)",
+		alert["message"])
+	require.Equal(t, "dbmate:postgres:db.example.com:app", alert["alias"])
+	require.Equal(t, "syntax error", alert["description"])
+	require.Equal(t, []interface{}{"dbmate", "production"}, alert["tags"])
+
+	report := testIncidentReport()
+	report.Err = nil
+	err = r(report)
+	require.NoError(t, err)
+	require.Len(t, *requests, 2)
+	require.Equal(t, "/v2/alerts/dbmate:postgres:db.example.com:app/close",
+		(*requests)[1].URL.EscapedPath())
+	require.Equal(t, "alias", (*requests)[1].URL.Query().Get("identifierType"))
+}
+
+func TestSendIncidentError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := pagerDutyReporter(server.URL, "key", "production")(testIncidentReport())
+	require.EqualError(t, err, "unable to send pagerduty event: 400 Bad Request")
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// lambdaRuntimeVersion is the AWS Lambda runtime API version
+const lambdaRuntimeVersion = "2018-06-01"
+
+// lambdaEvent contains the fields used from direct invoke and API Gateway
+// (REST and HTTP API) event payloads
+type lambdaEvent struct {
+	// direct invoke, e.g. {"command": "migrate"}
+	Command string `json:"command"`
+	// API Gateway REST API (payload version 1.0)
+	HTTPMethod string `json:"httpMethod"`
+	Path       string `json:"path"`
+	// API Gateway HTTP API (payload version 2.0)
+	RawPath        string `json:"rawPath"`
+	RequestContext struct {
+		HTTP struct {
+			Method string `json:"method"`
+		} `json:"http"`
+	} `json:"requestContext"`
+}
+
+// lambdaCommands maps direct invoke commands to server endpoints
+var lambdaCommands = map[string]string{
+	"status":   http.MethodGet,
+	"migrate":  http.MethodPost,
+	"rollback": http.MethodPost,
+}
+
+// lambdaRuntime processes invocations from the AWS Lambda runtime API
+type lambdaRuntime struct {
+	client  *http.Client
+	baseURL string
+	handler http.Handler
+}
+
+// runLambda serves Lambda invocations until the runtime shuts down. Lambda
+// invocations are authorized by IAM or API Gateway, so no token is required.
+func runLambda(db *dbmate.DB, c *cli.Context) error {
+	api := os.Getenv("AWS_LAMBDA_RUNTIME_API")
+	if api == "" {
+		return errors.New("lambda must be run inside AWS Lambda (AWS_LAMBDA_RUNTIME_API is not set)")
+	}
+
+	s, err := newServer(db, c, "")
+	if err != nil {
+		return err
+	}
+
+	rt := &lambdaRuntime{
+		client:  &http.Client{},
+		baseURL: fmt.Sprintf("http://%s/%s/runtime", api, lambdaRuntimeVersion),
+		handler: s.handler(),
+	}
+
+	for {
+		if err := rt.next(); err != nil {
+			return err
+		}
+	}
+}
+
+// next waits for the next invocation and posts its result
+func (rt *lambdaRuntime) next() error {
+	resp, err := rt.client.Get(rt.baseURL + "/invocation/next")
+	if err != nil {
+		return fmt.Errorf("unable to get lambda invocation: %s", err)
+	}
+	defer mustClose(resp.Body)
+
+	var event bytes.Buffer
+	if _, err := event.ReadFrom(resp.Body); err != nil {
+		return err
+	}
+	id := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+
+	result, err := lambdaInvoke(rt.handler, event.Bytes())
+	if err != nil {
+		data, _ := json.Marshal(map[string]string{
+			"errorMessage": err.Error(),
+			"errorType":    "dbmate.Error",
+		})
+		return rt.post(fmt.Sprintf("/invocation/%s/error", id), data)
+	}
+
+	return rt.post(fmt.Sprintf("/invocation/%s/response", id), result)
+}
+
+func (rt *lambdaRuntime) post(path string, data []byte) error {
+	resp, err := rt.client.Post(rt.baseURL+path, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to post lambda result: %s", err)
+	}
+	defer mustClose(resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unable to post lambda result: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// lambdaInvoke handles a single event. API Gateway events are routed to the
+// server endpoints and return a proxy response, while direct invocations return
+// the endpoint's JSON result (or an error if the command failed).
+func lambdaInvoke(h http.Handler, data []byte) ([]byte, error) {
+	var event lambdaEvent
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("unable to parse event: %s", err)
+	}
+
+	if event.Command != "" {
+		method, ok := lambdaCommands[event.Command]
+		if !ok {
+			return nil, fmt.Errorf("unsupported command: %s", event.Command)
+		}
+
+		rec := lambdaRequest(h, method, "/"+event.Command)
+		if rec.Code >= 300 {
+			var body struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(rec.Body.Bytes(), &body)
+			return nil, fmt.Errorf("%s failed: %s", event.Command, body.Error)
+		}
+
+		return rec.Body.Bytes(), nil
+	}
+
+	method, path := event.HTTPMethod, event.Path
+	if method == "" {
+		method, path = event.RequestContext.HTTP.Method, event.RawPath
+	}
+	if method == "" {
+		return nil, errors.New("unsupported event: expected a command or API Gateway request")
+	}
+
+	rec := lambdaRequest(h, method, path)
+
+	return json.Marshal(map[string]interface{}{
+		"statusCode": rec.Code,
+		"headers":    map[string]string{"Content-Type": "application/json"},
+		"body":       rec.Body.String(),
+	})
+}
+
+func lambdaRequest(h http.Handler, method, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(method, path, nil))
+
+	return rec
+}
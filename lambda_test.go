@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLambdaInvokeDirect(t *testing.T) {
+	s, _, _ := testServer(t)
+	s.token = ""
+	h := s.handler()
+
+	data, err := lambdaInvoke(h, []byte(`{"command":"status"}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"applied":false`)
+
+	data, err = lambdaInvoke(h, []byte(`{"command":"migrate"}`))
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"status":"success"`)
+
+	_, err = lambdaInvoke(h, []byte(`{"command":"rollback"}`))
+	require.NoError(t, err)
+	_, err = lambdaInvoke(h, []byte(`{"command":"rollback"}`))
+	require.EqualError(t, err, "rollback failed: can't rollback: no migrations have been applied")
+
+	_, err = lambdaInvoke(h, []byte(`{"command":"drop"}`))
+	require.EqualError(t, err, "unsupported command: drop")
+
+	_, err = lambdaInvoke(h, []byte(`{}`))
+	require.EqualError(t, err, "unsupported event: expected a command or API Gateway request")
+}
+
+func TestLambdaInvokeAPIGateway(t *testing.T) {
+	s, _, _ := testServer(t)
+	s.token = ""
+	h := s.handler()
+
+	var resp struct {
+		StatusCode int               `json:"statusCode"`
+		Headers    map[string]string `json:"headers"`
+		Body       string            `json:"body"`
+	}
+
+	// REST API payload
+	data, err := lambdaInvoke(h, []byte(`{"httpMethod":"GET","path":"/healthz"}`))
+	require.NoError(t, err)
+	err = json.Unmarshal(data, &resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Headers["Content-Type"])
+	require.JSONEq(t, `{"status":"ok"}`, resp.Body)
+
+	// HTTP API payload
+	data, err = lambdaInvoke(h, []byte(`{"rawPath":"/migrate","requestContext":{"http":{"method":"GET"}}}`))
+	require.NoError(t, err)
+	err = json.Unmarshal(data, &resp)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestLambdaRuntimeNext(t *testing.T) {
+	s, _, _ := testServer(t)
+	s.token = ""
+
+	var posted []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/2018-06-01/runtime/invocation/next":
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", "req-1")
+			_, _ = w.Write([]byte(`{"command":"rollback"}`))
+		default:
+			body, _ := ioutil.ReadAll(r.Body)
+			posted = append(posted, r.URL.Path+" "+string(body))
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer api.Close()
+
+	rt := &lambdaRuntime{
+		client:  api.Client(),
+		baseURL: api.URL + "/2018-06-01/runtime",
+		handler: s.handler(),
+	}
+
+	err := rt.next()
+	require.NoError(t, err)
+	require.Equal(t, []string{"/2018-06-01/runtime/invocation/req-1/error " +
+		`{"errorMessage":"rollback failed: can't rollback: no migrations have been applied",` +
+		`"errorType":"dbmate.Error"}`}, posted)
+}
@@ -0,0 +1,314 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// serviceAccountDir contains the credentials mounted into kubernetes pods
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+	// leaseDuration is how long a lease is valid without being renewed
+	leaseDuration = 15 * time.Second
+	// leaseRetryInterval is how often followers check whether the lease is available
+	leaseRetryInterval = 2 * time.Second
+	// k8sTimeFormat is the MicroTime format used by the Lease API
+	k8sTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
+
+// errLeaseConflict is returned when another holder modified the lease first
+var errLeaseConflict = errors.New("lease was modified concurrently")
+
+// k8sLease is a coordination.k8s.io/v1 Lease object
+type k8sLease struct {
+	APIVersion string       `json:"apiVersion"`
+	Kind       string       `json:"kind"`
+	Metadata   k8sLeaseMeta `json:"metadata"`
+	Spec       k8sLeaseSpec `json:"spec"`
+}
+
+type k8sLeaseMeta struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace,omitempty"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type k8sLeaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+}
+
+// expired returns whether the lease is free to be acquired
+func (l *k8sLease) expired(now time.Time) bool {
+	if l.Spec.HolderIdentity == "" {
+		return true
+	}
+
+	renewed, err := time.Parse(time.RFC3339, l.Spec.RenewTime)
+	if err != nil {
+		return true
+	}
+
+	return now.After(renewed.Add(time.Duration(l.Spec.LeaseDurationSeconds) * time.Second))
+}
+
+// leaseLock uses a kubernetes Lease for leader election, so that only one of
+// many replicas runs a command at a time
+type leaseLock struct {
+	client    *http.Client
+	baseURL   string
+	token     string
+	namespace string
+	name      string
+	identity  string
+	duration  time.Duration
+	interval  time.Duration
+	now       func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newLeaseLock creates a lease lock using the pod's service account
+func newLeaseLock(name string) (*leaseLock, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("--k8s-lease requires running in a kubernetes pod")
+	}
+
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account token: %s", err)
+	}
+
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("unable to read service account CA: %s", err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+
+	namespace := os.Getenv("POD_NAMESPACE")
+	if namespace == "" {
+		data, err := ioutil.ReadFile(serviceAccountDir + "/namespace")
+		if err != nil {
+			return nil, fmt.Errorf("unable to read service account namespace: %s", err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+
+	identity, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return &leaseLock{
+		client: &http.Client{
+			Timeout:   metricsTimeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+		},
+		baseURL:   fmt.Sprintf("https://%s:%s", host, port),
+		token:     strings.TrimSpace(string(token)),
+		namespace: namespace,
+		name:      name,
+		identity:  identity,
+		duration:  leaseDuration,
+		interval:  leaseRetryInterval,
+		now:       time.Now,
+	}, nil
+}
+
+// Acquire blocks until this process holds the lease, then renews it in the
+// background until Release is called
+func (l *leaseLock) Acquire(log io.Writer) error {
+	waiting := false
+	for {
+		ok, holder, err := l.tryAcquire()
+		if err != nil {
+			return err
+		}
+		if ok {
+			break
+		}
+
+		if !waiting {
+			fmt.Fprintf(log, "Waiting for lease %s (held by %s)\n", l.name, holder)
+			waiting = true
+		}
+		time.Sleep(l.interval)
+	}
+
+	l.stop = make(chan struct{})
+	l.done = make(chan struct{})
+	go l.renew()
+
+	return nil
+}
+
+// Release stops renewing the lease and clears the holder, so a waiting
+// replica can acquire it immediately
+func (l *leaseLock) Release() error {
+	if l.stop != nil {
+		close(l.stop)
+		<-l.done
+	}
+
+	lease, err := l.get()
+	if err != nil {
+		return err
+	}
+	if lease == nil || lease.Spec.HolderIdentity != l.identity {
+		return nil
+	}
+
+	lease.Spec.HolderIdentity = ""
+	lease.Spec.AcquireTime = ""
+	lease.Spec.RenewTime = ""
+
+	return l.write(http.MethodPut, lease)
+}
+
+// tryAcquire attempts to take the lease, and returns the current holder if it
+// is held by someone else
+func (l *leaseLock) tryAcquire() (bool, string, error) {
+	lease, err := l.get()
+	if err != nil {
+		return false, "", err
+	}
+
+	now := l.now().UTC().Format(k8sTimeFormat)
+	method := http.MethodPut
+	if lease == nil {
+		method = http.MethodPost
+		lease = &k8sLease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   k8sLeaseMeta{Name: l.name, Namespace: l.namespace},
+		}
+	} else if lease.Spec.HolderIdentity != l.identity && !lease.expired(l.now()) {
+		return false, lease.Spec.HolderIdentity, nil
+	}
+
+	lease.Spec.HolderIdentity = l.identity
+	lease.Spec.LeaseDurationSeconds = int(l.duration / time.Second)
+	lease.Spec.AcquireTime = now
+	lease.Spec.RenewTime = now
+
+	err = l.write(method, lease)
+	if err == errLeaseConflict {
+		// another replica won the race
+		return false, "another replica", nil
+	}
+
+	return err == nil, "", err
+}
+
+func (l *leaseLock) renew() {
+	defer close(l.done)
+
+	ticker := time.NewTicker(l.duration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+			lease, err := l.get()
+			if err != nil || lease == nil || lease.Spec.HolderIdentity != l.identity {
+				continue
+			}
+			lease.Spec.RenewTime = l.now().UTC().Format(k8sTimeFormat)
+			_ = l.write(http.MethodPut, lease)
+		}
+	}
+}
+
+func (l *leaseLock) url(name string) string {
+	u := fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", l.baseURL, l.namespace)
+	if name != "" {
+		u += "/" + name
+	}
+
+	return u
+}
+
+// get returns the lease, or nil if it does not exist
+func (l *leaseLock) get() (*k8sLease, error) {
+	resp, err := l.do(http.MethodGet, l.url(l.name), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unable to get lease %s: %s", l.name, resp.Status)
+	}
+
+	lease := &k8sLease{}
+	if err := json.NewDecoder(resp.Body).Decode(lease); err != nil {
+		return nil, err
+	}
+
+	return lease, nil
+}
+
+// write creates (POST) or updates (PUT) the lease
+func (l *leaseLock) write(method string, lease *k8sLease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	u := l.url(l.name)
+	if method == http.MethodPost {
+		u = l.url("")
+	}
+
+	resp, err := l.do(method, u, data)
+	if err != nil {
+		return err
+	}
+	defer mustClose(resp.Body)
+
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return errLeaseConflict
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("unable to update lease %s: %s", l.name, resp.Status)
+	}
+
+	return nil
+}
+
+func (l *leaseLock) do(method, u string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+l.token)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach kubernetes API: %s", err)
+	}
+
+	return resp, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeLeaseAPI implements the subset of the Lease API used by leaseLock,
+// including resourceVersion conflict detection
+type fakeLeaseAPI struct {
+	mu      sync.Mutex
+	lease   *k8sLease
+	version int
+}
+
+func (f *fakeLeaseAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Bearer token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if f.lease == nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(f.lease)
+	case http.MethodPost, http.MethodPut:
+		lease := &k8sLease{}
+		if err := json.NewDecoder(r.Body).Decode(lease); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if (r.Method == http.MethodPost && f.lease != nil) ||
+			(r.Method == http.MethodPut && lease.Metadata.ResourceVersion != strconv.Itoa(f.version)) {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		f.version++
+		lease.Metadata.ResourceVersion = strconv.Itoa(f.version)
+		f.lease = lease
+		_ = json.NewEncoder(w).Encode(f.lease)
+	}
+}
+
+func testLeaseLock(url, identity string) *leaseLock {
+	return &leaseLock{
+		client:    http.DefaultClient,
+		baseURL:   url,
+		token:     "token",
+		namespace: "default",
+		name:      "dbmate",
+		identity:  identity,
+		duration:  15 * time.Second,
+		interval:  10 * time.Millisecond,
+		now:       time.Now,
+	}
+}
+
+func TestLeaseExpired(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	lease := &k8sLease{Spec: k8sLeaseSpec{LeaseDurationSeconds: 15}}
+	require.True(t, lease.expired(now))
+
+	lease.Spec.HolderIdentity = "pod-1"
+	lease.Spec.RenewTime = now.Add(-10 * time.Second).Format(k8sTimeFormat)
+	require.False(t, lease.expired(now))
+
+	lease.Spec.RenewTime = now.Add(-20 * time.Second).Format(k8sTimeFormat)
+	require.True(t, lease.expired(now))
+}
+
+func TestLeaseLock(t *testing.T) {
+	api := &fakeLeaseAPI{}
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	leader := testLeaseLock(ts.URL, "pod-1")
+	follower := testLeaseLock(ts.URL, "pod-2")
+
+	// first replica creates the lease
+	var buf bytes.Buffer
+	err := leader.Acquire(&buf)
+	require.NoError(t, err)
+	require.Equal(t, "", buf.String())
+	require.Equal(t, "pod-1", api.lease.Spec.HolderIdentity)
+	require.Equal(t, 15, api.lease.Spec.LeaseDurationSeconds)
+
+	ok, holder, err := follower.tryAcquire()
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.Equal(t, "pod-1", holder)
+
+	// follower waits until the leader releases the lease
+	acquired := make(chan error)
+	go func() {
+		acquired <- follower.Acquire(&buf)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	err = leader.Release()
+	require.NoError(t, err)
+
+	err = <-acquired
+	require.NoError(t, err)
+	require.Equal(t, "Waiting for lease dbmate (held by pod-1)\n", buf.String())
+	require.Equal(t, "pod-2", api.lease.Spec.HolderIdentity)
+
+	err = follower.Release()
+	require.NoError(t, err)
+	require.Equal(t, "", api.lease.Spec.HolderIdentity)
+}
+
+func TestLeaseLockExpired(t *testing.T) {
+	api := &fakeLeaseAPI{lease: &k8sLease{
+		Metadata: k8sLeaseMeta{Name: "dbmate", ResourceVersion: "0"},
+		Spec: k8sLeaseSpec{
+			HolderIdentity:       "crashed-pod",
+			LeaseDurationSeconds: 15,
+			RenewTime:            time.Now().Add(-time.Minute).Format(k8sTimeFormat),
+		},
+	}}
+	ts := httptest.NewServer(api)
+	defer ts.Close()
+
+	l := testLeaseLock(ts.URL, "pod-1")
+	ok, _, err := l.tryAcquire()
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, "pod-1", api.lease.Spec.HolderIdentity)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+)
+
+// lintError is returned when migrations have lint violations, which are
+// reported individually as CI annotations
+type lintError struct {
+	dir        string
+	violations []dbmate.LintViolation
+}
+
+func (e lintError) Error() string {
+	if len(e.violations) == 1 {
+		return "found 1 lint violation"
+	}
+
+	return fmt.Sprintf("found %d lint violations", len(e.violations))
+}
+
+// annotations returns an annotation for each violation
+func (e lintError) annotations() []annotation {
+	as := []annotation{}
+	for _, v := range e.violations {
+		as = append(as, annotation{
+			File:    filepath.Join(e.dir, v.Filename),
+			Line:    v.Line,
+			Title:   "dbmate lint",
+			Message: v.Message,
+		})
+	}
+
+	return as
+}
+
+// lintMigrations prints any lint violations, and returns an error if there are any
+func lintMigrations(db *dbmate.DB) error {
+	violations, err := db.Lint()
+	if err != nil {
+		return err
+	}
+
+	for _, v := range violations {
+		fmt.Fprintln(db.Log, filepath.Join(db.MigrationsDir, v.String()))
+	}
+	if len(violations) > 0 {
+		return lintError{dir: db.MigrationsDir, violations: violations}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	var buf bytes.Buffer
+	db := dbmate.New(nil)
+	db.MigrationsDir = dir
+	db.Log = &buf
+
+	writeTestMigration(t, dir, "1_users.sql", "create table users (id integer);")
+	err = lintMigrations(db)
+	require.NoError(t, err)
+	require.Equal(t, "", buf.String())
+
+	err = ioutil.WriteFile(filepath.Join(dir, "2_drop.sql"),
+		[]byte("-- migrate:expand\n-- migrate:up\ndrop table users;\n"), 0644)
+	require.NoError(t, err)
+	err = lintMigrations(db)
+	require.EqualError(t, err, "found 1 lint violation")
+	require.Equal(t, filepath.Join(dir, "2_drop.sql")+":3: expand migration contains destructive "+
+		"statement `drop table` (move it to a contract migration)\n", buf.String())
+
+	// violations are reported as annotations
+	as := runAnnotations(runReport{Command: "lint", Err: err}, dir)
+	require.Equal(t, []annotation{{
+		File:    filepath.Join(dir, "2_drop.sql"),
+		Line:    3,
+		Title:   "dbmate lint",
+		Message: "expand migration contains destructive statement `drop table` (move it to a contract migration)",
+	}}, as)
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+// logFormatter formats a single line of output (without the trailing newline)
+type logFormatter func(t time.Time, level, msg string) string
+
+// textFormatter returns the message as-is
+func textFormatter(t time.Time, level, msg string) string {
+	return msg
+}
+
+// timestampFormatter prefixes the message with a timestamp
+func timestampFormatter(t time.Time, level, msg string) string {
+	return t.UTC().Format(time.RFC3339) + " " + msg
+}
+
+// logfmtFormatter formats the message as logfmt key/value pairs
+func logfmtFormatter(t time.Time, level, msg string) string {
+	return fmt.Sprintf("time=%s level=%s msg=%s",
+		t.UTC().Format(time.RFC3339), level, logfmtValue(msg))
+}
+
+// jsonFormatter formats the message as a json object
+func jsonFormatter(t time.Time, level, msg string) string {
+	data, _ := json.Marshal(struct {
+		Time  string `json:"time"`
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+	}{t.UTC().Format(time.RFC3339), level, msg})
+
+	return string(data)
+}
+
+// logfmtValue quotes a logfmt value if necessary
+func logfmtValue(s string) string {
+	if s == "" || strings.ContainsAny(s, " =\"\t") {
+		return strconv.Quote(s)
+	}
+
+	return s
+}
+
+// getLogFormatter returns the formatter for a --log-format value. Log files
+// always include timestamps, even in text format.
+func getLogFormatter(format string, file bool) (logFormatter, error) {
+	switch format {
+	case "", "text":
+		if file {
+			return timestampFormatter, nil
+		}
+		return textFormatter, nil
+	case "logfmt":
+		return logfmtFormatter, nil
+	case "json":
+		return jsonFormatter, nil
+	}
+
+	return nil, fmt.Errorf("unsupported log format: %s", format)
+}
+
+// logWriter formats each line written to it as a log record.
+// Partial lines are buffered until a newline is written, or the writer is flushed.
+type logWriter struct {
+	mu     sync.Mutex
+	w      io.Writer
+	buf    bytes.Buffer
+	format logFormatter
+	level  string
+	now    func() time.Time
+}
+
+func newLogWriter(w io.Writer, format logFormatter, level string) *logWriter {
+	return &logWriter{w: w, format: format, level: level, now: time.Now}
+}
+
+// Write implements io.Writer
+func (lw *logWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.buf.Write(p)
+	for {
+		i := bytes.IndexByte(lw.buf.Bytes(), '\n')
+		if i < 0 {
+			break
+		}
+
+		line := lw.buf.Next(i + 1)
+		if err := lw.writeLine(string(line[:i])); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush writes any buffered partial line
+func (lw *logWriter) Flush() error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	if lw.buf.Len() == 0 {
+		return nil
+	}
+
+	return lw.writeLine(string(lw.buf.Next(lw.buf.Len())))
+}
+
+// WriteLevel writes a single log record with the specified level
+func (lw *logWriter) WriteLevel(level, msg string) error {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+
+	lw.level, level = level, lw.level
+	defer func() { lw.level = level }()
+
+	return lw.writeLine(msg)
+}
+
+func (lw *logWriter) writeLine(line string) error {
+	_, err := io.WriteString(lw.w, lw.format(lw.now(), lw.level, line)+"\n")
+	return err
+}
+
+// logFile is an append-only log file
+type logFile struct {
+	*logWriter
+	f *os.File
+}
+
+// openLogFile opens a log file for appending, creating it if necessary
+func openLogFile(path string, format logFormatter) (*logFile, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &logFile{logWriter: newLogWriter(f, format, "info"), f: f}, nil
+}
+
+// Close flushes any partial line and closes the file
+func (lf *logFile) Close() error {
+	if err := lf.Flush(); err != nil {
+		_ = lf.f.Close()
+		return err
+	}
+
+	return lf.f.Close()
+}
+
+// runLogger directs command output according to the --log-format and --log-file options
+type runLogger struct {
+	format  logFormatter
+	console *logWriter
+	file    *logFile
+}
+
+// newRunLogger creates a runLogger from the global command line options
+func newRunLogger(c *cli.Context) (*runLogger, error) {
+	name := c.GlobalString("log-format")
+	format, err := getLogFormatter(name, false)
+	if err != nil {
+		return nil, err
+	}
+
+	l := &runLogger{format: format}
+	if name == "logfmt" || name == "json" {
+		l.console = newLogWriter(os.Stdout, format, "info")
+	}
+
+	if path := c.GlobalString("log-file"); path != "" {
+		fileFormat, _ := getLogFormatter(name, true)
+		if l.file, err = openLogFile(path, fileFormat); err != nil {
+			return nil, err
+		}
+		_ = l.file.WriteLevel("info", "Running: "+strings.Join(os.Args, " "))
+	}
+
+	return l, nil
+}
+
+// Writer returns the writer used for command output
+func (l *runLogger) Writer() io.Writer {
+	var console io.Writer = os.Stdout
+	if l.console != nil {
+		console = l.console
+	}
+
+	if l.file == nil {
+		return console
+	}
+
+	return io.MultiWriter(console, l.file)
+}
+
+// Error records a command error. When using a structured console format, the
+// error is written to stderr as a log record, rather than printed as plain text.
+// Errors which request a specific exit status (see cli.ExitCoder) keep it.
+func (l *runLogger) Error(err error) error {
+	if l.file != nil {
+		_ = l.file.WriteLevel("error", err.Error())
+	}
+
+	code := 1
+	exitErr, ok := err.(cli.ExitCoder)
+	if ok {
+		code = exitErr.ExitCode()
+	}
+
+	if l.console == nil {
+		if !ok {
+			return err
+		}
+		if err.Error() != "" {
+			_, _ = fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		}
+		return cli.NewExitError("", code)
+	}
+
+	_ = newLogWriter(os.Stderr, l.format, "error").WriteLevel("error", err.Error())
+	return cli.NewExitError("", code)
+}
+
+// Close flushes any buffered output and closes the log file
+func (l *runLogger) Close() error {
+	if l.console != nil {
+		if err := l.console.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if l.file != nil {
+		return l.file.Close()
+	}
+
+	return nil
+}
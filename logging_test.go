@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testLogTime() time.Time {
+	return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+}
+
+func TestLogWriter(t *testing.T) {
+	var buf bytes.Buffer
+	lw := newLogWriter(&buf, timestampFormatter, "info")
+	lw.now = testLogTime
+
+	_, err := lw.Write([]byte("Applying: foo.sql\nWaiting"))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte("...\n"))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte("partial"))
+	require.NoError(t, err)
+
+	require.Equal(t, "2020-01-02T03:04:05Z Applying: foo.sql\n"+
+		"2020-01-02T03:04:05Z Waiting...\n", buf.String())
+
+	err = lw.Flush()
+	require.NoError(t, err)
+	require.Equal(t, "2020-01-02T03:04:05Z Applying: foo.sql\n"+
+		"2020-01-02T03:04:05Z Waiting...\n"+
+		"2020-01-02T03:04:05Z partial\n", buf.String())
+}
+
+func TestLogWriter_WriteLevel(t *testing.T) {
+	var buf bytes.Buffer
+	lw := newLogWriter(&buf, logfmtFormatter, "info")
+	lw.now = testLogTime
+
+	err := lw.WriteLevel("error", "no migration files found")
+	require.NoError(t, err)
+	_, err = lw.Write([]byte("Applying: foo.sql\n"))
+	require.NoError(t, err)
+
+	require.Equal(t, "time=2020-01-02T03:04:05Z level=error msg=\"no migration files found\"\n"+
+		"time=2020-01-02T03:04:05Z level=info msg=\"Applying: foo.sql\"\n", buf.String())
+}
+
+func TestLogFormatters(t *testing.T) {
+	now := testLogTime()
+
+	require.Equal(t, "Writing: schema.sql", textFormatter(now, "info", "Writing: schema.sql"))
+	require.Equal(t, "time=2020-01-02T03:04:05Z level=info msg=done",
+		logfmtFormatter(now, "info", "done"))
+	require.Equal(t, `time=2020-01-02T03:04:05Z level=info msg="say \"hi\""`,
+		logfmtFormatter(now, "info", `say "hi"`))
+	require.Equal(t, `{"time":"2020-01-02T03:04:05Z","level":"info","msg":"Writing: schema.sql"}`,
+		jsonFormatter(now, "info", "Writing: schema.sql"))
+}
+
+func TestGetLogFormatter(t *testing.T) {
+	_, err := getLogFormatter("text", false)
+	require.NoError(t, err)
+	_, err = getLogFormatter("logfmt", false)
+	require.NoError(t, err)
+	_, err = getLogFormatter("json", true)
+	require.NoError(t, err)
+	_, err = getLogFormatter("xml", false)
+	require.EqualError(t, err, "unsupported log format: xml")
+}
+
+func TestOpenLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	path := filepath.Join(dir, "dbmate.log")
+	for _, line := range []string{"first\n", "second"} {
+		lf, err := openLogFile(path, timestampFormatter)
+		require.NoError(t, err)
+		_, err = lf.Write([]byte(line))
+		require.NoError(t, err)
+		err = lf.Close()
+		require.NoError(t, err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Regexp(t, `^\S+ first\n\S+ second\n$`, string(data))
+}
@@ -2,11 +2,17 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/url"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -32,8 +38,15 @@ func NewApp() *cli.App {
 	app.Name = "dbmate"
 	app.Usage = "A lightweight, framework-independent database migration tool."
 	app.Version = dbmate.Version
+	app.EnableBashCompletion = true
+	app.BashComplete = completeApp
 
 	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "config",
+			Value: defaultConfigFile,
+			Usage: "specify the config file location",
+		},
 		cli.StringFlag{
 			Name:  "env, e",
 			Value: "DATABASE_URL",
@@ -69,42 +82,301 @@ func NewApp() *cli.App {
 			Value: "DATABASE_PORT",
 			Usage: "specify the environment variable used to lookup the database port",
 		},
-		cli.StringFlag{
-			Name:  "migrations-dir, d",
-			Value: dbmate.DefaultMigrationsDir,
-			Usage: "specify the directory containing migration files",
+		cli.StringSliceFlag{
+			Name: "migrations-dir, d",
+			Usage: "specify the directory containing migration files (default " + dbmate.DefaultMigrationsDir +
+				", repeatable or comma separated, new migrations are created in the first)",
 		},
 		cli.StringFlag{
 			Name:  "schema-file, s",
 			Value: dbmate.DefaultSchemaFile,
 			Usage: "specify the schema file location",
 		},
+		cli.StringFlag{
+			Name:   "migrations-table",
+			EnvVar: "DBMATE_MIGRATIONS_TABLE",
+			Usage:  "specify the table which tracks applied migrations (default schema_migrations)",
+		},
+		cli.StringSliceFlag{
+			Name:   "schema",
+			EnvVar: "DBMATE_SCHEMAS",
+			Usage:  "set the search_path and dump these schemas (repeatable, postgres only)",
+		},
+		cli.StringSliceFlag{
+			Name:   "dump-exclude-table",
+			EnvVar: "DBMATE_DUMP_EXCLUDE_TABLES",
+			Usage:  "leave tables matching this pattern out of the schema file (repeatable)",
+		},
+		cli.StringSliceFlag{
+			Name:   "sqlite-pragma",
+			EnvVar: "DBMATE_SQLITE_PRAGMAS",
+			Usage:  "apply this PRAGMA (e.g. foreign_keys=on) to every sqlite connection (repeatable)",
+		},
+		cli.BoolFlag{
+			Name:  "dump-privileges",
+			Usage: "include grants and ownership in the schema file (postgres)",
+		},
 		cli.BoolFlag{
 			Name:  "no-dump-schema",
 			Usage: "don't update the schema file on migrate/rollback",
 		},
+		cli.BoolFlag{
+			Name:  "verbose",
+			Usage: "print the SQL of each migration as it is executed",
+		},
+		cli.BoolFlag{
+			Name:  "dry-run",
+			Usage: "print the statements up/migrate/rollback/redo/drop would execute, without changing the database",
+		},
+		cli.StringFlag{
+			Name:  "log-file",
+			Usage: "append a timestamped log of the run to this file",
+		},
+		cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: "output format: text, logfmt, or json",
+		},
+		cli.StringFlag{
+			Name:  "output",
+			Usage: "emit CI annotations for failures (github or gitlab)",
+		},
+		cli.StringFlag{
+			Name:  "audit-log",
+			Usage: "append a json line describing each invocation to this file",
+		},
+		cli.StringFlag{
+			Name:  "statsd-addr",
+			Usage: "send run metrics to this StatsD server (host:port)",
+		},
+		cli.StringFlag{
+			Name:  "metrics-prefix",
+			Value: "dbmate",
+			Usage: "prefix for StatsD metric names",
+		},
+		cli.StringFlag{
+			Name:  "pushgateway-url",
+			Usage: "push run metrics to this Prometheus Pushgateway",
+		},
+		cli.StringFlag{
+			Name:  "metrics-job",
+			Value: "dbmate",
+			Usage: "job name for metrics pushed to the Pushgateway",
+		},
+		cli.StringSliceFlag{
+			Name:  "webhook-url",
+			Usage: "post a json summary to this URL when migrate/rollback finishes (repeatable)",
+		},
+		cli.StringSliceFlag{
+			Name:  "slack-webhook-url",
+			Usage: "post a message to this Slack incoming webhook when migrate/rollback finishes (repeatable)",
+		},
+		cli.StringFlag{
+			Name:   "otlp-endpoint",
+			EnvVar: "OTEL_EXPORTER_OTLP_ENDPOINT",
+			Usage:  "export OpenTelemetry traces to this OTLP/HTTP endpoint",
+		},
+		cli.StringFlag{
+			Name:   "sentry-dsn",
+			EnvVar: "SENTRY_DSN",
+			Usage:  "report failures to Sentry",
+		},
+		cli.StringFlag{
+			Name:   "environment",
+			EnvVar: "DBMATE_ENVIRONMENT",
+			Usage:  "name of the environment the database belongs to, e.g. production",
+		},
+		cli.StringFlag{
+			Name:  "incident-environment",
+			Value: "production",
+			Usage: "only open incidents for failed runs in this --environment",
+		},
+		cli.StringFlag{
+			Name:   "pagerduty-routing-key",
+			EnvVar: "PAGERDUTY_ROUTING_KEY",
+			Usage:  "open a PagerDuty incident when migrate/rollback fails",
+		},
+		cli.StringFlag{
+			Name:   "opsgenie-api-key",
+			EnvVar: "OPSGENIE_API_KEY",
+			Usage:  "open an Opsgenie alert when migrate/rollback fails",
+		},
+		cli.StringFlag{
+			Name:  "opsgenie-api-url",
+			Value: defaultOpsgenieAPIURL,
+			Usage: "Opsgenie API URL (https://api.eu.opsgenie.com for the EU region)",
+		},
+		cli.DurationFlag{
+			Name:  "wait-timeout",
+			Value: dbmate.DefaultWaitTimeout,
+			Usage: "timeout for --wait flag and wait command",
+		},
+		cli.StringFlag{
+			Name:  "backup",
+			Usage: "back up the database before applying migrations (schema or full)",
+		},
+		cli.StringFlag{
+			Name:  "backup-dir",
+			Value: dbmate.DefaultBackupDir,
+			Usage: "directory for backups taken with --backup",
+		},
+		cli.BoolFlag{
+			Name:  "restore-on-failure",
+			Usage: "restore the --backup full backup if a migration fails",
+		},
+		cli.StringFlag{
+			Name:  "online-tool",
+			Value: dbmate.DefaultOnlineTool,
+			Usage: "tool for MySQL migrations marked -- migrate:online (gh-ost or pt-online-schema-change)",
+		},
+		cli.StringFlag{
+			Name:  "online-tool-path",
+			Usage: "path to the online schema change tool (defaults to the tool name)",
+		},
+		cli.StringSliceFlag{
+			Name:  "online-tool-flag",
+			Usage: "additional flag passed to the online schema change tool (repeatable)",
+		},
+		cli.BoolFlag{
+			Name:  "record-runs",
+			Usage: "record the duration, rows affected, and lock wait time of each migration in the schema_migration_runs table",
+		},
+		cli.StringFlag{
+			Name:  "snapshot-command",
+			Usage: "shell command to snapshot the database before migrations marked -- migrate:risky",
+		},
+		cli.BoolFlag{
+			Name:  "require-committed",
+			Usage: "refuse to run migrations which are not committed to git",
+		},
+		cli.StringFlag{
+			Name:  "schedule",
+			Usage: "only run migrations within this weekly maintenance window, e.g. \"Sat 02:00-04:00 Asia/Kolkata\"",
+		},
+		cli.BoolFlag{
+			Name:  "schedule-wait",
+			Usage: "wait for the --schedule window to open instead of failing",
+		},
+		cli.StringFlag{
+			Name:  "k8s-lease",
+			Usage: "name of a kubernetes Lease used to ensure only one replica runs at a time",
+		},
+		cli.DurationFlag{
+			Name:  "lock-timeout",
+			Usage: "abort any statement that waits longer than this to acquire a lock",
+		},
+		cli.BoolFlag{
+			Name:  "no-lock",
+			Usage: "don't hold the migrations lock during migrate/rollback (postgres and mysql)",
+		},
+		cli.DurationFlag{
+			Name:  "statement-timeout",
+			Usage: "abort any statement that takes longer than this (postgres only)",
+		},
+		cli.DurationFlag{
+			Name:  "idle-in-transaction-timeout",
+			Usage: "terminate the session if idle within a transaction for longer than this (postgres only)",
+		},
+		cli.DurationFlag{
+			Name:  "max-replication-lag",
+			Usage: "do not apply migrations while replication lag exceeds this",
+		},
+		cli.DurationFlag{
+			Name:  "replication-lag-wait",
+			Usage: "wait this long for replication lag to drop before aborting",
+		},
+		cli.StringSliceFlag{
+			Name:  "replica-url",
+			Usage: "replica database URL to check for replication lag (repeatable)",
+		},
+		cli.DurationFlag{
+			Name:  "max-transaction-age",
+			Usage: "do not apply migrations while sessions lock their tables or have transactions open longer than this",
+		},
+		cli.DurationFlag{
+			Name:  "blocker-wait",
+			Usage: "wait this long for blocking sessions to finish before aborting",
+		},
+		cli.StringFlag{
+			Name:   "out-of-order",
+			Value:  "allow",
+			EnvVar: "DBMATE_OUT_OF_ORDER",
+			Usage:  "allow, warn, or error when pending migrations are older than the latest applied migration",
+		},
 	}
 
+	waitFlag := cli.BoolFlag{
+		Name:  "wait",
+		Usage: "wait for the database to become available before proceeding",
+	}
+
+	phaseFlag := cli.StringFlag{
+		Name:  "phase",
+		Usage: "expand: stop before the first pending contract migration; contract: apply all",
+	}
+
+	toFlag := cli.StringFlag{
+		Name:  "to",
+		Usage: "migrate up to and including this version, instead of the latest version",
+	}
+
+	app.Before = loadConfig
+
 	app.Commands = []cli.Command{
+		{
+			Name:      "init",
+			Usage:     "Scaffold a new project (migrations directory, .env, and config file)",
+			ArgsUsage: "[postgres|mysql|sqlite]",
+			Action:    initAction,
+		},
 		{
 			Name:    "new",
 			Aliases: []string{"n"},
 			Usage:   "Generate a new migration file",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "template",
+					Usage: "generate from a template (concurrent-index or validate-constraint)",
+				},
+				cli.StringFlag{
+					Name:   "numbering",
+					Value:  "timestamp",
+					EnvVar: "DBMATE_NUMBERING",
+					Usage:  "version new migrations with a timestamp, or sequentially (0001, 0002, ...)",
+				},
+				cli.StringFlag{
+					Name:  "dir",
+					Usage: "create the migration in this subdirectory of the migrations directory (e.g. schema or data)",
+				},
+			},
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				db.Numbering = c.String("numbering")
 				name := c.Args().First()
-				return db.NewMigration(name)
+				return db.NewMigrationIn(c.String("dir"), name, c.String("template"))
+			}),
+		},
+		{
+			Name:         "gen-down",
+			Usage:        "Generate the down block of a migration by inverting its up block",
+			ArgsUsage:    "VERSION",
+			BashComplete: completeVersions,
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				return db.GenerateDown(c.Args().First())
 			}),
 		},
 		{
 			Name:  "up",
 			Usage: "Create database (if necessary) and migrate to the latest version",
-			Action: action(func(db *dbmate.DB, c *cli.Context) error {
-				return db.CreateAndMigrate()
+			Flags: []cli.Flag{waitFlag, phaseFlag, toFlag},
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				db.Phase = c.String("phase")
+				return db.CreateAndMigrateTo(c.String("to"))
 			}),
 		},
 		{
 			Name:  "create",
 			Usage: "Create database",
+			Flags: []cli.Flag{waitFlag},
 			Action: action(func(db *dbmate.DB, c *cli.Context) error {
 				return db.Create()
 			}),
@@ -119,18 +391,371 @@ func NewApp() *cli.App {
 		{
 			Name:  "migrate",
 			Usage: "Migrate to the latest version",
-			Action: action(func(db *dbmate.DB, c *cli.Context) error {
-				return db.Migrate()
+			Flags: []cli.Flag{waitFlag, phaseFlag, toFlag},
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				db.Phase = c.String("phase")
+				return db.MigrateTo(c.String("to"))
 			}),
 		},
 		{
 			Name:    "rollback",
 			Aliases: []string{"down"},
 			Usage:   "Rollback the most recent migration",
-			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+			Flags: []cli.Flag{
+				cli.IntFlag{
+					Name:  "step",
+					Usage: "roll back this many of the most recent migrations",
+				},
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "roll back every migration applied after this version",
+				},
+			},
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				steps, to := c.Int("step"), c.String("to")
+				switch {
+				case c.IsSet("step") && to != "":
+					return errors.New("please specify only one of --step and --to")
+				case to != "":
+					return db.RollbackTo(to)
+				case c.IsSet("step"):
+					return db.RollbackSteps(steps)
+				}
 				return db.Rollback()
 			}),
 		},
+		{
+			Name:  "baseline",
+			Usage: "Mark existing migrations as applied without running them",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "to",
+					Usage: "only mark migrations up to and including this version",
+				},
+			},
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				return db.Baseline(c.String("to"))
+			}),
+		},
+		{
+			Name:  "load",
+			Usage: "Create the database (if necessary) and load the schema file",
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				return db.LoadSchema()
+			}),
+		},
+		{
+			Name:  "repair",
+			Usage: "Find and fix inconsistencies between schema_migrations and the migration files",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "auto",
+					Usage: "fix every problem without asking",
+				},
+			},
+			Action: action(repairMigrations),
+		},
+		{
+			Name:  "squash",
+			Usage: "Consolidate old migrations into a single migration generated from the schema",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "before",
+					Usage: "squash the migrations before this version",
+				},
+				cli.StringFlag{
+					Name:  "archive-dir",
+					Usage: "directory for the squashed migration files (default: the migrations directory with an _archive suffix)",
+				},
+			},
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				before := c.String("before")
+				if before == "" {
+					return errors.New("please specify the cutoff version with --before")
+				}
+				archiveDir := c.String("archive-dir")
+				if archiveDir == "" {
+					archiveDir = filepath.Clean(db.MigrationsDir) + "_archive"
+				}
+				return db.Squash(before, archiveDir)
+			}),
+		},
+		{
+			Name:  "redo",
+			Usage: "Rollback the most recent migration and apply it again",
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				return db.Redo()
+			}),
+		},
+		{
+			Name:      "restore",
+			Usage:     "Restore the database from a full backup",
+			ArgsUsage: "FILE",
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				path := c.Args().First()
+				if path == "" {
+					return errors.New("please specify a backup file")
+				}
+				return db.Restore(path)
+			}),
+		},
+		{
+			Name:  "console",
+			Usage: "Open an interactive database shell (psql, mysql, or sqlite3)",
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				cmd, err := db.ConsoleCommand()
+				if err != nil {
+					return err
+				}
+
+				cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+				if err := cmd.Run(); err != nil {
+					// the shell has already reported the error
+					if exitErr, ok := err.(*exec.ExitError); ok {
+						return cli.NewExitError("", exitErr.ExitCode())
+					}
+					return err
+				}
+				return nil
+			}),
+		},
+		{
+			Name:      "exec",
+			Usage:     "Run an SQL file (or - for stdin) against the database",
+			ArgsUsage: "FILE",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "no-transaction",
+					Usage: "don't run the SQL inside a transaction",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				path := c.Args().First()
+				if path == "" {
+					return errors.New("please specify an SQL file, or - for stdin")
+				}
+
+				name := path
+				var contents []byte
+				var err error
+				if path == "-" {
+					name = "stdin"
+					contents, err = ioutil.ReadAll(os.Stdin)
+				} else {
+					contents, err = ioutil.ReadFile(path)
+				}
+				if err != nil {
+					return err
+				}
+
+				return db.ExecSQL(name, string(contents), !c.Bool("no-transaction"))
+			}),
+		},
+		{
+			Name:  "shards",
+			Usage: "Manage horizontally sharded databases",
+			Subcommands: []cli.Command{
+				{
+					Name:  "migrate",
+					Usage: "Run pending migrations on every shard, halting on the first failure",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "shard",
+							Usage: "shard database URL, environment variables are expanded (repeatable)",
+						},
+						cli.StringFlag{
+							Name:  "strategy",
+							Value: "lockstep",
+							Usage: "lockstep (each version on all shards first) or sequential (one shard at a time)",
+						},
+						cli.StringFlag{
+							Name:  "report",
+							Usage: "write a JSON report of each shard's state to this file",
+						},
+					},
+					Action: migrationAction(migrateShards),
+				},
+			},
+		},
+		{
+			Name:  "canary",
+			Usage: "Migrate a canary database first, then the remaining targets",
+			Subcommands: []cli.Command{
+				{
+					Name:  "migrate",
+					Usage: "Run pending migrations on the canary, verify it, then migrate the targets",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "canary",
+							Usage: "canary database URL, environment variables are expanded",
+						},
+						cli.StringSliceFlag{
+							Name:  "target",
+							Usage: "database URL to migrate after the canary (repeatable)",
+						},
+						cli.StringFlag{
+							Name:  "verify-query",
+							Usage: "query to run on the canary, which must return a true value",
+						},
+						cli.StringFlag{
+							Name:  "verify-command",
+							Usage: "shell command to run after migrating the canary, which must succeed",
+						},
+						cli.StringFlag{
+							Name:  "strategy",
+							Value: "lockstep",
+							Usage: "strategy for migrating the targets (lockstep or sequential)",
+						},
+						cli.StringFlag{
+							Name:  "report",
+							Usage: "write a JSON report of each target's state to this file",
+						},
+					},
+					Action: migrationAction(migrateCanary),
+				},
+			},
+		},
+		{
+			Name:  "tenants",
+			Usage: "Manage schema-per-tenant databases",
+			Subcommands: []cli.Command{
+				{
+					Name:  "migrate",
+					Usage: "Run pending migrations for each tenant schema (or MySQL database)",
+					Flags: []cli.Flag{
+						cli.StringSliceFlag{
+							Name:  "tenant",
+							Usage: "tenant to migrate (repeatable)",
+						},
+						cli.StringFlag{
+							Name:  "tenant-query",
+							Usage: "query which returns the tenants to migrate, one per row",
+						},
+						cli.BoolFlag{
+							Name:  "continue-on-error",
+							Usage: "continue migrating other tenants if a tenant fails",
+						},
+						cli.StringFlag{
+							Name:  "report",
+							Usage: "write a JSON report of each tenant's result to this file",
+						},
+						cli.StringFlag{
+							Name:  "resume",
+							Usage: "skip tenants which succeeded in this previous report",
+						},
+					},
+					Action: migrationAction(migrateTenants),
+				},
+			},
+		},
+		{
+			Name:  "seed",
+			Usage: "Run seed files (or manage seed data)",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "dir",
+					Value: dbmate.DefaultSeedsDir,
+					Usage: "directory containing seed files, with optional subdirectories per --environment",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				db.SeedsDir = c.String("dir")
+				db.Environment = c.GlobalString("environment")
+				return db.Seed()
+			}),
+			Subcommands: []cli.Command{
+				{
+					Name:  "generate",
+					Usage: "Generate anonymized seed files from an existing database",
+					Flags: []cli.Flag{
+						cli.StringFlag{
+							Name:  "from-env",
+							Usage: "environment variable containing the source database URL",
+						},
+						cli.StringFlag{
+							Name:  "anonymize",
+							Usage: "rules file listing the tables to sample and columns to mask",
+						},
+						cli.StringFlag{
+							Name:  "dir",
+							Value: dbmate.DefaultSeedsDir,
+							Usage: "directory to write seed files to",
+						},
+					},
+					Action: action(generateSeeds),
+				},
+			},
+		},
+		{
+			Name:  "lint",
+			Usage: "Check migration files for problems",
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				return lintMigrations(db)
+			}),
+		},
+		{
+			Name:  "verify",
+			Usage: "Check that applied migration files have not been modified",
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				return verifyChecksums(db)
+			}),
+		},
+		{
+			Name:  "version",
+			Usage: "Print the dbmate version, or the current database version with --db",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "db",
+					Usage: "print the latest applied migration version and the number of pending migrations",
+				},
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the version as json",
+				},
+			},
+			Action: func(c *cli.Context) error {
+				if c.Bool("db") {
+					return action(showVersion)(c)
+				}
+				if c.Bool("json") {
+					return json.NewEncoder(os.Stdout).Encode(map[string]string{"version": dbmate.Version})
+				}
+				fmt.Println(dbmate.Version)
+				return nil
+			},
+		},
+		{
+			Name:  "status",
+			Usage: "List applied and pending migrations",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "output",
+					Usage: "output format (text or terraform-external)",
+				},
+				cli.BoolFlag{
+					Name:  "exit-code",
+					Usage: "exit with status 1 if migrations are pending, or 2 if the status can't be read",
+				},
+				cli.BoolFlag{
+					Name:  "verbose",
+					Usage: "show when, how long, and by whom each migration was applied",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				return showStatus(db, c)
+			}),
+		},
+		{
+			Name:  "drift",
+			Usage: "Check whether the database schema differs from the schema file",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "interval",
+					Usage: "check repeatedly at this interval, reporting when drift is detected or resolved",
+				},
+			},
+			Action: action(detectDrift),
+		},
 		{
 			Name:  "dump",
 			Usage: "Write the database schema to disk",
@@ -145,11 +770,102 @@ func NewApp() *cli.App {
 				return db.Wait()
 			}),
 		},
+		{
+			Name:  "watch",
+			Usage: "Watch the migrations directory and report (or apply) new migrations",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "apply",
+					Usage: "apply new migrations as they appear",
+				},
+				cli.DurationFlag{
+					Name:  "interval",
+					Value: 5 * time.Second,
+					Usage: "how often to check the migrations directory",
+				},
+			},
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				return watchMigrations(db, c)
+			}),
+		},
+		{
+			Name:  "ping",
+			Usage: "Check that the database accepts connections and queries",
+			Flags: []cli.Flag{
+				cli.DurationFlag{
+					Name:  "timeout",
+					Value: dbmate.DefaultPingTimeout,
+					Usage: "maximum time to wait for the query",
+				},
+			},
+			Action: action(func(db *dbmate.DB, c *cli.Context) error {
+				db.PingTimeout = c.Duration("timeout")
+				return db.Ping()
+			}),
+		},
+		{
+			Name:  "serve",
+			Usage: "Serve status, migrate, and rollback endpoints over HTTP",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "addr",
+					Value: ":8080",
+					Usage: "address to listen on",
+				},
+				cli.StringFlag{
+					Name:   "token",
+					EnvVar: "DBMATE_SERVE_TOKEN",
+					Usage:  "bearer token required by the status, migrate, and rollback endpoints",
+				},
+			},
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				return serve(db, c)
+			}),
+		},
+		{
+			Name:   "ui",
+			Usage:  "Interactively list, apply, roll back, and view migrations",
+			Action: migrationAction(runUI),
+		},
+		{
+			Name:  "drivers",
+			Usage: "List the supported database drivers and their capabilities",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "json",
+					Usage: "print the drivers as json",
+				},
+			},
+			Action: listDrivers,
+		},
+		{
+			Name:      "completion",
+			Usage:     "Print a shell completion script for bash, zsh, or fish",
+			ArgsUsage: "SHELL",
+			Action:    printCompletionScript,
+		},
+		{
+			Name:  "lambda",
+			Usage: "Handle status, migrate, and rollback invocations as an AWS Lambda function",
+			Action: migrationAction(func(db *dbmate.DB, c *cli.Context) error {
+				return runLambda(db, c)
+			}),
+		},
 	}
+	setBashComplete(app.Commands)
 
 	return app
 }
 
+// dryRunCommands lists the commands which support --dry-run
+var dryRunCommands = map[string]bool{
+	"up":       true,
+	"migrate":  true,
+	"rollback": true,
+	"redo":     true,
+	"drop":     true,
+}
+
 // load environment variables from .env file
 func loadDotEnv() {
 	if _, err := os.Stat(".env"); err != nil {
@@ -163,20 +879,155 @@ func loadDotEnv() {
 
 // action wraps a cli.ActionFunc with dbmate initialization logic
 func action(f func(*dbmate.DB, *cli.Context) error) cli.ActionFunc {
+	return newAction(f, false)
+}
+
+// migrationAction wraps the action of a command which applies or rolls back
+// migrations, which only runs from committed migrations with --require-committed
+func migrationAction(f func(*dbmate.DB, *cli.Context) error) cli.ActionFunc {
+	return newAction(f, true)
+}
+
+// newAction wraps a cli.ActionFunc with dbmate initialization logic. migrates is
+// set for commands which apply or roll back migrations.
+func newAction(f func(*dbmate.DB, *cli.Context) error, migrates bool) cli.ActionFunc {
 	return func(c *cli.Context) error {
 		u, err := getDatabaseURL(c)
 		if err != nil {
 			return err
 		}
 		db := dbmate.New(u)
+		db.Verbose = c.GlobalBool("verbose")
 		db.AutoDumpSchema = !c.GlobalBool("no-dump-schema")
-		db.MigrationsDir = c.GlobalString("migrations-dir")
+		dirs := migrationsDirs(c)
+		db.MigrationsDir, db.MigrationsDirs = dirs[0], dirs[1:]
 		db.SchemaFile = c.GlobalString("schema-file")
+		db.MigrationsTableName = c.GlobalString("migrations-table")
+		db.Schemas = c.GlobalStringSlice("schema")
+		db.DumpExcludeTables = c.GlobalStringSlice("dump-exclude-table")
+		db.DumpPrivileges = c.GlobalBool("dump-privileges")
+		db.SQLitePragmas = c.GlobalStringSlice("sqlite-pragma")
+		db.WaitBefore = c.Bool("wait")
+		db.WaitTimeout = c.GlobalDuration("wait-timeout")
+		db.LockTimeout = c.GlobalDuration("lock-timeout")
+		db.NoLock = c.GlobalBool("no-lock")
+		db.StatementTimeout = c.GlobalDuration("statement-timeout")
+		db.IdleInTransactionTimeout = c.GlobalDuration("idle-in-transaction-timeout")
+		db.Backup = c.GlobalString("backup")
+		db.BackupDir = c.GlobalString("backup-dir")
+		db.RestoreOnFailure = c.GlobalBool("restore-on-failure")
+		db.OnlineTool = c.GlobalString("online-tool")
+		db.OnlineToolPath = c.GlobalString("online-tool-path")
+		db.OnlineToolFlags = c.GlobalStringSlice("online-tool-flag")
+		db.MaxReplicationLag = c.GlobalDuration("max-replication-lag")
+		db.ReplicationLagWait = c.GlobalDuration("replication-lag-wait")
+		db.DryRun = c.GlobalBool("dry-run")
+		if db.DryRun && !dryRunCommands[c.Command.Name] {
+			return fmt.Errorf("--dry-run is not supported by the %s command", c.Command.Name)
+		}
+		db.RecordRuns = c.GlobalBool("record-runs")
+		db.MaxTransactionAge = c.GlobalDuration("max-transaction-age")
+		db.BlockerWait = c.GlobalDuration("blocker-wait")
+		db.OutOfOrder = c.GlobalString("out-of-order")
+		for _, value := range c.GlobalStringSlice("replica-url") {
+			replica, err := url.Parse(os.ExpandEnv(value))
+			if err != nil {
+				return err
+			}
+			db.ReplicaURLs = append(db.ReplicaURLs, replica)
+		}
 
-		return f(db, c)
+		logger, err := newRunLogger(c)
+		if err != nil {
+			return err
+		}
+		defer mustClose(logger)
+		db.Log = logger.Writer()
+		if command := c.GlobalString("snapshot-command"); command != "" {
+			db.BeforeRiskyMigration = snapshotHook(command, db.Log)
+		}
+
+		rs, err := reporters(c)
+		if err != nil {
+			return err
+		}
+		if db.DryRun {
+			// dry runs do not change the database, so are not reported
+			rs = nil
+		}
+
+		if c.GlobalBool("require-committed") && migrates {
+			for _, dir := range dirs {
+				if err := checkCommitted(dir); err != nil {
+					return err
+				}
+			}
+		}
+
+		if value := c.GlobalString("schedule"); value != "" {
+			window, err := parseSchedule(value)
+			if err != nil {
+				return err
+			}
+			// the window is checked by each operation, since serve, ui, lambda,
+			// and watch keep running after it closes
+			wait := c.GlobalBool("schedule-wait")
+			db.BeforeMigrate = func() error {
+				return window.wait(db.Log, wait)
+			}
+		}
+
+		if name := c.GlobalString("k8s-lease"); name != "" {
+			lease, err := newLeaseLock(name)
+			if err != nil {
+				return err
+			}
+			if err := lease.Acquire(db.Log); err != nil {
+				return logger.Error(err)
+			}
+			defer func() {
+				if err := lease.Release(); err != nil {
+					fmt.Fprintf(db.Log, "Warning: %s\n", err)
+				}
+			}()
+		}
+
+		report := runReported(db, rs, newRunReport(c, u), func() error {
+			return f(db, c)
+		})
+		if report.Err != nil {
+			return logger.Error(report.Err)
+		}
+
+		return nil
+	}
+}
+
+// mustClose ensures a stream is closed
+func mustClose(c io.Closer) {
+	if err := c.Close(); err != nil {
+		panic(err)
 	}
 }
 
+// migrationsDirs returns the migrations directories, which may be given more
+// than once or as a comma separated list. The first is the main directory.
+func migrationsDirs(c *cli.Context) []string {
+	dirs := []string{}
+	for _, value := range c.GlobalStringSlice("migrations-dir") {
+		for _, dir := range strings.Split(value, ",") {
+			if dir = strings.TrimSpace(dir); dir != "" {
+				dirs = append(dirs, dir)
+			}
+		}
+	}
+	if len(dirs) == 0 {
+		return []string{dbmate.DefaultMigrationsDir}
+	}
+
+	return dirs
+}
+
 // getDatabaseURL returns the current environment database url
 func getDatabaseURL(c *cli.Context) (u *url.URL, err error) {
 	env := c.GlobalString("env")
@@ -190,7 +1041,7 @@ func getDatabaseURL(c *cli.Context) (u *url.URL, err error) {
 }
 
 func constructDatabaseUrl(c *cli.Context) (*url.URL, error) {
-	portvar := c.GlobalString("portvar")
+	portvar := c.GlobalString("dbportvar")
 	namevar := c.GlobalString("dbnamevar")
 	drivervar := c.GlobalString("drivervar")
 	passvar := c.GlobalString("passvar")
@@ -227,6 +1078,8 @@ func constructDatabaseUrl(c *cli.Context) (*url.URL, error) {
 	return url.Parse(dsnUrl)
 }
 
+// readVarVal returns the value of the environment variable named by the
+// environment variable v, e.g. DATABASE_HOST=PGHOST reads the host from PGHOST
 func readVarVal(v string) string {
 	return os.Getenv(os.Getenv(v))
 }
@@ -35,3 +35,44 @@ func TestGetDatabaseUrl(t *testing.T) {
 	require.Equal(t, "example.org", u.Host)
 	require.Equal(t, "/db", u.Path)
 }
+
+func TestConstructDatabaseUrl(t *testing.T) {
+	ctx := testContext(t, &url.URL{})
+	for name, value := range map[string]string{
+		"DATABASE_DRIVER":   "MYAPP_DB_DRIVER",
+		"MYAPP_DB_DRIVER":   "mysql",
+		"DATABASE_HOST":     "MYAPP_DB_HOST",
+		"MYAPP_DB_HOST":     "db",
+		"DATABASE_PORT":     "MYAPP_DB_PORT",
+		"MYAPP_DB_PORT":     "3306",
+		"DATABASE_NAME":     "MYAPP_DB_NAME",
+		"MYAPP_DB_NAME":     "app",
+		"DATABASE_USER":     "MYAPP_DB_USER",
+		"MYAPP_DB_USER":     "root",
+		"DATABASE_PASSWORD": "MYAPP_DB_PASSWORD",
+		"MYAPP_DB_PASSWORD": "pw",
+	} {
+		err := os.Setenv(name, value)
+		require.NoError(t, err)
+		defer func(name string) {
+			err := os.Unsetenv(name)
+			require.NoError(t, err)
+		}(name)
+	}
+
+	u, err := constructDatabaseUrl(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "mysql://root:pw@db:3306/app?sslmode=disable", u.String())
+}
+
+func TestMigrationsDirs(t *testing.T) {
+	u, err := url.Parse("foo://example.org/db")
+	require.NoError(t, err)
+
+	ctx := testContext(t, u)
+	require.Equal(t, []string{"./db/migrations"}, migrationsDirs(ctx))
+
+	require.NoError(t, ctx.GlobalSet("migrations-dir", "./a, ./b"))
+	require.NoError(t, ctx.GlobalSet("migrations-dir", "./c"))
+	require.Equal(t, []string{"./a", "./b", "./c"}, migrationsDirs(ctx))
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// metricsTimeout limits the time spent sending metrics
+const metricsTimeout = 5 * time.Second
+
+// statsdReporter sends run metrics to a StatsD server over UDP
+func statsdReporter(addr, prefix string) reporter {
+	return func(report runReport) error {
+		conn, err := net.DialTimeout("udp", addr, metricsTimeout)
+		if err != nil {
+			return fmt.Errorf("unable to send metrics: %s", err)
+		}
+		defer mustClose(conn)
+
+		if _, err := conn.Write(statsdPayload(prefix, report)); err != nil {
+			return fmt.Errorf("unable to send metrics: %s", err)
+		}
+
+		return nil
+	}
+}
+
+// statsdPayload formats the run metrics as StatsD lines
+func statsdPayload(prefix string, report runReport) []byte {
+	failures := 0
+	if report.Err != nil {
+		failures = 1
+	}
+
+	name := prefix + "." + report.Command
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s.migrations_applied:%d|c\n", name, report.Applied())
+	fmt.Fprintf(&buf, "%s.failures:%d|c\n", name, failures)
+	fmt.Fprintf(&buf, "%s.duration:%d|ms\n", name, report.Duration.Milliseconds())
+
+	return buf.Bytes()
+}
+
+// pushgatewayReporter pushes run metrics to a Prometheus Pushgateway
+func pushgatewayReporter(baseURL, job string) reporter {
+	return func(report runReport) error {
+		u := strings.TrimRight(baseURL, "/") + "/metrics/job/" + url.PathEscape(job)
+		client := http.Client{Timeout: metricsTimeout}
+
+		resp, err := client.Post(u, "text/plain; version=0.0.4", bytes.NewReader(pushgatewayPayload(report)))
+		if err != nil {
+			return fmt.Errorf("unable to push metrics: %s", err)
+		}
+		defer mustClose(resp.Body)
+
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("unable to push metrics: %s", resp.Status)
+		}
+
+		return nil
+	}
+}
+
+// pushgatewayPayload formats the run metrics in the Prometheus text format
+func pushgatewayPayload(report runReport) []byte {
+	failed := 0
+	if report.Err != nil {
+		failed = 1
+	}
+
+	labels := fmt.Sprintf("{command=%q}", report.Command)
+	metrics := []struct {
+		name  string
+		value string
+	}{
+		{"dbmate_migrations_applied", fmt.Sprint(report.Applied())},
+		{"dbmate_failed", fmt.Sprint(failed)},
+		{"dbmate_duration_seconds", fmt.Sprint(report.Duration.Seconds())},
+		{"dbmate_last_run_timestamp_seconds", fmt.Sprint(report.StartedAt.Unix())},
+	}
+
+	var buf bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&buf, "# TYPE %s gauge\n%s%s %s\n", m.name, m.name, labels, m.value)
+	}
+
+	return buf.Bytes()
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func testReport() runReport {
+	return runReport{
+		Command:   "migrate",
+		StartedAt: time.Unix(1577934245, 0),
+		Duration:  1500 * time.Millisecond,
+		Migrations: []dbmate.MigrationResult{
+			{Version: "1", Direction: "up"},
+			{Version: "2", Direction: "up"},
+			{Version: "3", Direction: "up", Err: errors.New("syntax error")},
+		},
+		Err: errors.New("syntax error"),
+	}
+}
+
+func TestStatsdPayload(t *testing.T) {
+	require.Equal(t, "dbmate.migrate.migrations_applied:2|c\n"+
+		"dbmate.migrate.failures:1|c\n"+
+		"dbmate.migrate.duration:1500|ms\n", string(statsdPayload("dbmate", testReport())))
+}
+
+func TestStatsdReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer mustClose(conn)
+
+	err = statsdReporter(conn.LocalAddr().String(), "svc")(testReport())
+	require.NoError(t, err)
+
+	buf := make([]byte, 1024)
+	err = conn.SetReadDeadline(time.Now().Add(time.Second))
+	require.NoError(t, err)
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Contains(t, string(buf[:n]), "svc.migrate.migrations_applied:2|c\n")
+}
+
+func TestPushgatewayPayload(t *testing.T) {
+	require.Equal(t, "# TYPE dbmate_migrations_applied gauge\n"+
+		"dbmate_migrations_applied{command=\"migrate\"} 2\n"+
+		"# TYPE dbmate_failed gauge\n"+
+		"dbmate_failed{command=\"migrate\"} 1\n"+
+		"# TYPE dbmate_duration_seconds gauge\n"+
+		"dbmate_duration_seconds{command=\"migrate\"} 1.5\n"+
+		"# TYPE dbmate_last_run_timestamp_seconds gauge\n"+
+		"dbmate_last_run_timestamp_seconds{command=\"migrate\"} 1577934245\n",
+		string(pushgatewayPayload(testReport())))
+}
+
+func TestPushgatewayReporter(t *testing.T) {
+	var path, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		data, _ := ioutil.ReadAll(r.Body)
+		body = string(data)
+	}))
+	defer server.Close()
+
+	err := pushgatewayReporter(server.URL+"/", "orders")(testReport())
+	require.NoError(t, err)
+	require.Equal(t, "/metrics/job/orders", path)
+	require.Contains(t, body, "dbmate_migrations_applied{command=\"migrate\"} 2\n")
+}
+
+func TestPushgatewayReporter_Error(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	err := pushgatewayReporter(server.URL, "dbmate")(testReport())
+	require.EqualError(t, err, "unable to push metrics: 400 Bad Request")
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// notifyCommands lists the commands which trigger webhook notifications
+var notifyCommands = map[string]bool{
+	"up":       true,
+	"migrate":  true,
+	"rollback": true,
+	"redo":     true,
+	"drift":    true,
+}
+
+// webhookMigration describes a migration in the generic webhook payload
+type webhookMigration struct {
+	Version         string  `json:"version"`
+	Filename        string  `json:"filename"`
+	Direction       string  `json:"direction"`
+	DurationSeconds float64 `json:"duration_seconds"`
+	Error           string  `json:"error,omitempty"`
+}
+
+// webhookReporter posts a json payload to a webhook URL after migrate/rollback commands
+func webhookReporter(url string, payload func(runReport) interface{}) reporter {
+	return func(report runReport) error {
+		if !notifyCommands[report.Command] {
+			return nil
+		}
+
+		data, err := json.Marshal(payload(report))
+		if err != nil {
+			return err
+		}
+
+		client := http.Client{Timeout: metricsTimeout}
+		resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("unable to send webhook: %s", err)
+		}
+		defer mustClose(resp.Body)
+
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("unable to send webhook: %s", resp.Status)
+		}
+
+		return nil
+	}
+}
+
+// reportStatus returns "success" or "failure"
+func reportStatus(report runReport) string {
+	if report.Err != nil {
+		return "failure"
+	}
+
+	return "success"
+}
+
+// genericWebhookPayload returns the json payload for generic webhooks
+func genericWebhookPayload(report runReport) interface{} {
+	migrations := []webhookMigration{}
+	for _, m := range report.Migrations {
+		wm := webhookMigration{
+			Version:         m.Version,
+			Filename:        m.Filename,
+			Direction:       m.Direction,
+			DurationSeconds: m.Duration.Seconds(),
+		}
+		if m.Err != nil {
+			wm.Error = m.Err.Error()
+		}
+		migrations = append(migrations, wm)
+	}
+
+	payload := map[string]interface{}{
+		"command":          report.Command,
+		"status":           reportStatus(report),
+		"driver":           report.Driver,
+		"database_host":    report.DatabaseHost,
+		"database":         report.Database,
+		"hostname":         report.Hostname,
+		"user":             report.User,
+		"started_at":       report.StartedAt.UTC(),
+		"duration_seconds": report.Duration.Seconds(),
+		"migrations":       migrations,
+	}
+	if report.Err != nil {
+		payload["error"] = report.Err.Error()
+	}
+
+	return payload
+}
+
+// slackWebhookPayload returns the message payload for Slack incoming webhooks
+func slackWebhookPayload(report runReport) interface{} {
+	icon, status := ":white_check_mark:", "succeeded"
+	if report.Err != nil {
+		icon, status = ":x:", "failed"
+	}
+
+	var text strings.Builder
+	fmt.Fprintf(&text, "%s dbmate %s %s for %s database `%s` (run by %s@%s)",
+		icon, report.Command, status, report.Driver, report.Database, report.User, report.Hostname)
+
+	for _, m := range report.Migrations {
+		verb := "Applied"
+		if m.Direction == "down" {
+			verb = "Rolled back"
+		}
+		if m.Err != nil {
+			verb = "Failed"
+		}
+		fmt.Fprintf(&text, "\n• %s `%s`", verb, m.Filename)
+	}
+
+	if len(report.Migrations) == 0 && report.Err == nil {
+		text.WriteString("\nNo pending migrations")
+	}
+	if report.Err != nil {
+		fmt.Fprintf(&text, "\n```%s```", report.Err)
+	}
+
+	return map[string]string{"text": text.String()}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenericWebhookPayload(t *testing.T) {
+	report := testReport()
+	report.Hostname = "deploy-1"
+
+	payload := genericWebhookPayload(report).(map[string]interface{})
+	require.Equal(t, "migrate", payload["command"])
+	require.Equal(t, "failure", payload["status"])
+	require.Equal(t, "syntax error", payload["error"])
+	require.Equal(t, "deploy-1", payload["hostname"])
+
+	migrations := payload["migrations"].([]webhookMigration)
+	require.Len(t, migrations, 3)
+	require.Equal(t, "1", migrations[0].Version)
+	require.Equal(t, "", migrations[0].Error)
+	require.Equal(t, "syntax error", migrations[2].Error)
+}
+
+func TestSlackWebhookPayload(t *testing.T) {
+	report := testReport()
+	report.Driver = "postgres"
+	report.Database = "orders"
+	report.User = "deploy"
+	report.Hostname = "ci-1"
+	report.Migrations[0].Filename = "1_create_users.sql"
+
+	payload := slackWebhookPayload(report).(map[string]string)
+	require.Contains(t, payload["text"], ":x: dbmate migrate failed for postgres database `orders` (run by deploy@ci-1)")
+	require.Contains(t, payload["text"], "• Applied `1_create_users.sql`")
+	require.Contains(t, payload["text"], "```syntax error```")
+
+	report = runReport{Command: "rollback", Driver: "mysql", Database: "orders"}
+	payload = slackWebhookPayload(report).(map[string]string)
+	require.Contains(t, payload["text"], ":white_check_mark: dbmate rollback succeeded")
+	require.Contains(t, payload["text"], "No pending migrations")
+}
+
+func TestWebhookReporter(t *testing.T) {
+	requests := 0
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		data, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+	}))
+	defer server.Close()
+
+	rep := webhookReporter(server.URL, genericWebhookPayload)
+
+	// other commands do not trigger notifications
+	err := rep(runReport{Command: "dump"})
+	require.NoError(t, err)
+	require.Equal(t, 0, requests)
+
+	err = rep(testReport())
+	require.NoError(t, err)
+	require.Equal(t, 1, requests)
+	require.Equal(t, "failure", body["status"])
+}
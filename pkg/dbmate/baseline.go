@@ -0,0 +1,81 @@
+package dbmate
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// Baseline marks migrations as applied without running them, so that an existing
+// database can be adopted without replaying its history. All migrations up to
+// and including the specified version (or every migration, if empty) are marked.
+func (db *DB) Baseline(version string) error {
+	re := regexp.MustCompile(`^\d.*\.sql$`)
+	files, err := db.migrationFiles(re)
+	if err != nil {
+		return err
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no migration files found")
+	}
+
+	if version != "" && !containsVersion(files, version) {
+		return fmt.Errorf("can't find migration version %s", version)
+	}
+
+	if err := db.beforeMigrate(); err != nil {
+		return err
+	}
+
+	drv, sqlDB, err := db.openDatabaseForMigration()
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	applied, err := drv.SelectMigrations(sqlDB, -1)
+	if err != nil {
+		return err
+	}
+
+	marked := 0
+	err = doTransaction(sqlDB, func(tx Transaction) error {
+		for _, filename := range files {
+			ver := migrationVersion(filename)
+			if !applied[ver] {
+				checksum, err := db.migrationChecksum(filepath.Join(db.MigrationsDir, filename))
+				if err != nil {
+					return err
+				}
+
+				fmt.Fprintf(db.Log, "Baselining: %s\n", filename)
+				if err := drv.InsertMigration(tx, ver); err != nil {
+					return err
+				}
+				if err := db.recordChecksum(drv, tx, ver, checksum); err != nil {
+					return err
+				}
+				marked++
+			}
+
+			if ver == version {
+				break
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(db.Log, "Marked %d migrations as applied\n", marked)
+
+	// automatically update schema file, silence errors
+	if db.AutoDumpSchema {
+		_ = db.DumpSchema()
+	}
+
+	return nil
+}
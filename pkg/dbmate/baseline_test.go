@@ -0,0 +1,70 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBaseline(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "baseline.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+
+	err = db.Baseline("")
+	require.EqualError(t, err, "no migration files found")
+
+	for _, name := range []string{"1_users", "2_posts", "3_comments"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".sql"),
+			[]byte("-- migrate:up\ncreate table "+name[2:]+" (id integer);\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	// the existing database already has the users and posts tables
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("create table users (id integer); create table posts (id integer);")
+	require.NoError(t, err)
+
+	err = db.Baseline("4")
+	require.EqualError(t, err, "can't find migration version 4")
+
+	err = db.Baseline("2")
+	require.NoError(t, err)
+	require.Equal(t, "Baselining: 1_users.sql\nBaselining: 2_posts.sql\n"+
+		"Marked 2 migrations as applied\n", buf.String())
+
+	// only genuinely new migrations are applied
+	buf.Reset()
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Applying: 3_comments.sql\n", buf.String())
+
+	results, err := db.Verify()
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	require.NotEqual(t, "", results[0].Recorded)
+
+	buf.Reset()
+	err = db.Baseline("")
+	require.NoError(t, err)
+	require.Equal(t, "Marked 0 migrations as applied\n", buf.String())
+}
@@ -0,0 +1,58 @@
+package dbmate
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// batchSizePlaceholder is replaced with the batch size in batched migrations
+const batchSizePlaceholder = "{{batch_size}}"
+
+// runBatches runs a batched migration repeatedly until a batch affects fewer rows
+// than the batch size. Each batch runs in its own transaction (unless disabled),
+// so that a large backfill does not hold locks or accumulate changes for its whole
+// duration. The statement must only affect rows which have not been processed yet,
+// so that an interrupted migration resumes where it left off when run again.
+// The total number of rows affected is returned.
+func (db *DB) runBatches(sqlDB *sql.DB, m Migration, filename string) (int64, error) {
+	size := m.Options.BatchSize()
+	contents := strings.Replace(m.Contents, batchSizePlaceholder, strconv.Itoa(size), -1)
+
+	var total int64
+	for batch := 1; ; batch++ {
+		var rows int64
+		exec := func(tx Transaction) error {
+			res, err := tx.Exec(contents)
+			if err != nil {
+				return err
+			}
+
+			rows, err = res.RowsAffected()
+			return err
+		}
+
+		var err error
+		if m.Options.Transaction() {
+			err = doTransaction(sqlDB, exec)
+		} else {
+			err = exec(sqlDB)
+		}
+		if err != nil {
+			return total, fmt.Errorf("batch %d of %s failed after %d rows: %s", batch, filename, total, err)
+		}
+
+		total += rows
+		fmt.Fprintf(db.Log, "Batch %d: %d rows (%d total)\n", batch, rows, total)
+
+		if rows < int64(size) {
+			return total, nil
+		}
+
+		if sleep := m.Options.BatchSleep(); sleep > 0 {
+			time.Sleep(sleep)
+		}
+	}
+}
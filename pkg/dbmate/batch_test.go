@@ -0,0 +1,76 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatchOptions(t *testing.T) {
+	up, _, err := parseMigrationContents("-- migrate:up batch:500 batch-sleep:100ms\nselect 1;\n")
+	require.NoError(t, err)
+	require.Equal(t, 500, up.Options.BatchSize())
+	require.Equal(t, 100*time.Millisecond, up.Options.BatchSleep())
+
+	up, _, err = parseMigrationContents("-- migrate:up batch:lots\nselect 1;\n")
+	require.NoError(t, err)
+	require.Equal(t, 0, up.Options.BatchSize())
+	require.Equal(t, time.Duration(0), up.Options.BatchSleep())
+}
+
+func TestMigrateBatched(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "batch.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	migrations := map[string]string{
+		"1_users.sql": "-- migrate:up\ncreate table users (id integer primary key, done integer);\n" +
+			"with recursive n(i) as (select 1 union all select i + 1 from n where i < 25)\n" +
+			"insert into users (id, done) select i, 0 from n;\n",
+		"2_backfill.sql": "-- migrate:up batch:10 batch-sleep:1ms\n" +
+			"update users set done = 1 where id in " +
+			"(select id from users where done = 0 limit {{batch_size}});\n",
+	}
+	for name, contents := range migrations {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Applying: 1_users.sql\n"+
+		"Applying: 2_backfill.sql\n"+
+		"Batch 1: 10 rows (10 total)\n"+
+		"Batch 2: 10 rows (20 total)\n"+
+		"Batch 3: 5 rows (25 total)\n", buf.String())
+
+	sqlDB, err := SQLiteDriver{}.Open(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+
+	count := -1
+	err = sqlDB.QueryRow("select count(*) from users where done = 0").Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.True(t, status[1].Applied)
+}
@@ -0,0 +1,102 @@
+package dbmate
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Blocker describes a database session which may block a migration, because it
+// holds a lock on a table the migration touches, or has a long running transaction
+type Blocker struct {
+	PID   int64
+	Table string
+	Query string
+	Age   time.Duration
+}
+
+// String describes the blocker for the migration output
+func (b Blocker) String() string {
+	reason := fmt.Sprintf("transaction open for %s", b.Age.Round(time.Second))
+	if b.Table != "" {
+		reason += ", holds a lock on " + b.Table
+	}
+
+	query := strings.Join(strings.Fields(b.Query), " ")
+	if len(query) > 100 {
+		query = query[:97] + "..."
+	}
+
+	return fmt.Sprintf("pid %d (%s): %s", b.PID, reason, query)
+}
+
+// migrationTableRegExp matches the table names in statements which take locks
+var migrationTableRegExp = regexp.MustCompile(`(?i)\b(?:alter\s+table|drop\s+table|` +
+	`truncate(?:\s+table)?|lock\s+table|update|insert\s+into|delete\s+from|references|` +
+	`create\s+(?:unique\s+)?index\s+(?:concurrently\s+)?(?:if\s+not\s+exists\s+)?(?:\S+\s+)??on)` +
+	`\s+(?:if\s+exists\s+)?(?:only\s+)?([\w."` + "`" + `]+)`)
+
+// migrationTables returns the tables touched by a migration
+func migrationTables(contents string) []string {
+	tables := []string{}
+	seen := map[string]bool{}
+	for _, match := range migrationTableRegExp.FindAllStringSubmatch(trimSQLComments(contents), -1) {
+		table := match[1]
+		if !seen[strings.ToLower(table)] {
+			seen[strings.ToLower(table)] = true
+			tables = append(tables, table)
+		}
+	}
+
+	return tables
+}
+
+// checkBlockers waits until no sessions may block the migration, for up to
+// BlockerWait, if MaxTransactionAge is set
+func (db *DB) checkBlockers(drv Driver, sqlDB *sql.DB, m Migration, filename string) error {
+	if db.MaxTransactionAge == 0 {
+		return nil
+	}
+
+	blockerDrv, ok := drv.(blockerDriver)
+	if !ok {
+		return fmt.Errorf("blocker checks are not supported by the %s driver", db.DatabaseURL.Scheme)
+	}
+
+	tables := migrationTables(m.Contents)
+	deadline := time.Now().Add(db.BlockerWait)
+	for attempt := 0; ; attempt++ {
+		blockers, err := blockerDrv.Blockers(sqlDB, tables, db.MaxTransactionAge)
+		if err != nil {
+			return fmt.Errorf("unable to check for blocking sessions: %s", err)
+		}
+		if len(blockers) == 0 {
+			return nil
+		}
+
+		// report the blockers when starting to wait, and when giving up
+		waiting := time.Now().Before(deadline)
+		if waiting && attempt == 0 {
+			fmt.Fprintf(db.Log, "Waiting: %s may be blocked by %d sessions\n", filename, len(blockers))
+		} else if !waiting {
+			fmt.Fprintf(db.Log, "Blocked: %s may be blocked by %d sessions\n", filename, len(blockers))
+		}
+		if !waiting || attempt == 0 {
+			for _, b := range blockers {
+				fmt.Fprintf(db.Log, "  %s\n", b)
+			}
+		}
+
+		if !waiting {
+			pids := make([]string, len(blockers))
+			for i, b := range blockers {
+				pids[i] = fmt.Sprint(b.PID)
+			}
+			return fmt.Errorf("migration %s may be blocked by sessions %s", filename, strings.Join(pids, ", "))
+		}
+
+		time.Sleep(db.WaitInterval)
+	}
+}
@@ -0,0 +1,107 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationTables(t *testing.T) {
+	tables := migrationTables(`-- migrate:up
+-- update comments
+ALTER TABLE users ADD COLUMN team_id integer REFERENCES teams (id);
+create unique index concurrently if not exists idx_users_email on only public.users (email);
+create index on "Posts" (user_id);
+update users set team_id = 1;
+DELETE FROM sessions where expired;
+insert into audit_log (message) values ('backfilled');
+drop table if exists legacy_users;
+truncate events;
+`)
+	require.Equal(t, []string{"users", "teams", "public.users", `"Posts"`, "sessions",
+		"audit_log", "legacy_users", "events"}, tables)
+}
+
+func TestBlockerString(t *testing.T) {
+	b := Blocker{PID: 123, Query: "update users\n  set name = 'x'", Age: 90*time.Second + 300*time.Millisecond}
+	require.Equal(t, "pid 123 (transaction open for 1m30s): update users set name = 'x'", b.String())
+
+	b.Table = "users"
+	b.Query = "select " + string(bytes.Repeat([]byte("x"), 200))
+	require.Equal(t, "pid 123 (transaction open for 1m30s, holds a lock on users): select "+
+		string(bytes.Repeat([]byte("x"), 90))+"...", b.String())
+}
+
+// blockerTestDriver is a sqlite driver which reports a sequence of blockers
+type blockerTestDriver struct {
+	SQLiteDriver
+	blockers [][]Blocker
+	tables   []string
+}
+
+func (drv *blockerTestDriver) Blockers(db *sql.DB, tables []string, maxAge time.Duration) ([]Blocker, error) {
+	drv.tables = tables
+	blockers := drv.blockers[0]
+	if len(drv.blockers) > 1 {
+		drv.blockers = drv.blockers[1:]
+	}
+
+	return blockers, nil
+}
+
+func TestCheckBlockers(t *testing.T) {
+	drv := &blockerTestDriver{}
+	RegisterDriver(drv, "sqlite-blockers")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-blockers:///" + filepath.Join(dir, "blockers.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	db.WaitInterval = time.Millisecond
+	db.MaxTransactionAge = time.Minute
+	err = ioutil.WriteFile(filepath.Join(dir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\nalter table users add column name text;\n"), 0644)
+	require.NoError(t, err)
+
+	blocker := Blocker{PID: 42, Table: "users", Query: "select * from users", Age: 5 * time.Minute}
+
+	// aborts immediately without a wait time
+	drv.blockers = [][]Blocker{{blocker}}
+	err = db.Migrate()
+	require.EqualError(t, err, "migration 1_users.sql may be blocked by sessions 42")
+	require.Equal(t, "Blocked: 1_users.sql may be blocked by 1 sessions\n"+
+		"  pid 42 (transaction open for 5m0s, holds a lock on users): select * from users\n", buf.String())
+	require.Equal(t, []string{"users"}, drv.tables)
+
+	// waits for the blockers to finish
+	buf.Reset()
+	db.BlockerWait = time.Minute
+	drv.blockers = [][]Blocker{{blocker}, {blocker}, {}}
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Waiting: 1_users.sql may be blocked by 1 sessions\n"+
+		"  pid 42 (transaction open for 5m0s, holds a lock on users): select * from users\n"+
+		"Applying: 1_users.sql\n", buf.String())
+
+	db.DatabaseURL = sqliteTestURL(t)
+	err = db.checkBlockers(SQLiteDriver{}, nil, NewMigration(), "1_users.sql")
+	require.EqualError(t, err, "blocker checks are not supported by the sqlite3 driver")
+}
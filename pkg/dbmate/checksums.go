@@ -0,0 +1,99 @@
+package dbmate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+	"regexp"
+)
+
+// MigrationChecksum compares the checksum of an applied migration file with the
+// checksum recorded when it was applied
+type MigrationChecksum struct {
+	Version  string
+	Filename string
+	// Recorded is empty if the migration was applied before checksums were recorded
+	Recorded string
+	Current  string
+}
+
+// Modified returns whether the migration file was edited after being applied
+func (c MigrationChecksum) Modified() bool {
+	return c.Recorded != "" && c.Recorded != c.Current
+}
+
+// migrationChecksum returns the sha256 checksum of a migration file
+func (db *DB) migrationChecksum(path string) (string, error) {
+	data, err := db.readFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// recordChecksum records the checksum of a migration file as it is applied
+func (db *DB) recordChecksum(drv Driver, tx Transaction, version, checksum string) error {
+	checksumDrv, ok := drv.(checksumDriver)
+	if !ok {
+		return nil
+	}
+
+	return checksumDrv.InsertChecksum(tx, version, checksum)
+}
+
+// Verify recomputes the checksum of each applied migration file, for comparison
+// with the checksum recorded when it was applied
+func (db *DB) Verify() ([]MigrationChecksum, error) {
+	re := regexp.MustCompile(`^\d.*\.sql$`)
+	files, err := db.migrationFiles(re)
+	if err != nil {
+		return nil, err
+	}
+
+	drv, sqlDB, err := db.openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(sqlDB)
+
+	checksumDrv, ok := drv.(checksumDriver)
+	if !ok {
+		return nil, fmt.Errorf("checksums are not supported by the %s driver", db.DatabaseURL.Scheme)
+	}
+
+	applied, err := db.selectApplied(drv, sqlDB)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded, err := checksumDrv.SelectMigrationChecksums(sqlDB)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []MigrationChecksum{}
+	for _, filename := range files {
+		ver := migrationVersion(filename)
+		if !applied[ver] {
+			continue
+		}
+
+		current, err := db.migrationChecksum(filepath.Join(db.MigrationsDir, filename))
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, MigrationChecksum{
+			Version:  ver,
+			Filename: filename,
+			Recorded: recorded[ver],
+			Current:  current,
+		})
+	}
+
+	return results, nil
+}
@@ -0,0 +1,138 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "verify.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	write := func(name, contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+	write("1_users.sql", "-- migrate:up\ncreate table users (id integer);\n-- migrate:down\ndrop table users;\n")
+	write("2_posts.sql", "-- migrate:up\ncreate table posts (id integer);\n-- migrate:down\ndrop table posts;\n")
+
+	err = db.Migrate()
+	require.NoError(t, err)
+
+	results, err := db.Verify()
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "1_users.sql", results[0].Filename)
+	require.Len(t, results[0].Recorded, 64)
+	require.Equal(t, results[0].Recorded, results[0].Current)
+	require.False(t, results[0].Modified())
+
+	// edits to the down migration are detected too
+	write("2_posts.sql", "-- migrate:up\ncreate table posts (id integer);\n"+
+		"-- migrate:down\ndrop table if exists posts;\n")
+	results, err = db.Verify()
+	require.NoError(t, err)
+	require.True(t, results[1].Modified())
+
+	// rolling back removes the checksum, and applying records the new one
+	err = db.Redo()
+	require.NoError(t, err)
+	results, err = db.Verify()
+	require.NoError(t, err)
+	require.False(t, results[1].Modified())
+
+	// migrations applied before checksums were recorded are not modified
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("update schema_migrations set checksum = null where version = '1'")
+	require.NoError(t, err)
+
+	results, err = db.Verify()
+	require.NoError(t, err)
+	require.Equal(t, "", results[0].Recorded)
+	require.False(t, results[0].Modified())
+
+	// versioned checksums are only recorded in schema_migrations
+	err = db.Rollback()
+	require.NoError(t, err)
+	checksums, err := SQLiteDriver{}.SelectMigrationChecksums(sqlDB)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{}, checksums)
+	checksums, err = SQLiteDriver{}.SelectRepeatableChecksums(sqlDB)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{}, checksums)
+}
+
+func TestChecksumColumnUpgrade(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "upgrade.sqlite3"))
+	require.NoError(t, err)
+
+	// a migrations table created by an older version of dbmate
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	for _, stmt := range []string{
+		"create table schema_migrations (version varchar(255) primary key)",
+		"insert into schema_migrations (version) values ('1'), ('2')",
+	} {
+		_, err = sqlDB.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	// the checksum column is added, and migrations applied before it existed
+	// have no checksum
+	drv := SQLiteDriver{}
+	for i := 0; i < 2; i++ {
+		err = drv.CreateChecksumsTable(sqlDB)
+		require.NoError(t, err)
+	}
+	checksums, err := drv.SelectMigrationChecksums(sqlDB)
+	require.NoError(t, err)
+	require.Empty(t, checksums)
+	checksums, err = drv.SelectRepeatableChecksums(sqlDB)
+	require.NoError(t, err)
+	require.Empty(t, checksums)
+
+	// checksums are written to schema_migrations as migrations are applied
+	err = drv.InsertMigration(sqlDB, "3")
+	require.NoError(t, err)
+	err = drv.InsertChecksum(sqlDB, "3", "def")
+	require.NoError(t, err)
+	checksums, err = drv.SelectMigrationChecksums(sqlDB)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"3": "def"}, checksums)
+
+	// custom migrations tables are upgraded too
+	_, err = sqlDB.Exec("create table migrations (version varchar(255) primary key)")
+	require.NoError(t, err)
+	err = SQLiteDriver{MigrationsTableName: "migrations"}.CreateChecksumsTable(sqlDB)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec("select checksum from migrations")
+	require.NoError(t, err)
+}
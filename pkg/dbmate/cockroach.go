@@ -0,0 +1,231 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"net/url"
+	"regexp"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	RegisterDriver(CockroachDriver{}, "cockroachdb")
+}
+
+// cockroachAutoRetries is the number of times a migration is retried after a
+// serialization failure, unless the retry option is set
+const cockroachAutoRetries = 3
+
+// cockroachNoTransactionRegExp matches statements which cockroach can't run
+// inside a transaction
+var cockroachNoTransactionRegExp = regexp.MustCompile(
+	`(?im)^\s*(?:set\s+cluster\s+setting|backup|restore|import)\b`)
+
+// CockroachDriver provides top level database functions. Cockroach speaks the
+// postgres wire protocol, so most functions are provided by the postgres driver.
+type CockroachDriver struct {
+	postgres PostgresDriver
+}
+
+// cockroachPostgresURL returns the postgres URL used to connect to cockroach
+func cockroachPostgresURL(u *url.URL) *url.URL {
+	postgresURL := *u
+	postgresURL.Scheme = "postgres"
+
+	// set default port
+	if u.Port() == "" {
+		postgresURL.Host = u.Hostname() + ":26257"
+	}
+
+	return &postgresURL
+}
+
+// Info describes the cockroach driver
+func (drv CockroachDriver) Info() DriverInfo {
+	return DriverInfo{
+		SchemaDump: true,
+		Binaries:   []string{"cockroach"},
+		URLOptions: []string{"sslmode", "sslcert", "sslkey", "sslrootcert", "connect_timeout",
+			"application_name", "options"},
+	}
+}
+
+// Open creates a new database connection
+func (drv CockroachDriver) Open(u *url.URL) (*sql.DB, error) {
+	return drv.postgres.Open(cockroachPostgresURL(u))
+}
+
+// CreateDatabase creates the specified database
+func (drv CockroachDriver) CreateDatabase(u *url.URL) error {
+	return drv.postgres.CreateDatabase(cockroachPostgresURL(u))
+}
+
+// DropDatabase drops the specified database (if it exists)
+func (drv CockroachDriver) DropDatabase(u *url.URL) error {
+	return drv.postgres.DropDatabase(cockroachPostgresURL(u))
+}
+
+// DumpSchema returns the current database schema. pg_dump does not support
+// cockroach, so the schema is generated with `show create all tables`.
+func (drv CockroachDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	statements, err := queryColumn(db, "show create all tables")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := postgresSchemaMigrationsDump(db, drv.postgres.migrationsTable())
+	if err != nil {
+		return nil, err
+	}
+
+	var schema bytes.Buffer
+	for i, stmt := range statements {
+		if i > 0 {
+			schema.WriteString("\n")
+		}
+		schema.WriteString(stmt + "\n")
+	}
+	schema.Write(migrations)
+
+	return schema.Bytes(), nil
+}
+
+// DatabaseExists determines whether the database exists
+func (drv CockroachDriver) DatabaseExists(u *url.URL) (bool, error) {
+	return drv.postgres.DatabaseExists(cockroachPostgresURL(u))
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table
+func (drv CockroachDriver) MigrationsTable(name string) Driver {
+	drv.postgres = drv.postgres.withMigrationsTable(name)
+
+	return drv
+}
+
+// CreateMigrationsTable creates the schema_migrations table
+func (drv CockroachDriver) CreateMigrationsTable(db *sql.DB) error {
+	return drv.postgres.CreateMigrationsTable(db)
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv CockroachDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.postgres.MigrationsTableExists(db)
+}
+
+// SelectMigrations returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv CockroachDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.postgres.SelectMigrations(db, limit)
+}
+
+// InsertMigration adds a new migration record
+func (drv CockroachDriver) InsertMigration(db Transaction, version string) error {
+	return drv.postgres.InsertMigration(db, version)
+}
+
+// DeleteMigration removes a migration record
+func (drv CockroachDriver) DeleteMigration(db Transaction, version string) error {
+	return drv.postgres.DeleteMigration(db, version)
+}
+
+// CreateChecksumsTable adds the checksum column to the migrations table
+func (drv CockroachDriver) CreateChecksumsTable(db *sql.DB) error {
+	return drv.postgres.CreateChecksumsTable(db)
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv CockroachDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.postgres.SelectRepeatableChecksums(db)
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv CockroachDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.postgres.SelectMigrationChecksums(db)
+}
+
+// CreateMetadataColumns adds the metadata columns to the migrations table
+func (drv CockroachDriver) CreateMetadataColumns(db *sql.DB) error {
+	return drv.postgres.CreateMetadataColumns(db)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv CockroachDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	return drv.postgres.UpdateMigrationMetadata(db, version, meta)
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv CockroachDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	return drv.postgres.SelectMigrationMetadata(db)
+}
+
+// InsertChecksum records the checksum of an applied migration
+func (drv CockroachDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	return drv.postgres.InsertChecksum(db, version, checksum)
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv CockroachDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	return drv.postgres.InsertRepeatableChecksum(db, name, checksum)
+}
+
+// ConsoleCommand returns the cockroach sql command to connect to the database
+func (drv CockroachDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return "cockroach", []string{"sql", "--url", cockroachPostgresURL(u).String()}
+}
+
+// RetryableError returns whether an error was caused by a serialization failure,
+// lock timeout, or deadlock
+func (drv CockroachDriver) RetryableError(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "40001" {
+		return true
+	}
+
+	return drv.postgres.RetryableError(err)
+}
+
+// ErrorPosition returns the offset in query of the position reported by an error
+func (drv CockroachDriver) ErrorPosition(err error, query string) (int, bool) {
+	return drv.postgres.ErrorPosition(err, query)
+}
+
+// PrepareRetry does nothing, as failed schema changes are rolled back by cockroach
+func (drv CockroachDriver) PrepareRetry(db *sql.DB, contents string) error {
+	return nil
+}
+
+// LockTimeoutSQL returns statements to set and reset the session lock timeout
+func (drv CockroachDriver) LockTimeoutSQL(d time.Duration) (string, string) {
+	return drv.postgres.LockTimeoutSQL(d)
+}
+
+// AutoRetries returns the number of times a migration is retried after a
+// serialization failure, which cockroach expects clients to handle
+func (drv CockroachDriver) AutoRetries() int {
+	return cockroachAutoRetries
+}
+
+// NoTransaction returns whether migration contents include statements which
+// cockroach can't run inside a transaction
+func (drv CockroachDriver) NoTransaction(contents string) bool {
+	return cockroachNoTransactionRegExp.MatchString(trimSQLComments(contents))
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings
+func (drv CockroachDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	return drv.postgres.SessionSettingsSQL(s)
+}
+
+// ResetSessionSettingsSQL returns the statements which reset session settings
+func (drv CockroachDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	return drv.postgres.ResetSessionSettingsSQL(s)
+}
+
+// Ping verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv CockroachDriver) Ping(u *url.URL) error {
+	return drv.postgres.Ping(cockroachPostgresURL(u))
+}
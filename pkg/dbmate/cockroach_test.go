@@ -0,0 +1,50 @@
+package dbmate
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCockroachPostgresURL(t *testing.T) {
+	u, err := url.Parse("cockroachdb://root@host/dbmate?sslmode=disable")
+	require.NoError(t, err)
+
+	require.Equal(t, "postgres://root@host:26257/dbmate?sslmode=disable",
+		cockroachPostgresURL(u).String())
+
+	u, err = url.Parse("cockroachdb://root@host:1234/dbmate")
+	require.NoError(t, err)
+	require.Equal(t, "postgres://root@host:1234/dbmate", cockroachPostgresURL(u).String())
+}
+
+func TestCockroachRetryableError(t *testing.T) {
+	drv := CockroachDriver{}
+
+	require.True(t, drv.RetryableError(&pq.Error{Code: "40001"}))
+	require.True(t, drv.RetryableError(&pq.Error{Code: "40P01"}))
+	require.False(t, drv.RetryableError(&pq.Error{Code: "42P01"}))
+	require.False(t, drv.RetryableError(errors.New("restart transaction")))
+	require.Equal(t, cockroachAutoRetries, drv.AutoRetries())
+}
+
+func TestCockroachNoTransaction(t *testing.T) {
+	drv := CockroachDriver{}
+
+	require.True(t, drv.NoTransaction("SET CLUSTER SETTING sql.defaults.vectorize = on;"))
+	require.True(t, drv.NoTransaction("create table users (id int);\nimport into users csv data ('nodelocal://1/users.csv');"))
+	require.False(t, drv.NoTransaction("create table backups (id int);"))
+	require.False(t, drv.NoTransaction("-- restore the index\ncreate index users_id on users (id);"))
+}
+
+func TestCockroachConsoleCommand(t *testing.T) {
+	u, err := url.Parse("cockroachdb://root@host/dbmate")
+	require.NoError(t, err)
+
+	name, args := CockroachDriver{}.ConsoleCommand(u)
+	require.Equal(t, "cockroach", name)
+	require.Equal(t, []string{"sql", "--url", "postgres://root@host:26257/dbmate"}, args)
+}
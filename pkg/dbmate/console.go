@@ -0,0 +1,29 @@
+package dbmate
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// ConsoleCommand returns the command which opens an interactive shell (such as
+// psql, mysql, or sqlite3) connected to the database. The caller attaches the
+// terminal and runs it.
+func (db *DB) ConsoleCommand() (*exec.Cmd, error) {
+	drv, err := db.GetDriver()
+	if err != nil {
+		return nil, err
+	}
+
+	consoleDrv, ok := drv.(consoleDriver)
+	if !ok {
+		return nil, fmt.Errorf("consoles are not supported by the %s driver", db.DatabaseURL.Scheme)
+	}
+
+	name, args := consoleDrv.ConsoleCommand(db.DatabaseURL)
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find %s: %s", name, err)
+	}
+
+	return exec.Command(path, args...), nil
+}
@@ -0,0 +1,32 @@
+package dbmate
+
+import (
+	"net/url"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConsoleCommand(t *testing.T) {
+	u, err := url.Parse("sqlite:////tmp/app.sqlite3")
+	require.NoError(t, err)
+
+	db := New(u)
+	db.driver = plainTestDriver{SQLiteDriver{}}
+	_, err = db.ConsoleCommand()
+	require.EqualError(t, err, "consoles are not supported by the sqlite driver")
+
+	// the shell must be installed
+	path := os.Getenv("PATH")
+	defer func() {
+		err := os.Setenv("PATH", path)
+		require.NoError(t, err)
+	}()
+	err = os.Setenv("PATH", "")
+	require.NoError(t, err)
+
+	_, err = New(u).ConsoleCommand()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to find sqlite3")
+}
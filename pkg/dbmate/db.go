@@ -1,14 +1,20 @@
 package dbmate
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,14 +30,143 @@ const DefaultWaitInterval = time.Second
 // DefaultWaitTimeout specifies maximum time for connection attempts
 const DefaultWaitTimeout = 60 * time.Second
 
+// DefaultBackupDir specifies default directory for backups taken before migrating
+const DefaultBackupDir = "./db/backups"
+
+// DefaultRetryBackoff specifies the delay before the first retry of a migration
+// with the retry option, which doubles after each attempt
+const DefaultRetryBackoff = time.Second
+
+// DefaultRetryLockTimeout specifies the lock timeout for migrations with the
+// retry option, if no lock timeout is set
+const DefaultRetryLockTimeout = 5 * time.Second
+
+// DefaultPingTimeout specifies maximum time for the ping query
+const DefaultPingTimeout = 5 * time.Second
+
 // DB allows dbmate actions to be performed on a specified database
 type DB struct {
 	AutoDumpSchema bool
 	DatabaseURL    *url.URL
+	Log            io.Writer
 	MigrationsDir  string
-	SchemaFile     string
-	WaitInterval   time.Duration
-	WaitTimeout    time.Duration
+	// MigrationsDirs are further directories of migration files (such as
+	// migrations vendored from a shared library), which are merged with those in
+	// MigrationsDir by version. New migrations are created in MigrationsDir.
+	MigrationsDirs []string
+	// FS is the filesystem which migrations are read from, such as an embed.FS
+	// of the migrations directory. MigrationsDir is a path within FS (e.g.
+	// db/migrations). When nil, migrations are read from the OS filesystem.
+	FS           fs.FS
+	SchemaFile   string
+	Verbose      bool
+	WaitBefore   bool
+	WaitInterval time.Duration
+	WaitTimeout  time.Duration
+	PingTimeout  time.Duration
+	// SeedsDir contains the seed files run by Seed, and Environment selects a
+	// subdirectory of additional seed files
+	SeedsDir    string
+	Environment string
+	// Numbering selects the version of new migrations: "timestamp" (the default)
+	// or "sequential" (0001, 0002, ...)
+	Numbering string
+	// Session settings applied to the migration connection
+	LockTimeout              time.Duration
+	StatementTimeout         time.Duration
+	IdleInTransactionTimeout time.Duration
+	// RetryBackoff is the delay before retrying a migration with the retry option
+	RetryBackoff time.Duration
+	// Backup takes a "schema" or "full" backup before applying pending migrations,
+	// and RestoreOnFailure restores a full backup if a migration fails
+	Backup           string
+	BackupDir        string
+	RestoreOnFailure bool
+	// MaxReplicationLag waits (for up to ReplicationLagWait) before applying each
+	// migration until replication lag is below this value, if set. Lag is checked
+	// on each of ReplicaURLs, or reported by the primary database if empty.
+	MaxReplicationLag  time.Duration
+	ReplicationLagWait time.Duration
+	ReplicaURLs        []*url.URL
+	// MaxTransactionAge enables a check before applying each migration for sessions
+	// which hold locks on the tables it touches, or have a transaction open for
+	// longer than this. If any are found, migrate waits for up to BlockerWait for
+	// them to finish, and otherwise aborts.
+	MaxTransactionAge time.Duration
+	BlockerWait       time.Duration
+	// Phase limits migrate to the "expand" phase, which stops at the first
+	// pending migration marked `-- migrate:contract`
+	Phase string
+	// OutOfOrder is the policy for pending migrations which are older than the
+	// latest applied migration (e.g. merged from a stale branch): "allow" (the
+	// default) applies them, "warn" applies them with a warning, and "error"
+	// refuses to migrate
+	OutOfOrder string
+	// OnlineTool (gh-ost or pt-online-schema-change) runs migrations marked
+	// `-- migrate:online`, using OnlineToolPath and OnlineToolFlags if set
+	OnlineTool      string
+	OnlineToolPath  string
+	OnlineToolFlags []string
+	// BeforeRiskyMigration is called before applying a migration marked with
+	// `-- migrate:risky`, e.g. to take a snapshot. Returning an error aborts the migration.
+	BeforeRiskyMigration func(MigrationResult) error
+	// OnMigration is called after each migration is applied or rolled back
+	OnMigration func(MigrationResult)
+	// BeforeMigrate is called before each operation which applies or rolls back
+	// migrations, or otherwise writes to the migrations table (e.g. to check a
+	// maintenance window). Returning an error aborts the operation.
+	BeforeMigrate func() error
+	// DryRun prints the statements which migrate, rollback, redo, and drop would
+	// execute, without modifying the database
+	DryRun bool
+	// MigrationsTableName is the table which tracks applied migrations (default
+	// schema_migrations). It may be qualified with a schema, e.g.
+	// ops.schema_migrations, for drivers which support it.
+	MigrationsTableName string
+	// Schemas sets the search_path of the migration connection, and limits the
+	// schema dump to these schemas (Postgres only). Migrations are tracked in the
+	// first schema, unless MigrationsTableName is qualified with a schema.
+	Schemas []string
+	// DumpExcludeTables are table patterns (using the * and ? wildcards) which
+	// are left out of the schema file
+	DumpExcludeTables []string
+	// DumpPrivileges includes grants and ownership in the schema file
+	DumpPrivileges bool
+	// SQLitePragmas are PRAGMAs (name=value, e.g. foreign_keys=on) applied to
+	// every SQLite connection, unless the URL sets the same option
+	SQLitePragmas []string
+	// NoLock disables the migrations lock (a Postgres advisory lock) which is held
+	// by migrate, rollback, and redo, e.g. when connecting through a transaction
+	// pooler which does not support session locks
+	NoLock bool
+	// RecordRuns writes the result of each migration applied or rolled back,
+	// with its duration, rows affected, and lock wait time, to a
+	// schema_migration_runs table
+	RecordRuns bool
+
+	// driver overrides the driver registered for the URL scheme (see ForTenant)
+	driver Driver
+	// runID groups the rows written to schema_migration_runs by a single run
+	runID string
+	// runsTableCreated is set once the run has created schema_migration_runs
+	runsTableCreated bool
+}
+
+// MigrationResult describes the outcome of applying or rolling back a migration
+type MigrationResult struct {
+	Version   string
+	Filename  string
+	Direction string
+	Contents  string
+	StartedAt time.Time
+	Duration  time.Duration
+	// RowsAffected is reported by the database for the last statement (or the
+	// total of all batches in a batched migration)
+	RowsAffected int64
+	// LockWait is the time spent waiting for blocking sessions before the
+	// migration, and on attempts which failed due to lock contention
+	LockWait time.Duration
+	Err      error
 }
 
 // New initializes a new dbmate database
@@ -39,16 +174,73 @@ func New(databaseURL *url.URL) *DB {
 	return &DB{
 		AutoDumpSchema: true,
 		DatabaseURL:    databaseURL,
+		Log:            os.Stdout,
 		MigrationsDir:  DefaultMigrationsDir,
 		SchemaFile:     DefaultSchemaFile,
 		WaitInterval:   DefaultWaitInterval,
 		WaitTimeout:    DefaultWaitTimeout,
+		PingTimeout:    DefaultPingTimeout,
+		BackupDir:      DefaultBackupDir,
+		SeedsDir:       DefaultSeedsDir,
+		RetryBackoff:   DefaultRetryBackoff,
 	}
 }
 
 // GetDriver loads the required database driver
 func (db *DB) GetDriver() (Driver, error) {
-	return GetDriver(db.DatabaseURL.Scheme)
+	if db.driver != nil {
+		return db.driver, nil
+	}
+
+	drv, err := GetDriver(db.DatabaseURL.Scheme)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(db.Schemas) > 0 {
+		schemasDrv, ok := drv.(schemasDriver)
+		if !ok {
+			return nil, fmt.Errorf("schemas are not supported by the %s driver", db.DatabaseURL.Scheme)
+		}
+		drv = schemasDrv.WithSchemas(db.Schemas)
+	}
+
+	if db.MigrationsTableName != "" {
+		tableDrv, ok := drv.(migrationsTableDriver)
+		if !ok {
+			return nil, fmt.Errorf("custom migrations tables are not supported by the %s driver",
+				db.DatabaseURL.Scheme)
+		}
+		drv = tableDrv.MigrationsTable(db.MigrationsTableName)
+	}
+
+	if len(db.DumpExcludeTables) > 0 {
+		excludeDrv, ok := drv.(dumpExcludeDriver)
+		if !ok {
+			return nil, fmt.Errorf("excluding tables from the schema dump is not supported by the %s driver",
+				db.DatabaseURL.Scheme)
+		}
+		drv = excludeDrv.ExcludeTables(db.DumpExcludeTables)
+	}
+
+	if db.DumpPrivileges {
+		privilegesDrv, ok := drv.(privilegesDriver)
+		if !ok {
+			return nil, fmt.Errorf("dumping privileges is not supported by the %s driver",
+				db.DatabaseURL.Scheme)
+		}
+		drv = privilegesDrv.WithPrivileges()
+	}
+
+	if len(db.SQLitePragmas) > 0 {
+		pragmasDrv, ok := drv.(pragmasDriver)
+		if !ok {
+			return nil, fmt.Errorf("pragmas are not supported by the %s driver", db.DatabaseURL.Scheme)
+		}
+		drv = pragmasDrv.WithPragmas(db.SQLitePragmas)
+	}
+
+	return drv, nil
 }
 
 // Wait blocks until the database server is available. It does not verify that
@@ -66,44 +258,94 @@ func (db *DB) Wait() error {
 		return nil
 	}
 
-	fmt.Print("Waiting for database")
+	fmt.Fprint(db.Log, "Waiting for database")
 	for i := 0 * time.Second; i < db.WaitTimeout; i += db.WaitInterval {
-		fmt.Print(".")
+		fmt.Fprint(db.Log, ".")
 		time.Sleep(db.WaitInterval)
 
 		// attempt connection to database server
 		err = drv.Ping(db.DatabaseURL)
 		if err == nil {
 			// connection successful
-			fmt.Print("\n")
+			fmt.Fprint(db.Log, "\n")
 			return nil
 		}
 	}
 
 	// if we find outselves here, we could not connect within the timeout
-	fmt.Print("\n")
+	fmt.Fprint(db.Log, "\n")
 	return fmt.Errorf("unable to connect to database: %s", err)
 }
 
+// Ping connects to the specified database and runs a trivial query. Unlike Wait,
+// it checks the database itself (not only the server), does not retry, and does
+// not create or read any tables.
+func (db *DB) Ping() error {
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), db.PingTimeout)
+	defer cancel()
+
+	var result int
+	if err := sqlDB.QueryRowContext(ctx, "select 1").Scan(&result); err != nil {
+		return fmt.Errorf("unable to ping database: %s", err)
+	}
+
+	return nil
+}
+
+// waitBefore waits for the database server if WaitBefore is enabled
+func (db *DB) waitBefore() error {
+	if !db.WaitBefore {
+		return nil
+	}
+
+	return db.Wait()
+}
+
 // CreateAndMigrate creates the database (if necessary) and runs migrations
 func (db *DB) CreateAndMigrate() error {
+	return db.CreateAndMigrateTo("")
+}
+
+// CreateAndMigrateTo creates the database (if necessary) and migrates up to and
+// including the specified version, or the latest version if empty
+func (db *DB) CreateAndMigrateTo(version string) error {
 	drv, err := db.GetDriver()
 	if err != nil {
 		return err
 	}
 
+	if err := db.waitBefore(); err != nil {
+		return err
+	}
+
 	// create database if it does not already exist
 	// skip this step if we cannot determine status
 	// (e.g. user does not have list database permission)
 	exists, err := drv.DatabaseExists(db.DatabaseURL)
 	if err == nil && !exists {
-		if err := drv.CreateDatabase(db.DatabaseURL); err != nil {
-			return err
+		if db.DryRun {
+			fmt.Fprintf(db.Log, "Creating: %s (dry run)\n", databaseName(db.DatabaseURL))
+		} else {
+			fmt.Fprintf(db.Log, "Creating: %s\n", databaseName(db.DatabaseURL))
+			if err := drv.CreateDatabase(db.DatabaseURL); err != nil {
+				return err
+			}
 		}
 	}
 
 	// migrate
-	return db.Migrate()
+	return db.migrate(version, false)
 }
 
 // Create creates the current database
@@ -113,6 +355,12 @@ func (db *DB) Create() error {
 		return err
 	}
 
+	if err := db.waitBefore(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(db.Log, "Creating: %s\n", databaseName(db.DatabaseURL))
+
 	return drv.CreateDatabase(db.DatabaseURL)
 }
 
@@ -123,23 +371,44 @@ func (db *DB) Drop() error {
 		return err
 	}
 
+	if db.DryRun {
+		fmt.Fprintf(db.Log, "Dropping: %s (dry run)\n", databaseName(db.DatabaseURL))
+		return nil
+	}
+
+	fmt.Fprintf(db.Log, "Dropping: %s\n", databaseName(db.DatabaseURL))
+
 	return drv.DropDatabase(db.DatabaseURL)
 }
 
 // DumpSchema writes the current database schema to a file
 func (db *DB) DumpSchema() error {
-	drv, sqlDB, err := db.openDatabaseForMigration()
+	drv, sqlDB, err := db.openDatabase()
 	if err != nil {
 		return err
 	}
 	defer mustClose(sqlDB)
 
+	// the schema file includes the migrations table, so it is only created for a
+	// database which has never been migrated
+	exists := false
+	if existsDrv, ok := drv.(migrationsExistDriver); ok {
+		if exists, err = existsDrv.MigrationsTableExists(sqlDB); err != nil {
+			return err
+		}
+	}
+	if !exists {
+		if err := drv.CreateMigrationsTable(sqlDB); err != nil {
+			return err
+		}
+	}
+
 	schema, err := drv.DumpSchema(db.DatabaseURL, sqlDB)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Writing: %s\n", db.SchemaFile)
+	fmt.Fprintf(db.Log, "Writing: %s\n", db.SchemaFile)
 
 	// ensure schema directory exists
 	if err = ensureDir(filepath.Dir(db.SchemaFile)); err != nil {
@@ -152,23 +421,75 @@ func (db *DB) DumpSchema() error {
 
 const migrationTemplate = "-- migrate:up\n\n\n-- migrate:down\n\n"
 
+// migrationTemplates contains the templates available to NewMigrationFromTemplate
+var migrationTemplates = map[string]string{
+	"concurrent-index": `-- migrate:up transaction:false retry:5
+create index concurrently index_name on table_name (column_name);
+
+-- migrate:down transaction:false
+drop index concurrently if exists index_name;
+`,
+	"validate-constraint": `-- Add the constraint with NOT VALID in an earlier migration, e.g.
+--   alter table table_name add constraint constraint_name
+--     foreign key (column_name) references other_table (id) not valid;
+-- so that validating does not block writes to the table.
+
+-- migrate:up retry:5
+alter table table_name validate constraint constraint_name;
+
+-- migrate:down
+`,
+}
+
 // NewMigration creates a new migration file
 func (db *DB) NewMigration(name string) error {
+	return db.NewMigrationFromTemplate(name, "")
+}
+
+// NewMigrationFromTemplate creates a new migration file from a named template
+// (concurrent-index or validate-constraint), or the default template if empty
+func (db *DB) NewMigrationFromTemplate(name, template string) error {
+	return db.NewMigrationIn("", name, template)
+}
+
+// NewMigrationIn creates a new migration file from a template (as with
+// NewMigrationFromTemplate) in a subdirectory of the migrations directory, such
+// as "schema" or "data", or in the migrations directory itself if subdir is empty
+func (db *DB) NewMigrationIn(subdir, name, template string) error {
+	if db.FS != nil {
+		return fmt.Errorf("migrations can't be created in DB.FS")
+	}
+	if filepath.IsAbs(subdir) || strings.HasPrefix(filepath.Clean(subdir), "..") {
+		return fmt.Errorf("invalid migrations subdirectory: %s", subdir)
+	}
+
+	contents := migrationTemplate
+	if template != "" {
+		var ok bool
+		if contents, ok = migrationTemplates[template]; !ok {
+			return fmt.Errorf("unknown migration template: %s", template)
+		}
+	}
+
 	// new migration name
-	timestamp := time.Now().UTC().Format("20060102150405")
 	if name == "" {
 		return fmt.Errorf("please specify a name for the new migration")
 	}
-	name = fmt.Sprintf("%s_%s.sql", timestamp, name)
+	version, err := db.newMigrationVersion()
+	if err != nil {
+		return err
+	}
+	name = fmt.Sprintf("%s_%s.sql", version, name)
 
 	// create migrations dir if missing
-	if err := ensureDir(db.MigrationsDir); err != nil {
+	dir := filepath.Join(db.MigrationsDir, subdir)
+	if err := ensureDir(dir); err != nil {
 		return err
 	}
 
 	// check file does not already exist
-	path := filepath.Join(db.MigrationsDir, name)
-	fmt.Printf("Creating migration: %s\n", path)
+	path := filepath.Join(dir, name)
+	fmt.Fprintf(db.Log, "Creating migration: %s\n", path)
 
 	if _, err := os.Stat(path); !os.IsNotExist(err) {
 		return fmt.Errorf("file already exists")
@@ -181,10 +502,58 @@ func (db *DB) NewMigration(name string) error {
 	}
 
 	defer mustClose(file)
-	_, err = file.WriteString(migrationTemplate)
+	_, err = file.WriteString(contents)
 	return err
 }
 
+// newMigrationVersion returns the version of a new migration, which is either a
+// timestamp, or one more than the highest existing version (zero padded to the
+// width of existing versions, or four digits) with sequential numbering
+func (db *DB) newMigrationVersion() (string, error) {
+	switch db.Numbering {
+	case "", "timestamp":
+		return time.Now().UTC().Format("20060102150405"), nil
+	case "sequential":
+	default:
+		return "", fmt.Errorf("invalid numbering: %s (expected timestamp or sequential)", db.Numbering)
+	}
+
+	// the migrations directory is created with the first migration
+	files, err := db.migrationFiles(regexp.MustCompile(`^\d.*\.sql$`))
+	if err != nil {
+		files = []string{}
+	}
+
+	last, width := 0, 4
+	seen := map[string]string{}
+	for _, filename := range files {
+		ver := migrationVersion(filename)
+		if other, ok := seen[ver]; ok {
+			return "", fmt.Errorf("version %s is used by both %s and %s, please renumber one of them",
+				ver, other, filename)
+		}
+		seen[ver] = filename
+
+		if len(ver) >= len("20060102150405") {
+			return "", fmt.Errorf("can't use sequential numbering: %s has a timestamp version", filename)
+		}
+		if n, _ := strconv.Atoi(ver); n > last {
+			last = n
+		}
+		if len(ver) > width {
+			width = len(ver)
+		}
+	}
+
+	// migrations are ordered by name, so every version must have the same width
+	if len(strconv.Itoa(last+1)) > width {
+		return "", fmt.Errorf("can't use sequential numbering: version %d has more than %d digits",
+			last+1, width)
+	}
+
+	return fmt.Sprintf("%0*d", width, last+1), nil
+}
+
 func doTransaction(db *sql.DB, txFunc func(Transaction) error) error {
 	tx, err := db.Begin()
 	if err != nil {
@@ -202,7 +571,10 @@ func doTransaction(db *sql.DB, txFunc func(Transaction) error) error {
 	return tx.Commit()
 }
 
-func (db *DB) openDatabaseForMigration() (Driver, *sql.DB, error) {
+// openDatabase opens the database with the session settings applied, for commands
+// which only read it. The migrations table is not created or upgraded, so these
+// commands work for users which can't change the schema.
+func (db *DB) openDatabase() (Driver, *sql.DB, error) {
 	drv, err := db.GetDriver()
 	if err != nil {
 		return nil, nil, err
@@ -213,7 +585,7 @@ func (db *DB) openDatabaseForMigration() (Driver, *sql.DB, error) {
 		return nil, nil, err
 	}
 
-	if err := drv.CreateMigrationsTable(sqlDB); err != nil {
+	if err := db.applySessionSettings(drv, sqlDB); err != nil {
 		mustClose(sqlDB)
 		return nil, nil, err
 	}
@@ -221,184 +593,1156 @@ func (db *DB) openDatabaseForMigration() (Driver, *sql.DB, error) {
 	return drv, sqlDB, nil
 }
 
-// Migrate migrates database to the latest version
-func (db *DB) Migrate() error {
-	re := regexp.MustCompile(`^\d.*\.sql$`)
-	files, err := findMigrationFiles(db.MigrationsDir, re)
+// openDatabaseForMigration opens the database for commands which write to the
+// migrations table, creating it (and upgrading a table created by an older
+// version of dbmate) if necessary
+func (db *DB) openDatabaseForMigration() (Driver, *sql.DB, error) {
+	drv, sqlDB, err := db.openDatabase()
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
-	if len(files) == 0 {
-		return fmt.Errorf("no migration files found")
+	if err := drv.CreateMigrationsTable(sqlDB); err != nil {
+		mustClose(sqlDB)
+		return nil, nil, err
 	}
 
-	drv, sqlDB, err := db.openDatabaseForMigration()
-	if err != nil {
-		return err
+	if checksumDrv, ok := drv.(checksumDriver); ok {
+		if err := checksumDrv.CreateChecksumsTable(sqlDB); err != nil {
+			mustClose(sqlDB)
+			return nil, nil, err
+		}
 	}
-	defer mustClose(sqlDB)
 
-	applied, err := drv.SelectMigrations(sqlDB, -1)
-	if err != nil {
-		return err
+	if metadataDrv, ok := drv.(metadataDriver); ok {
+		if err := metadataDrv.CreateMetadataColumns(sqlDB); err != nil {
+			mustClose(sqlDB)
+			return nil, nil, err
+		}
 	}
 
-	for _, filename := range files {
-		ver := migrationVersion(filename)
-		if ok := applied[ver]; ok {
-			// migration already applied
-			continue
+	if db.RecordRuns {
+		if err := db.startRun(drv); err != nil {
+			mustClose(sqlDB)
+			return nil, nil, err
 		}
+	}
 
-		fmt.Printf("Applying: %s\n", filename)
+	return drv, sqlDB, nil
+}
 
-		up, _, err := parseMigration(filepath.Join(db.MigrationsDir, filename))
+// selectApplied returns the applied migrations for commands which only read the
+// database. A migrations table which does not exist yet has no applied
+// migrations. Drivers which can't check whether it exists create it instead.
+func (db *DB) selectApplied(drv Driver, sqlDB *sql.DB) (map[string]bool, error) {
+	if existsDrv, ok := drv.(migrationsExistDriver); ok {
+		exists, err := existsDrv.MigrationsTableExists(sqlDB)
 		if err != nil {
-			return err
-		}
-
-		execMigration := func(tx Transaction) error {
-			// run actual migration
-			if _, err := tx.Exec(up.Contents); err != nil {
-				return err
-			}
-
-			// record migration
-			return drv.InsertMigration(tx, ver)
+			return nil, err
 		}
-
-		if up.Options.Transaction() {
-			// begin transaction
-			err = doTransaction(sqlDB, execMigration)
-		} else {
-			// run outside of transaction
-			err = execMigration(sqlDB)
+		if !exists {
+			return map[string]bool{}, nil
 		}
+	} else if err := drv.CreateMigrationsTable(sqlDB); err != nil {
+		return nil, err
+	}
 
-		if err != nil {
-			return err
-		}
+	return drv.SelectMigrations(sqlDB, -1)
+}
 
+// sessionSettings returns the session-level timeouts of the migration connection
+func (db *DB) sessionSettings() SessionSettings {
+	return SessionSettings{
+		LockTimeout:              db.LockTimeout,
+		StatementTimeout:         db.StatementTimeout,
+		IdleInTransactionTimeout: db.IdleInTransactionTimeout,
 	}
+}
 
-	// automatically update schema file, silence errors
-	if db.AutoDumpSchema {
-		_ = db.DumpSchema()
+// applySessionSettings configures session-level timeouts on the migration connection
+func (db *DB) applySessionSettings(drv Driver, sqlDB *sql.DB) error {
+	settings := db.sessionSettings()
+	if settings.IsZero() {
+		return nil
 	}
 
-	return nil
-}
+	sessionDrv, ok := drv.(sessionSettingsDriver)
+	if !ok {
+		return fmt.Errorf("session settings are not supported by the %s driver",
+			db.DatabaseURL.Scheme)
+	}
 
-func findMigrationFiles(dir string, re *regexp.Regexp) ([]string, error) {
-	files, err := ioutil.ReadDir(dir)
+	statements, err := sessionDrv.SessionSettingsSQL(settings)
 	if err != nil {
-		return nil, fmt.Errorf("could not find migrations directory `%s`", dir)
+		return err
 	}
 
-	matches := []string{}
-	for _, file := range files {
-		if file.IsDir() {
-			continue
-		}
+	// session settings only apply to a single connection
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
 
-		name := file.Name()
-		if !re.MatchString(name) {
-			continue
+	for _, s := range statements {
+		if _, err := sqlDB.Exec(s); err != nil {
+			return err
 		}
-
-		matches = append(matches, name)
 	}
 
-	sort.Strings(matches)
+	return nil
+}
 
-	return matches, nil
+// Migrate migrates database to the latest version
+func (db *DB) Migrate() error {
+	if err := db.waitBefore(); err != nil {
+		return err
+	}
+
+	return db.migrate("", false)
 }
 
-func findMigrationFile(dir string, ver string) (string, error) {
-	if ver == "" {
-		panic("migration version is required")
+// MigrateTo migrates the database up to and including the specified version
+func (db *DB) MigrateTo(version string) error {
+	if err := db.waitBefore(); err != nil {
+		return err
 	}
 
-	ver = regexp.QuoteMeta(ver)
-	re := regexp.MustCompile(fmt.Sprintf(`^%s.*\.sql$`, ver))
+	return db.migrate(version, false)
+}
 
-	files, err := findMigrationFiles(dir, re)
+// openForMigrate acquires the migrations lock, opens the database, and reads the
+// applied migrations. The returned function closes the database and releases
+// the lock. In dry run mode, the database is not modified, and no connection is
+// returned.
+func (db *DB) openForMigrate() (Driver, *sql.DB, map[string]bool, func(), error) {
+	drv, err := db.GetDriver()
 	if err != nil {
-		return "", err
+		return nil, nil, nil, nil, err
 	}
 
-	if len(files) == 0 {
-		return "", fmt.Errorf("can't find migration file: %s*.sql", ver)
+	if db.DryRun {
+		applied, err := db.dryRunApplied(drv)
+
+		return drv, nil, applied, func() {}, err
 	}
 
-	return files[0], nil
-}
+	if err := db.beforeMigrate(); err != nil {
+		return nil, nil, nil, nil, err
+	}
 
-func migrationVersion(filename string) string {
-	return regexp.MustCompile(`^\d+`).FindString(filename)
-}
+	unlock, err := db.lock(drv)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
 
-// Rollback rolls back the most recent migration
-func (db *DB) Rollback() error {
 	drv, sqlDB, err := db.openDatabaseForMigration()
 	if err != nil {
-		return err
+		unlock()
+		return nil, nil, nil, nil, err
 	}
-	defer mustClose(sqlDB)
 
-	applied, err := drv.SelectMigrations(sqlDB, 1)
+	applied, err := drv.SelectMigrations(sqlDB, -1)
 	if err != nil {
-		return err
+		mustClose(sqlDB)
+		unlock()
+		return nil, nil, nil, nil, err
 	}
 
-	// grab most recent applied migration (applied has len=1)
-	latest := ""
-	for ver := range applied {
-		latest = ver
+	return drv, sqlDB, applied, func() {
+		mustClose(sqlDB)
+		unlock()
+	}, nil
+}
+
+// beforeMigrate calls the BeforeMigrate hook, if set
+func (db *DB) beforeMigrate() error {
+	if db.BeforeMigrate == nil {
+		return nil
 	}
-	if latest == "" {
-		return fmt.Errorf("can't rollback: no migrations have been applied")
+
+	return db.BeforeMigrate()
+}
+
+// lock acquires the migrations lock for drivers which support it, so that
+// concurrent commands (such as app replicas running dbmate up on boot) apply
+// migrations one at a time. The lock is held on a connection of its own, and
+// waits for up to LockTimeout. The returned function releases it.
+func (db *DB) lock(drv Driver) (func(), error) {
+	lockDrv, ok := drv.(lockDriver)
+	if !ok || db.NoLock {
+		return func() {}, nil
 	}
 
-	filename, err := findMigrationFile(db.MigrationsDir, latest)
+	lockDB, err := drv.Open(db.DatabaseURL)
 	if err != nil {
+		return nil, err
+	}
+	lockDB.SetMaxOpenConns(1)
+
+	if err := lockDrv.Lock(lockDB, db.LockTimeout); err != nil {
+		mustClose(lockDB)
+		return nil, err
+	}
+
+	return func() {
+		_ = lockDrv.Unlock(lockDB)
+		mustClose(lockDB)
+	}, nil
+}
+
+// migrate applies pending migrations, stopping after the target version if set.
+// With redo set, the most recent applied migration is rolled back and applied
+// again instead, once the checks before applying it have passed.
+func (db *DB) migrate(target string, redo bool) error {
+	if err := db.validateBackup(); err != nil {
 		return err
 	}
 
-	fmt.Printf("Rolling back: %s\n", filename)
+	switch db.Phase {
+	case "", "expand", "contract":
+	default:
+		return fmt.Errorf("invalid phase: %s (expected expand or contract)", db.Phase)
+	}
+
+	switch db.OutOfOrder {
+	case "", "allow", "warn", "error":
+	default:
+		return fmt.Errorf("invalid out of order policy: %s (expected allow, warn, or error)", db.OutOfOrder)
+	}
 
-	_, down, err := parseMigration(filepath.Join(db.MigrationsDir, filename))
+	re := regexp.MustCompile(`^\d.*\.sql$`)
+	files, err := db.migrationFiles(re)
 	if err != nil {
 		return err
 	}
 
-	execMigration := func(tx Transaction) error {
-		// rollback migration
-		if _, err := tx.Exec(down.Contents); err != nil {
-			return err
-		}
-
-		// remove migration record
-		return drv.DeleteMigration(tx, latest)
+	if len(files) == 0 && !redo {
+		return fmt.Errorf("no migration files found")
 	}
 
-	if down.Options.Transaction() {
-		// begin transaction
-		err = doTransaction(sqlDB, execMigration)
-	} else {
-		// run outside of transaction
-		err = execMigration(sqlDB)
+	if target != "" && !containsVersion(files, target) {
+		return fmt.Errorf("can't find migration version %s", target)
 	}
 
+	drv, sqlDB, applied, closeDB, err := db.openForMigrate()
 	if err != nil {
 		return err
 	}
+	defer closeDB()
 
-	// automatically update schema file, silence errors
-	if db.AutoDumpSchema {
-		_ = db.DumpSchema()
+	if redo {
+		for ver := range applied {
+			if ver > target {
+				target = ver
+			}
+		}
+		if target == "" {
+			return fmt.Errorf("can't redo: no migrations have been applied")
+		}
+		if !containsVersion(files, target) {
+			return fmt.Errorf("can't find migration file: %s*.sql", target)
+		}
+	} else if err := db.checkOutOfOrder(files, applied, target); err != nil {
+		return err
 	}
 
-	return nil
+	backupPath := ""
+	reachedTarget := false
+	stopped := false
+	for _, filename := range files {
+		if reachedTarget {
+			break
+		}
+
+		ver := migrationVersion(filename)
+		reachedTarget = ver == target
+		redoing := redo && reachedTarget
+		if applied[ver] && !redoing || redo && !redoing {
+			// migration already applied, or not the migration being redone
+			continue
+		}
+
+		path := filepath.Join(db.MigrationsDir, filename)
+		up, down, err := db.parseMigration(path)
+		if err != nil {
+			return err
+		}
+		checksum, err := db.migrationChecksum(path)
+		if err != nil {
+			return err
+		}
+
+		// the migration being redone can't rely on pending migrations, since
+		// only it is applied
+		if redoing {
+			for _, req := range up.Options.Requires() {
+				if !applied[req] {
+					return fmt.Errorf("%s requires migration %s, which has not been applied", filename, req)
+				}
+			}
+		}
+
+		// contract migrations run after the application has been deployed
+		if db.Phase == "expand" && up.Options.Phase() == "contract" {
+			fmt.Fprintf(db.Log, "Stopping: %s is a contract migration\n", filename)
+			stopped = true
+			break
+		}
+
+		if db.DryRun {
+			if redoing {
+				fmt.Fprintf(db.Log, "Rolling back: %s (dry run)\n", filename)
+				db.printDryRun(drv, down, "remove version "+ver+" from schema_migrations")
+			}
+			fmt.Fprintf(db.Log, "Applying: %s (dry run)\n", filename)
+			db.printDryRun(drv, up, "record version "+ver+" in schema_migrations")
+			continue
+		}
+
+		if err := db.checkReplicationLag(drv, sqlDB); err != nil {
+			return err
+		}
+		waitStart := time.Now()
+		if err := db.checkBlockers(drv, sqlDB, up, filename); err != nil {
+			return err
+		}
+		lockWait := time.Since(waitStart)
+
+		// back up before applying the first pending migration
+		if db.Backup != "" && backupPath == "" {
+			backupPath, err = db.backup(drv)
+			if err != nil {
+				return err
+			}
+		}
+
+		result := MigrationResult{
+			Version:   ver,
+			Filename:  filename,
+			Direction: "up",
+			LockWait:  lockWait,
+		}
+		if up.Options.Risky() && db.BeforeRiskyMigration != nil {
+			if err := db.BeforeRiskyMigration(result); err != nil {
+				return fmt.Errorf("unable to prepare for risky migration %s: %s", filename, err)
+			}
+		}
+
+		if redoing {
+			err = db.rollbackMigration(drv, sqlDB, ver, filename, down)
+			if err != nil && backupPath != "" {
+				mustClose(sqlDB)
+				return db.restoreAfterFailure(backupPath, err)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		fmt.Fprintf(db.Log, "Applying: %s\n", filename)
+
+		err = db.execMigration(drv, sqlDB, up, result, func(tx Transaction, result MigrationResult) error {
+			// record migration
+			if err := drv.InsertMigration(tx, ver); err != nil {
+				return err
+			}
+			if err := db.recordChecksum(drv, tx, ver, checksum); err != nil {
+				return err
+			}
+			return db.recordMetadata(drv, tx, result)
+		})
+		if err != nil && backupPath != "" {
+			mustClose(sqlDB)
+			return db.restoreAfterFailure(backupPath, err)
+		}
+		if err != nil {
+			return err
+		}
+
+	}
+
+	// repeatable migrations may depend on any versioned migration
+	if target == "" && !stopped {
+		if err := db.applyRepeatable(drv, sqlDB); err != nil {
+			return err
+		}
+	}
+
+	// automatically update schema file, silence errors
+	if db.AutoDumpSchema && !db.DryRun {
+		_ = db.DumpSchema()
+	}
+
+	return nil
+}
+
+// checkOutOfOrder applies the OutOfOrder policy to the pending migrations (up to
+// and including target, if set) which are older than the latest applied migration,
+// and checks the versions which the pending migrations require before any of them
+// are applied
+func (db *DB) checkOutOfOrder(files []string, applied map[string]bool, target string) error {
+	latest := ""
+	for ver := range applied {
+		if ver > latest {
+			latest = ver
+		}
+	}
+
+	versions := map[string]bool{}
+	for _, filename := range files {
+		versions[migrationVersion(filename)] = true
+	}
+
+	outOfOrder := []string{}
+	for _, filename := range files {
+		ver := migrationVersion(filename)
+		if !applied[ver] {
+			if ver < latest {
+				outOfOrder = append(outOfOrder, filename)
+			}
+
+			// migrations merged out of order (e.g. from a long-lived branch) are
+			// only applied once the migrations they depend on have been
+			up, _, err := db.parseMigration(filepath.Join(db.MigrationsDir, filename))
+			if err != nil {
+				return err
+			}
+			if err := db.checkRequires(filename, up, applied, versions, latest); err != nil {
+				return err
+			}
+		}
+		if ver == target {
+			break
+		}
+	}
+	if len(outOfOrder) == 0 || db.OutOfOrder == "" || db.OutOfOrder == "allow" {
+		return nil
+	}
+
+	if db.OutOfOrder == "error" {
+		return fmt.Errorf("pending migrations are older than the latest applied version %s: %s",
+			latest, strings.Join(outOfOrder, ", "))
+	}
+	for _, filename := range outOfOrder {
+		fmt.Fprintf(db.Log, "Warning: %s is older than the latest applied version %s\n", filename, latest)
+	}
+
+	return nil
+}
+
+// checkRequires returns an error if a pending migration requires a version which
+// can't be found, which is not an earlier version (so would be applied after it),
+// or which the OutOfOrder policy refuses to apply. Other required versions are
+// either applied, or pending and applied earlier in the same run.
+func (db *DB) checkRequires(filename string, m Migration, applied, versions map[string]bool,
+	latest string) error {
+	ver := migrationVersion(filename)
+	for _, req := range m.Options.Requires() {
+		switch {
+		case applied[req]:
+		case !versions[req]:
+			return fmt.Errorf("%s requires migration %s, which can't be found", filename, req)
+		case req >= ver:
+			return fmt.Errorf("%s requires migration %s, which is not an earlier version", filename, req)
+		case req < latest && db.OutOfOrder == "error":
+			return fmt.Errorf("%s requires migration %s, which is older than the latest applied version %s",
+				filename, req, latest)
+		}
+	}
+
+	return nil
+}
+
+// validateBackup checks the backup options
+func (db *DB) validateBackup() error {
+	switch db.Backup {
+	case "", "schema", "full":
+	default:
+		return fmt.Errorf("invalid backup mode: %s (expected schema or full)", db.Backup)
+	}
+
+	if db.RestoreOnFailure && db.Backup != "full" {
+		return errors.New("restore on failure requires a full backup")
+	}
+
+	return nil
+}
+
+// backup writes a backup to the backup directory, and returns the path
+func (db *DB) backup(drv Driver) (string, error) {
+	backupDrv, ok := drv.(backupDriver)
+	if !ok {
+		return "", fmt.Errorf("backups are not supported by the %s driver",
+			db.DatabaseURL.Scheme)
+	}
+
+	if err := ensureDir(db.BackupDir); err != nil {
+		return "", err
+	}
+
+	path := filepath.Join(db.BackupDir, fmt.Sprintf("%s_%s.backup",
+		time.Now().UTC().Format("20060102150405"), db.Backup))
+
+	fmt.Fprintf(db.Log, "Backing up: %s\n", path)
+	if err := backupDrv.Backup(db.DatabaseURL, path, db.Backup == "schema"); err != nil {
+		return "", fmt.Errorf("unable to back up database: %s", err)
+	}
+
+	return path, nil
+}
+
+// restoreAfterFailure restores the backup if enabled, and returns the migration error
+func (db *DB) restoreAfterFailure(path string, migrationErr error) error {
+	if !db.RestoreOnFailure {
+		fmt.Fprintf(db.Log, "Backup: %s\n", path)
+		return migrationErr
+	}
+
+	fmt.Fprintf(db.Log, "Restoring: %s\n", path)
+	if err := db.Restore(path); err != nil {
+		return fmt.Errorf("%s (restoring backup %s failed: %s)", migrationErr, path, err)
+	}
+
+	return fmt.Errorf("%s (database restored from %s)", migrationErr, path)
+}
+
+// Restore replaces the database contents with a full backup
+func (db *DB) Restore(path string) error {
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	backupDrv, ok := drv.(backupDriver)
+	if !ok {
+		return fmt.Errorf("backups are not supported by the %s driver", db.DatabaseURL.Scheme)
+	}
+
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("can't find backup file: %s", path)
+	}
+
+	return backupDrv.Restore(db.DatabaseURL, path)
+}
+
+// execMigration runs a migration block followed by the record function, inside a
+// transaction unless disabled by the migration options. The result is passed to the
+// OnMigration callback (if any), and recorded in schema_migration_runs if enabled.
+func (db *DB) execMigration(drv Driver, sqlDB *sql.DB, m Migration, result MigrationResult,
+	record func(Transaction, MigrationResult) error) error {
+	db.logSQL(m.Contents)
+
+	restore, err := db.applyMigrationSettings(drv, sqlDB, m)
+	if err != nil {
+		return err
+	}
+	defer restore()
+
+	tool := db.onlineTool(m)
+	batched := m.Options.BatchSize() > 0
+	transaction := migrationTransaction(drv, m)
+	if transaction && tool == "" && !batched {
+		if err := checkTransaction(drv, m, result); err != nil {
+			return err
+		}
+	}
+	batches, err := db.migrationBatches(drv, m)
+	if err != nil {
+		return err
+	}
+	failed := -1
+	exec := func(tx Transaction) error {
+		failed = -1
+
+		// run actual migration
+		if tool != "" {
+			if err := db.runOnlineMigration(tool, m); err != nil {
+				return err
+			}
+		} else if batched {
+			rows, err := db.runBatches(sqlDB, m, result.Filename)
+			if err != nil {
+				return err
+			}
+			result.RowsAffected = rows
+		} else {
+			rows, index, err := execBatches(drv, tx, batches)
+			if err != nil {
+				failed = index
+				return err
+			}
+			result.RowsAffected = rows
+		}
+
+		// asynchronous DDL must finish before the migration is recorded, and
+		// runs outside of a transaction
+		if ddlDrv, ok := drv.(ddlWaitDriver); ok && !transaction {
+			if err := ddlDrv.WaitForDDL(sqlDB); err != nil {
+				return err
+			}
+		}
+
+		result.Duration = time.Since(result.StartedAt)
+		return record(tx, result)
+	}
+
+	result.Contents = m.Contents
+	result.StartedAt = time.Now()
+
+	run := func() error {
+		// batched migrations run each batch in a separate transaction
+		if transaction && tool == "" && !batched {
+			// begin transaction
+			return doTransaction(sqlDB, exec)
+		}
+
+		// run outside of transaction
+		return exec(sqlDB)
+	}
+
+	retries := m.Options.Retries()
+	if autoDrv, ok := drv.(autoRetryDriver); ok && retries == 0 {
+		retries = autoDrv.AutoRetries()
+	}
+
+	if retries > 0 {
+		// time spent before the final attempt was lost to lock contention
+		var attempt time.Duration
+		err = db.retryMigration(sqlDB, m, result.Filename, retries, func() error {
+			start := time.Now()
+			defer func() { attempt = time.Since(start) }()
+			return run()
+		})
+		result.LockWait += time.Since(result.StartedAt) - attempt
+	} else {
+		err = run()
+	}
+
+	// report where in the migration file a failed statement is
+	if err != nil && failed >= 0 {
+		err = statementError(drv, m, batches, failed, result.Filename, err)
+	}
+
+	result.Duration = time.Since(result.StartedAt)
+	result.Err = err
+	if db.RecordRuns {
+		db.recordRun(drv, sqlDB, result)
+	}
+	if db.OnMigration != nil {
+		db.OnMigration(result)
+	}
+
+	return err
+}
+
+// applyMigrationSettings applies the lock_timeout and statement_timeout options of
+// a migration to the migration connection. The returned function restores the
+// session settings afterwards.
+func (db *DB) applyMigrationSettings(drv Driver, sqlDB *sql.DB, m Migration) (func(), error) {
+	settings := SessionSettings{
+		LockTimeout:      m.Options.LockTimeout(),
+		StatementTimeout: m.Options.StatementTimeout(),
+	}
+	if settings.IsZero() {
+		return func() {}, nil
+	}
+
+	sessionDrv, ok := drv.(sessionSettingsDriver)
+	resetDrv, canReset := drv.(sessionResetDriver)
+	if !ok || !canReset {
+		return nil, fmt.Errorf("the lock_timeout and statement_timeout options are not supported by the %s driver",
+			db.DatabaseURL.Scheme)
+	}
+
+	statements, err := sessionDrv.SessionSettingsSQL(settings)
+	if err != nil {
+		return nil, err
+	}
+	restore, err := sessionDrv.SessionSettingsSQL(db.sessionSettings())
+	if err != nil {
+		return nil, err
+	}
+	restore = append(resetDrv.ResetSessionSettingsSQL(settings), restore...)
+
+	// session settings only apply to a single connection
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+
+	for _, s := range statements {
+		if _, err := sqlDB.Exec(s); err != nil {
+			return nil, err
+		}
+	}
+
+	return func() {
+		for _, s := range restore {
+			_, _ = sqlDB.Exec(s)
+		}
+	}, nil
+}
+
+// migrationTransaction returns whether a migration runs inside a transaction,
+// which is disabled by the transaction option, or by drivers which can't run
+// some of its statements transactionally
+func migrationTransaction(drv Driver, m Migration) bool {
+	if noTxDrv, ok := drv.(noTransactionDriver); ok && noTxDrv.NoTransaction(m.Contents) {
+		return false
+	}
+
+	return m.Options.Transaction()
+}
+
+// checkTransaction returns an error if a migration includes a statement which the
+// driver can't run inside a transaction
+func checkTransaction(drv Driver, m Migration, result MigrationResult) error {
+	checkDrv, ok := drv.(transactionCheckDriver)
+	if !ok {
+		return nil
+	}
+
+	stmt := checkDrv.NoTransactionStatement(m.Contents)
+	if stmt == "" {
+		return nil
+	}
+
+	return fmt.Errorf("%s: can't run %q inside a transaction, add \"-- migrate:%s transaction:false\" "+
+		"to run the migration outside of one", result.Filename, strings.SplitN(stmt, "\n", 2)[0],
+		result.Direction)
+}
+
+// scriptBatches splits SQL into batches for drivers which require it
+func scriptBatches(drv Driver, contents string) []string {
+	if batchDrv, ok := drv.(batchDriver); ok {
+		return batchDrv.SplitBatches(contents)
+	}
+
+	return []string{contents}
+}
+
+// migrationBatches splits a migration into batches, starting with the statement
+// delimiter set by the delimiter option (if any)
+func (db *DB) migrationBatches(drv Driver, m Migration) ([]string, error) {
+	delimiter := m.Options.Delimiter()
+	if delimiter == "" {
+		return scriptBatches(drv, m.Contents), nil
+	}
+
+	delimiterDrv, ok := drv.(delimiterDriver)
+	if !ok {
+		return nil, fmt.Errorf("the delimiter option is not supported by the %s driver",
+			db.DatabaseURL.Scheme)
+	}
+
+	return delimiterDrv.SplitDelimited(m.Contents, delimiter), nil
+}
+
+// execScript runs SQL, split into batches for drivers which require it, and
+// returns the total number of rows affected
+func execScript(drv Driver, tx Transaction, contents string) (int64, error) {
+	rows, _, err := execBatches(drv, tx, scriptBatches(drv, contents))
+	return rows, err
+}
+
+// execBatches runs batches of SQL, and returns the total number of rows affected,
+// or the index of the batch which failed
+func execBatches(drv Driver, tx Transaction, batches []string) (int64, int, error) {
+	copyDrv, canCopy := drv.(copyDriver)
+
+	var total int64
+	for i, batch := range batches {
+		if canCopy {
+			rows, copied, err := copyDrv.ExecCopy(tx, batch)
+			if err != nil {
+				return total, i, err
+			}
+			if copied {
+				total += rows
+				continue
+			}
+		}
+
+		res, err := tx.Exec(batch)
+		if err != nil {
+			return total, i, err
+		}
+		// not all drivers report rows affected, and sqlite has no result
+		// for a migration without statements
+		if strings.TrimSpace(trimSQLComments(batch)) != "" {
+			rows, _ := res.RowsAffected()
+			total += rows
+		}
+	}
+
+	return total, -1, nil
+}
+
+// retryMigration runs a migration up to retries more times, with exponential
+// backoff, if it fails due to lock contention. If the migration has the retry
+// option and no lock timeout is set, DefaultRetryLockTimeout is used while the
+// migration runs.
+func (db *DB) retryMigration(sqlDB *sql.DB, m Migration, filename string, retries int,
+	run func() error) error {
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	retryDrv, ok := drv.(retryDriver)
+	if !ok {
+		return fmt.Errorf("the retry option is not supported by the %s driver",
+			db.DatabaseURL.Scheme)
+	}
+
+	if db.LockTimeout == 0 && m.Options.LockTimeout() == 0 && m.Options.Retries() > 0 {
+		set, reset := retryDrv.LockTimeoutSQL(DefaultRetryLockTimeout)
+
+		// the lock timeout must apply to the connection running the migration
+		sqlDB.SetMaxOpenConns(1)
+		if _, err := sqlDB.Exec(set); err != nil {
+			return err
+		}
+		defer func() {
+			_, _ = sqlDB.Exec(reset)
+		}()
+	}
+
+	backoff := db.RetryBackoff
+	for attempt := 1; ; attempt++ {
+		err = run()
+		if err == nil || attempt > retries || !retryDrv.RetryableError(err) {
+			return err
+		}
+
+		fmt.Fprintf(db.Log, "Retrying: %s in %s (%s)\n", filename, backoff, err)
+		time.Sleep(backoff)
+		backoff *= 2
+
+		if !migrationTransaction(drv, m) {
+			if err := retryDrv.PrepareRetry(sqlDB, m.Contents); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// logSQL prints migration contents in verbose mode
+func (db *DB) logSQL(contents string) {
+	if !db.Verbose {
+		return
+	}
+
+	fmt.Fprintln(db.Log, strings.TrimSpace(contents))
+}
+
+// containsVersion returns whether a migration file has the specified version
+func containsVersion(files []string, version string) bool {
+	for _, filename := range files {
+		if migrationVersion(filename) == version {
+			return true
+		}
+	}
+
+	return false
+}
+
+// findMigrationFiles returns the migration files in dir and its subdirectories
+// (other than hidden directories) whose names match re, as paths relative to dir.
+// Files are ordered by name, and so by version, regardless of their directory.
+func (db *DB) findMigrationFiles(dir string, re *regexp.Regexp) ([]string, error) {
+	entries, err := db.readDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("could not find migrations directory `%s`", dir)
+	}
+
+	matches := matchFiles(entries, re)
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		files, err := db.findMigrationFiles(filepath.Join(dir, entry.Name()), re)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range files {
+			matches = append(matches, filepath.Join(entry.Name(), name))
+		}
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		return filepath.Base(matches[i]) < filepath.Base(matches[j])
+	})
+
+	return matches, nil
+}
+
+// listFiles returns the names of the files in dir (but not its subdirectories)
+// which match re, in order
+func listFiles(dir string, re *regexp.Regexp) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return matchFiles(entries, re), nil
+}
+
+// matchFiles returns the names of the files (but not directories) among the
+// directory entries which match re, in order
+func matchFiles(entries []fs.DirEntry, re *regexp.Regexp) []string {
+	matches := []string{}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		name := entry.Name()
+		if !re.MatchString(name) {
+			continue
+		}
+
+		matches = append(matches, name)
+	}
+
+	sort.Strings(matches)
+
+	return matches
+}
+
+// migrationFiles returns the migration files in MigrationsDir and MigrationsDirs
+// whose names match re, ordered by name (and so by version) regardless of their
+// directory. Files in MigrationsDirs are returned as paths relative to
+// MigrationsDir (e.g. ../shared/001_users.sql), so that each file can be found by
+// joining it to MigrationsDir.
+func (db *DB) migrationFiles(re *regexp.Regexp) ([]string, error) {
+	files, err := db.findMigrationFiles(db.MigrationsDir, re)
+	if err != nil || len(db.MigrationsDirs) == 0 {
+		return files, err
+	}
+
+	base, err := filepath.Abs(db.MigrationsDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range db.MigrationsDirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return nil, err
+		}
+		rel, err := filepath.Rel(base, abs)
+		if err != nil {
+			return nil, err
+		}
+		if rel == "." {
+			continue
+		}
+
+		names, err := db.findMigrationFiles(dir, re)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			files = append(files, filepath.Join(rel, name))
+		}
+	}
+
+	sort.SliceStable(files, func(i, j int) bool {
+		return filepath.Base(files[i]) < filepath.Base(files[j])
+	})
+
+	return files, nil
+}
+
+// migrationFile returns the first migration file with the version
+func (db *DB) migrationFile(ver string) (string, error) {
+	if ver == "" {
+		panic("migration version is required")
+	}
+
+	ver = regexp.QuoteMeta(ver)
+	re := regexp.MustCompile(fmt.Sprintf(`^%s.*\.sql$`, ver))
+
+	files, err := db.migrationFiles(re)
+	if err != nil {
+		return "", err
+	}
+
+	if len(files) == 0 {
+		return "", fmt.Errorf("can't find migration file: %s*.sql", ver)
+	}
+
+	return files[0], nil
+}
+
+func migrationVersion(filename string) string {
+	return regexp.MustCompile(`^\d+`).FindString(filepath.Base(filename))
+}
+
+// MigrationStatus describes a migration file and whether it has been applied
+type MigrationStatus struct {
+	Version  string
+	Filename string
+	Applied  bool
+	// Checksum is the sha256 checksum of the migration file recorded in
+	// schema_migrations when it was applied. It is empty for pending migrations,
+	// migrations applied before checksums were recorded, and drivers which do
+	// not record checksums.
+	Checksum string
+	// Metadata describes when, how long, and by whom the migration was applied.
+	// It is nil for pending migrations, migrations applied before metadata was
+	// recorded, and drivers which do not record metadata.
+	Metadata *MigrationMetadata
+}
+
+// Status returns the status of each migration file, in order
+func (db *DB) Status() ([]MigrationStatus, error) {
+	re := regexp.MustCompile(`^\d.*\.sql$`)
+	files, err := db.migrationFiles(re)
+	if err != nil {
+		return nil, err
+	}
+
+	drv, sqlDB, err := db.openDatabase()
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(sqlDB)
+
+	applied, err := db.selectApplied(drv, sqlDB)
+	if err != nil {
+		return nil, err
+	}
+
+	checksums := map[string]string{}
+	if checksumDrv, ok := drv.(checksumDriver); ok {
+		if checksums, err = checksumDrv.SelectMigrationChecksums(sqlDB); err != nil {
+			return nil, err
+		}
+	}
+
+	metadata := map[string]MigrationMetadata{}
+	if metadataDrv, ok := drv.(metadataDriver); ok {
+		if metadata, err = metadataDrv.SelectMigrationMetadata(sqlDB); err != nil {
+			return nil, err
+		}
+	}
+
+	results := []MigrationStatus{}
+	for _, filename := range files {
+		ver := migrationVersion(filename)
+		status := MigrationStatus{
+			Version:  ver,
+			Filename: filename,
+			Applied:  applied[ver],
+			Checksum: checksums[ver],
+		}
+		if meta, ok := metadata[ver]; ok && status.Applied {
+			status.Metadata = &meta
+		}
+		results = append(results, status)
+	}
+
+	return results, nil
+}
+
+// Rollback rolls back the most recent migration
+func (db *DB) Rollback() error {
+	return db.rollback(1, "")
+}
+
+// RollbackSteps rolls back the specified number of most recent migrations
+func (db *DB) RollbackSteps(steps int) error {
+	if steps < 1 {
+		return fmt.Errorf("invalid number of steps: %d", steps)
+	}
+
+	return db.rollback(steps, "")
+}
+
+// RollbackTo rolls back every migration applied after the specified version,
+// leaving it as the most recent applied migration
+func (db *DB) RollbackTo(version string) error {
+	return db.rollback(-1, version)
+}
+
+// Redo rolls back the most recent migration and applies it again, updating the
+// schema file once both have completed
+func (db *DB) Redo() error {
+	if err := db.waitBefore(); err != nil {
+		return err
+	}
+
+	return db.migrate("", true)
+}
+
+// rollback rolls back the most recent migrations, either the specified number of
+// steps or every migration after the target version
+func (db *DB) rollback(steps int, target string) error {
+	drv, sqlDB, applied, closeDB, err := db.openForMigrate()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	// most recent applied migration first
+	versions := []string{}
+	for ver := range applied {
+		versions = append(versions, ver)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+
+	if len(versions) == 0 {
+		return fmt.Errorf("can't rollback: no migrations have been applied")
+	}
+	if target != "" {
+		if !applied[target] {
+			return fmt.Errorf("can't rollback to %s: migration has not been applied", target)
+		}
+		steps = sort.Search(len(versions), func(i int) bool { return versions[i] <= target })
+	}
+	if steps > len(versions) {
+		return fmt.Errorf("can't rollback %d migrations: only %d have been applied", steps, len(versions))
+	}
+
+	for _, ver := range versions[:steps] {
+		filename, err := db.migrationFile(ver)
+		if err != nil {
+			return err
+		}
+
+		_, down, err := db.parseMigration(filepath.Join(db.MigrationsDir, filename))
+		if err != nil {
+			return err
+		}
+
+		if db.DryRun {
+			fmt.Fprintf(db.Log, "Rolling back: %s (dry run)\n", filename)
+			db.printDryRun(drv, down, "remove version "+ver+" from schema_migrations")
+			continue
+		}
+
+		if err := db.rollbackMigration(drv, sqlDB, ver, filename, down); err != nil {
+			return err
+		}
+	}
+
+	// automatically update schema file, silence errors
+	if db.AutoDumpSchema && !db.DryRun {
+		_ = db.DumpSchema()
+	}
+
+	return nil
+}
+
+// rollbackMigration runs the down migration of an applied migration, and removes
+// its record
+func (db *DB) rollbackMigration(drv Driver, sqlDB *sql.DB, ver, filename string, down Migration) error {
+	fmt.Fprintf(db.Log, "Rolling back: %s\n", filename)
+
+	return db.execMigration(drv, sqlDB, down, MigrationResult{
+		Version:   ver,
+		Filename:  filename,
+		Direction: "down",
+	}, func(tx Transaction, _ MigrationResult) error {
+		// remove migration record
+		return drv.DeleteMigration(tx, ver)
+	})
 }
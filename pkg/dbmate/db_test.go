@@ -1,10 +1,16 @@
 package dbmate
 
 import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
 
@@ -36,10 +42,15 @@ func TestNew(t *testing.T) {
 	db := New(u)
 	require.True(t, db.AutoDumpSchema)
 	require.Equal(t, u.String(), db.DatabaseURL.String())
+	require.Equal(t, os.Stdout, db.Log)
+	require.False(t, db.Verbose)
 	require.Equal(t, "./db/migrations", db.MigrationsDir)
 	require.Equal(t, "./db/schema.sql", db.SchemaFile)
+	require.False(t, db.WaitBefore)
 	require.Equal(t, time.Second, db.WaitInterval)
 	require.Equal(t, 60*time.Second, db.WaitTimeout)
+	require.Equal(t, 5*time.Second, db.PingTimeout)
+	require.Equal(t, "./db/backups", db.BackupDir)
 }
 
 func TestWait(t *testing.T) {
@@ -66,6 +77,53 @@ func TestWait(t *testing.T) {
 	require.Contains(t, err.Error(), "connect: connection refused")
 }
 
+func TestPing(t *testing.T) {
+	u := sqliteTestURL(t)
+	db := newTestDB(t, u)
+
+	err := db.Ping()
+	require.NoError(t, err)
+
+	// the connection is opened with the driver options, such as sqlite pragmas
+	db.SQLitePragmas = []string{"foreign_keys"}
+	err = db.Ping()
+	require.EqualError(t, err, `invalid sqlite pragma "foreign_keys", expected name=value`)
+
+	// unknown database host
+	u, err = url.Parse("postgres://postgres@nonexistent-host:5432/dbmate?connect_timeout=1")
+	require.NoError(t, err)
+	db = newTestDB(t, u)
+	db.PingTimeout = time.Second
+
+	err = db.Ping()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to ping database: ")
+}
+
+func TestWaitBefore(t *testing.T) {
+	u := postgresTestURL(t)
+	db := newTestDB(t, u)
+	db.WaitBefore = true
+
+	// speed up our retry loop for testing
+	db.WaitInterval = time.Millisecond
+	db.WaitTimeout = 5 * time.Millisecond
+
+	// drop database
+	err := db.Drop()
+	require.NoError(t, err)
+
+	// create waits for the server then creates the database
+	err = db.Create()
+	require.NoError(t, err)
+
+	// migrate fails with a wait error if the server is unavailable
+	u.Host = "postgres:404"
+	err = db.Migrate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to connect to database: dial tcp")
+}
+
 func TestDumpSchema(t *testing.T) {
 	u := postgresTestURL(t)
 	db := newTestDB(t, u)
@@ -193,77 +251,1499 @@ func TestMigrate(t *testing.T) {
 	}
 }
 
-func testUpURL(t *testing.T, u *url.URL) {
+func TestMigrateVerbose(t *testing.T) {
+	u := sqliteTestURL(t)
 	db := newTestDB(t, u)
+	db.Verbose = true
+
+	var buf bytes.Buffer
+	db.Log = &buf
 
-	// drop database
 	err := db.Drop()
 	require.NoError(t, err)
+	err = db.Migrate()
+	require.NoError(t, err)
 
-	// create and migrate
-	err = db.CreateAndMigrate()
+	require.Contains(t, buf.String(), "Dropping: /tmp/dbmate.sqlite3\n")
+	require.Contains(t, buf.String(), "Applying: 20151129054053_test_migration.sql\n")
+	require.Contains(t, buf.String(), "create table users (")
+}
+
+func TestOnMigration(t *testing.T) {
+	u := sqliteTestURL(t)
+	db := newTestDB(t, u)
+
+	results := []MigrationResult{}
+	db.OnMigration = func(r MigrationResult) {
+		results = append(results, r)
+	}
+
+	err := db.Drop()
+	require.NoError(t, err)
+	err = db.Migrate()
+	require.NoError(t, err)
+	err = db.Rollback()
+	require.NoError(t, err)
+
+	require.Len(t, results, 2)
+	require.Equal(t, "20151129054053", results[0].Version)
+	require.Equal(t, "20151129054053_test_migration.sql", results[0].Filename)
+	require.Equal(t, "up", results[0].Direction)
+	require.Contains(t, results[0].Contents, "create table users")
+	require.False(t, results[0].StartedAt.IsZero())
+	require.NoError(t, results[0].Err)
+	require.Equal(t, "down", results[1].Direction)
+}
+
+func TestStatus(t *testing.T) {
+	u := sqliteTestURL(t)
+	db := newTestDB(t, u)
+
+	err := db.Drop()
+	require.NoError(t, err)
+	err = db.Create()
+	require.NoError(t, err)
+
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	require.Equal(t, "20151129054053", status[0].Version)
+	require.Equal(t, "20151129054053_test_migration.sql", status[0].Filename)
+	require.False(t, status[0].Applied)
+	require.Equal(t, "", status[0].Checksum)
+
+	err = db.Migrate()
+	require.NoError(t, err)
+
+	status, err = db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	require.True(t, status[0].Applied)
+	checksum, err := db.migrationChecksum(filepath.Join(db.MigrationsDir, status[0].Filename))
+	require.NoError(t, err)
+	require.Equal(t, checksum, status[0].Checksum)
+}
+
+func TestStatusReadOnly(t *testing.T) {
+	u := sqliteTestURL(t)
+	db := newTestDB(t, u)
+
+	err := db.Drop()
+	require.NoError(t, err)
+	err = db.Create()
 	require.NoError(t, err)
 
-	// verify results
 	sqlDB, err := GetDriverOpen(u)
 	require.NoError(t, err)
 	defer mustClose(sqlDB)
+	tables := func() []string {
+		names, err := queryColumn(sqlDB, "select name from sqlite_master where type = 'table' order by name")
+		require.NoError(t, err)
+		return names
+	}
 
-	count := 0
-	err = sqlDB.QueryRow(`select count(*) from schema_migrations
-		where version = '20151129054053'`).Scan(&count)
+	// the migrations table is not created by commands which only read
+	status, err := db.Status()
 	require.NoError(t, err)
-	require.Equal(t, 1, count)
+	require.False(t, status[0].Applied)
+	_, err = db.Verify()
+	require.NoError(t, err)
+	require.Empty(t, tables())
 
-	err = sqlDB.QueryRow("select count(*) from users").Scan(&count)
+	// nor is a table created by an older version of dbmate upgraded
+	_, err = sqlDB.Exec("create table schema_migrations (version varchar(255) primary key)")
 	require.NoError(t, err)
-	require.Equal(t, 1, count)
+	_, err = sqlDB.Exec("insert into schema_migrations (version) values ('20151129054053')")
+	require.NoError(t, err)
+
+	status, err = db.Status()
+	require.NoError(t, err)
+	require.True(t, status[0].Applied)
+	require.Equal(t, "", status[0].Checksum)
+	require.Nil(t, status[0].Metadata)
+	checksums, err := db.Verify()
+	require.NoError(t, err)
+	require.Len(t, checksums, 1)
+	require.Equal(t, "", checksums[0].Recorded)
+
+	require.Equal(t, []string{"schema_migrations"}, tables())
+	columns, err := queryColumn(sqlDB, "select name from pragma_table_info('schema_migrations')")
+	require.NoError(t, err)
+	require.Equal(t, []string{"version"}, columns)
 }
 
-func TestUp(t *testing.T) {
-	for _, u := range testURLs(t) {
-		testUpURL(t, u)
+func TestMigrateBackup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "backup.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	db.BackupDir = filepath.Join(dir, "backups")
+	db.Backup = "full"
+	db.RestoreOnFailure = true
+
+	require.NoError(t, ensureDir(db.MigrationsDir))
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n-- migrate:down\n"), 0644)
+	require.NoError(t, err)
+	// a non-transactional migration which fails part way through
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "2_posts.sql"),
+		[]byte("-- migrate:up transaction:false\ncreate table posts (id integer);\nnot valid sql;\n"+
+			"-- migrate:down\n"), 0644)
+	require.NoError(t, err)
+
+	err = db.Create()
+	require.NoError(t, err)
+
+	err = db.Migrate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "(database restored from "+db.BackupDir)
+	require.Contains(t, buf.String(), "Backing up: "+db.BackupDir)
+	require.Contains(t, buf.String(), "Restoring: "+db.BackupDir)
+
+	// neither migration remains
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.False(t, status[0].Applied)
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	tables, err := queryColumn(sqlDB, "select name from sqlite_master where type = 'table' "+
+		"and name in ('users', 'posts')")
+	require.NoError(t, err)
+	require.Len(t, tables, 0)
+
+	// without restore, the backup path is printed
+	buf.Reset()
+	db.RestoreOnFailure = false
+	err = db.Migrate()
+	require.Error(t, err)
+	require.NotContains(t, err.Error(), "restored")
+	require.Contains(t, buf.String(), "Backup: "+db.BackupDir)
+}
+
+func TestBeforeRiskyMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "risky.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	err = ioutil.WriteFile(filepath.Join(dir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer, name text);\n"), 0644)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(dir, "2_drop_users.sql"),
+		[]byte("-- migrate:risky\n-- migrate:up\ndrop table users;\n"), 0644)
+	require.NoError(t, err)
+
+	called := []string{}
+	db.BeforeRiskyMigration = func(r MigrationResult) error {
+		called = append(called, r.Filename)
+		return errors.New("snapshot failed")
 	}
+
+	err = db.Migrate()
+	require.EqualError(t, err, "unable to prepare for risky migration 2_drop_users.sql: snapshot failed")
+	require.Equal(t, []string{"2_drop_users.sql"}, called)
+
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.True(t, status[0].Applied)
+	require.False(t, status[1].Applied)
+
+	db.BeforeRiskyMigration = func(r MigrationResult) error { return nil }
+	err = db.Migrate()
+	require.NoError(t, err)
 }
 
-func testRollbackURL(t *testing.T, u *url.URL) {
-	db := newTestDB(t, u)
+func TestMigratePhase(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
 
-	// drop, recreate, and migrate database
-	err := db.Drop()
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "phase.sqlite3"))
 	require.NoError(t, err)
-	err = db.Create()
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	migrations := map[string]string{
+		"1_add_email.sql":    "-- migrate:expand\n-- migrate:up\ncreate table emails (id integer);\n",
+		"2_drop_names.sql":   "-- migrate:contract\n-- migrate:up\ncreate table names (id integer);\n",
+		"3_add_accounts.sql": "-- migrate:up\ncreate table accounts (id integer);\n",
+	}
+	for name, contents := range migrations {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	db.Phase = "expand"
+	err = db.Migrate()
 	require.NoError(t, err)
+	require.Equal(t, "Applying: 1_add_email.sql\n"+
+		"Stopping: 2_drop_names.sql is a contract migration\n", buf.String())
+
+	buf.Reset()
+	db.Phase = "contract"
 	err = db.Migrate()
 	require.NoError(t, err)
+	require.Equal(t, "Applying: 2_drop_names.sql\n"+
+		"Applying: 3_add_accounts.sql\n", buf.String())
 
-	// verify migration
-	sqlDB, err := GetDriverOpen(u)
+	db.Phase = "cleanup"
+	err = db.Migrate()
+	require.EqualError(t, err, "invalid phase: cleanup (expected expand or contract)")
+}
+
+func TestMigrateTo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "to.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	for _, name := range []string{"1_users", "2_posts", "3_comments"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".sql"),
+			[]byte("-- migrate:up\ncreate table "+name[2:]+" (id integer);\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	err = db.MigrateTo("2")
+	require.NoError(t, err)
+	require.Equal(t, "Applying: 1_users.sql\nApplying: 2_posts.sql\n", buf.String())
+
+	// already at the target version
+	buf.Reset()
+	err = db.MigrateTo("1")
+	require.NoError(t, err)
+	require.Equal(t, "", buf.String())
+
+	err = db.MigrateTo("4")
+	require.EqualError(t, err, "can't find migration version 4")
+
+	buf.Reset()
+	err = db.CreateAndMigrateTo("3")
+	require.NoError(t, err)
+	require.Equal(t, "Applying: 3_comments.sql\n", buf.String())
+}
+
+// retryTestDriver is a sqlite driver which treats "locked" errors as retryable
+type retryTestDriver struct {
+	SQLiteDriver
+	prepared int
+}
+
+func (drv *retryTestDriver) RetryableError(err error) bool {
+	return strings.Contains(err.Error(), "locked")
+}
+
+func (drv *retryTestDriver) PrepareRetry(db *sql.DB, contents string) error {
+	drv.prepared++
+	return nil
+}
+
+func (drv *retryTestDriver) LockTimeoutSQL(d time.Duration) (string, string) {
+	return "pragma busy_timeout = 5000", "pragma busy_timeout = 0"
+}
+
+func TestRetryMigration(t *testing.T) {
+	drv := &retryTestDriver{}
+	RegisterDriver(drv, "sqlite-retry")
+
+	u, err := url.Parse("sqlite-retry:////tmp/dbmate_retry.sqlite3")
+	require.NoError(t, err)
+	sqlDB, err := drv.Open(u)
 	require.NoError(t, err)
 	defer mustClose(sqlDB)
 
-	count := 0
-	err = sqlDB.QueryRow(`select count(*) from schema_migrations
-		where version = '20151129054053'`).Scan(&count)
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.RetryBackoff = time.Millisecond
+
+	up, _, err := parseMigrationContents("-- migrate:up transaction:false retry:2\nselect 1;\n")
 	require.NoError(t, err)
-	require.Equal(t, 1, count)
+	require.Equal(t, 2, up.Options.Retries())
 
-	// rollback
-	err = db.Rollback()
+	// succeeds on the final attempt
+	attempts := 0
+	err = db.retryMigration(sqlDB, up, "1_index.sql", 2, func() error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("database is locked")
+		}
+		return nil
+	})
 	require.NoError(t, err)
+	require.Equal(t, 3, attempts)
+	require.Equal(t, 2, drv.prepared)
+	require.Equal(t, "Retrying: 1_index.sql in 1ms (database is locked)\n"+
+		"Retrying: 1_index.sql in 2ms (database is locked)\n", buf.String())
 
-	// verify rollback
-	err = sqlDB.QueryRow("select count(*) from schema_migrations").Scan(&count)
+	// the lock timeout is reset afterwards
+	timeout := -1
+	err = sqlDB.QueryRow("pragma busy_timeout").Scan(&timeout)
 	require.NoError(t, err)
-	require.Equal(t, 0, count)
+	require.Equal(t, 0, timeout)
 
-	err = sqlDB.QueryRow("select count(*) from users").Scan(&count)
-	require.NotNil(t, err)
-	require.Regexp(t, "(does not exist|doesn't exist|no such table)", err.Error())
+	// gives up after the configured retries, and does not retry other errors
+	attempts = 0
+	err = db.retryMigration(sqlDB, up, "1_index.sql", 2, func() error {
+		attempts++
+		return errors.New("database is locked")
+	})
+	require.EqualError(t, err, "database is locked")
+	require.Equal(t, 3, attempts)
+
+	attempts = 0
+	err = db.retryMigration(sqlDB, up, "1_index.sql", 2, func() error {
+		attempts++
+		return errors.New("syntax error")
+	})
+	require.EqualError(t, err, "syntax error")
+	require.Equal(t, 1, attempts)
+
+	db.DatabaseURL = sqliteTestURL(t)
+	err = db.retryMigration(sqlDB, up, "1_index.sql", 2, nil)
+	require.EqualError(t, err, "the retry option is not supported by the sqlite3 driver")
 }
 
-func TestRollback(t *testing.T) {
-	for _, u := range testURLs(t) {
-		testRollbackURL(t, u)
+// autoRetryTestDriver retries failed migrations by default, and runs vacuum
+// outside of a transaction
+type autoRetryTestDriver struct {
+	retryTestDriver
+}
+
+func (drv *autoRetryTestDriver) RetryableError(err error) bool {
+	return strings.Contains(err.Error(), "no such table")
+}
+
+func (drv *autoRetryTestDriver) AutoRetries() int {
+	return 2
+}
+
+func (drv *autoRetryTestDriver) NoTransaction(contents string) bool {
+	return strings.Contains(contents, "vacuum")
+}
+
+func TestAutoRetryNoTransaction(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	drv := &autoRetryTestDriver{}
+	RegisterDriver(drv, "sqlite-autoretry")
+	u, err := url.Parse("sqlite-autoretry:///" + filepath.Join(dir, "autoretry.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.RetryBackoff = time.Millisecond
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(db.MigrationsDir, 0755))
+
+	// vacuum fails inside a transaction
+	writeMigration := func(name, up string) {
+		err := ioutil.WriteFile(filepath.Join(db.MigrationsDir, name),
+			[]byte("-- migrate:up\n"+up+"\n-- migrate:down\n"), 0644)
+		require.NoError(t, err)
 	}
+	writeMigration("1_vacuum.sql", "vacuum;")
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+
+	// retryable errors are retried without the retry option
+	writeMigration("2_missing.sql", "select * from missing;")
+	buf.Reset()
+	err = db.Migrate()
+	require.EqualError(t, err, "2_missing.sql: statement 1, line 2: no such table: missing")
+	require.Equal(t, "Applying: 2_missing.sql\n"+
+		"Retrying: 2_missing.sql in 1ms (no such table: missing)\n"+
+		"Retrying: 2_missing.sql in 2ms (no such table: missing)\n", buf.String())
+	require.Equal(t, 0, drv.prepared)
+}
+
+// ddlWaitTestDriver counts the calls to WaitForDDL, and runs migrations which
+// create tables outside of a transaction
+type ddlWaitTestDriver struct {
+	SQLiteDriver
+	waits *int
+}
+
+func (drv ddlWaitTestDriver) NoTransaction(contents string) bool {
+	return strings.Contains(contents, "create table")
+}
+
+func (drv ddlWaitTestDriver) WaitForDDL(db *sql.DB) error {
+	*drv.waits++
+	return nil
+}
+
+func TestWaitForDDL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	waits := 0
+	RegisterDriver(ddlWaitTestDriver{waits: &waits}, "sqlite-ddl")
+	u, err := url.Parse("sqlite-ddl:///" + filepath.Join(dir, "ddl.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(db.MigrationsDir, 0755))
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n-- migrate:down\nselect 1;\n"), 0644)
+	require.NoError(t, err)
+
+	// only migrations which run outside of a transaction wait for DDL
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+	require.Equal(t, 1, waits)
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	require.Equal(t, 1, waits)
+}
+
+func TestNewMigrationFromTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	db := New(sqliteTestURL(t))
+	db.Log = ioutil.Discard
+	db.MigrationsDir = dir
+
+	err = db.NewMigrationFromTemplate("add_users_email_index", "concurrent-index")
+	require.NoError(t, err)
+	files, err := filepath.Glob(filepath.Join(dir, "*_add_users_email_index.sql"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	up, down, err := db.parseMigration(files[0])
+	require.NoError(t, err)
+	require.False(t, up.Options.Transaction())
+	require.Equal(t, 5, up.Options.Retries())
+	require.Contains(t, up.Contents, "create index concurrently")
+	require.False(t, down.Options.Transaction())
+
+	err = db.NewMigrationFromTemplate("foo", "zero-downtime")
+	require.EqualError(t, err, "unknown migration template: zero-downtime")
+}
+
+func TestNewMigrationSequential(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	db := New(sqliteTestURL(t))
+	db.Log = ioutil.Discard
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	db.Numbering = "sequential"
+
+	for _, name := range []string{"create_users", "create_posts"} {
+		err = db.NewMigration(name)
+		require.NoError(t, err)
+	}
+	files, err := db.findMigrationFiles(db.MigrationsDir, regexp.MustCompile(`\.sql$`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"0001_create_users.sql", "0002_create_posts.sql"}, files)
+
+	// migrations created on separate branches collide
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "0002_create_tags.sql"), []byte{}, 0644)
+	require.NoError(t, err)
+	err = db.NewMigration("create_comments")
+	require.EqualError(t, err, "version 0002 is used by both 0002_create_posts.sql and "+
+		"0002_create_tags.sql, please renumber one of them")
+
+	err = os.Rename(filepath.Join(db.MigrationsDir, "0002_create_tags.sql"),
+		filepath.Join(db.MigrationsDir, "9999_create_tags.sql"))
+	require.NoError(t, err)
+	err = db.NewMigration("create_comments")
+	require.EqualError(t, err, "can't use sequential numbering: version 10000 has more than 4 digits")
+
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "20151129054053_old.sql"), []byte{}, 0644)
+	require.NoError(t, err)
+	err = db.NewMigration("create_likes")
+	require.EqualError(t, err, "can't use sequential numbering: 20151129054053_old.sql has a timestamp version")
+
+	db.Numbering = "random"
+	err = db.NewMigration("create_likes")
+	require.EqualError(t, err, "invalid numbering: random (expected timestamp or sequential)")
+}
+
+func TestMigrateSubdirectories(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "subdirectories.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	db.Numbering = "sequential"
+
+	err = db.NewMigrationIn("../data", "backfill_users", "")
+	require.EqualError(t, err, "invalid migrations subdirectory: ../data")
+
+	err = db.NewMigrationIn("schema", "create_users", "")
+	require.NoError(t, err)
+	err = db.NewMigrationIn("data", "backfill_users", "")
+	require.NoError(t, err)
+	err = db.NewMigration("create_posts")
+	require.NoError(t, err)
+	// hidden directories are ignored
+	err = os.Mkdir(filepath.Join(db.MigrationsDir, ".git"), 0755)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, ".git", "0004_hidden.sql"), []byte{}, 0644)
+	require.NoError(t, err)
+
+	files, err := db.findMigrationFiles(db.MigrationsDir, regexp.MustCompile(`^\d.*\.sql$`))
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join("schema", "0001_create_users.sql"),
+		filepath.Join("data", "0002_backfill_users.sql"),
+		"0003_create_posts.sql",
+	}, files)
+
+	for _, f := range files {
+		err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, f), []byte("-- migrate:up\n"+
+			"create table t"+migrationVersion(f)+" (id integer);\n-- migrate:down\n"+
+			"drop table t"+migrationVersion(f)+";\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	// migrations are applied in version order, regardless of their directory
+	buf.Reset()
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Applying: "+files[0]+"\nApplying: "+files[1]+"\nApplying: "+files[2]+"\n", buf.String())
+
+	err = db.RollbackSteps(2)
+	require.NoError(t, err)
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Equal(t, files[0], status[0].Filename)
+	require.True(t, status[0].Applied)
+	require.False(t, status[1].Applied)
+}
+
+func TestMigrateMultipleDirs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "dirs.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	db.MigrationsDirs = []string{filepath.Join(dir, "shared"), db.MigrationsDir}
+
+	for _, f := range []string{
+		filepath.Join(db.MigrationsDir, "001_create_users.sql"),
+		filepath.Join(dir, "shared", "002_create_posts.sql"),
+		filepath.Join(db.MigrationsDir, "003_create_comments.sql"),
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Dir(f), 0755))
+		err = ioutil.WriteFile(f, []byte("-- migrate:up\n"+
+			"create table t"+migrationVersion(f)+" (id integer);\n-- migrate:down\n"+
+			"drop table t"+migrationVersion(f)+";\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	// migrations are applied in version order, regardless of their directory
+	err = db.Migrate()
+	require.NoError(t, err)
+	shared := filepath.Join("..", "shared", "002_create_posts.sql")
+	require.Equal(t, "Applying: 001_create_users.sql\nApplying: "+shared+
+		"\nApplying: 003_create_comments.sql\n", buf.String())
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	err = db.Rollback()
+	require.NoError(t, err)
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 3)
+	require.Equal(t, shared, status[1].Filename)
+	require.True(t, status[0].Applied)
+	require.False(t, status[1].Applied)
+
+	// new migrations are created in the first directory
+	err = db.NewMigration("create_tags")
+	require.NoError(t, err)
+	files, err := db.findMigrationFiles(db.MigrationsDir, regexp.MustCompile(`^\d.*\.sql$`))
+	require.NoError(t, err)
+	require.Len(t, files, 3)
+}
+
+func TestMigrateRequires(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "requires.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+
+	writeMigration := func(name, contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+	writeMigration("001_users.sql", "-- migrate:up\ncreate table users (id integer);\n")
+	writeMigration("003_posts.sql", "-- migrate:requires 001\n-- migrate:up\ncreate table posts (id integer);\n")
+
+	// requirements may be applied earlier in the same run
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+
+	// requirements are checked before any migration is applied
+	applied := func() int {
+		status, err := db.Status()
+		require.NoError(t, err)
+		count := 0
+		for _, s := range status {
+			if s.Applied {
+				count++
+			}
+		}
+		return count
+	}
+	writeMigration("002_tags.sql", "-- migrate:up\ncreate table tags (id integer);\n")
+	writeMigration("004_comments.sql", "-- migrate:requires 001,009\n"+
+		"-- migrate:up\ncreate table comments (id integer);\n")
+	err = db.Migrate()
+	require.EqualError(t, err, "004_comments.sql requires migration 009, which can't be found")
+	require.Equal(t, 2, applied())
+
+	db.DryRun = true
+	err = db.Migrate()
+	require.EqualError(t, err, "004_comments.sql requires migration 009, which can't be found")
+	db.DryRun = false
+
+	// a required version must be older, so that it is applied first
+	writeMigration("004_comments.sql", "-- migrate:requires 005\n-- migrate:up\ncreate table comments (id integer);\n")
+	writeMigration("005_likes.sql", "-- migrate:up\ncreate table likes (id integer);\n")
+	err = db.Migrate()
+	require.EqualError(t, err, "004_comments.sql requires migration 005, which is not an earlier version")
+	require.Equal(t, 2, applied())
+
+	// a required version which the out of order policy refuses to apply
+	writeMigration("004_comments.sql", "-- migrate:requires 002\n-- migrate:up\ncreate table comments (id integer);\n")
+	db.OutOfOrder = "error"
+	err = db.Migrate()
+	require.EqualError(t, err, "004_comments.sql requires migration 002, "+
+		"which is older than the latest applied version 003")
+	require.Equal(t, 2, applied())
+
+	// other policies apply the required version first, in the same run
+	db.OutOfOrder = "warn"
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, 5, applied())
+}
+
+func TestMigrateWindowsLineEndings(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "windows.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+
+	err = ioutil.WriteFile(filepath.Join(dir, "001_users.sql"), []byte("\ufeff-- migrate:up\r\n"+
+		"create table users (id integer);\r\n\r\n-- migrate:down\r\ndrop table users;\r\n"), 0644)
+	require.NoError(t, err)
+
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+	err = db.Rollback()
+	require.NoError(t, err)
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 1)
+	require.False(t, status[0].Applied)
+}
+
+func TestMigrateOutOfOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "order.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+
+	writeMigration := func(name string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte("-- migrate:up\n"+
+			"create table t"+migrationVersion(name)+" (id integer);\n"), 0644)
+		require.NoError(t, err)
+	}
+	writeMigration("001_users.sql")
+	writeMigration("004_posts.sql")
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+
+	db.OutOfOrder = "sometimes"
+	err = db.Migrate()
+	require.EqualError(t, err, "invalid out of order policy: sometimes (expected allow, warn, or error)")
+
+	// migrations merged from stale branches are older than the latest applied
+	writeMigration("002_tags.sql")
+	writeMigration("003_likes.sql")
+	writeMigration("005_comments.sql")
+	db.OutOfOrder = "error"
+	err = db.Migrate()
+	require.EqualError(t, err, "pending migrations are older than the latest applied version 004: "+
+		"002_tags.sql, 003_likes.sql")
+
+	// only migrations up to the target are checked
+	err = db.MigrateTo("002")
+	require.EqualError(t, err, "pending migrations are older than the latest applied version 004: 002_tags.sql")
+
+	buf.Reset()
+	db.OutOfOrder = "warn"
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Warning: 002_tags.sql is older than the latest applied version 004\n"+
+		"Warning: 003_likes.sql is older than the latest applied version 004\n"+
+		"Applying: 002_tags.sql\nApplying: 003_likes.sql\nApplying: 005_comments.sql\n", buf.String())
+
+	// migrations newer than the latest applied version are not out of order
+	writeMigration("006_tags.sql")
+	db.OutOfOrder = "error"
+	err = db.Migrate()
+	require.NoError(t, err)
+}
+
+func TestMigrateDriverBlocks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "drivers.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+
+	err = ioutil.WriteFile(filepath.Join(dir, "001_users.sql"), []byte("-- migrate:up driver:postgres\n"+
+		"create table users (id serial primary key);\n-- migrate:up driver:sqlite\n"+
+		"create table lite_users (id integer primary key);\n-- migrate:down driver:postgres\n"+
+		"drop table users;\n-- migrate:down\ndrop table lite_users;\n"), 0644)
+	require.NoError(t, err)
+
+	// only the blocks for the sqlite driver are executed
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	tables, err := queryColumn(sqlDB, "select name from sqlite_master where name like '%users' order by name")
+	require.NoError(t, err)
+	require.Equal(t, []string{"lite_users"}, tables)
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	tables, err = queryColumn(sqlDB, "select name from sqlite_master where name like '%users' order by name")
+	require.NoError(t, err)
+	require.Len(t, tables, 0)
+}
+
+func TestMigrateBackupValidation(t *testing.T) {
+	db := New(sqliteTestURL(t))
+
+	db.Backup = "everything"
+	require.EqualError(t, db.Migrate(), "invalid backup mode: everything (expected schema or full)")
+
+	db.Backup = "schema"
+	db.RestoreOnFailure = true
+	require.EqualError(t, db.Migrate(), "restore on failure requires a full backup")
+}
+
+func testUpURL(t *testing.T, u *url.URL) {
+	db := newTestDB(t, u)
+
+	// drop database
+	err := db.Drop()
+	require.NoError(t, err)
+
+	// create and migrate
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+
+	// verify results
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+
+	count := 0
+	err = sqlDB.QueryRow(`select count(*) from schema_migrations
+		where version = '20151129054053'`).Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	err = sqlDB.QueryRow("select count(*) from users").Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+}
+
+func TestUp(t *testing.T) {
+	for _, u := range testURLs(t) {
+		testUpURL(t, u)
+	}
+}
+
+func testRollbackURL(t *testing.T, u *url.URL) {
+	db := newTestDB(t, u)
+
+	// drop, recreate, and migrate database
+	err := db.Drop()
+	require.NoError(t, err)
+	err = db.Create()
+	require.NoError(t, err)
+	err = db.Migrate()
+	require.NoError(t, err)
+
+	// verify migration
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+
+	count := 0
+	err = sqlDB.QueryRow(`select count(*) from schema_migrations
+		where version = '20151129054053'`).Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 1, count)
+
+	// rollback
+	err = db.Rollback()
+	require.NoError(t, err)
+
+	// verify rollback
+	err = sqlDB.QueryRow("select count(*) from schema_migrations").Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 0, count)
+
+	err = sqlDB.QueryRow("select count(*) from users").Scan(&count)
+	require.NotNil(t, err)
+	require.Regexp(t, "(does not exist|doesn't exist|no such table)", err.Error())
+}
+
+func TestRollback(t *testing.T) {
+	for _, u := range testURLs(t) {
+		testRollbackURL(t, u)
+	}
+}
+
+func TestRollbackSteps(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "rollback.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	for _, name := range []string{"1_users", "2_posts", "3_comments", "4_likes"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".sql"), []byte("-- migrate:up\ncreate table "+
+			name[2:]+" (id integer);\n-- migrate:down\ndrop table "+name[2:]+";\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	err = db.Rollback()
+	require.EqualError(t, err, "can't rollback: no migrations have been applied")
+
+	err = db.Migrate()
+	require.NoError(t, err)
+
+	err = db.RollbackSteps(0)
+	require.EqualError(t, err, "invalid number of steps: 0")
+	err = db.RollbackSteps(5)
+	require.EqualError(t, err, "can't rollback 5 migrations: only 4 have been applied")
+
+	buf.Reset()
+	err = db.RollbackSteps(2)
+	require.NoError(t, err)
+	require.Equal(t, "Rolling back: 4_likes.sql\nRolling back: 3_comments.sql\n", buf.String())
+
+	err = db.RollbackTo("3")
+	require.EqualError(t, err, "can't rollback to 3: migration has not been applied")
+
+	// already at the target version
+	buf.Reset()
+	err = db.RollbackTo("2")
+	require.NoError(t, err)
+	require.Equal(t, "", buf.String())
+
+	err = db.RollbackTo("1")
+	require.NoError(t, err)
+	require.Equal(t, "Rolling back: 2_posts.sql\n", buf.String())
+
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.True(t, status[0].Applied)
+	require.False(t, status[1].Applied)
+}
+
+func TestRedo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "redo.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+
+	err = db.Redo()
+	require.EqualError(t, err, "can't redo: no migrations have been applied")
+
+	for _, name := range []string{"1_users", "2_posts"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".sql"), []byte("-- migrate:up\ncreate table "+
+			name[2:]+" (id integer);\n-- migrate:down\ndrop table "+name[2:]+";\n"), 0644)
+		require.NoError(t, err)
+	}
+	err = db.Migrate()
+	require.NoError(t, err)
+
+	// edit the latest migration
+	err = ioutil.WriteFile(filepath.Join(dir, "2_posts.sql"), []byte("-- migrate:up\n"+
+		"create table posts (id integer, title text);\n-- migrate:down\ndrop table posts;\n"), 0644)
+	require.NoError(t, err)
+
+	buf.Reset()
+	err = db.Redo()
+	require.NoError(t, err)
+	require.Equal(t, "Rolling back: 2_posts.sql\nApplying: 2_posts.sql\n", buf.String())
+
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("insert into posts (id, title) values (1, 'hello')")
+	require.NoError(t, err)
+
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.True(t, status[1].Applied)
+}
+
+func TestDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	path := filepath.Join(dir, "dry.sqlite3")
+	u, err := url.Parse("sqlite:///" + path)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.SchemaFile = filepath.Join(dir, "schema.sql")
+	db.MigrationsDir = dir
+	db.DryRun = true
+	migrations := map[string]string{
+		"1_users.sql": "-- migrate:up\ncreate table users (id integer);\n\n" +
+			"-- migrate:down\ndrop table users;\n",
+		"2_index.sql": "-- migrate:up transaction:false\ncreate index users_id on users (id);\n\n" +
+			"-- migrate:down transaction:false\ndrop index users_id;\n",
+	}
+	for name, contents := range migrations {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	// the database does not exist yet
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+	require.Equal(t, "Creating: "+path+" (dry run)\n"+
+		"Applying: 1_users.sql (dry run)\n"+
+		"begin;\n"+
+		"-- migrate:up\n"+
+		"create table users (id integer);\n"+
+		"-- record version 1 in schema_migrations\n"+
+		"commit;\n"+
+		"Applying: 2_index.sql (dry run)\n"+
+		"-- transaction disabled\n"+
+		"-- migrate:up transaction:false\n"+
+		"create index users_id on users (id);\n"+
+		"-- record version 2 in schema_migrations\n", buf.String())
+	_, err = os.Stat(path)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(db.SchemaFile)
+	require.True(t, os.IsNotExist(err))
+
+	db.DryRun = false
+	err = db.MigrateTo("1")
+	require.NoError(t, err)
+
+	// only pending migrations are printed
+	db.DryRun = true
+	buf.Reset()
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Applying: 2_index.sql (dry run)\n"+
+		"-- transaction disabled\n"+
+		"-- migrate:up transaction:false\n"+
+		"create index users_id on users (id);\n"+
+		"-- record version 2 in schema_migrations\n", buf.String())
+
+	buf.Reset()
+	err = db.Rollback()
+	require.NoError(t, err)
+	require.Equal(t, "Rolling back: 1_users.sql (dry run)\n"+
+		"begin;\n"+
+		"-- migrate:down\n"+
+		"drop table users;\n"+
+		"-- remove version 1 from schema_migrations\n"+
+		"commit;\n", buf.String())
+
+	buf.Reset()
+	err = db.Drop()
+	require.NoError(t, err)
+	require.Equal(t, "Dropping: "+path+" (dry run)\n", buf.String())
+
+	// nothing was changed
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.True(t, status[0].Applied)
+	require.False(t, status[1].Applied)
+}
+
+func TestDryRunNoTransaction(t *testing.T) {
+	var buf bytes.Buffer
+	db := New(sqliteTestURL(t))
+	db.Log = &buf
+
+	// statements which the driver can't run in a transaction disable it
+	up, _, err := parseMigrationContents("-- migrate:up\ncreate table users (id integer);\n")
+	require.NoError(t, err)
+	db.printDryRun(ddlWaitTestDriver{}, up, "record version 1 in schema_migrations")
+	require.Equal(t, "-- transaction disabled\n"+
+		"-- migrate:up\n"+
+		"create table users (id integer);\n"+
+		"-- record version 1 in schema_migrations\n", buf.String())
+
+	buf.Reset()
+	db.printDryRun(SQLiteDriver{}, up, "record version 1 in schema_migrations")
+	require.Equal(t, "begin;\n"+
+		"-- migrate:up\n"+
+		"create table users (id integer);\n"+
+		"-- record version 1 in schema_migrations\n"+
+		"commit;\n", buf.String())
+}
+
+var batchTestRegExp = regexp.MustCompile(`(?m)^GO$`)
+
+// batchTestDriver splits sqlite migrations at GO lines
+type batchTestDriver struct {
+	SQLiteDriver
+}
+
+func (drv batchTestDriver) SplitBatches(contents string) []string {
+	return batchTestRegExp.Split(contents, -1)
+}
+
+func TestExecScriptBatches(t *testing.T) {
+	drv := batchTestDriver{}
+	db := prepTestSQLiteDB(t)
+	defer mustClose(db)
+
+	rows, err := execScript(drv, db, "create table users (id integer);\nGO\n"+
+		"insert into users values (1), (2);\nGO\n"+
+		"insert into users values (3);\n")
+	require.NoError(t, err)
+	require.Equal(t, int64(3), rows)
+
+	count := 0
+	err = db.QueryRow("select count(*) from users").Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	// sqlite rejects GO when the driver does not split batches
+	_, err = execScript(SQLiteDriver{}, db, "select 1;\nGO\n")
+	require.Error(t, err)
+}
+
+func TestMigrationsTableName(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "table.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsTableName = "dbmate_versions"
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(db.MigrationsDir, 0755))
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n-- migrate:down\ndrop table users;\n"), 0644)
+	require.NoError(t, err)
+
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+
+	versions, err := queryColumn(sqlDB, "select version from dbmate_versions")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1"}, versions)
+	tables, err := queryColumn(sqlDB, "select name from sqlite_master where name = 'schema_migrations'")
+	require.NoError(t, err)
+	require.Empty(t, tables)
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	versions, err = queryColumn(sqlDB, "select version from dbmate_versions")
+	require.NoError(t, err)
+	require.Empty(t, versions)
+
+	// drivers which only support schema_migrations return an error
+	RegisterDriver(plainTestDriver{SQLiteDriver{}}, "sqlite-plain")
+	u, err = url.Parse("sqlite-plain:///" + filepath.Join(dir, "plain.sqlite3"))
+	require.NoError(t, err)
+	db = New(u)
+	db.MigrationsTableName = "dbmate_versions"
+	_, err = db.GetDriver()
+	require.EqualError(t, err, "custom migrations tables are not supported by the sqlite-plain driver")
+}
+
+// sessionTestDriver is a sqlite driver which records the session settings applied
+type sessionTestDriver struct {
+	SQLiteDriver
+	settings *[]SessionSettings
+}
+
+func (drv sessionTestDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	*drv.settings = append(*drv.settings, s)
+	return drv.SQLiteDriver.SessionSettingsSQL(s)
+}
+
+func (drv sessionTestDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	return []string{"pragma busy_timeout = 0"}
+}
+
+func TestMigrationSessionSettings(t *testing.T) {
+	settings := []SessionSettings{}
+	RegisterDriver(sessionTestDriver{settings: &settings}, "sqlite-session")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-session:///" + filepath.Join(dir, "session.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.LockTimeout = time.Second
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(db.MigrationsDir, 0755))
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up lock_timeout:2s\ncreate table users (id integer);\n"), 0644)
+	require.NoError(t, err)
+
+	// the migration setting is applied, and the session setting is restored
+	require.NoError(t, db.CreateAndMigrate())
+	require.Equal(t, []SessionSettings{
+		{LockTimeout: time.Second},
+		{LockTimeout: 2 * time.Second},
+		{LockTimeout: time.Second},
+	}, settings)
+
+	// drivers which cannot reset session settings return an error
+	u, err = url.Parse("sqlite:///" + filepath.Join(dir, "session.sqlite3"))
+	require.NoError(t, err)
+	db.DatabaseURL = u
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "2_posts.sql"),
+		[]byte("-- migrate:up lock_timeout:2s\ncreate table posts (id integer);\n"), 0644)
+	require.NoError(t, err)
+	err = db.Migrate()
+	require.EqualError(t, err, "the lock_timeout and statement_timeout options are not supported "+
+		"by the sqlite driver")
+}
+
+// delimiterTestDriver is a sqlite driver which supports the delimiter option
+type delimiterTestDriver struct {
+	SQLiteDriver
+}
+
+func (drv delimiterTestDriver) SplitDelimited(contents, delimiter string) []string {
+	return splitMySQLDelimiter(contents, delimiter)
+}
+
+func TestMigrationDelimiter(t *testing.T) {
+	RegisterDriver(delimiterTestDriver{}, "sqlite-delimiter")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-delimiter:///" + filepath.Join(dir, "delimiter.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(db.MigrationsDir, 0755))
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up delimiter:$$\ncreate table users (id integer, name text)$$\n"+
+			"create trigger users_name after insert on users begin\n"+
+			"  update users set name = trim(name) where id = new.id;\nend$$\n"), 0644)
+	require.NoError(t, err)
+
+	// statements are split at the delimiter
+	require.NoError(t, db.CreateAndMigrate())
+
+	sqlDB, err := delimiterTestDriver{}.Open(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("insert into users (id, name) values (1, '  alice ')")
+	require.NoError(t, err)
+	name := ""
+	require.NoError(t, sqlDB.QueryRow("select name from users").Scan(&name))
+	require.Equal(t, "alice", name)
+
+	// drivers which do not support the delimiter option return an error
+	u, err = url.Parse("sqlite:///" + filepath.Join(dir, "delimiter.sqlite3"))
+	require.NoError(t, err)
+	db.DatabaseURL = u
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "2_posts.sql"),
+		[]byte("-- migrate:up delimiter:$$\ncreate table posts (id integer)$$\n"), 0644)
+	require.NoError(t, err)
+	err = db.Migrate()
+	require.EqualError(t, err, "the delimiter option is not supported by the sqlite driver")
+}
+
+// lockTestDriver is a sqlite driver which records the migrations lock
+type lockTestDriver struct {
+	SQLiteDriver
+	events *[]string
+}
+
+func (drv lockTestDriver) Lock(db *sql.DB, timeout time.Duration) error {
+	*drv.events = append(*drv.events, fmt.Sprintf("lock %s", timeout))
+	return nil
+}
+
+func (drv lockTestDriver) Unlock(db *sql.DB) error {
+	*drv.events = append(*drv.events, "unlock")
+	return nil
+}
+
+func TestMigrationsLock(t *testing.T) {
+	events := []string{}
+	RegisterDriver(lockTestDriver{events: &events}, "sqlite-lock")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-lock:///" + filepath.Join(dir, "lock.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.LockTimeout = time.Second
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(db.MigrationsDir, 0755))
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n-- migrate:down\ndrop table users;\n"), 0644)
+	require.NoError(t, err)
+
+	require.NoError(t, db.CreateAndMigrate())
+	require.NoError(t, db.Rollback())
+	require.Equal(t, []string{"lock 1s", "unlock", "lock 1s", "unlock"}, events)
+
+	// the lock is not taken with NoLock, or in dry run mode
+	events = events[:0]
+	db.NoLock = true
+	require.NoError(t, db.Migrate())
+	db.NoLock = false
+	db.DryRun = true
+	require.NoError(t, db.Rollback())
+	require.Empty(t, events)
+}
+
+func TestDumpPrivileges(t *testing.T) {
+	u, err := url.Parse("sqlite:///dbmate.sqlite3")
+	require.NoError(t, err)
+	db := New(u)
+	db.DumpPrivileges = true
+	_, err = db.GetDriver()
+	require.EqualError(t, err, "dumping privileges is not supported by the sqlite driver")
+
+	u, err = url.Parse("postgres://localhost/dbmate")
+	require.NoError(t, err)
+	db = New(u)
+	db.DumpPrivileges = true
+	drv, err := db.GetDriver()
+	require.NoError(t, err)
+	require.True(t, drv.(PostgresDriver).DumpPrivileges)
+}
+
+func TestSchemas(t *testing.T) {
+	u, err := url.Parse("postgres://localhost/dbmate")
+	require.NoError(t, err)
+	db := New(u)
+	db.Schemas = []string{"app", "audit"}
+	drv, err := db.GetDriver()
+	require.NoError(t, err)
+	require.Equal(t, []string{"app", "audit"}, drv.(PostgresDriver).Schemas)
+	require.Equal(t, "app", drv.(PostgresDriver).MigrationsSchema)
+
+	// drivers without schemas return an error
+	u, err = url.Parse("sqlite:///dbmate.sqlite3")
+	require.NoError(t, err)
+	db = New(u)
+	db.Schemas = []string{"app"}
+	_, err = db.GetDriver()
+	require.EqualError(t, err, "schemas are not supported by the sqlite driver")
+}
+
+func TestDumpExcludeTables(t *testing.T) {
+	u, err := url.Parse("mysql://root@localhost/dbmate")
+	require.NoError(t, err)
+	db := New(u)
+	db.DumpExcludeTables = []string{"audit_*"}
+	drv, err := db.GetDriver()
+	require.NoError(t, err)
+	require.Equal(t, []string{"audit_*"}, drv.(MySQLDriver).DumpExcludeTables)
+
+	// drivers which cannot exclude tables return an error
+	u, err = url.Parse("sqlite:///dbmate.sqlite3")
+	require.NoError(t, err)
+	db = New(u)
+	db.DumpExcludeTables = []string{"audit_*"}
+	_, err = db.GetDriver()
+	require.EqualError(t, err, "excluding tables from the schema dump is not supported by the sqlite driver")
 }
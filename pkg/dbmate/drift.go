@@ -0,0 +1,68 @@
+package dbmate
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// DetectDrift dumps the live database schema, and returns whether it differs
+// from the schema file (for example, due to changes applied outside dbmate)
+func (db *DB) DetectDrift() (bool, error) {
+	diff, err := db.SchemaDiff()
+	if err != nil {
+		return false, err
+	}
+
+	return diff != "", nil
+}
+
+// SchemaDiff dumps the live database schema, and returns a unified diff from the
+// schema file to the live schema, or an empty string if they match
+func (db *DB) SchemaDiff() (string, error) {
+	expected, err := ioutil.ReadFile(db.SchemaFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read schema file `%s`: %s", db.SchemaFile, err)
+	}
+
+	drv, err := db.GetDriver()
+	if err != nil {
+		return "", err
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return "", err
+	}
+	defer mustClose(sqlDB)
+
+	live, err := drv.DumpSchema(db.DatabaseURL, sqlDB)
+	if err != nil {
+		return "", err
+	}
+
+	expected, live = normalizeSchema(expected), normalizeSchema(live)
+	if bytes.Equal(expected, live) {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(expected)),
+		B:        difflib.SplitLines(string(live)),
+		FromFile: db.SchemaFile,
+		ToFile:   "database",
+		Context:  3,
+	})
+}
+
+// normalizeSchema ignores line ending and trailing whitespace differences
+func normalizeSchema(schema []byte) []byte {
+	lines := bytes.Split(bytes.Replace(schema, []byte("\r\n"), []byte("\n"), -1), []byte("\n"))
+	for i, line := range lines {
+		lines[i] = bytes.TrimRight(line, " \t")
+	}
+
+	return bytes.TrimSpace(bytes.Join(lines, []byte("\n")))
+}
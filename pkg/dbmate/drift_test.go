@@ -0,0 +1,59 @@
+package dbmate
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// driftTestDriver is a sqlite driver which returns a fixed schema dump
+type driftTestDriver struct {
+	SQLiteDriver
+	schema string
+}
+
+func (drv *driftTestDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	return []byte(drv.schema), nil
+}
+
+func TestDetectDrift(t *testing.T) {
+	drv := &driftTestDriver{schema: "CREATE TABLE users (id integer);\n"}
+	RegisterDriver(drv, "sqlite-drift")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-drift:///" + filepath.Join(dir, "drift.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.SchemaFile = filepath.Join(dir, "schema.sql")
+	_, err = db.DetectDrift()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to read schema file")
+
+	err = ioutil.WriteFile(db.SchemaFile, []byte("CREATE TABLE users (id integer);  \r\n\r\n"), 0644)
+	require.NoError(t, err)
+	drifted, err := db.DetectDrift()
+	require.NoError(t, err)
+	require.False(t, drifted)
+
+	drv.schema = "CREATE TABLE users (id integer, email text);\n"
+	drifted, err = db.DetectDrift()
+	require.NoError(t, err)
+	require.True(t, drifted)
+
+	diff, err := db.SchemaDiff()
+	require.NoError(t, err)
+	require.Equal(t, "--- "+db.SchemaFile+"\n+++ database\n@@ -1 +1 @@\n"+
+		"-CREATE TABLE users (id integer);\n+CREATE TABLE users (id integer, email text);\n", diff)
+}
@@ -4,9 +4,14 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
+	"sort"
+	"time"
 )
 
-// Driver provides top level database functions
+// Driver provides top level database functions. Drivers may also implement the
+// optional methods described below (such as SplitBatches or RetryableError) to
+// support additional features; these are detected with type assertions, so
+// drivers outside of this package only need to declare the same methods.
 type Driver interface {
 	Open(*url.URL) (*sql.DB, error)
 	DatabaseExists(*url.URL) (bool, error)
@@ -20,11 +25,116 @@ type Driver interface {
 	Ping(*url.URL) error
 }
 
-var drivers = map[string]Driver{}
+// DriverFunc returns a driver. It is called each time the driver for a URL
+// scheme is loaded.
+type DriverFunc func() Driver
+
+var drivers = map[string]DriverFunc{}
 
 // RegisterDriver registers a driver for a URL scheme
 func RegisterDriver(drv Driver, scheme string) {
-	drivers[scheme] = drv
+	RegisterDriverFunc(scheme, func() Driver {
+		return drv
+	})
+}
+
+// RegisterDriverFunc registers a driver factory for a URL scheme, replacing any
+// driver already registered for the scheme. Drivers outside of this package
+// (including those loaded as Go plugins) should call it from an init function.
+func RegisterDriverFunc(scheme string, factory DriverFunc) {
+	if factory == nil {
+		panic("dbmate: RegisterDriverFunc factory is nil")
+	}
+
+	drivers[scheme] = factory
+}
+
+// DriverInfo describes a registered driver, to help debug connection problems
+type DriverInfo struct {
+	Scheme string `json:"scheme"`
+	// SchemaDump is whether the driver can write the schema file
+	SchemaDump bool `json:"schema_dump"`
+	// Binaries are the external commands run by the driver, for example to dump
+	// the schema or open a console
+	Binaries []string `json:"binaries"`
+	// URLOptions are the query string options understood in the database URL
+	URLOptions []string `json:"url_options"`
+	// Features are the optional features supported by the driver
+	Features []string `json:"features"`
+}
+
+// Drivers describes the registered drivers, ordered by scheme
+func Drivers() []DriverInfo {
+	infos := []DriverInfo{}
+	for scheme, factory := range drivers {
+		drv := factory()
+		info := DriverInfo{SchemaDump: true}
+		if infoDrv, ok := drv.(infoDriver); ok {
+			info = infoDrv.Info()
+		}
+		info.Scheme = scheme
+		info.Features = driverFeatures(drv)
+		infos = append(infos, info)
+	}
+
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Scheme < infos[j].Scheme
+	})
+
+	return infos
+}
+
+// driverFeatures lists the optional driver interfaces implemented by drv
+func driverFeatures(drv Driver) []string {
+	features := []string{}
+	add := func(name string, ok bool) {
+		if ok {
+			features = append(features, name)
+		}
+	}
+
+	_, ok := drv.(backupDriver)
+	add("backup", ok)
+	_, ok = drv.(checksumDriver)
+	add("checksums", ok)
+	_, ok = drv.(metadataDriver)
+	add("migration metadata", ok)
+	_, ok = drv.(retryDriver)
+	add("lock retries", ok)
+	_, ok = drv.(runsDriver)
+	add("migration runs", ok)
+	_, ok = drv.(onlineSchemaChangeDriver)
+	add("online schema changes", ok)
+	_, ok = drv.(replicationLagDriver)
+	add("replication lag", ok)
+	_, ok = drv.(blockerDriver)
+	add("blockers", ok)
+	_, ok = drv.(tenantDriver)
+	add("tenants", ok)
+	_, ok = drv.(migrationsTableDriver)
+	add("migrations table", ok)
+	_, ok = drv.(schemasDriver)
+	add("schemas", ok)
+	_, ok = drv.(dumpExcludeDriver)
+	add("dump exclude tables", ok)
+	_, ok = drv.(privilegesDriver)
+	add("dump privileges", ok)
+	_, ok = drv.(pragmasDriver)
+	add("pragmas", ok)
+	_, ok = drv.(lockDriver)
+	add("migrations lock", ok)
+	_, ok = drv.(copyDriver)
+	add("copy from stdin", ok)
+	_, ok = drv.(errorPositionDriver)
+	add("error positions", ok)
+	_, ok = drv.(delimiterDriver)
+	add("delimiter", ok)
+	_, ok = drv.(sessionSettingsDriver)
+	add("session settings", ok)
+	_, ok = drv.(consoleDriver)
+	add("console", ok)
+
+	return features
 }
 
 // Transaction can represent a database or open transaction
@@ -32,10 +142,232 @@ type Transaction interface {
 	Exec(query string, args ...interface{}) (sql.Result, error)
 }
 
+// SessionSettings contains session-level timeouts applied to the migration connection
+type SessionSettings struct {
+	LockTimeout              time.Duration
+	StatementTimeout         time.Duration
+	IdleInTransactionTimeout time.Duration
+}
+
+// IsZero returns true if no session settings are specified
+func (s SessionSettings) IsZero() bool {
+	return s == SessionSettings{}
+}
+
+// infoDriver is implemented by drivers which describe their requirements
+type infoDriver interface {
+	// Info describes the driver (the scheme and features are filled in by Drivers)
+	Info() DriverInfo
+}
+
+// backupDriver is implemented by drivers which can back up and restore a database
+type backupDriver interface {
+	// Backup writes a backup of the database (or only its schema) to path
+	Backup(u *url.URL, path string, schemaOnly bool) error
+	// Restore replaces the database contents with a backup written by Backup
+	Restore(u *url.URL, path string) error
+}
+
+// retryDriver is implemented by drivers which can retry migrations that fail
+// due to lock contention
+type retryDriver interface {
+	// RetryableError returns whether an error was caused by a lock timeout or deadlock
+	RetryableError(error) bool
+	// PrepareRetry cleans up after a failed migration which ran outside of a
+	// transaction, before it is retried
+	PrepareRetry(*sql.DB, string) error
+	// LockTimeoutSQL returns statements to set and reset the session lock timeout
+	LockTimeoutSQL(time.Duration) (string, string)
+}
+
+// autoRetryDriver is implemented by drivers which retry migrations that fail
+// with a retryable error even when the retry option is not set
+type autoRetryDriver interface {
+	// AutoRetries returns the number of times a migration is retried by default
+	AutoRetries() int
+}
+
+// noTransactionDriver is implemented by drivers which can't run some statements
+// inside a transaction
+type noTransactionDriver interface {
+	// NoTransaction returns whether migration contents must run outside of a transaction
+	NoTransaction(contents string) bool
+}
+
+// transactionCheckDriver is implemented by drivers which refuse to run migrations
+// inside a transaction if they include statements which can't run in one, rather
+// than silently running the whole migration outside of a transaction
+type transactionCheckDriver interface {
+	// NoTransactionStatement returns the first statement of the migration contents
+	// which can't run inside a transaction, or an empty string
+	NoTransactionStatement(contents string) string
+}
+
+// ddlWaitDriver is implemented by drivers which run DDL asynchronously
+type ddlWaitDriver interface {
+	// WaitForDDL waits for running DDL jobs to finish
+	WaitForDDL(*sql.DB) error
+}
+
+// checksumDriver is implemented by drivers which record the checksum of each
+// migration file when it is applied
+type checksumDriver interface {
+	// CreateChecksumsTable adds the checksum column to the migrations table, and
+	// creates the schema_migration_checksums table of repeatable migrations, if
+	// they do not exist
+	CreateChecksumsTable(*sql.DB) error
+	// SelectMigrationChecksums returns the checksums in the migrations table by
+	// version, for applied migrations (none if the table has no checksum column)
+	SelectMigrationChecksums(*sql.DB) (map[string]string, error)
+	// InsertChecksum records the checksum of an applied migration in the
+	// migrations table
+	InsertChecksum(db Transaction, version, checksum string) error
+	// SelectRepeatableChecksums returns the checksums of the repeatable migrations
+	// by name, as they were last applied
+	SelectRepeatableChecksums(*sql.DB) (map[string]string, error)
+	// InsertRepeatableChecksum replaces the checksum of an applied repeatable
+	// migration
+	InsertRepeatableChecksum(db Transaction, name, checksum string) error
+}
+
+// replicationLagDriver is implemented by drivers which can report replication lag
+type replicationLagDriver interface {
+	// ReplicationLag returns the lag of a replica, or of the most lagged replica
+	// when connected to a primary
+	ReplicationLag(*sql.DB) (time.Duration, error)
+}
+
+// blockerDriver is implemented by drivers which can find sessions that may block
+// a migration
+type blockerDriver interface {
+	// Blockers returns sessions which hold locks on any of the tables, or have a
+	// transaction open for longer than maxAge
+	Blockers(db *sql.DB, tables []string, maxAge time.Duration) ([]Blocker, error)
+}
+
+// migrationsExistDriver is implemented by drivers which can check whether the
+// migrations table exists, so that commands which only read the database don't
+// need to create it
+type migrationsExistDriver interface {
+	// MigrationsTableExists returns whether the migrations table exists
+	MigrationsTableExists(*sql.DB) (bool, error)
+}
+
+// migrationsTableDriver is implemented by drivers which can track applied
+// migrations in a table other than schema_migrations
+type migrationsTableDriver interface {
+	// MigrationsTable returns a driver which tracks migrations in the named table,
+	// which may be qualified with a schema (or database)
+	MigrationsTable(name string) Driver
+}
+
+// schemasDriver is implemented by drivers which can migrate and dump a list of
+// schemas
+type schemasDriver interface {
+	// WithSchemas returns a driver which uses the given schemas
+	WithSchemas(schemas []string) Driver
+}
+
+// dumpExcludeDriver is implemented by drivers which can leave tables out of the
+// schema dump
+type dumpExcludeDriver interface {
+	// ExcludeTables returns a driver which does not dump tables matching the
+	// patterns (which may be qualified with a schema, and use * and ? wildcards)
+	ExcludeTables(patterns []string) Driver
+}
+
+// pragmasDriver is implemented by drivers which can apply PRAGMAs to every
+// connection
+type pragmasDriver interface {
+	// WithPragmas returns a driver which applies the PRAGMAs (name=value)
+	WithPragmas(pragmas []string) Driver
+}
+
+// privilegesDriver is implemented by drivers which can include grants and
+// ownership in the schema dump
+type privilegesDriver interface {
+	// WithPrivileges returns a driver which dumps grants and ownership
+	WithPrivileges() Driver
+}
+
+// tenantDriver is implemented by drivers which can migrate each tenant (a schema
+// or database) of a multi-tenant database separately
+type tenantDriver interface {
+	// Tenant returns the driver and URL used to migrate a tenant
+	Tenant(u *url.URL, tenant string) (Driver, *url.URL)
+}
+
+// sessionSettingsDriver is implemented by drivers which support session settings
+type sessionSettingsDriver interface {
+	// SessionSettingsSQL returns the statements required to apply session settings,
+	// or an error if any of the settings are not supported
+	SessionSettingsSQL(SessionSettings) ([]string, error)
+}
+
+// sessionResetDriver is implemented by drivers which can reset session settings,
+// so that they can be applied to a single migration
+type sessionResetDriver interface {
+	// ResetSessionSettingsSQL returns the statements which reset the given
+	// session settings to their defaults
+	ResetSessionSettingsSQL(SessionSettings) []string
+}
+
+// consoleDriver is implemented by drivers which can open an interactive shell
+type consoleDriver interface {
+	// ConsoleCommand returns the shell command and arguments to connect to the database
+	ConsoleCommand(u *url.URL) (string, []string)
+}
+
+// batchDriver is implemented by drivers which run migrations as several batches
+type batchDriver interface {
+	// SplitBatches splits SQL into batches which are executed separately
+	SplitBatches(contents string) []string
+}
+
+// statementDriver is implemented by drivers whose SQL is split into statements
+// differently from the standard, such as MySQL, in which backslashes escape quotes
+type statementDriver interface {
+	// SplitStatements splits SQL into statements, including any preceding comments
+	SplitStatements(contents string) []string
+}
+
+// delimiterDriver is implemented by drivers which support the DELIMITER command
+// of the mysql client, to create routines containing semicolons
+type delimiterDriver interface {
+	// SplitDelimited splits SQL into batches, starting with a statement delimiter
+	SplitDelimited(contents, delimiter string) []string
+}
+
+// lockDriver is implemented by drivers which can hold a lock (such as a Postgres
+// advisory lock) so that concurrent migrate and rollback commands run one at a time
+type lockDriver interface {
+	// Lock acquires the migrations lock on a connection, waiting for up to
+	// timeout (or indefinitely if zero)
+	Lock(db *sql.DB, timeout time.Duration) error
+	// Unlock releases the migrations lock
+	Unlock(db *sql.DB) error
+}
+
+// copyDriver is implemented by drivers which load the inline data of COPY FROM
+// stdin statements (as written by pg_dump) in migrations
+type copyDriver interface {
+	// ExecCopy runs a batch starting with a COPY FROM stdin statement, and returns
+	// the number of rows loaded, or false if the batch is not a COPY
+	ExecCopy(tx Transaction, batch string) (int64, bool, error)
+}
+
+// errorPositionDriver is implemented by drivers whose errors report the position
+// in a query at which they occurred
+type errorPositionDriver interface {
+	// ErrorPosition returns the byte offset in query at which err occurred, or
+	// false if err has no position
+	ErrorPosition(err error, query string) (int, bool)
+}
+
 // GetDriver loads a database driver by name
 func GetDriver(name string) (Driver, error) {
-	if val, ok := drivers[name]; ok {
-		return val, nil
+	if factory, ok := drivers[name]; ok {
+		return factory(), nil
 	}
 
 	return nil, fmt.Errorf("unsupported driver: %s", name)
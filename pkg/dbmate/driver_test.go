@@ -1,6 +1,7 @@
 package dbmate
 
 import (
+	"sort"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -25,3 +26,53 @@ func TestGetDriver_Error(t *testing.T) {
 	require.EqualError(t, err, "unsupported driver: foo")
 	require.Nil(t, drv)
 }
+
+func TestDrivers(t *testing.T) {
+	// other tests register fake drivers
+	infos := map[string]DriverInfo{}
+	schemes := []string{}
+	for _, info := range Drivers() {
+		infos[info.Scheme] = info
+		schemes = append(schemes, info.Scheme)
+	}
+	require.True(t, sort.StringsAreSorted(schemes))
+
+	pg := infos["postgres"]
+	require.True(t, pg.SchemaDump)
+	require.Contains(t, pg.Binaries, "pg_dump")
+	require.Contains(t, pg.URLOptions, "sslmode")
+	require.Contains(t, pg.Features, "tenants")
+	require.Equal(t, pg.Binaries, infos["postgresql"].Binaries)
+
+	sqlite := infos["sqlite"]
+	require.Equal(t, []string{"sqlite3"}, sqlite.Binaries)
+	require.Contains(t, sqlite.URLOptions, "foreign_keys")
+	require.NotContains(t, sqlite.Features, "tenants")
+	require.Contains(t, sqlite.Features, "console")
+}
+
+// pluginTestDriver is a sqlite driver registered with a factory
+type pluginTestDriver struct {
+	SQLiteDriver
+	id int
+}
+
+func TestRegisterDriverFunc(t *testing.T) {
+	calls := 0
+	RegisterDriverFunc("sqlite-plugin", func() Driver {
+		calls++
+		return pluginTestDriver{id: calls}
+	})
+
+	drv, err := GetDriver("sqlite-plugin")
+	require.NoError(t, err)
+	require.Equal(t, pluginTestDriver{id: 1}, drv)
+
+	drv, err = GetDriver("sqlite-plugin")
+	require.NoError(t, err)
+	require.Equal(t, pluginTestDriver{id: 2}, drv)
+
+	require.Panics(t, func() {
+		RegisterDriverFunc("sqlite-plugin", nil)
+	})
+}
@@ -0,0 +1,94 @@
+package dbmate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// dryRunApplied returns the applied migrations without modifying the database.
+// A database which does not exist yet (or has no schema_migrations table) has no
+// applied migrations.
+func (db *DB) dryRunApplied(drv Driver) (map[string]bool, error) {
+	exists, err := drv.DatabaseExists(db.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return map[string]bool{}, nil
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(sqlDB)
+
+	applied, err := drv.SelectMigrations(sqlDB, -1)
+	if err != nil {
+		// the schema_migrations table is created by the first migration
+		return map[string]bool{}, nil
+	}
+
+	return applied, nil
+}
+
+// dryRunChecksums returns the recorded repeatable migration checksums without
+// modifying the database, or none if the database or checksums table does not exist
+func (db *DB) dryRunChecksums(drv Driver) map[string]string {
+	checksumDrv, ok := drv.(checksumDriver)
+	if !ok {
+		return map[string]string{}
+	}
+
+	exists, err := drv.DatabaseExists(db.DatabaseURL)
+	if err != nil || !exists {
+		return map[string]string{}
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return map[string]string{}
+	}
+	defer mustClose(sqlDB)
+
+	recorded, err := checksumDrv.SelectRepeatableChecksums(sqlDB)
+	if err != nil {
+		return map[string]string{}
+	}
+
+	return recorded
+}
+
+// printDryRun prints the statements which a migration would run, including
+// transaction boundaries, followed by a comment describing the record change.
+// Transactions are decided as by execMigration, so statements which the driver
+// can't run in a transaction disable it.
+func (db *DB) printDryRun(drv Driver, m Migration, record string) {
+	tool := db.onlineTool(m)
+	batched := m.Options.BatchSize() > 0
+	transaction := migrationTransaction(drv, m) && tool == "" && !batched
+
+	switch {
+	case tool != "":
+		fmt.Fprintf(db.Log, "-- run with %s\n", tool)
+	case batched:
+		fmt.Fprintf(db.Log, "-- repeat in batches of %d until fewer rows are affected", m.Options.BatchSize())
+		if m.Options.Transaction() {
+			fmt.Fprint(db.Log, ", each in a transaction")
+		}
+		fmt.Fprintln(db.Log)
+	case !transaction:
+		fmt.Fprintln(db.Log, "-- transaction disabled")
+	}
+
+	if transaction {
+		fmt.Fprintln(db.Log, "begin;")
+	}
+	if contents := strings.TrimSpace(m.Contents); contents != "" {
+		fmt.Fprintln(db.Log, contents)
+	}
+	fmt.Fprintf(db.Log, "-- %s\n", record)
+	if transaction {
+		fmt.Fprintln(db.Log, "commit;")
+	}
+}
@@ -0,0 +1,158 @@
+package dbmate
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// StatementError is returned when a statement of a migration fails, and reports
+// where the statement is in the migration file
+type StatementError struct {
+	Filename string
+	// Statement is the index of the failed statement in the migration block,
+	// counting from 1, or 0 if the failure can't be narrowed down to a statement
+	Statement int
+	// Line is the line of the migration file at which the error occurred, or on
+	// which the failed statements start if the driver does not report a position
+	Line int
+	// Column is the column at which the error occurred, if reported by the driver
+	Column int
+	// Query is the text of the failed statement, if it was narrowed down
+	Query string
+	Err   error
+}
+
+// Error implements error
+func (e *StatementError) Error() string {
+	location := fmt.Sprintf("line %d", e.Line)
+	if e.Column > 0 {
+		location += fmt.Sprintf(", column %d", e.Column)
+	}
+
+	if e.Statement > 0 {
+		location = fmt.Sprintf("statement %d, %s", e.Statement, location)
+	}
+
+	return fmt.Sprintf("%s: %s: %s", e.Filename, location, e.Err)
+}
+
+// Unwrap returns the driver error
+func (e *StatementError) Unwrap() error {
+	return e.Err
+}
+
+// statementError locates the error of a failed batch within a migration. When a
+// batch contains several statements and the driver does not report a position,
+// the error is located at the start of the batch. If the batch can't be found,
+// the error is located at the start of the migration block.
+func statementError(drv Driver, m Migration, batches []string, failed int, filename string,
+	err error) error {
+	line := m.Line
+	if line == 0 {
+		line = 1
+	}
+
+	// find where the batch starts in the migration, since drivers may remove
+	// delimiters and batch separators
+	start, next := 0, 0
+	for _, batch := range batches[:failed+1] {
+		trimmed := strings.TrimSpace(batch)
+		index := strings.Index(m.Contents[next:], trimmed)
+		if index < 0 {
+			return &StatementError{Filename: filename, Line: line, Err: err}
+		}
+		start = next + index
+		next = start + len(trimmed)
+	}
+	batch := batches[failed]
+	leading := len(batch) - len(strings.TrimLeft(batch, " \t\r\n"))
+
+	offset, column := 0, 0
+	if positionDrv, ok := drv.(errorPositionDriver); ok {
+		if position, ok := positionDrv.ErrorPosition(err, batch); ok {
+			if position > leading {
+				offset = position - leading
+			}
+			offset += start
+			lineStart := strings.LastIndex(m.Contents[:offset], "\n") + 1
+			column = utf8.RuneCountInString(m.Contents[lineStart:offset]) + 1
+		}
+	}
+	statements := driverStatements(drv, m.Contents)
+	if column == 0 {
+		offset = start + statementStart(strings.TrimSpace(batch))
+		if countStatements(driverStatements(drv, batch)) != 1 {
+			return &StatementError{
+				Filename: filename,
+				Line:     line + strings.Count(m.Contents[:offset], "\n"),
+				Err:      err,
+			}
+		}
+	}
+
+	// count the statements up to the one containing the error
+	statement, end, query := 0, 0, ""
+	for _, stmt := range statements {
+		if strings.TrimSpace(trimSQLComments(stmt)) != "" {
+			statement++
+		}
+		if end += len(stmt); end > offset {
+			// without a position, the offset is at the start of the statement,
+			// after any batch separator
+			query = strings.TrimSpace(stmt)
+			if column == 0 {
+				query = strings.TrimSpace(m.Contents[offset:end])
+			}
+			query = strings.TrimSuffix(query[statementStart(query):], ";")
+			break
+		}
+	}
+	if statement == 0 {
+		statement = 1
+	}
+
+	return &StatementError{
+		Filename:  filename,
+		Statement: statement,
+		Line:      line + strings.Count(m.Contents[:offset], "\n"),
+		Column:    column,
+		Query:     query,
+		Err:       err,
+	}
+}
+
+// driverStatements splits SQL into statements the way the driver does
+func driverStatements(drv Driver, contents string) []string {
+	if stmtDrv, ok := drv.(statementDriver); ok {
+		return stmtDrv.SplitStatements(contents)
+	}
+
+	return schemaStatements(contents)
+}
+
+// countStatements returns the number of statements which are not only comments
+func countStatements(statements []string) int {
+	count := 0
+	for _, stmt := range statements {
+		if strings.TrimSpace(trimSQLComments(stmt)) != "" {
+			count++
+		}
+	}
+
+	return count
+}
+
+// statementStart returns the offset of a statement after any preceding blank
+// lines and comments
+func statementStart(stmt string) int {
+	offset := 0
+	for _, line := range strings.SplitAfter(stmt, "\n") {
+		if !isEmptyLine(line) && !isCommentLine(line) {
+			return offset + len(line) - len(strings.TrimLeft(line, " \t"))
+		}
+		offset += len(line)
+	}
+
+	return 0
+}
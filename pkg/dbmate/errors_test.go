@@ -0,0 +1,135 @@
+package dbmate
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// positionTestDriver reports errors at a fixed offset of each query
+type positionTestDriver struct {
+	SQLiteDriver
+	position int
+}
+
+func (drv positionTestDriver) ErrorPosition(err error, query string) (int, bool) {
+	return drv.position, drv.position >= 0
+}
+
+func TestStatementError(t *testing.T) {
+	contents := "-- migrate:up\ncreate table users (id integer);\n\n-- posts\n" +
+		"create table posts (\n  id integer,\n  title ñame\n);\nGO\ninsert into posts values (1);\n"
+	m := NewMigration()
+	m.Contents = contents
+	m.Line = 3
+	driverErr := errors.New("syntax error")
+
+	t.Run("single statement batches", func(t *testing.T) {
+		drv := batchTestDriver{}
+		batches := scriptBatches(drv, contents)
+		require.Len(t, batches, 2)
+
+		err := statementError(drv, m, batches, 1, "001_posts.sql", driverErr)
+		require.EqualError(t, err, "001_posts.sql: statement 3, line 12: syntax error")
+		stmtErr, ok := err.(*StatementError)
+		require.True(t, ok)
+		require.Equal(t, 3, stmtErr.Statement)
+		require.Equal(t, 0, stmtErr.Column)
+		require.Equal(t, "insert into posts values (1)", stmtErr.Query)
+		require.True(t, errors.Is(err, driverErr))
+	})
+
+	t.Run("mysql multi-statement migration", func(t *testing.T) {
+		drv := MySQLDriver{}
+		m := NewMigration()
+		m.Contents = "-- migrate:up\ncreate table users (id int);\n" +
+			"-- the name may contain ; and \\'\ninsert into users values (1, 'it\\'s; fine');\n" +
+			"insert into missing values (1);\n"
+		m.Line = 1
+		batches := scriptBatches(drv, m.Contents)
+		require.Len(t, batches, 3)
+
+		err := statementError(drv, m, batches, 2, "001_users.sql", driverErr)
+		require.EqualError(t, err, "001_users.sql: statement 3, line 5: syntax error")
+		require.Equal(t, "insert into missing values (1)", err.(*StatementError).Query)
+
+		err = statementError(drv, m, batches, 1, "001_users.sql", driverErr)
+		require.EqualError(t, err, "001_users.sql: statement 2, line 4: syntax error")
+		require.Equal(t, "insert into users values (1, 'it\\'s; fine')", err.(*StatementError).Query)
+	})
+
+	t.Run("several statements without a position", func(t *testing.T) {
+		drv := batchTestDriver{}
+		// the error is located at the start of the batch
+		err := statementError(drv, m, scriptBatches(drv, contents), 0, "001_posts.sql", driverErr)
+		require.EqualError(t, err, "001_posts.sql: line 4: syntax error")
+		require.Equal(t, 0, err.(*StatementError).Statement)
+	})
+
+	t.Run("driver position", func(t *testing.T) {
+		// the position of "ñame", counted in bytes of the batch
+		position := len("-- migrate:up\ncreate table users (id integer);\n\n-- posts\n" +
+			"create table posts (\n  id integer,\n  title ")
+		drv := positionTestDriver{position: position}
+		err := statementError(drv, m, []string{contents}, 0, "001_posts.sql", driverErr)
+		require.EqualError(t, err, "001_posts.sql: statement 2, line 9, column 9: syntax error")
+	})
+
+	t.Run("batch not found", func(t *testing.T) {
+		drv := positionTestDriver{position: 0}
+		err := statementError(drv, m, []string{"select 1"}, 0, "001_posts.sql", driverErr)
+		require.EqualError(t, err, "001_posts.sql: line 3: syntax error")
+	})
+}
+
+func TestStatementStart(t *testing.T) {
+	require.Equal(t, 0, statementStart("select 1"))
+	require.Equal(t, 19, statementStart("-- migrate:up\n\n    select 1"))
+	require.Equal(t, 0, statementStart("-- comment\n"))
+}
+
+func TestMigrateStatementError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "errors.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+
+	err = ioutil.WriteFile(filepath.Join(dir, "001_users.sql"), []byte("-- migrate:transaction true\n\n"+
+		"-- migrate:up\n-- missing table\ninsert into users values (1);\n\n-- migrate:down\n"), 0644)
+	require.NoError(t, err)
+
+	err = db.CreateAndMigrate()
+	require.Error(t, err)
+	stmtErr, ok := err.(*StatementError)
+	require.True(t, ok, err.Error())
+	require.Equal(t, "001_users.sql", stmtErr.Filename)
+	require.Equal(t, 1, stmtErr.Statement)
+	require.Equal(t, 5, stmtErr.Line)
+	require.Contains(t, err.Error(), "001_users.sql: statement 1, line 5: ")
+	require.Contains(t, err.Error(), "no such table: users")
+
+	// sqlite runs the whole block at once, so the error is located at its start
+	err = ioutil.WriteFile(filepath.Join(dir, "001_users.sql"), []byte("-- migrate:up\n"+
+		"create table users (id integer);\ninsert into posts values (1);\n"), 0644)
+	require.NoError(t, err)
+
+	err = db.Migrate()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "001_users.sql: line 2: ")
+	require.Contains(t, err.Error(), "no such table: posts")
+}
@@ -0,0 +1,47 @@
+package dbmate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExecSQL runs ad-hoc SQL against the database, using the same connection
+// handling and session settings as migrations. The statements run inside a
+// transaction if transaction is set. Nothing is recorded in schema_migrations.
+func (db *DB) ExecSQL(name, contents string, transaction bool) error {
+	if strings.TrimSpace(trimSQLComments(contents)) == "" {
+		return fmt.Errorf("no SQL to execute in %s", name)
+	}
+
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	if err := db.waitBefore(); err != nil {
+		return err
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	if err := db.applySessionSettings(drv, sqlDB); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(db.Log, "Executing: %s\n", name)
+	db.logSQL(contents)
+
+	if !transaction {
+		_, err = execScript(drv, sqlDB, contents)
+		return err
+	}
+
+	return doTransaction(sqlDB, func(tx Transaction) error {
+		_, err := execScript(drv, tx, contents)
+		return err
+	})
+}
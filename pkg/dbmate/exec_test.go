@@ -0,0 +1,54 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExecSQL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "exec.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+
+	err = db.ExecSQL("empty.sql", "-- nothing here\n", true)
+	require.EqualError(t, err, "no SQL to execute in empty.sql")
+
+	err = db.ExecSQL("users.sql", "create table users (id integer); insert into users values (1);", true)
+	require.NoError(t, err)
+	require.Equal(t, "Executing: users.sql\n", buf.String())
+
+	// a failure rolls back the transaction
+	err = db.ExecSQL("stdin", "insert into users values (2); insert into missing values (1);", true)
+	require.EqualError(t, err, "no such table: missing")
+
+	// without a transaction, earlier statements are kept
+	err = db.ExecSQL("stdin", "insert into users values (3); insert into missing values (1);", false)
+	require.EqualError(t, err, "no such table: missing")
+
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	ids, err := queryColumn(sqlDB, "select id from users order by id")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "3"}, ids)
+
+	// schema_migrations is not created
+	_, err = sqlDB.Exec("select * from schema_migrations")
+	require.Error(t, err)
+}
@@ -0,0 +1,35 @@
+package dbmate
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+)
+
+// fsPath returns the path of a file within DB.FS, which is slash separated and
+// has no leading ./ (e.g. db/migrations for ./db/migrations)
+func fsPath(name string) string {
+	return path.Clean(filepath.ToSlash(name))
+}
+
+// readFile reads a migration file from DB.FS, or from the OS filesystem if no
+// FS is set
+func (db *DB) readFile(name string) ([]byte, error) {
+	if db.FS == nil {
+		return ioutil.ReadFile(name)
+	}
+
+	return fs.ReadFile(db.FS, fsPath(name))
+}
+
+// readDir reads a migrations directory from DB.FS, or from the OS filesystem
+// if no FS is set
+func (db *DB) readDir(dir string) ([]fs.DirEntry, error) {
+	if db.FS == nil {
+		return os.ReadDir(dir)
+	}
+
+	return fs.ReadDir(db.FS, fsPath(dir))
+}
@@ -0,0 +1,68 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFSPath(t *testing.T) {
+	require.Equal(t, "db/migrations", fsPath("./db/migrations"))
+	require.Equal(t, "db/migrations/001_users.sql", fsPath(filepath.Join("./db/migrations", "001_users.sql")))
+	require.Equal(t, "db/shared/002_posts.sql", fsPath(filepath.Join("db/migrations", "../shared/002_posts.sql")))
+}
+
+func TestMigrateFS(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	path := filepath.Join(dir, "fs.sqlite3")
+	u, err := url.Parse("sqlite:///" + path)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = "embedded/migrations"
+	db.FS = fstest.MapFS{
+		"embedded/migrations/001_create_users.sql": {Data: []byte("-- migrate:up\n" +
+			"create table users (id integer);\n-- migrate:down\ndrop table users;\n")},
+		"embedded/migrations/data/002_insert_users.sql": {Data: []byte("-- migrate:up\n" +
+			"insert into users (id) values (1);\n-- migrate:down\ndelete from users;\n")},
+	}
+
+	// the migrations directory is only read from FS
+	_, err = os.Stat(db.MigrationsDir)
+	require.True(t, os.IsNotExist(err))
+
+	err = db.CreateAndMigrate()
+	require.NoError(t, err)
+	require.Equal(t, "Creating: "+path+"\nApplying: 001_create_users.sql\nApplying: "+
+		filepath.Join("data", "002_insert_users.sql")+"\n", buf.String())
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	require.True(t, status[0].Applied)
+	require.False(t, status[1].Applied)
+
+	err = db.NewMigration("create_posts")
+	require.EqualError(t, err, "migrations can't be created in DB.FS")
+
+	db.MigrationsDir = "./missing"
+	err = db.Migrate()
+	require.EqualError(t, err, "could not find migrations directory `./missing`")
+}
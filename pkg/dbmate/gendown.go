@@ -0,0 +1,195 @@
+package dbmate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// identifier matches a table, index, or column name, which may be quoted and
+// qualified with a schema
+const identifier = "([\\w.\"`]+)"
+
+// inversions map simple DDL statements to the statements which undo them. Each
+// replacement is expanded with the submatches of its regular expression.
+var inversions = []struct {
+	re      *regexp.Regexp
+	inverse string
+}{
+	{regexp.MustCompile(`(?is)^create\s+table\s+(?:if\s+not\s+exists\s+)?` + identifier + `\s*\(`),
+		"drop table $1"},
+	{regexp.MustCompile(`(?is)^create\s+(?:unique\s+)?index\s+concurrently\s+(?:if\s+not\s+exists\s+)?` +
+		identifier + `\s+on\s`), "drop index concurrently $1"},
+	{regexp.MustCompile(`(?is)^create\s+(?:unique\s+)?index\s+(?:if\s+not\s+exists\s+)?` + identifier +
+		`\s+on\s+` + identifier), "drop index $1"},
+	{regexp.MustCompile(`(?is)^create\s+(materialized\s+view|view|sequence|schema|type|extension)\s+` +
+		`(?:if\s+not\s+exists\s+)?` + identifier), "drop $1 $2"},
+	{regexp.MustCompile(`(?is)^alter\s+table\s+` + identifier + `\s+add\s+constraint\s+` + identifier + `\s`),
+		"alter table $1 drop constraint $2"},
+	{regexp.MustCompile(`(?is)^alter\s+table\s+` + identifier + `\s+add\s+(?:column\s+)?(?:if\s+not\s+exists\s+)?` +
+		identifier + `\s`), "alter table $1 drop column $2"},
+	{regexp.MustCompile(`(?is)^alter\s+table\s+` + identifier + `\s+rename\s+column\s+` + identifier +
+		`\s+to\s+` + identifier + `$`), "alter table $1 rename column $3 to $2"},
+	{regexp.MustCompile(`(?is)^alter\s+table\s+` + identifier + `\s+rename\s+to\s+` + identifier + `$`),
+		"alter table $2 rename to $1"},
+}
+
+// unnamedConstraintRegExp matches the keywords which follow ADD in an ALTER TABLE
+// statement adding a constraint or index without naming it
+var unnamedConstraintRegExp = regexp.MustCompile(`(?i)^(primary|foreign|unique|check|index|key|exclude)$`)
+
+// mysqlIndexRegExp matches a create index statement, which is inverted on MySQL
+// by a drop index statement naming the table
+var mysqlIndexRegExp = regexp.MustCompile(`(?is)^create\s+(?:unique\s+)?index\s+` + identifier +
+	`\s+on\s+` + identifier)
+
+// invertStatement returns the statement which undoes a DDL statement, or false
+// if the statement can't be inverted (for example an ALTER TABLE with several
+// clauses, or a data change)
+func invertStatement(stmt, scheme string) (string, bool) {
+	stmt = strings.TrimSuffix(strings.TrimSpace(trimSQLComments(stmt)), ";")
+
+	// MySQL indexes belong to their table
+	if match := mysqlIndexRegExp.FindStringSubmatch(stmt); match != nil &&
+		(driverMatches("mysql", scheme) || driverMatches("mariadb", scheme) || driverMatches("tidb", scheme)) {
+		return fmt.Sprintf("drop index %s on %s", match[1], match[2]), true
+	}
+
+	for _, inversion := range inversions {
+		match := inversion.re.FindStringSubmatchIndex(stmt)
+		if match == nil {
+			continue
+		}
+		// alter table statements with several clauses are not inverted, nor are
+		// table constraints added without a name (e.g. add primary key)
+		if alterTableRegExp.MatchString(stmt) && hasTopLevelComma(stmt) {
+			return "", false
+		}
+		inverse := string(inversion.re.ExpandString(nil, inversion.inverse, stmt, match))
+		if fields := strings.Fields(inverse); len(fields) > 5 && fields[4] == "column" &&
+			unnamedConstraintRegExp.MatchString(fields[5]) {
+			return "", false
+		}
+
+		return whitespaceRegExp.ReplaceAllString(inverse, " "), true
+	}
+
+	return "", false
+}
+
+// hasTopLevelComma returns whether a statement contains a comma outside of
+// parentheses and quotes, such as between the clauses of an ALTER TABLE
+func hasTopLevelComma(stmt string) bool {
+	depth := 0
+	quote := rune(0)
+	for _, c := range stmt {
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ',' && depth == 0:
+			return true
+		}
+	}
+
+	return false
+}
+
+// GenerateDown writes the down block of a migration, by inverting the statements
+// of its up block in reverse order. Statements which can't be inverted are
+// written as TODO comments, and printed as warnings. The migration must not
+// already have a down block containing statements.
+func (db *DB) GenerateDown(version string) error {
+	if version == "" {
+		return fmt.Errorf("please specify a migration version")
+	}
+	if db.FS != nil {
+		return fmt.Errorf("migrations can't be written in DB.FS")
+	}
+
+	filename, err := db.migrationFile(version)
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(db.MigrationsDir, filename)
+	data, err := db.readFile(path)
+	if err != nil {
+		return err
+	}
+	contents := normalizeMigration(string(data))
+	for _, line := range blockRegExp.FindAllString(contents, -1) {
+		if _, ok := parseMigrationOptions(line).(migrationOptions)["driver"]; ok {
+			return fmt.Errorf("%s: can't generate the down block of a migration with driver blocks", filename)
+		}
+	}
+
+	up, down, err := parseMigrationContents(contents)
+	if err != nil {
+		return fmt.Errorf("%s: %s", filename, err)
+	}
+	if strings.TrimSpace(trimSQLComments(downRegExp.ReplaceAllString(down.Contents, ""))) != "" {
+		return fmt.Errorf("%s already has a down block", filename)
+	}
+
+	statements := splitStatements(upRegExp.ReplaceAllString(up.Contents, ""))
+	inverse := make([]string, 0, len(statements))
+	for i := len(statements) - 1; i >= 0; i-- {
+		stmt, ok := invertStatement(statements[i], db.DatabaseURL.Scheme)
+		if !ok {
+			first := strings.SplitN(strings.TrimSpace(trimSQLComments(statements[i])), "\n", 2)[0]
+			fmt.Fprintf(db.Log, "Warning: can't invert statement: %s\n", first)
+			inverse = append(inverse, "-- TODO: invert: "+first)
+			continue
+		}
+		inverse = append(inverse, stmt+";")
+	}
+
+	// keep the options of an existing down block, or run the down block outside
+	// of a transaction if the up block does
+	directive := "-- migrate:down"
+	if !up.Options.Transaction() {
+		directive += " transaction:false"
+	}
+	downStart, downEnd, hasDown := getMatchPositions(contents, downRegExp)
+	if hasDown {
+		options := parseMigrationOptions(contents[downStart:downEnd]).(migrationOptions)
+		delete(options, "migrate")
+		if len(options) > 0 {
+			directive = strings.TrimSpace(contents[downStart:downEnd])
+		}
+	}
+	block := directive + "\n" + strings.Join(inverse, "\n") + "\n"
+
+	if hasDown {
+		// the down block ends at the up block, if it comes first
+		end := len(contents)
+		if upStart, _, _ := getMatchPositions(contents, upRegExp); upStart > downStart {
+			end = upStart
+			block += "\n"
+		}
+		contents = contents[:downStart] + block + contents[end:]
+	} else {
+		contents = strings.TrimRight(contents, "\n") + "\n\n" + block
+	}
+
+	// keep the line endings and byte order mark of the file
+	if strings.Contains(string(data), "\r\n") {
+		contents = strings.ReplaceAll(contents, "\n", "\r\n")
+	}
+	if strings.HasPrefix(string(data), utf8BOM) {
+		contents = utf8BOM + contents
+	}
+
+	fmt.Fprintf(db.Log, "Writing: %s\n", path)
+
+	return ioutil.WriteFile(path, []byte(contents), 0644)
+}
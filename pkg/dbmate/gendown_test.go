@@ -0,0 +1,132 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInvertStatement(t *testing.T) {
+	cases := map[string]string{
+		"create table users (id serial primary key);":                                                 "drop table users",
+		"CREATE TABLE IF NOT EXISTS public.users (\n  id integer\n);":                                 "drop table public.users",
+		"create unique index users_email_idx on users (email);":                                       "drop index users_email_idx",
+		"create index concurrently users_name_idx on users (name);":                                   "drop index concurrently users_name_idx",
+		"create view active_users as select * from users;":                                            "drop view active_users",
+		"create materialized view totals as select 1;":                                                "drop materialized view totals",
+		"create type status as enum ('active', 'inactive');":                                          "drop type status",
+		"create extension if not exists pgcrypto;":                                                    "drop extension pgcrypto",
+		"alter table users add column email text;":                                                    "alter table users drop column email",
+		"alter table users add price numeric(10, 2) not null default 0;":                              "alter table users drop column price",
+		"alter table posts add constraint posts_user_fk foreign key (user_id) references users (id);": "alter table posts drop constraint posts_user_fk",
+		"alter table users rename column name to full_name;":                                          "alter table users rename column full_name to name",
+		"alter table users rename to accounts;":                                                       "alter table accounts rename to users",
+	}
+	for stmt, expected := range cases {
+		inverse, ok := invertStatement(stmt, "postgres")
+		require.True(t, ok, stmt)
+		require.Equal(t, expected, inverse)
+	}
+
+	// MySQL indexes are dropped from their table
+	inverse, ok := invertStatement("create index users_email_idx on users (email);", "mysql")
+	require.True(t, ok)
+	require.Equal(t, "drop index users_email_idx on users", inverse)
+
+	for _, stmt := range []string{
+		"insert into users (id) values (1);",
+		"drop table users;",
+		"create or replace view v as select 1;",
+		"alter table users add column a int, add column b int;",
+		"alter table users add primary key (id);",
+		"alter table users alter column email set not null;",
+	} {
+		_, ok := invertStatement(stmt, "postgres")
+		require.False(t, ok, stmt)
+	}
+}
+
+func TestGenerateDown(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("postgres://localhost/dbmate")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.MigrationsDir = dir
+
+	path := filepath.Join(dir, "001_users.sql")
+	err = ioutil.WriteFile(path, []byte("-- migrate:up\n"+
+		"create table users (id serial primary key);\n"+
+		"-- backfill the admin user\n"+
+		"insert into users (id) values (1);\n"+
+		"alter table users add column email text;\n\n"+
+		"-- migrate:down\n\n"), 0644)
+	require.NoError(t, err)
+
+	err = db.GenerateDown("001")
+	require.NoError(t, err)
+	contents, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "-- migrate:up\n"+
+		"create table users (id serial primary key);\n"+
+		"-- backfill the admin user\n"+
+		"insert into users (id) values (1);\n"+
+		"alter table users add column email text;\n\n"+
+		"-- migrate:down\n"+
+		"alter table users drop column email;\n"+
+		"-- TODO: invert: insert into users (id) values (1)\n"+
+		"drop table users;\n", string(contents))
+	require.Equal(t, "Warning: can't invert statement: insert into users (id) values (1)\n"+
+		"Writing: "+path+"\n", buf.String())
+
+	// existing down blocks are not replaced
+	err = db.GenerateDown("001")
+	require.EqualError(t, err, "001_users.sql already has a down block")
+
+	// a down block is added if missing, outside of a transaction if the up block is
+	path = filepath.Join(dir, "002_index.sql")
+	err = ioutil.WriteFile(path, []byte("-- migrate:up transaction:false\n"+
+		"create index concurrently users_email_idx on users (email);\n"), 0644)
+	require.NoError(t, err)
+	err = db.GenerateDown("002")
+	require.NoError(t, err)
+	contents, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "-- migrate:up transaction:false\n"+
+		"create index concurrently users_email_idx on users (email);\n\n"+
+		"-- migrate:down transaction:false\n"+
+		"drop index concurrently users_email_idx;\n", string(contents))
+
+	err = ioutil.WriteFile(filepath.Join(dir, "003_drivers.sql"), []byte("-- migrate:up driver:postgres\n"+
+		"create table t (id integer);\n"), 0644)
+	require.NoError(t, err)
+	err = db.GenerateDown("003")
+	require.EqualError(t, err, "003_drivers.sql: can't generate the down block of a migration with driver blocks")
+
+	// the line endings and byte order mark of the file are kept
+	path = filepath.Join(dir, "004_windows.sql")
+	err = ioutil.WriteFile(path, []byte("\ufeff-- migrate:up\r\ncreate table posts (id integer);\r\n"), 0644)
+	require.NoError(t, err)
+	err = db.GenerateDown("004")
+	require.NoError(t, err)
+	contents, err = ioutil.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, "\ufeff-- migrate:up\r\ncreate table posts (id integer);\r\n\r\n"+
+		"-- migrate:down\r\ndrop table posts;\r\n", string(contents))
+
+	err = db.GenerateDown("005")
+	require.EqualError(t, err, "can't find migration file: 005*.sql")
+}
@@ -0,0 +1,276 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+func init() {
+	RegisterDriver(GreenplumDriver{}, "greenplum")
+}
+
+// greenplumNoTransactionRegExp matches statements which greenplum can't run
+// inside a transaction
+var greenplumNoTransactionRegExp = regexp.MustCompile(
+	`(?im)^\s*(?:vacuum|(?:create|drop)\s+(?:database|tablespace))\b`)
+
+// GreenplumDriver provides top level database functions. Greenplum is based on
+// postgres, so most functions are provided by the postgres driver.
+type GreenplumDriver struct {
+	postgres PostgresDriver
+}
+
+// greenplumPostgresURL returns the postgres URL used to connect to greenplum
+func greenplumPostgresURL(u *url.URL) *url.URL {
+	postgresURL := *u
+	postgresURL.Scheme = "postgres"
+
+	return &postgresURL
+}
+
+// Info describes the greenplum driver
+func (drv GreenplumDriver) Info() DriverInfo {
+	info := drv.postgres.Info()
+	info.Binaries = []string{"pg_dump", "psql"}
+
+	return info
+}
+
+// Open creates a new database connection
+func (drv GreenplumDriver) Open(u *url.URL) (*sql.DB, error) {
+	return drv.postgres.Open(greenplumPostgresURL(u))
+}
+
+// CreateDatabase creates the specified database
+func (drv GreenplumDriver) CreateDatabase(u *url.URL) error {
+	return drv.postgres.CreateDatabase(greenplumPostgresURL(u))
+}
+
+// DropDatabase drops the specified database (if it exists)
+func (drv GreenplumDriver) DropDatabase(u *url.URL) error {
+	return drv.postgres.DropDatabase(greenplumPostgresURL(u))
+}
+
+// DumpSchema returns the current database schema. The pg_dump included with
+// greenplum writes the distribution policy of each table, but a standard pg_dump
+// does not, so the policies are added if they are missing.
+func (drv GreenplumDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	schema, err := drv.postgres.dumpSchemaWith("pg_dump", greenplumPostgresURL(u), db,
+		"--no-security-labels")
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(schema, []byte("DISTRIBUTED ")) {
+		return schema, nil
+	}
+
+	policies, err := greenplumDistributionDump(db)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(schema, policies...), nil
+}
+
+// greenplumDistributionDump returns statements which set the distribution policy
+// of each table
+func greenplumDistributionDump(db *sql.DB) ([]byte, error) {
+	rows, err := db.Query(`select c.oid::regclass::text, pg_get_table_distributedby(c.oid)
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind = 'r' and n.nspname not in ('information_schema', 'gp_toolkit')
+		and n.nspname not like 'pg\_%'
+		order by 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	var buf bytes.Buffer
+	for rows.Next() {
+		var table, policy string
+		if err := rows.Scan(&table, &policy); err != nil {
+			return nil, err
+		}
+
+		if buf.Len() == 0 {
+			buf.WriteString("\n--\n-- Greenplum distribution policies\n--\n\n")
+		}
+		fmt.Fprintf(&buf, "ALTER TABLE %s SET WITH (REORGANIZE=false) %s;\n", table, policy)
+	}
+
+	return buf.Bytes(), rows.Err()
+}
+
+// DatabaseExists determines whether the database exists
+func (drv GreenplumDriver) DatabaseExists(u *url.URL) (bool, error) {
+	return drv.postgres.DatabaseExists(greenplumPostgresURL(u))
+}
+
+// SplitBatches splits migration contents around COPY FROM stdin statements
+func (drv GreenplumDriver) SplitBatches(contents string) []string {
+	return drv.postgres.SplitBatches(contents)
+}
+
+// ExecCopy runs a COPY FROM stdin statement, streaming its inline data
+func (drv GreenplumDriver) ExecCopy(tx Transaction, batch string) (int64, bool, error) {
+	return drv.postgres.ExecCopy(tx, batch)
+}
+
+// Lock acquires a session advisory lock keyed on the migrations table
+func (drv GreenplumDriver) Lock(db *sql.DB, timeout time.Duration) error {
+	return drv.postgres.Lock(db, timeout)
+}
+
+// Unlock releases the advisory lock
+func (drv GreenplumDriver) Unlock(db *sql.DB) error {
+	return drv.postgres.Unlock(db)
+}
+
+// WithPrivileges returns a driver which includes grants and ownership in the
+// schema dump
+func (drv GreenplumDriver) WithPrivileges() Driver {
+	drv.postgres.DumpPrivileges = true
+
+	return drv
+}
+
+// ExcludeTables returns a driver which does not dump tables matching the patterns
+func (drv GreenplumDriver) ExcludeTables(patterns []string) Driver {
+	drv.postgres.DumpExcludeTables = patterns
+
+	return drv
+}
+
+// WithSchemas returns a driver which sets the search_path to the given schemas,
+// and only includes them in the schema dump
+func (drv GreenplumDriver) WithSchemas(schemas []string) Driver {
+	drv.postgres = drv.postgres.withSchemas(schemas)
+
+	return drv
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table
+func (drv GreenplumDriver) MigrationsTable(name string) Driver {
+	drv.postgres = drv.postgres.withMigrationsTable(name)
+
+	return drv
+}
+
+// CreateMigrationsTable creates the schema_migrations table
+func (drv GreenplumDriver) CreateMigrationsTable(db *sql.DB) error {
+	return drv.postgres.CreateMigrationsTable(db)
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv GreenplumDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.postgres.MigrationsTableExists(db)
+}
+
+// SelectMigrations returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv GreenplumDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.postgres.SelectMigrations(db, limit)
+}
+
+// InsertMigration adds a new migration record
+func (drv GreenplumDriver) InsertMigration(db Transaction, version string) error {
+	return drv.postgres.InsertMigration(db, version)
+}
+
+// DeleteMigration removes a migration record
+func (drv GreenplumDriver) DeleteMigration(db Transaction, version string) error {
+	return drv.postgres.DeleteMigration(db, version)
+}
+
+// CreateChecksumsTable adds the checksum column to the migrations table
+func (drv GreenplumDriver) CreateChecksumsTable(db *sql.DB) error {
+	return drv.postgres.CreateChecksumsTable(db)
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv GreenplumDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.postgres.SelectRepeatableChecksums(db)
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv GreenplumDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.postgres.SelectMigrationChecksums(db)
+}
+
+// CreateMetadataColumns adds the metadata columns to the migrations table
+func (drv GreenplumDriver) CreateMetadataColumns(db *sql.DB) error {
+	return drv.postgres.CreateMetadataColumns(db)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv GreenplumDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	return drv.postgres.UpdateMigrationMetadata(db, version, meta)
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv GreenplumDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	return drv.postgres.SelectMigrationMetadata(db)
+}
+
+// InsertChecksum records the checksum of an applied migration
+func (drv GreenplumDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	return drv.postgres.InsertChecksum(db, version, checksum)
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv GreenplumDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	return drv.postgres.InsertRepeatableChecksum(db, name, checksum)
+}
+
+// ConsoleCommand returns the psql command to connect to the database
+func (drv GreenplumDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return drv.postgres.ConsoleCommand(greenplumPostgresURL(u))
+}
+
+// NoTransaction returns whether migration contents include statements which
+// greenplum can't run inside a transaction
+func (drv GreenplumDriver) NoTransaction(contents string) bool {
+	return greenplumNoTransactionRegExp.MatchString(trimSQLComments(contents))
+}
+
+// RetryableError returns whether an error was caused by a lock timeout or deadlock
+func (drv GreenplumDriver) RetryableError(err error) bool {
+	return drv.postgres.RetryableError(err)
+}
+
+// ErrorPosition returns the offset in query of the position reported by an error
+func (drv GreenplumDriver) ErrorPosition(err error, query string) (int, bool) {
+	return drv.postgres.ErrorPosition(err, query)
+}
+
+// PrepareRetry does nothing, as greenplum does not support concurrent index builds
+func (drv GreenplumDriver) PrepareRetry(db *sql.DB, contents string) error {
+	return nil
+}
+
+// LockTimeoutSQL returns statements to set and reset the session lock timeout
+func (drv GreenplumDriver) LockTimeoutSQL(d time.Duration) (string, string) {
+	return drv.postgres.LockTimeoutSQL(d)
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings
+func (drv GreenplumDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	return drv.postgres.SessionSettingsSQL(s)
+}
+
+// ResetSessionSettingsSQL returns the statements which reset session settings
+func (drv GreenplumDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	return drv.postgres.ResetSessionSettingsSQL(s)
+}
+
+// Ping verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv GreenplumDriver) Ping(u *url.URL) error {
+	return drv.postgres.Ping(greenplumPostgresURL(u))
+}
@@ -0,0 +1,35 @@
+package dbmate
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGreenplumPostgresURL(t *testing.T) {
+	u, err := url.Parse("greenplum://gpadmin@host/dbmate?sslmode=disable")
+	require.NoError(t, err)
+
+	require.Equal(t, "postgres://gpadmin@host/dbmate?sslmode=disable",
+		greenplumPostgresURL(u).String())
+	require.Equal(t, "greenplum", u.Scheme)
+}
+
+func TestGreenplumNoTransaction(t *testing.T) {
+	drv := GreenplumDriver{}
+
+	require.True(t, drv.NoTransaction("delete from events;\nVACUUM events;"))
+	require.True(t, drv.NoTransaction("create tablespace fast location '/data/fast';"))
+	require.False(t, drv.NoTransaction("create table events (id int) distributed by (id);"))
+	require.False(t, drv.NoTransaction("-- vacuum later\nanalyze events;"))
+}
+
+func TestGreenplumConsoleCommand(t *testing.T) {
+	u, err := url.Parse("greenplum://gpadmin@host/dbmate")
+	require.NoError(t, err)
+
+	name, args := GreenplumDriver{}.ConsoleCommand(u)
+	require.Equal(t, "psql", name)
+	require.Equal(t, []string{"postgres://gpadmin@host/dbmate"}, args)
+}
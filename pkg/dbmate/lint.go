@@ -0,0 +1,147 @@
+package dbmate
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// LintViolation describes a problem found in a migration file
+type LintViolation struct {
+	Filename string
+	Line     int
+	Message  string
+}
+
+func (v LintViolation) String() string {
+	return fmt.Sprintf("%s:%d: %s", v.Filename, v.Line, v.Message)
+}
+
+// destructiveRegExp matches statements which are not backwards compatible
+var destructiveRegExp = regexp.MustCompile(
+	`(?i)\b(drop\s+(table|column|index|view|schema|type|constraint|function)|rename\s+(to|column)|truncate)\b`)
+
+// Lint checks migration files for problems, such as destructive statements in
+// migrations marked `-- migrate:expand`, `-- migrate:requires` directives which
+// don't name an earlier migration, or mixed line endings
+func (db *DB) Lint() ([]LintViolation, error) {
+	re := regexp.MustCompile(`^\d.*\.sql$`)
+	files, err := db.migrationFiles(re)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := map[string]bool{}
+	for _, filename := range files {
+		versions[migrationVersion(filename)] = true
+	}
+
+	violations := []LintViolation{}
+	for _, filename := range files {
+		data, err := db.readFile(filepath.Join(db.MigrationsDir, filename))
+		if err != nil {
+			return nil, err
+		}
+
+		contents := normalizeMigration(string(data))
+		violations = append(violations, lintLineEndings(filename, string(data))...)
+		violations = append(violations, lintMigration(filename, contents)...)
+		violations = append(violations, lintRequires(filename, contents, versions)...)
+	}
+
+	return violations, nil
+}
+
+// lineEndingNames names the line endings reported by lintLineEndings
+var lineEndingNames = map[bool]string{true: "CRLF", false: "LF"}
+
+// lintLineEndings checks that a migration file does not mix CRLF and LF line
+// endings, which editors and diffs may not preserve
+func lintLineEndings(filename, contents string) []LintViolation {
+	lines := strings.SplitAfter(contents, "\n")
+	crlf := strings.HasSuffix(lines[0], "\r\n")
+	for i, line := range lines {
+		// the last line may not have a line ending
+		if !strings.HasSuffix(line, "\n") {
+			break
+		}
+		if strings.HasSuffix(line, "\r\n") != crlf {
+			return []LintViolation{{Filename: filename, Line: i + 1,
+				Message: fmt.Sprintf("mixed line endings: line ends with %s, but earlier lines end with %s",
+					lineEndingNames[!crlf], lineEndingNames[crlf])}}
+		}
+	}
+
+	return nil
+}
+
+// lintMigration checks the contents of a single migration file
+func lintMigration(filename, contents string) []LintViolation {
+	up, _, err := parseMigrationContents(contents)
+	if err != nil {
+		return []LintViolation{{Filename: filename, Line: 1, Message: err.Error()}}
+	}
+
+	directives := parseMigrationDirectives(contents)
+	if directives["expand"] == "true" && directives["contract"] == "true" {
+		return []LintViolation{{Filename: filename, Line: 1,
+			Message: "migration cannot be marked both expand and contract"}}
+	}
+
+	if up.Options.Phase() != "expand" {
+		return nil
+	}
+
+	violations := []LintViolation{}
+	inUp := false
+	for i, line := range strings.Split(contents, "\n") {
+		switch {
+		case upRegExp.MatchString(line):
+			inUp = true
+		case downRegExp.MatchString(line):
+			inUp = false
+		case inUp && !isCommentLine(line):
+			if match := destructiveRegExp.FindString(line); match != "" {
+				violations = append(violations, LintViolation{
+					Filename: filename,
+					Line:     i + 1,
+					Message: fmt.Sprintf("expand migration contains destructive statement `%s` "+
+						"(move it to a contract migration)", strings.ToLower(whitespaceRegExp.ReplaceAllString(match, " "))),
+				})
+			}
+		}
+	}
+
+	return violations
+}
+
+// requiresRegExp matches a `-- migrate:requires` directive
+var requiresRegExp = regexp.MustCompile(`^--\s*migrate:requires\b`)
+
+// lintRequires checks that each version required by a migration is an earlier
+// migration, so that the migration can be applied after it
+func lintRequires(filename, contents string, versions map[string]bool) []LintViolation {
+	ver := migrationVersion(filename)
+	violations := []LintViolation{}
+	for i, line := range strings.Split(contents, "\n") {
+		if !requiresRegExp.MatchString(line) {
+			continue
+		}
+
+		for _, req := range migrationOptions(parseMigrationDirectives(line)).Requires() {
+			message := ""
+			switch {
+			case !versions[req]:
+				message = fmt.Sprintf("requires migration %s, which can't be found", req)
+			case req >= ver:
+				message = fmt.Sprintf("requires migration %s, which is not an earlier version", req)
+			default:
+				continue
+			}
+			violations = append(violations, LintViolation{Filename: filename, Line: i + 1, Message: message})
+		}
+	}
+
+	return violations
+}
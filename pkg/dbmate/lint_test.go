@@ -0,0 +1,102 @@
+package dbmate
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintMigration(t *testing.T) {
+	// unmarked migrations may contain anything
+	require.Len(t, lintMigration("1_a.sql", "-- migrate:up\ndrop table users;\n"), 0)
+
+	// destructive statements in the down block are allowed
+	violations := lintMigration("2_b.sql", `-- migrate:expand
+
+-- migrate:up
+alter table users add column email text;
+alter table users
+  drop   column name;
+-- drop table users is only mentioned in a comment
+
+-- migrate:down
+drop table posts;
+`)
+	require.Equal(t, []LintViolation{{
+		Filename: "2_b.sql",
+		Line:     6,
+		Message:  "expand migration contains destructive statement `drop column` (move it to a contract migration)",
+	}}, violations)
+	require.Equal(t, "2_b.sql:6: expand migration contains destructive statement `drop column` "+
+		"(move it to a contract migration)", violations[0].String())
+
+	violations = lintMigration("3_c.sql", "-- migrate:expand\n-- migrate:contract\n-- migrate:up\n")
+	require.Equal(t, []LintViolation{{Filename: "3_c.sql", Line: 1,
+		Message: "migration cannot be marked both expand and contract"}}, violations)
+
+	violations = lintMigration("4_d.sql", "select 1;\n")
+	require.Len(t, violations, 1)
+	require.Contains(t, violations[0].Message, "up bock")
+}
+
+func TestLintLineEndings(t *testing.T) {
+	require.Nil(t, lintLineEndings("1_users.sql", "-- migrate:up\nselect 1;\n"))
+	require.Nil(t, lintLineEndings("1_users.sql", "-- migrate:up\r\nselect 1;"))
+	require.Equal(t, []LintViolation{{Filename: "1_users.sql", Line: 2,
+		Message: "mixed line endings: line ends with LF, but earlier lines end with CRLF"}},
+		lintLineEndings("1_users.sql", "-- migrate:up\r\nselect 1;\nselect 2;\r\n"))
+	require.Equal(t, []LintViolation{{Filename: "1_users.sql", Line: 3,
+		Message: "mixed line endings: line ends with CRLF, but earlier lines end with LF"}},
+		lintLineEndings("1_users.sql", "-- migrate:up\nselect 1;\nselect 2;\r\n"))
+}
+
+func TestLint(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	err = ioutil.WriteFile(filepath.Join(dir, "1_users.sql"),
+		[]byte("-- migrate:expand\n-- migrate:up\ntruncate users;\n"), 0644)
+	require.NoError(t, err)
+
+	db := New(sqliteTestURL(t))
+	db.MigrationsDir = dir
+	violations, err := db.Lint()
+	require.NoError(t, err)
+	require.Len(t, violations, 1)
+	require.Equal(t, 3, violations[0].Line)
+}
+
+func TestLintRequires(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	for name, contents := range map[string]string{
+		"1_users.sql": "-- migrate:up\ncreate table users (id integer);\n",
+		"2_posts.sql": "-- migrate:requires 1\n-- migrate:up\ncreate table posts (id integer);\n",
+		"3_tags.sql":  "-- migrate:requires 1,4\n-- migrate:requires 9\n-- migrate:up\nselect 1;\n",
+		"4_likes.sql": "-- migrate:up\nselect 1;\n",
+	} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	db := New(sqliteTestURL(t))
+	db.MigrationsDir = dir
+	violations, err := db.Lint()
+	require.NoError(t, err)
+	require.Equal(t, []LintViolation{
+		{Filename: "3_tags.sql", Line: 1, Message: "requires migration 4, which is not an earlier version"},
+		{Filename: "3_tags.sql", Line: 2, Message: "requires migration 9, which can't be found"},
+	}, violations)
+}
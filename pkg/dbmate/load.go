@@ -0,0 +1,107 @@
+package dbmate
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+)
+
+// LoadSchema creates the database (if necessary) and loads the schema file into
+// it, which is much faster than replaying every migration. The migrations recorded
+// in the schema file are marked as applied, and any newer migrations remain pending.
+func (db *DB) LoadSchema() error {
+	schema, err := ioutil.ReadFile(db.SchemaFile)
+	if err != nil {
+		return fmt.Errorf("unable to read schema file `%s`: %s", db.SchemaFile, err)
+	}
+
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	if err := db.beforeMigrate(); err != nil {
+		return err
+	}
+
+	if err := db.waitBefore(); err != nil {
+		return err
+	}
+
+	// create database if it does not already exist
+	// skip this step if we cannot determine status
+	exists, err := drv.DatabaseExists(db.DatabaseURL)
+	if err == nil && !exists {
+		fmt.Fprintf(db.Log, "Creating: %s\n", databaseName(db.DatabaseURL))
+		if err := drv.CreateDatabase(db.DatabaseURL); err != nil {
+			return err
+		}
+	}
+
+	if err := db.execSchema(drv, string(schema)); err != nil {
+		return err
+	}
+
+	drv, sqlDB, err := db.openDatabaseForMigration()
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	applied, err := drv.SelectMigrations(sqlDB, -1)
+	if err != nil {
+		return err
+	}
+
+	// record checksums for the loaded migrations, so that they can be verified
+	files, err := db.migrationFiles(regexp.MustCompile(`^\d.*\.sql$`))
+	if err == nil {
+		err = doTransaction(sqlDB, func(tx Transaction) error {
+			for _, filename := range files {
+				ver := migrationVersion(filename)
+				if !applied[ver] {
+					continue
+				}
+
+				checksum, err := db.migrationChecksum(filepath.Join(db.MigrationsDir, filename))
+				if err != nil {
+					return err
+				}
+				if err := db.recordChecksum(drv, tx, ver, checksum); err != nil {
+					return err
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(db.Log, "Loaded %d applied migrations\n", len(applied))
+
+	return nil
+}
+
+// execSchema runs the schema file, refusing to load it into a database which
+// already has applied migrations
+func (db *DB) execSchema(drv Driver, schema string) error {
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	// the schema_migrations table is created by the schema file itself
+	if applied, err := drv.SelectMigrations(sqlDB, -1); err == nil && len(applied) > 0 {
+		return fmt.Errorf("can't load schema: database already has %d applied migrations", len(applied))
+	}
+
+	fmt.Fprintf(db.Log, "Loading: %s\n", db.SchemaFile)
+	db.logSQL(schema)
+
+	_, err = execScript(drv, sqlDB, schema)
+	return err
+}
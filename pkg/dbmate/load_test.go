@@ -0,0 +1,74 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSchema(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "load.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	db.SchemaFile = filepath.Join(dir, "schema.sql")
+
+	err = db.LoadSchema()
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to read schema file `"+db.SchemaFile+"`")
+
+	for _, name := range []string{"1_users", "2_posts", "3_comments"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".sql"),
+			[]byte("-- migrate:up\ncreate table "+name[2:]+" (id integer);\n"), 0644)
+		require.NoError(t, err)
+	}
+	err = ioutil.WriteFile(db.SchemaFile, []byte(`CREATE TABLE schema_migrations (version varchar(255) primary key);
+CREATE TABLE users (id integer);
+CREATE TABLE posts (id integer);
+-- Dbmate schema migrations
+INSERT INTO schema_migrations (version) VALUES
+  ('1'),
+  ('2');
+`), 0644)
+	require.NoError(t, err)
+
+	err = db.LoadSchema()
+	require.NoError(t, err)
+	require.Equal(t, "Creating: "+databaseName(u)+"\nLoading: "+db.SchemaFile+
+		"\nLoaded 2 applied migrations\n", buf.String())
+
+	// migrations which are newer than the schema file remain pending
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 3)
+	require.True(t, status[0].Applied)
+	require.True(t, status[1].Applied)
+	require.False(t, status[2].Applied)
+
+	checksums, err := db.Verify()
+	require.NoError(t, err)
+	require.Len(t, checksums, 2)
+	require.Equal(t, checksums[0].Current, checksums[0].Recorded)
+
+	err = db.LoadSchema()
+	require.EqualError(t, err, "can't load schema: database already has 2 applied migrations")
+
+	err = db.Migrate()
+	require.NoError(t, err)
+}
@@ -0,0 +1,265 @@
+package dbmate
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func init() {
+	RegisterDriver(MariaDBDriver{}, "mariadb")
+}
+
+// mariadbDumpNoiseRegExp matches lines written by mariadb-dump which vary between
+// client versions or dumps: the sandbox mode comment, MariaDB versioned comments,
+// and the current value of each sequence
+var mariadbDumpNoiseRegExp = regexp.MustCompile(
+	`(?m)^(?:/\*M?!999999\\- enable the sandbox mode \*/|/\*M!\d+ .*\*/;|(?:SELECT|DO) SETVAL\(.*\);)[ \t]*\r?\n`)
+
+// MariaDBDriver provides top level database functions. MariaDB speaks the mysql
+// protocol, so most functions are provided by the mysql driver.
+type MariaDBDriver struct {
+	mysql MySQLDriver
+}
+
+// mariadbMySQLURL returns the mysql URL used to connect to mariadb
+func mariadbMySQLURL(u *url.URL) *url.URL {
+	mysqlURL := *u
+	mysqlURL.Scheme = "mysql"
+
+	return &mysqlURL
+}
+
+// trimMariaDBDump removes lines which vary between mariadb-dump versions or
+// dumps, and the leading comments, from a schema dump
+func trimMariaDBDump(schema []byte) ([]byte, error) {
+	return trimLeadingSQLComments(mariadbDumpNoiseRegExp.ReplaceAll(schema, nil))
+}
+
+// Info describes the mariadb driver
+func (drv MariaDBDriver) Info() DriverInfo {
+	info := drv.mysql.Info()
+	info.Binaries = []string{"mariadb-dump", "mariadb"}
+
+	return info
+}
+
+// Open creates a new database connection
+func (drv MariaDBDriver) Open(u *url.URL) (*sql.DB, error) {
+	return drv.mysql.Open(mariadbMySQLURL(u))
+}
+
+// Tenant returns a driver and URL which migrate a tenant database
+func (drv MariaDBDriver) Tenant(u *url.URL, tenant string) (Driver, *url.URL) {
+	mysqlDrv, tenantURL := drv.mysql.Tenant(u, tenant)
+	drv.mysql = mysqlDrv.(MySQLDriver)
+
+	return drv, tenantURL
+}
+
+// CreateDatabase creates the specified database
+func (drv MariaDBDriver) CreateDatabase(u *url.URL) error {
+	return drv.mysql.CreateDatabase(mariadbMySQLURL(u))
+}
+
+// DropDatabase drops the specified database (if it exists)
+func (drv MariaDBDriver) DropDatabase(u *url.URL) error {
+	return drv.mysql.DropDatabase(mariadbMySQLURL(u))
+}
+
+// DumpSchema returns the current database schema, using mariadb-dump if it is
+// installed (older versions only install mysqldump)
+func (drv MariaDBDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	excluded, err := mysqlExcludedTables(db, drv.mysql.DumpExcludeTables)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := runCommand(preferCommand("mariadb-dump", "mysqldump"), mysqldumpArgs(u, excluded...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := mysqlSchemaMigrationsDump(db, drv.mysql.migrationsTable())
+	if err != nil {
+		return nil, err
+	}
+
+	return trimMariaDBDump(append(schema, migrations...))
+}
+
+// DatabaseExists determines whether the database exists
+func (drv MariaDBDriver) DatabaseExists(u *url.URL) (bool, error) {
+	return drv.mysql.DatabaseExists(mariadbMySQLURL(u))
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table
+func (drv MariaDBDriver) MigrationsTable(name string) Driver {
+	drv.mysql.MigrationsTableName = name
+
+	return drv
+}
+
+// ExcludeTables returns a driver which does not dump tables matching the patterns
+func (drv MariaDBDriver) ExcludeTables(patterns []string) Driver {
+	drv.mysql.DumpExcludeTables = patterns
+
+	return drv
+}
+
+// CreateMigrationsTable creates the schema_migrations table
+func (drv MariaDBDriver) CreateMigrationsTable(db *sql.DB) error {
+	return drv.mysql.CreateMigrationsTable(db)
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv MariaDBDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.mysql.MigrationsTableExists(db)
+}
+
+// SelectMigrations returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv MariaDBDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.mysql.SelectMigrations(db, limit)
+}
+
+// InsertMigration adds a new migration record
+func (drv MariaDBDriver) InsertMigration(db Transaction, version string) error {
+	return drv.mysql.InsertMigration(db, version)
+}
+
+// DeleteMigration removes a migration record
+func (drv MariaDBDriver) DeleteMigration(db Transaction, version string) error {
+	return drv.mysql.DeleteMigration(db, version)
+}
+
+// CreateChecksumsTable adds the checksum column to the migrations table
+func (drv MariaDBDriver) CreateChecksumsTable(db *sql.DB) error {
+	return drv.mysql.CreateChecksumsTable(db)
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv MariaDBDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.mysql.SelectRepeatableChecksums(db)
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv MariaDBDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.mysql.SelectMigrationChecksums(db)
+}
+
+// CreateMetadataColumns adds the metadata columns to the migrations table
+func (drv MariaDBDriver) CreateMetadataColumns(db *sql.DB) error {
+	return drv.mysql.CreateMetadataColumns(db)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv MariaDBDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	return drv.mysql.UpdateMigrationMetadata(db, version, meta)
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv MariaDBDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	return drv.mysql.SelectMigrationMetadata(db)
+}
+
+// InsertChecksum records the checksum of an applied migration
+func (drv MariaDBDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	return drv.mysql.InsertChecksum(db, version, checksum)
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv MariaDBDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	return drv.mysql.InsertRepeatableChecksum(db, name, checksum)
+}
+
+// CreateRunsTable creates the schema_migration_runs table
+func (drv MariaDBDriver) CreateRunsTable(db *sql.DB) error {
+	return drv.mysql.CreateRunsTable(db)
+}
+
+// InsertRun records a migration result in the schema_migration_runs table
+func (drv MariaDBDriver) InsertRun(db *sql.DB, runID string, result MigrationResult) error {
+	return drv.mysql.InsertRun(db, runID, result)
+}
+
+// SelectRunDirections returns the direction of the most recent successful run of
+// each version
+func (drv MariaDBDriver) SelectRunDirections(db *sql.DB) (map[string]string, error) {
+	return drv.mysql.SelectRunDirections(db)
+}
+
+// ConsoleCommand returns the mariadb (or mysql) command to connect to the database
+func (drv MariaDBDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return preferCommand("mariadb", "mysql"), append(mysqlConnectionArgs(u), strings.TrimLeft(u.Path, "/"))
+}
+
+// SplitBatches splits migration contents into statements, at semicolons and
+// DELIMITER commands
+func (drv MariaDBDriver) SplitBatches(contents string) []string {
+	return drv.mysql.SplitBatches(contents)
+}
+
+// SplitStatements splits SQL into statements, in which backslashes escape quotes
+// and # starts a comment
+func (drv MariaDBDriver) SplitStatements(contents string) []string {
+	return drv.mysql.SplitStatements(contents)
+}
+
+// SplitDelimited splits migration contents into statements ending with the
+// delimiter, as if they started with a DELIMITER command
+func (drv MariaDBDriver) SplitDelimited(contents, delimiter string) []string {
+	return drv.mysql.SplitDelimited(contents, delimiter)
+}
+
+// OnlineSchemaChangeArgs returns the pt-online-schema-change arguments to run an
+// ALTER TABLE statement. gh-ost does not support mariadb.
+func (drv MariaDBDriver) OnlineSchemaChangeArgs(tool string, u *url.URL, stmt alterStatement) ([]string, error) {
+	if tool == "gh-ost" {
+		return nil, fmt.Errorf("gh-ost does not support mariadb, use pt-online-schema-change instead")
+	}
+
+	return drv.mysql.OnlineSchemaChangeArgs(tool, mariadbMySQLURL(u), stmt)
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings
+func (drv MariaDBDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	return drv.mysql.SessionSettingsSQL(s)
+}
+
+// ResetSessionSettingsSQL returns the statements which reset session settings
+func (drv MariaDBDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	return drv.mysql.ResetSessionSettingsSQL(s)
+}
+
+// ReplicationLag returns Seconds_Behind_Master from SHOW SLAVE STATUS, or zero
+// if the server is not a replica
+func (drv MariaDBDriver) ReplicationLag(db *sql.DB) (time.Duration, error) {
+	return drv.mysql.ReplicationLag(db)
+}
+
+// Blockers returns sessions with an InnoDB transaction open for longer than maxAge
+func (drv MariaDBDriver) Blockers(db *sql.DB, tables []string, maxAge time.Duration) ([]Blocker, error) {
+	return drv.mysql.Blockers(db, tables, maxAge)
+}
+
+// Lock acquires the mysql named lock held while migrating
+func (drv MariaDBDriver) Lock(db *sql.DB, timeout time.Duration) error {
+	return drv.mysql.Lock(db, timeout)
+}
+
+// Unlock releases the named lock
+func (drv MariaDBDriver) Unlock(db *sql.DB) error {
+	return drv.mysql.Unlock(db)
+}
+
+// Ping verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv MariaDBDriver) Ping(u *url.URL) error {
+	return drv.mysql.Ping(mariadbMySQLURL(u))
+}
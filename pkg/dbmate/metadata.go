@@ -0,0 +1,201 @@
+package dbmate
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// MigrationMetadata describes when, how long, and by whom a migration was
+// applied, as recorded in the schema_migrations table
+type MigrationMetadata struct {
+	AppliedAt time.Time
+	Duration  time.Duration
+	// AppliedBy is the OS user which ran dbmate
+	AppliedBy     string
+	Hostname      string
+	DbmateVersion string
+}
+
+// metadataDriver is implemented by drivers which record migration metadata in
+// columns of the schema_migrations table
+type metadataDriver interface {
+	// CreateMetadataColumns adds the metadata columns to a migrations table
+	// created by an older version of dbmate
+	CreateMetadataColumns(*sql.DB) error
+	// UpdateMigrationMetadata records the metadata of an applied migration
+	UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error
+	// SelectMigrationMetadata returns the recorded metadata by version (none if
+	// the table has no metadata columns)
+	SelectMigrationMetadata(*sql.DB) (map[string]MigrationMetadata, error)
+}
+
+// metadataColumns returns the definitions of the metadata columns of the
+// schema_migrations table, using the timestamp type of a driver
+func metadataColumns(timestamp string) []string {
+	return []string{
+		"applied_at " + timestamp,
+		"duration_ms bigint",
+		"applied_by varchar(255)",
+		"hostname varchar(255)",
+		"dbmate_version varchar(32)",
+	}
+}
+
+// metadataSelect lists the columns read by SelectMigrationMetadata
+const metadataSelect = "select version, applied_at, duration_ms, applied_by, hostname, dbmate_version from "
+
+// addMetadataColumns adds the metadata columns which a migrations table does not
+// have, one statement per column since sqlite can only add a single column at a
+// time. Each column is checked with exists, so that an upgrade which failed part
+// way through is completed.
+func addMetadataColumns(db *sql.DB, table string, columns []string,
+	exists func(*sql.DB, string) (bool, error)) error {
+	for _, column := range columns {
+		found, err := exists(db, strings.Fields(column)[0])
+		if err != nil {
+			return err
+		}
+		if found {
+			continue
+		}
+		if _, err := db.Exec("alter table " + table + " add column " + column); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// metadataColumnsExist returns whether a migrations table has every metadata
+// column, since commands which only read the database don't add them to a
+// table created by an older version of dbmate
+func metadataColumnsExist(db *sql.DB, exists func(*sql.DB, string) (bool, error)) (bool, error) {
+	for _, column := range metadataColumns("") {
+		found, err := exists(db, strings.Fields(column)[0])
+		if err != nil || !found {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// metadataValues returns the values written by UpdateMigrationMetadata, in the
+// order of metadataColumns
+func metadataValues(meta MigrationMetadata) []interface{} {
+	return []interface{}{
+		meta.AppliedAt.UTC(),
+		meta.Duration.Milliseconds(),
+		meta.AppliedBy,
+		meta.Hostname,
+		meta.DbmateVersion,
+	}
+}
+
+// metadataTime scans a timestamp, which drivers return either as a time.Time or
+// as text (e.g. MySQL without the parseTime option)
+type metadataTime struct {
+	time.Time
+}
+
+// metadataTimeFormats are the text formats in which drivers return timestamps
+var metadataTimeFormats = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999 -0700 MST",
+	"2006-01-02 15:04:05.999999999",
+}
+
+// Scan implements sql.Scanner
+func (t *metadataTime) Scan(value interface{}) error {
+	var text string
+	switch v := value.(type) {
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		text = string(v)
+	case string:
+		text = v
+	default:
+		return fmt.Errorf("unable to scan %T as a timestamp", value)
+	}
+
+	for _, format := range metadataTimeFormats {
+		if parsed, err := time.Parse(format, text); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unable to parse timestamp: %s", text)
+}
+
+// selectMetadata runs a metadataSelect query which returns migration metadata
+func selectMetadata(db *sql.DB, query string) (map[string]MigrationMetadata, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	metadata := map[string]MigrationMetadata{}
+	for rows.Next() {
+		var version string
+		var appliedAt metadataTime
+		var durationMs sql.NullInt64
+		var appliedBy, hostname, dbmateVersion sql.NullString
+		if err := rows.Scan(&version, &appliedAt, &durationMs, &appliedBy, &hostname, &dbmateVersion); err != nil {
+			return nil, err
+		}
+
+		metadata[version] = MigrationMetadata{
+			AppliedAt:     appliedAt.UTC(),
+			Duration:      time.Duration(durationMs.Int64) * time.Millisecond,
+			AppliedBy:     appliedBy.String,
+			Hostname:      hostname.String,
+			DbmateVersion: dbmateVersion.String,
+		}
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
+
+// recordMetadata records the metadata of a migration as it is applied
+func (db *DB) recordMetadata(drv Driver, tx Transaction, result MigrationResult) error {
+	metadataDrv, ok := drv.(metadataDriver)
+	if !ok {
+		return nil
+	}
+
+	return metadataDrv.UpdateMigrationMetadata(tx, result.Version, MigrationMetadata{
+		AppliedAt:     result.StartedAt.Add(result.Duration),
+		Duration:      result.Duration,
+		AppliedBy:     osUsername(),
+		Hostname:      osHostname(),
+		DbmateVersion: Version,
+	})
+}
+
+// osUsername returns the name of the OS user running dbmate
+func osUsername() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return current.Username
+	}
+
+	return strings.TrimSpace(os.Getenv("USER"))
+}
+
+// osHostname returns the hostname of the machine running dbmate
+func osHostname() string {
+	hostname, _ := os.Hostname()
+
+	return hostname
+}
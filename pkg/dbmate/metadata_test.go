@@ -0,0 +1,102 @@
+package dbmate
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadataTimeScan(t *testing.T) {
+	expected := time.Date(2026, 10, 14, 12, 30, 0, 123456000, time.UTC)
+	for _, value := range []interface{}{
+		expected,
+		"2026-10-14T12:30:00.123456Z",
+		[]byte("2026-10-14 12:30:00.123456"),
+		"2026-10-14 12:30:00.123456+00:00",
+		"2026-10-14 12:30:00.123456 +0000 UTC",
+	} {
+		var scanned metadataTime
+		require.NoError(t, scanned.Scan(value))
+		require.True(t, expected.Equal(scanned.Time), "%v", value)
+	}
+
+	var scanned metadataTime
+	require.EqualError(t, scanned.Scan("yesterday"), "unable to parse timestamp: yesterday")
+	require.EqualError(t, scanned.Scan(42), "unable to scan int as a timestamp")
+}
+
+func TestMigrationMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "metadata.sqlite3"))
+	require.NoError(t, err)
+
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	for _, name := range []string{"1_users.sql", "2_posts.sql"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte("-- migrate:up\n"+
+			"create table t"+migrationVersion(name)+" (id integer);\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	// a migrations table created by an older version of dbmate
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	for _, stmt := range []string{
+		"create table schema_migrations (version varchar(255) primary key, checksum varchar(64))",
+		"create table t1 (id integer)",
+		"insert into schema_migrations (version) values ('1')",
+	} {
+		_, err = sqlDB.Exec(stmt)
+		require.NoError(t, err)
+	}
+
+	start := time.Now().UTC()
+	err = db.Migrate()
+	require.NoError(t, err)
+
+	// the metadata columns are added, and recorded as migrations are applied
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	require.Nil(t, status[0].Metadata)
+	meta := status[1].Metadata
+	require.NotNil(t, meta)
+	require.False(t, meta.AppliedAt.Before(start.Truncate(time.Second)))
+	require.False(t, meta.AppliedAt.After(time.Now().UTC()))
+	require.True(t, meta.Duration >= 0)
+	require.Equal(t, osUsername(), meta.AppliedBy)
+	require.Equal(t, osHostname(), meta.Hostname)
+	require.Equal(t, Version, meta.DbmateVersion)
+
+	// upgrading the table again has no effect
+	err = SQLiteDriver{}.CreateMetadataColumns(sqlDB)
+	require.NoError(t, err)
+
+	// an upgrade which stopped part way through is completed
+	for _, stmt := range []string{
+		"create table migrations (version varchar(255) primary key)",
+		"alter table migrations add column applied_at datetime",
+		"alter table migrations add column duration_ms bigint",
+	} {
+		_, err = sqlDB.Exec(stmt)
+		require.NoError(t, err)
+	}
+	err = SQLiteDriver{MigrationsTableName: "migrations"}.CreateMetadataColumns(sqlDB)
+	require.NoError(t, err)
+	_, err = sqlDB.Exec("select applied_at, duration_ms, applied_by, hostname, dbmate_version from migrations")
+	require.NoError(t, err)
+}
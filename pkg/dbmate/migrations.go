@@ -2,14 +2,25 @@ package dbmate
 
 import (
 	"fmt"
-	"io/ioutil"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // MigrationOptions is an interface for accessing migration options
 type MigrationOptions interface {
 	Transaction() bool
+	Risky() bool
+	Phase() string
+	Online() string
+	Retries() int
+	BatchSize() int
+	BatchSleep() time.Duration
+	LockTimeout() time.Duration
+	StatementTimeout() time.Duration
+	Delimiter() string
+	Requires() []string
 }
 
 type migrationOptions map[string]string
@@ -20,10 +31,117 @@ func (m migrationOptions) Transaction() bool {
 	return m["transaction"] != "false"
 }
 
+// Risky returns whether this migration is marked with `-- migrate:risky`, which
+// requests a snapshot before it is applied. Defaults to false.
+func (m migrationOptions) Risky() bool {
+	return m["risky"] == "true"
+}
+
+// Phase returns "expand" or "contract" if this migration is marked with
+// `-- migrate:expand` or `-- migrate:contract`, or an empty string otherwise.
+func (m migrationOptions) Phase() string {
+	switch {
+	case m["contract"] == "true":
+		return "contract"
+	case m["expand"] == "true":
+		return "expand"
+	}
+
+	return ""
+}
+
+// Online returns the online schema change tool for this migration, "true" if it
+// is marked with `-- migrate:online` without a tool, or an empty string otherwise
+func (m migrationOptions) Online() string {
+	return m["online"]
+}
+
+// Retries returns the number of times to retry this migration if it fails due
+// to lock contention, set with the `retry:N` option. Defaults to 0.
+func (m migrationOptions) Retries() int {
+	n, err := strconv.Atoi(m["retry"])
+	if err != nil || n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// BatchSize returns the batch size for a batched data migration, set with the
+// `batch:N` option. Defaults to 0 (not batched).
+func (m migrationOptions) BatchSize() int {
+	n, err := strconv.Atoi(m["batch"])
+	if err != nil || n < 0 {
+		return 0
+	}
+
+	return n
+}
+
+// BatchSleep returns the delay between batches of a batched data migration, set
+// with the `batch-sleep:DURATION` option. Defaults to 0.
+func (m migrationOptions) BatchSleep() time.Duration {
+	d, err := time.ParseDuration(m["batch-sleep"])
+	if err != nil || d < 0 {
+		return 0
+	}
+
+	return d
+}
+
+// LockTimeout returns the lock timeout applied while this migration runs, set
+// with the `lock_timeout:DURATION` option. Defaults to 0 (the session setting).
+func (m migrationOptions) LockTimeout() time.Duration {
+	return m.duration("lock_timeout")
+}
+
+// StatementTimeout returns the statement timeout applied while this migration
+// runs, set with the `statement_timeout:DURATION` option. Defaults to 0 (the
+// session setting).
+func (m migrationOptions) StatementTimeout() time.Duration {
+	return m.duration("statement_timeout")
+}
+
+// Delimiter returns the statement delimiter set with the `delimiter:$$` option,
+// as if the migration started with a DELIMITER command. Defaults to empty.
+func (m migrationOptions) Delimiter() string {
+	return m["delimiter"]
+}
+
+// Requires returns the versions which must be applied before this migration, set
+// with one or more `-- migrate:requires VERSION[,VERSION...]` directives
+func (m migrationOptions) Requires() []string {
+	versions := []string{}
+	for _, ver := range strings.Split(m["requires"], ",") {
+		if ver = strings.TrimSpace(ver); ver != "" {
+			versions = append(versions, ver)
+		}
+	}
+
+	return versions
+}
+
+// duration returns a duration option, which may also be written with a hyphen
+// (e.g. lock-timeout), or 0 if it is not set or invalid
+func (m migrationOptions) duration(name string) time.Duration {
+	value, ok := m[name]
+	if !ok {
+		value = m[strings.Replace(name, "_", "-", -1)]
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0
+	}
+
+	return d
+}
+
 // Migration contains the migration contents and options
 type Migration struct {
 	Contents string
 	Options  MigrationOptions
+	// Line is the line of the migration file on which Contents starts
+	Line int
 }
 
 // NewMigration constructs a Migration object
@@ -32,22 +150,136 @@ func NewMigration() Migration {
 }
 
 // parseMigration reads a migration file and returns (up Migration, down Migration, error)
-func parseMigration(path string) (Migration, Migration, error) {
-	data, err := ioutil.ReadFile(path)
+func (db *DB) parseMigration(path string) (Migration, Migration, error) {
+	data, err := db.readFile(path)
 	if err != nil {
 		return NewMigration(), NewMigration(), err
 	}
-	up, down, err := parseMigrationContents(string(data))
+	file := normalizeMigration(string(data))
+	contents, err := selectDriverBlocks(file, db.DatabaseURL.Scheme)
+	if err != nil {
+		return NewMigration(), NewMigration(), err
+	}
+	up, down, err := parseMigrationContents(contents)
+	up.Line = contentsLine(file, up.Contents)
+	down.Line = contentsLine(file, down.Contents)
 	return up, down, err
 }
 
-var upRegExp = regexp.MustCompile(`(?m)^--\s*migrate:up(\s*$|\s+\S+)`)
-var downRegExp = regexp.MustCompile(`(?m)^--\s*migrate:down(\s*$|\s+\S+)$`)
+// utf8BOM is the byte order mark which some Windows editors write at the start
+// of UTF-8 files
+const utf8BOM = "\ufeff"
+
+// normalizeMigration removes a UTF-8 byte order mark from the start of migration
+// contents, and converts CRLF line endings to LF, so that the directives of
+// migrations written on Windows are found
+func normalizeMigration(contents string) string {
+	return strings.ReplaceAll(strings.TrimPrefix(contents, utf8BOM), "\r\n", "\n")
+}
+
+// contentsLine returns the line of a migration file on which part of its
+// contents starts
+func contentsLine(file, contents string) int {
+	index := strings.Index(file, strings.TrimRight(contents, "\n"))
+	if index < 0 || contents == "" {
+		return 1
+	}
+
+	return strings.Count(file[:index], "\n") + 1
+}
+
+// blockRegExp matches an up or down block directive
+var blockRegExp = regexp.MustCompile(`(?m)^--\s*migrate:(up|down)(\s*$|\s+.*$)`)
+
+// selectDriverBlocks returns the contents of a migration with only the up and
+// down blocks for the driver of a URL scheme. Blocks with a `driver:NAME` option
+// (or `driver:NAME,NAME`) apply only to the drivers named, and a block without
+// the option applies to any driver which has no block of its own. Migrations
+// without a driver option are returned unchanged.
+func selectDriverBlocks(contents, scheme string) (string, error) {
+	if !strings.Contains(contents, "driver:") {
+		return contents, nil
+	}
+
+	matches := blockRegExp.FindAllStringSubmatchIndex(contents, -1)
+	selected := map[string][]string{}
+	fallback := map[string][]string{}
+	for i, match := range matches {
+		end := len(contents)
+		if i+1 < len(matches) {
+			end = matches[i+1][0]
+		}
+		direction, block := contents[match[2]:match[3]], contents[match[0]:end]
+
+		options := parseMigrationOptions(contents[match[0]:match[1]]).(migrationOptions)
+		drivers, ok := options["driver"]
+		if !ok {
+			fallback[direction] = append(fallback[direction], block)
+			continue
+		}
+		for _, name := range strings.Split(drivers, ",") {
+			if driverMatches(name, scheme) {
+				selected[direction] = append(selected[direction], block)
+				break
+			}
+		}
+	}
+
+	result := ""
+	if len(matches) > 0 {
+		result = contents[:matches[0][0]]
+	}
+	for _, direction := range []string{"up", "down"} {
+		blocks := selected[direction]
+		if len(blocks) == 0 {
+			blocks = fallback[direction]
+		}
+		if len(blocks) > 1 {
+			return "", fmt.Errorf("migration defines more than one %s block for the %s driver", direction, scheme)
+		}
+		if len(blocks) == 0 && direction == "up" {
+			return "", fmt.Errorf("migration does not define an up block for the %s driver", scheme)
+		}
+		// the last block may not end with a newline
+		for _, block := range blocks {
+			if !strings.HasSuffix(block, "\n") {
+				block += "\n"
+			}
+			result += block
+		}
+	}
+
+	return result, nil
+}
+
+// driverMatches returns whether a driver name in a block option, such as
+// postgres, names the driver for a URL scheme (including aliases of the driver,
+// such as postgresql)
+func driverMatches(name, scheme string) bool {
+	if name == scheme {
+		return true
+	}
+
+	named, err := GetDriver(name)
+	if err != nil {
+		return false
+	}
+	drv, err := GetDriver(scheme)
+	if err != nil {
+		return false
+	}
+
+	return fmt.Sprintf("%T", named) == fmt.Sprintf("%T", drv)
+}
+
+var upRegExp = regexp.MustCompile(`(?m)^--\s*migrate:up(\s*$|\s+.*$)`)
+var downRegExp = regexp.MustCompile(`(?m)^--\s*migrate:down(\s*$|\s+.*$)`)
 var emptyLineRegExp = regexp.MustCompile(`^\s*$`)
 var commentLineRegExp = regexp.MustCompile(`^\s*--`)
 var whitespaceRegExp = regexp.MustCompile(`\s+`)
 var optionSeparatorRegExp = regexp.MustCompile(`:`)
 var blockDirectiveRegExp = regexp.MustCompile(`^--\s*migrate:[up|down]]`)
+var fileDirectiveRegExp = regexp.MustCompile(`(?m)^--\s*migrate:(\w+)(?:[ \t]+(\S+))?[ \t]*$`)
 
 // parseMigrationContents parses the string contents of a migration.
 // It will return two Migration objects, the first representing the "up"
@@ -87,9 +319,57 @@ func parseMigrationContents(contents string) (Migration, Migration, error) {
 	down.Options = parseMigrationOptions(downDirective)
 	down.Contents = substring(contents, downDirectiveStart, downEnd)
 
+	directives := parseMigrationDirectives(contents)
+	applyMigrationDirectives(up.Options, directives)
+	applyMigrationDirectives(down.Options, directives)
+
 	return up, down, nil
 }
 
+// parseMigrationDirectives parses file level directives, which are comment lines
+// in the form `-- migrate:name [value]` other than the up and down block directives.
+// Directives without a value are set to "true", and the values of repeated
+// requires directives are joined with commas.
+//
+// For example:
+//
+//     fmt.Printf("%#v", parseMigrationDirectives("-- migrate:risky\n-- migrate:up\n"))
+//     // map[string]string{"risky": "true"}
+//
+func parseMigrationDirectives(contents string) map[string]string {
+	directives := map[string]string{}
+	for _, match := range fileDirectiveRegExp.FindAllStringSubmatch(contents, -1) {
+		name, value := match[1], match[2]
+		if name == "up" || name == "down" {
+			continue
+		}
+		if value == "" {
+			value = "true"
+		}
+		if prev, ok := directives[name]; ok && name == "requires" {
+			value = prev + "," + value
+		}
+		directives[name] = value
+	}
+
+	return directives
+}
+
+// applyMigrationDirectives adds file level directives to block options. Options
+// set on the block directive take precedence.
+func applyMigrationDirectives(options MigrationOptions, directives map[string]string) {
+	m, ok := options.(migrationOptions)
+	if !ok {
+		return
+	}
+
+	for name, value := range directives {
+		if _, set := m[name]; !set {
+			m[name] = value
+		}
+	}
+}
+
 // parseMigrationOptions parses the migration options out of a block
 // directive into an object that implements the MigrationOptions interface.
 //
@@ -1,7 +1,11 @@
 package dbmate
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -130,3 +134,155 @@ ADD COLUMN status status_type DEFAULT 'active';
 	require.NotNil(t, err)
 	require.Equal(t, "dbmate requires each migration to define an up bock with '-- migrate:up'", err.Error())
 }
+
+func TestMigrationTimeoutOptions(t *testing.T) {
+	up, down, err := parseMigrationContents("-- migrate:up lock_timeout:5s statement_timeout:10m\n" +
+		"alter table users add column name text;\n-- migrate:down lock-timeout:1s\n")
+	require.Nil(t, err)
+	require.Equal(t, 5*time.Second, up.Options.LockTimeout())
+	require.Equal(t, 10*time.Minute, up.Options.StatementTimeout())
+	require.Equal(t, time.Second, down.Options.LockTimeout())
+	require.Equal(t, time.Duration(0), down.Options.StatementTimeout())
+
+	// invalid durations are ignored
+	require.Equal(t, time.Duration(0), parseMigrationOptions("-- migrate:up lock_timeout:soon").LockTimeout())
+}
+
+func TestMigrationDelimiterOption(t *testing.T) {
+	up, down, err := parseMigrationContents("-- migrate:up delimiter:$$\n" +
+		"create procedure noop() begin end$$\n-- migrate:down\ndrop procedure noop;\n")
+	require.Nil(t, err)
+	require.Equal(t, "$$", up.Options.Delimiter())
+	require.Equal(t, "", down.Options.Delimiter())
+}
+
+func TestMigrationRequiresOption(t *testing.T) {
+	up, down, err := parseMigrationContents("-- migrate:requires 20230101120000\n" +
+		"-- migrate:requires 20230102120000,20230103120000\n-- migrate:up\nselect 1;\n-- migrate:down\n")
+	require.Nil(t, err)
+	require.Equal(t, []string{"20230101120000", "20230102120000", "20230103120000"}, up.Options.Requires())
+	require.Equal(t, up.Options.Requires(), down.Options.Requires())
+
+	up, _, err = parseMigrationContents("-- migrate:up\nselect 1;\n")
+	require.Nil(t, err)
+	require.Equal(t, []string{}, up.Options.Requires())
+}
+
+func TestSelectDriverBlocks(t *testing.T) {
+	migration := `-- migrate:risky
+-- migrate:up driver:postgres
+create table users (id serial);
+-- migrate:down driver:postgres
+drop table users;
+-- migrate:up driver:mysql,mariadb transaction:false
+create table users (id int auto_increment primary key);
+-- migrate:up
+create table users (id integer);
+-- migrate:down
+drop table users;`
+
+	contents, err := selectDriverBlocks(migration, "postgresql")
+	require.Nil(t, err)
+	require.Equal(t, "-- migrate:risky\n-- migrate:up driver:postgres\ncreate table users (id serial);\n"+
+		"-- migrate:down driver:postgres\ndrop table users;\n", contents)
+
+	// blocks without a driver apply to drivers which have no block of their own
+	contents, err = selectDriverBlocks(migration, "mariadb")
+	require.Nil(t, err)
+	up, down, err := parseMigrationContents(contents)
+	require.Nil(t, err)
+	require.Equal(t, "-- migrate:up driver:mysql,mariadb transaction:false\n"+
+		"create table users (id int auto_increment primary key);\n", up.Contents)
+	require.Equal(t, false, up.Options.Transaction())
+	require.Equal(t, true, up.Options.Risky())
+	require.Equal(t, "-- migrate:down\ndrop table users;\n", down.Contents)
+
+	contents, err = selectDriverBlocks(migration, "sqlite")
+	require.Nil(t, err)
+	require.Equal(t, "-- migrate:risky\n-- migrate:up\ncreate table users (id integer);\n"+
+		"-- migrate:down\ndrop table users;\n", contents)
+
+	// migrations without a driver option are unchanged
+	contents, err = selectDriverBlocks("-- migrate:up\nselect 1;", "sqlite")
+	require.Nil(t, err)
+	require.Equal(t, "-- migrate:up\nselect 1;", contents)
+
+	_, err = selectDriverBlocks("-- migrate:up driver:postgres\nselect 1;\n", "sqlite")
+	require.EqualError(t, err, "migration does not define an up block for the sqlite driver")
+
+	_, err = selectDriverBlocks("-- migrate:up driver:sqlite\nselect 1;\n"+
+		"-- migrate:up driver:sqlite3\nselect 2;\n", "sqlite")
+	require.EqualError(t, err, "migration defines more than one up block for the sqlite driver")
+}
+
+func TestDriverMatches(t *testing.T) {
+	require.True(t, driverMatches("postgres", "postgres"))
+	require.True(t, driverMatches("postgres", "postgresql"))
+	require.True(t, driverMatches("sqlite3", "sqlite"))
+	require.False(t, driverMatches("postgres", "cockroachdb"))
+	require.False(t, driverMatches("mysql", "sqlite"))
+	require.False(t, driverMatches("nosuchdriver", "sqlite"))
+}
+
+func TestParseMigrationDirectives(t *testing.T) {
+	migration := `-- This migration drops a column
+-- migrate:risky
+
+-- migrate:up
+alter table users drop column name;
+
+-- migrate:down
+`
+
+	up, down, err := parseMigrationContents(migration)
+	require.Nil(t, err)
+	require.Equal(t, true, up.Options.Risky())
+	require.Equal(t, true, down.Options.Risky())
+	require.Equal(t, true, up.Options.Transaction())
+
+	// directives may have a value, and block options take precedence
+	require.Equal(t, map[string]string{"risky": "true", "phase": "expand"},
+		parseMigrationDirectives("-- migrate:risky\n--migrate:phase expand\n-- migrate:up\n"))
+
+	up, _, err = parseMigrationContents("-- migrate:transaction false\n-- migrate:up\nselect 1;\n")
+	require.Nil(t, err)
+	require.Equal(t, false, up.Options.Transaction())
+	require.Equal(t, false, up.Options.Risky())
+
+	// comments which mention directives are ignored
+	require.Equal(t, map[string]string{},
+		parseMigrationDirectives("-- see migrate:risky for details\n-- migrate:up\n"))
+}
+
+func TestNormalizeMigration(t *testing.T) {
+	require.Equal(t, "-- migrate:up\nselect 1;\n", normalizeMigration("\ufeff-- migrate:up\r\nselect 1;\r\n"))
+	require.Equal(t, "-- migrate:up\nselect 1;\n", normalizeMigration("-- migrate:up\nselect 1;\r\n"))
+	require.Equal(t, "select '\ufeff';\n", normalizeMigration("select '\ufeff';\n"))
+}
+
+func TestParseMigrationWindows(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	// migrations written on Windows may start with a byte order mark, and have
+	// CRLF line endings
+	path := filepath.Join(dir, "001_users.sql")
+	err = ioutil.WriteFile(path, []byte("\ufeff-- migrate:requires 000\r\n\r\n"+
+		"-- migrate:up transaction:false\r\ncreate table users (id integer);\r\n\r\n"+
+		"-- migrate:down\r\ndrop table users;\r\n"), 0644)
+	require.NoError(t, err)
+
+	db := New(sqliteTestURL(t))
+	up, down, err := db.parseMigration(path)
+	require.NoError(t, err)
+	require.Equal(t, "-- migrate:up transaction:false\ncreate table users (id integer);\n\n", up.Contents)
+	require.Equal(t, false, up.Options.Transaction())
+	require.Equal(t, []string{"000"}, up.Options.Requires())
+	require.Equal(t, 3, up.Line)
+	require.Equal(t, "-- migrate:down\ndrop table users;\n", down.Contents)
+	require.Equal(t, 6, down.Line)
+}
@@ -3,9 +3,13 @@ package dbmate
 import (
 	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/url"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql" // mysql driver for database/sql
 )
@@ -16,6 +20,40 @@ func init() {
 
 // MySQLDriver provides top level database functions
 type MySQLDriver struct {
+	// MigrationsTableName is the name of the migrations table, which may be
+	// qualified with a database (default schema_migrations)
+	MigrationsTableName string
+	// DumpExcludeTables are table patterns which are left out of the schema dump
+	DumpExcludeTables []string
+}
+
+// migrationsTable returns the quoted name of the schema_migrations table
+func (drv MySQLDriver) migrationsTable() string {
+	name := drv.MigrationsTableName
+	if name == "" {
+		name = "schema_migrations"
+	}
+
+	database, table := splitQualifiedName(name)
+	if database == "" {
+		return mysqlQuoteIdentifier(table)
+	}
+
+	return mysqlQuoteIdentifier(database) + "." + mysqlQuoteIdentifier(table)
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table
+func (drv MySQLDriver) MigrationsTable(name string) Driver {
+	drv.MigrationsTableName = name
+
+	return drv
+}
+
+// ExcludeTables returns a driver which does not dump tables matching the patterns
+func (drv MySQLDriver) ExcludeTables(patterns []string) Driver {
+	drv.DumpExcludeTables = patterns
+
+	return drv
 }
 
 func normalizeMySQLURL(u *url.URL) string {
@@ -51,9 +89,38 @@ func normalizeMySQLURL(u *url.URL) string {
 	return normalizedString
 }
 
+// Info describes the mysql driver. URL options are passed to go-sql-driver/mysql,
+// which always has multiStatements enabled, except for the TLS certificate
+// options, which are loaded by dbmate.
+func (drv MySQLDriver) Info() DriverInfo {
+	return DriverInfo{
+		SchemaDump: true,
+		Binaries:   []string{"mysqldump", "mysql"},
+		URLOptions: []string{"tls", "tls-ca", "tls-cert", "tls-key", "allowCleartextPasswords",
+			"charset", "collation", "loc", "parseTime", "timeout", "readTimeout", "writeTimeout"},
+	}
+}
+
 // Open creates a new database connection
 func (drv MySQLDriver) Open(u *url.URL) (*sql.DB, error) {
-	return sql.Open("mysql", normalizeMySQLURL(u))
+	tlsURL, err := mysqlTLSURL(u)
+	if err != nil {
+		return nil, err
+	}
+
+	return sql.Open("mysql", normalizeMySQLURL(tlsURL))
+}
+
+// Tenant returns a driver and URL which migrate a tenant database. The
+// migrations table is always within the tenant database.
+func (drv MySQLDriver) Tenant(u *url.URL, tenant string) (Driver, *url.URL) {
+	tenantURL := *u
+	tenantURL.Path = "/" + tenant
+	if drv.MigrationsTableName != "" {
+		_, drv.MigrationsTableName = splitQualifiedName(drv.MigrationsTableName)
+	}
+
+	return drv, &tenantURL
 }
 
 func (drv MySQLDriver) openRootDB(u *url.URL) (*sql.DB, error) {
@@ -73,7 +140,6 @@ func mysqlQuoteIdentifier(str string) string {
 // CreateDatabase creates the specified database
 func (drv MySQLDriver) CreateDatabase(u *url.URL) error {
 	name := databaseName(u)
-	fmt.Printf("Creating: %s\n", name)
 
 	db, err := drv.openRootDB(u)
 	if err != nil {
@@ -90,7 +156,6 @@ func (drv MySQLDriver) CreateDatabase(u *url.URL) error {
 // DropDatabase drops the specified database (if it exists)
 func (drv MySQLDriver) DropDatabase(u *url.URL) error {
 	name := databaseName(u)
-	fmt.Printf("Dropping: %s\n", name)
 
 	db, err := drv.openRootDB(u)
 	if err != nil {
@@ -104,11 +169,25 @@ func (drv MySQLDriver) DropDatabase(u *url.URL) error {
 	return err
 }
 
-func mysqldumpArgs(u *url.URL) []string {
+func mysqldumpArgs(u *url.URL, ignoreTables ...string) []string {
 	// generate CLI arguments
 	args := []string{"--opt", "--routines", "--no-data",
 		"--skip-dump-date", "--skip-add-drop-table"}
+	args = append(args, mysqlConnectionArgs(u)...)
 
+	// add database name
+	name := strings.TrimLeft(u.Path, "/")
+	for _, table := range ignoreTables {
+		args = append(args, "--ignore-table="+name+"."+table)
+	}
+	args = append(args, name)
+
+	return args
+}
+
+// mysqlConnectionArgs returns the mysql/mysqldump CLI arguments to connect to a database
+func mysqlConnectionArgs(u *url.URL) []string {
+	args := []string{}
 	if hostname := u.Hostname(); hostname != "" {
 		args = append(args, "--host="+hostname)
 	}
@@ -124,16 +203,13 @@ func mysqldumpArgs(u *url.URL) []string {
 		args = append(args, "--password="+password)
 	}
 
-	// add database name
-	args = append(args, strings.TrimLeft(u.Path, "/"))
-
-	return args
+	return append(args, mysqlTLSArgs(u)...)
 }
 
-func mysqlSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
+func mysqlSchemaMigrationsDump(db *sql.DB, table string) ([]byte, error) {
 	// load applied migrations
 	migrations, err := queryColumn(db,
-		"select quote(version) from schema_migrations order by version asc")
+		"select quote(version) from "+table+" order by version asc")
 	if err != nil {
 		return nil, err
 	}
@@ -141,10 +217,10 @@ func mysqlSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
 	// build schema_migrations table data
 	var buf bytes.Buffer
 	buf.WriteString("\n--\n-- Dbmate schema migrations\n--\n\n" +
-		"LOCK TABLES `schema_migrations` WRITE;\n")
+		"LOCK TABLES " + table + " WRITE;\n")
 
 	if len(migrations) > 0 {
-		buf.WriteString("INSERT INTO `schema_migrations` (version) VALUES\n  (" +
+		buf.WriteString("INSERT INTO " + table + " (version) VALUES\n  (" +
 			strings.Join(migrations, "),\n  (") +
 			");\n")
 	}
@@ -154,14 +230,58 @@ func mysqlSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// DumpSchema returns the current database schema
+// mysqlExcludedTables returns the tables in the current database which match
+// the patterns (using the * and ? wildcards)
+func mysqlExcludedTables(db *sql.DB, patterns []string) ([]string, error) {
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+
+	conditions := []string{}
+	args := []interface{}{}
+	for _, pattern := range patterns {
+		database, table := splitQualifiedName(pattern)
+		if database == "" {
+			database = "*"
+		}
+		conditions = append(conditions, "(table_schema like ? and table_name like ?)")
+		args = append(args, likePattern(database), likePattern(table))
+	}
+
+	rows, err := db.Query("select table_name from information_schema.tables "+
+		"where table_schema = database() and ("+strings.Join(conditions, " or ")+
+		") order by table_name", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	tables := []string{}
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+
+	return tables, rows.Err()
+}
+
+// DumpSchema returns the current database schema, generated from
+// information_schema, so that mysqldump is not required
 func (drv MySQLDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
-	schema, err := runCommand("mysqldump", mysqldumpArgs(u)...)
+	excluded, err := mysqlExcludedTables(db, drv.DumpExcludeTables)
+	if err != nil {
+		return nil, err
+	}
+
+	schema, err := mysqlCatalogDump(db, excluded)
 	if err != nil {
 		return nil, err
 	}
 
-	migrations, err := mysqlSchemaMigrationsDump(db)
+	migrations, err := mysqlSchemaMigrationsDump(db, drv.migrationsTable())
 	if err != nil {
 		return nil, err
 	}
@@ -192,16 +312,38 @@ func (drv MySQLDriver) DatabaseExists(u *url.URL) (bool, error) {
 
 // CreateMigrationsTable creates the schema_migrations table
 func (drv MySQLDriver) CreateMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec("create table if not exists schema_migrations " +
-		"(version varchar(255) primary key)")
+	_, err := db.Exec("create table if not exists " + drv.migrationsTable() + " " +
+		"(version varchar(255) primary key, checksum varchar(64), " +
+		strings.Join(metadataColumns("datetime(6)"), ", ") + ")")
 
 	return err
 }
 
+// migrationsColumnExists returns whether the migrations table has a column, which
+// may be missing from a table created by an older version of dbmate
+func (drv MySQLDriver) migrationsColumnExists(db *sql.DB, column string) (bool, error) {
+	name := drv.MigrationsTableName
+	if name == "" {
+		name = "schema_migrations"
+	}
+	database, table := splitQualifiedName(name)
+	var columns int
+	err := db.QueryRow("select count(*) from information_schema.columns "+
+		"where table_schema = coalesce(nullif(?, ''), database()) and table_name = ? "+
+		"and column_name = ?", database, table, column).Scan(&columns)
+
+	return columns > 0, err
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv MySQLDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.migrationsColumnExists(db, "version")
+}
+
 // SelectMigrations returns a list of applied migrations
 // with an optional limit (in descending order)
 func (drv MySQLDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
-	query := "select version from schema_migrations order by version desc"
+	query := "select version from " + drv.migrationsTable() + " order by version desc"
 	if limit >= 0 {
 		query = fmt.Sprintf("%s limit %d", query, limit)
 	}
@@ -227,14 +369,448 @@ func (drv MySQLDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool,
 
 // InsertMigration adds a new migration record
 func (drv MySQLDriver) InsertMigration(db Transaction, version string) error {
-	_, err := db.Exec("insert into schema_migrations (version) values (?)", version)
+	_, err := db.Exec("insert into "+drv.migrationsTable()+" (version) values (?)", version)
 
 	return err
 }
 
 // DeleteMigration removes a migration record
 func (drv MySQLDriver) DeleteMigration(db Transaction, version string) error {
-	_, err := db.Exec("delete from schema_migrations where version = ?", version)
+	_, err := db.Exec("delete from "+drv.migrationsTable()+" where version = ?", version)
+
+	return err
+}
+
+// CreateChecksumsTable creates schema_migration_checksums, which records the
+// checksums of repeatable migrations, and adds the checksum column to a
+// migrations table created by an older version of dbmate
+func (drv MySQLDriver) CreateChecksumsTable(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists schema_migration_checksums " +
+		"(version varchar(255) primary key, checksum varchar(64) not null)")
+	if err != nil {
+		return err
+	}
+
+	exists, err := drv.migrationsColumnExists(db, "checksum")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = db.Exec("alter table " + drv.migrationsTable() + " add column checksum varchar(64)")
+
+	return err
+}
+
+// CreateMetadataColumns adds the metadata columns to a migrations table created by
+// an older version of dbmate
+func (drv MySQLDriver) CreateMetadataColumns(db *sql.DB) error {
+	return addMetadataColumns(db, drv.migrationsTable(), metadataColumns("datetime(6)"), drv.migrationsColumnExists)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv MySQLDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	_, err := db.Exec("update "+drv.migrationsTable()+" set applied_at = ?, duration_ms = ?, "+
+		"applied_by = ?, hostname = ?, dbmate_version = ? where version = ?",
+		append(metadataValues(meta), version)...)
+
+	return err
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv MySQLDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	exists, err := metadataColumnsExist(db, drv.migrationsColumnExists)
+	if err != nil || !exists {
+		return map[string]MigrationMetadata{}, err
+	}
+
+	return selectMetadata(db, metadataSelect+drv.migrationsTable()+" where applied_at is not null")
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv MySQLDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	exists, err := drv.migrationsColumnExists(db, "checksum")
+	if err != nil || !exists {
+		return map[string]string{}, err
+	}
+
+	return selectChecksums(db, "select version, checksum from "+drv.migrationsTable()+
+		" where checksum is not null")
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv MySQLDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return selectChecksums(db, "select version, checksum from schema_migration_checksums")
+}
+
+// InsertChecksum records the checksum of an applied migration in schema_migrations
+func (drv MySQLDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	_, err := db.Exec("update "+drv.migrationsTable()+" set checksum = ? where version = ?",
+		checksum, version)
+
+	return err
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv MySQLDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	if _, err := db.Exec("delete from schema_migration_checksums where version = ?", name); err != nil {
+		return err
+	}
+	_, err := db.Exec("insert into schema_migration_checksums (version, checksum) values (?, ?)",
+		name, checksum)
+
+	return err
+}
+
+// CreateRunsTable creates the schema_migration_runs table
+func (drv MySQLDriver) CreateRunsTable(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists schema_migration_runs (" +
+		"id bigint not null auto_increment primary key, " +
+		"run_id varchar(32) not null, " +
+		"version varchar(255) not null, " +
+		"direction varchar(4) not null, " +
+		"started_at datetime(6) not null, " +
+		"duration_ms bigint not null, " +
+		"rows_affected bigint not null, " +
+		"lock_wait_ms bigint not null, " +
+		"success boolean not null, " +
+		"error text)")
+
+	return err
+}
+
+// InsertRun records a migration result in the schema_migration_runs table
+func (drv MySQLDriver) InsertRun(db *sql.DB, runID string, result MigrationResult) error {
+	_, err := db.Exec("insert into schema_migration_runs ("+runsInsertColumns+") "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?)", runValues(runID, result)...)
+
+	return err
+}
+
+// SelectRunDirections returns the direction of the most recent successful run of
+// each version
+func (drv MySQLDriver) SelectRunDirections(db *sql.DB) (map[string]string, error) {
+	var tables int
+	err := db.QueryRow("select count(*) from information_schema.tables " +
+		"where table_schema = database() and table_name = 'schema_migration_runs'").Scan(&tables)
+	if err != nil || tables == 0 {
+		return nil, err
+	}
+
+	return selectRunDirections(db, "select version, direction from schema_migration_runs "+
+		"where success order by id")
+}
+
+// Backup writes a mysqldump of the database
+func (drv MySQLDriver) Backup(u *url.URL, path string, schemaOnly bool) error {
+	args := []string{"--opt", "--routines", "--single-transaction", "--result-file=" + path}
+	if schemaOnly {
+		args = append(args, "--no-data")
+	}
+	args = append(args, mysqlConnectionArgs(u)...)
+	args = append(args, strings.TrimLeft(u.Path, "/"))
+
+	_, err := runCommand("mysqldump", args...)
+	return err
+}
+
+// Restore replaces the database contents with a mysqldump. Tables in the dump
+// are dropped and recreated.
+func (drv MySQLDriver) Restore(u *url.URL, path string) error {
+	args := append(mysqlConnectionArgs(u), "--execute=source "+path,
+		strings.TrimLeft(u.Path, "/"))
+
+	_, err := runCommand("mysql", args...)
+	return err
+}
+
+// ConsoleCommand returns the mysql command to connect to the database
+func (drv MySQLDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return "mysql", append(mysqlConnectionArgs(u), strings.TrimLeft(u.Path, "/"))
+}
+
+// ptDSNValue escapes commas in a Percona Toolkit DSN value, which otherwise
+// separate the DSN options
+func ptDSNValue(value string) string {
+	return strings.Replace(value, ",", `\,`, -1)
+}
+
+// OnlineSchemaChangeArgs returns the gh-ost or pt-online-schema-change arguments
+// to run an ALTER TABLE statement
+func (drv MySQLDriver) OnlineSchemaChangeArgs(tool string, u *url.URL, stmt alterStatement) ([]string, error) {
+	database := stmt.Database
+	if database == "" {
+		database = databaseName(u)
+	}
+
+	switch tool {
+	case "gh-ost":
+		args := mysqlConnectionArgs(u)
+		return append(args, "--database="+database, "--table="+stmt.Table,
+			"--alter="+stmt.Alter, "--execute"), nil
+	case "pt-online-schema-change":
+		dsn := []string{"D=" + ptDSNValue(database), "t=" + ptDSNValue(stmt.Table)}
+		if hostname := u.Hostname(); hostname != "" {
+			dsn = append(dsn, "h="+ptDSNValue(hostname))
+		}
+		if port := u.Port(); port != "" {
+			dsn = append(dsn, "P="+port)
+		}
+		if username := u.User.Username(); username != "" {
+			dsn = append(dsn, "u="+ptDSNValue(username))
+		}
+		if password, set := u.User.Password(); set {
+			dsn = append(dsn, "p="+ptDSNValue(password))
+		}
+		return []string{"--alter=" + stmt.Alter, "--execute", strings.Join(dsn, ",")}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported online schema change tool: %s", tool)
+}
+
+// mysqlDelimiterRegExp matches a DELIMITER command of the mysql client
+var mysqlDelimiterRegExp = regexp.MustCompile(`(?im)^\s*delimiter\s+(\S+)\s*$`)
+
+// mysqlCommentRegExp matches MySQL comments, except for /*! */ comments, which
+// contain SQL run by the server
+var mysqlCommentRegExp = regexp.MustCompile(`(?m)(?:--|#).*$|(?s)/\*(?:[^!].*?)?\*/`)
+
+// isMySQLComment returns whether SQL contains only comments and whitespace,
+// which the server rejects as an empty query
+func isMySQLComment(s string) bool {
+	return strings.TrimSpace(mysqlCommentRegExp.ReplaceAllString(s, "")) == ""
+}
+
+// splitMySQLStatements splits SQL into statements like mysqlStatements, but
+// includes comments in the following statement (or the last statement, if
+// nothing follows them)
+func splitMySQLStatements(contents string) []string {
+	statements := []string{}
+	comments := ""
+	for _, stmt := range mysqlStatements(contents) {
+		if isMySQLComment(stmt) {
+			comments += stmt
+			continue
+		}
+		statements = append(statements, comments+stmt)
+		comments = ""
+	}
+	if comments != "" {
+		if len(statements) == 0 {
+			return []string{comments}
+		}
+		statements[len(statements)-1] += comments
+	}
+
+	return statements
+}
+
+// splitMySQLDelimiter splits migration contents at DELIMITER commands, which are
+// interpreted by the mysql client rather than the server. Statements ending with
+// a delimiter other than a semicolon run as separate batches (without the
+// delimiter), so that routines and triggers may contain semicolons. Statements
+// ending with a semicolon also run as separate batches, so that a failure can be
+// located at its statement.
+func splitMySQLDelimiter(contents, delimiter string) []string {
+	batches := []string{}
+	var batch strings.Builder
+	flush := func() {
+		if isMySQLComment(batch.String()) {
+			batch.Reset()
+			return
+		}
+		if delimiter == ";" {
+			batches = append(batches, splitMySQLStatements(batch.String())...)
+		} else {
+			batches = append(batches, batch.String())
+		}
+		batch.Reset()
+	}
+
+	for _, line := range strings.SplitAfter(contents, "\n") {
+		// DELIMITER is only a command between statements, and may otherwise be
+		// a column name
+		pending := strings.TrimSpace(trimSQLComments(batch.String()))
+		match := mysqlDelimiterRegExp.FindStringSubmatch(line)
+		if match != nil && (pending == "" || strings.HasSuffix(pending, ";")) {
+			flush()
+			delimiter = match[1]
+			continue
+		}
+
+		trimmed := strings.TrimRight(line, " \t\r\n")
+		if delimiter != ";" && !isCommentLine(line) && strings.HasSuffix(trimmed, delimiter) {
+			batch.WriteString(strings.TrimSuffix(trimmed, delimiter) + "\n")
+			flush()
+			continue
+		}
+		batch.WriteString(line)
+	}
+	flush()
+
+	return batches
+}
+
+// SplitBatches splits migration contents into statements, at semicolons and
+// DELIMITER commands
+func (drv MySQLDriver) SplitBatches(contents string) []string {
+	return splitMySQLDelimiter(contents, ";")
+}
+
+// SplitStatements splits SQL into statements, in which backslashes escape quotes
+// and # starts a comment
+func (drv MySQLDriver) SplitStatements(contents string) []string {
+	return splitMySQLStatements(contents)
+}
+
+// SplitDelimited splits migration contents into statements ending with the
+// delimiter, as if they started with a DELIMITER command
+func (drv MySQLDriver) SplitDelimited(contents, delimiter string) []string {
+	return splitMySQLDelimiter(contents, delimiter)
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings.
+// The lock timeout applies to both metadata locks and InnoDB row locks.
+func (drv MySQLDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	if s.StatementTimeout > 0 {
+		return nil, errors.New("statement timeout is not supported by the mysql driver")
+	}
+	if s.IdleInTransactionTimeout > 0 {
+		return nil, errors.New("idle in transaction timeout is not supported by the mysql driver")
+	}
+
+	var statements []string
+	if s.LockTimeout > 0 {
+		seconds := durationUnits(s.LockTimeout, time.Second)
+		statements = append(statements,
+			fmt.Sprintf("set session lock_wait_timeout = %d", seconds),
+			fmt.Sprintf("set session innodb_lock_wait_timeout = %d", seconds))
+	}
+
+	return statements, nil
+}
+
+// ResetSessionSettingsSQL returns the statements which reset session settings to
+// the global values
+func (drv MySQLDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	var statements []string
+	if s.LockTimeout > 0 {
+		statements = append(statements, "set session lock_wait_timeout = default",
+			"set session innodb_lock_wait_timeout = default")
+	}
+
+	return statements
+}
+
+// ReplicationLag returns Seconds_Behind_Master from SHOW SLAVE STATUS, or zero
+// if the server is not a replica
+func (drv MySQLDriver) ReplicationLag(db *sql.DB) (time.Duration, error) {
+	rows, err := db.Query("show slave status")
+	if err != nil {
+		return 0, err
+	}
+	defer mustClose(rows)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		return 0, rows.Err()
+	}
+
+	values := make([]sql.RawBytes, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return 0, err
+	}
+
+	for i, column := range columns {
+		if column != "Seconds_Behind_Master" && column != "Seconds_Behind_Source" {
+			continue
+		}
+		if values[i] == nil {
+			return 0, errors.New("replication is not running")
+		}
+
+		seconds, err := strconv.Atoi(string(values[i]))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	return 0, errors.New("unable to find Seconds_Behind_Master in replica status")
+}
+
+// Blockers returns sessions with an InnoDB transaction open for longer than
+// maxAge. Table locks are not checked.
+func (drv MySQLDriver) Blockers(db *sql.DB, tables []string, maxAge time.Duration) ([]Blocker, error) {
+	rows, err := db.Query(`select trx_mysql_thread_id, coalesce(trx_query, ''),
+			timestampdiff(second, trx_started, now())
+		from information_schema.innodb_trx
+		where trx_mysql_thread_id <> connection_id()
+			and trx_started < now() - interval ? second
+		order by trx_started`, durationUnits(maxAge, time.Second))
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	blockers := []Blocker{}
+	for rows.Next() {
+		var b Blocker
+		var seconds int64
+		if err := rows.Scan(&b.PID, &b.Query, &seconds); err != nil {
+			return nil, err
+		}
+		b.Age = time.Duration(seconds) * time.Second
+		blockers = append(blockers, b)
+	}
+
+	return blockers, rows.Err()
+}
+
+// mysqlLockName is the name of the migrations lock. Named locks are server wide,
+// so the name includes the database and migrations table (up to the 64
+// character limit).
+const mysqlLockName = "left(concat('dbmate_migrations:', database(), ':', ?), 64)"
+
+// Lock acquires a named lock keyed on the database and migrations table,
+// waiting for up to timeout (or indefinitely if zero)
+func (drv MySQLDriver) Lock(db *sql.DB, timeout time.Duration) error {
+	seconds := int64(-1)
+	if timeout > 0 {
+		seconds = durationUnits(timeout, time.Second)
+	}
+
+	var obtained sql.NullInt64
+	err := db.QueryRow("select get_lock("+mysqlLockName+", ?)", drv.migrationsTable(), seconds).
+		Scan(&obtained)
+	if err != nil {
+		return err
+	}
+	if !obtained.Valid {
+		return errors.New("unable to acquire the migrations lock")
+	}
+	if obtained.Int64 != 1 {
+		return fmt.Errorf("timed out after %s waiting for the migrations lock, "+
+			"another migration is in progress", timeout)
+	}
+
+	return nil
+}
+
+// Unlock releases the named lock
+func (drv MySQLDriver) Unlock(db *sql.DB) error {
+	_, err := db.Exec("select release_lock("+mysqlLockName+")", drv.migrationsTable())
 
 	return err
 }
@@ -0,0 +1,250 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// mysqlDumpHeader disables foreign key checks while the schema is loaded, so
+// that tables may reference tables which are created after them
+const mysqlDumpHeader = `/*!40101 SET NAMES utf8mb4 */;
+/*!40014 SET FOREIGN_KEY_CHECKS=0 */;
+
+`
+
+// mysqlDumpFooter enables foreign key checks again
+const mysqlDumpFooter = "/*!40014 SET FOREIGN_KEY_CHECKS=1 */;\n"
+
+// mysqlAutoIncrementRegExp matches the next auto increment value in a create
+// table statement
+var mysqlAutoIncrementRegExp = regexp.MustCompile(` AUTO_INCREMENT=\d+`)
+
+// mysqlDefinerRegExp matches the definer of a view, trigger, or routine, which
+// depends on the user who created it
+var mysqlDefinerRegExp = regexp.MustCompile(" DEFINER=`[^`]*`@`[^`]*`")
+
+// mysqlView is a view which is ordered by its dependencies
+type mysqlView struct {
+	name, definition string
+}
+
+// sortMySQLViews returns the names of views ordered so that each view follows
+// the views it selects from, and otherwise in the order given
+func sortMySQLViews(views []mysqlView) []string {
+	sorted := []string{}
+	visited := map[string]bool{}
+
+	var visit func(view mysqlView)
+	visit = func(view mysqlView) {
+		if visited[view.name] {
+			return
+		}
+		visited[view.name] = true
+
+		for _, dep := range views {
+			if dep.name != view.name && strings.Contains(view.definition, "`"+dep.name+"`") {
+				visit(dep)
+			}
+		}
+		sorted = append(sorted, view.name)
+	}
+
+	for _, view := range views {
+		visit(view)
+	}
+
+	return sorted
+}
+
+// mysqlShowCreate returns a column of the row returned by a show create
+// statement. The number of columns varies between statements and versions.
+func mysqlShowCreate(db *sql.DB, query string, column int) (string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return "", err
+	}
+	defer mustClose(rows)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", fmt.Errorf("no rows returned by %s", query)
+	}
+
+	values := make([]sql.NullString, len(columns))
+	dest := make([]interface{}, len(columns))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	if err := rows.Scan(dest...); err != nil {
+		return "", err
+	}
+
+	return values[column].String, nil
+}
+
+// mysqlCatalogDumper generates a schema dump from information_schema and show
+// create statements
+type mysqlCatalogDumper struct {
+	db   *sql.DB
+	skip map[string]bool
+	buf  bytes.Buffer
+}
+
+// mysqlCatalogDump returns the database schema, generated in Go rather than with
+// mysqldump, so that it does not vary between client versions. Tables are
+// written first, followed by routines, views, and triggers, and the excluded
+// tables and views are left out. Definers and auto increment values are
+// removed, because they depend on who created an object and on the data.
+func mysqlCatalogDump(db *sql.DB, excluded []string) ([]byte, error) {
+	d := &mysqlCatalogDumper{db: db, skip: map[string]bool{}}
+	for _, name := range excluded {
+		d.skip[name] = true
+	}
+
+	d.buf.WriteString(mysqlDumpHeader)
+	for _, section := range []func() error{d.tables, d.routines, d.views, d.triggers} {
+		if err := section(); err != nil {
+			return nil, err
+		}
+	}
+	d.buf.WriteString(mysqlDumpFooter)
+
+	return d.buf.Bytes(), nil
+}
+
+// entry writes a statement with a comment describing it
+func (d *mysqlCatalogDumper) entry(kind, name, stmt string) {
+	stmt = mysqlDefinerRegExp.ReplaceAllString(stmt, "")
+	fmt.Fprintf(&d.buf, "--\n-- Structure for %s %s\n--\n\n%s;\n\n",
+		kind, mysqlQuoteIdentifier(name), strings.TrimSpace(stmt))
+}
+
+func (d *mysqlCatalogDumper) tables() error {
+	tables, err := queryColumn(d.db, "select table_name from information_schema.tables "+
+		"where table_schema = database() and table_type = 'BASE TABLE' order by table_name")
+	if err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		if d.skip[table] {
+			continue
+		}
+		stmt, err := mysqlShowCreate(d.db, "show create table "+mysqlQuoteIdentifier(table), 1)
+		if err != nil {
+			return err
+		}
+		d.entry("table", table, mysqlAutoIncrementRegExp.ReplaceAllString(stmt, ""))
+	}
+
+	return nil
+}
+
+func (d *mysqlCatalogDumper) routines() error {
+	rows, err := d.db.Query("select routine_type, routine_name from information_schema.routines " +
+		"where routine_schema = database() order by routine_type, routine_name")
+	if err != nil {
+		return err
+	}
+	defer mustClose(rows)
+
+	type routine struct {
+		kind, name string
+	}
+	routines := []routine{}
+	for rows.Next() {
+		var r routine
+		if err := rows.Scan(&r.kind, &r.name); err != nil {
+			return err
+		}
+		routines = append(routines, r)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range routines {
+		stmt, err := mysqlShowCreate(d.db, "show create "+r.kind+" "+mysqlQuoteIdentifier(r.name), 2)
+		if err != nil {
+			return err
+		}
+		d.entry(strings.ToLower(r.kind), r.name, stmt)
+	}
+
+	return nil
+}
+
+func (d *mysqlCatalogDumper) views() error {
+	rows, err := d.db.Query("select table_name, view_definition from information_schema.views " +
+		"where table_schema = database() order by table_name")
+	if err != nil {
+		return err
+	}
+	defer mustClose(rows)
+
+	views := []mysqlView{}
+	for rows.Next() {
+		var v mysqlView
+		if err := rows.Scan(&v.name, &v.definition); err != nil {
+			return err
+		}
+		if !d.skip[v.name] {
+			views = append(views, v)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, view := range sortMySQLViews(views) {
+		stmt, err := mysqlShowCreate(d.db, "show create view "+mysqlQuoteIdentifier(view), 1)
+		if err != nil {
+			return err
+		}
+		d.entry("view", view, stmt)
+	}
+
+	return nil
+}
+
+func (d *mysqlCatalogDumper) triggers() error {
+	rows, err := d.db.Query("select trigger_name, event_object_table from information_schema.triggers " +
+		"where trigger_schema = database() order by event_object_table, action_order, trigger_name")
+	if err != nil {
+		return err
+	}
+	defer mustClose(rows)
+
+	triggers := []string{}
+	for rows.Next() {
+		var name, table string
+		if err := rows.Scan(&name, &table); err != nil {
+			return err
+		}
+		if !d.skip[table] {
+			triggers = append(triggers, name)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, trigger := range triggers {
+		stmt, err := mysqlShowCreate(d.db, "show create trigger "+mysqlQuoteIdentifier(trigger), 2)
+		if err != nil {
+			return err
+		}
+		d.entry("trigger", trigger, stmt)
+	}
+
+	return nil
+}
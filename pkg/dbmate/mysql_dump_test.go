@@ -0,0 +1,26 @@
+package dbmate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSortMySQLViews(t *testing.T) {
+	views := []mysqlView{
+		{"active_admins", "select * from `dbmate`.`admins` where active"},
+		{"admins", "select * from `dbmate`.`users` where admin"},
+		{"user_names", "select `dbmate`.`users`.`name` from `dbmate`.`users`"},
+	}
+	require.Equal(t, []string{"admins", "active_admins", "user_names"}, sortMySQLViews(views))
+}
+
+func TestMySQLDefinerRegExp(t *testing.T) {
+	stmt := "CREATE ALGORITHM=UNDEFINED DEFINER=`root`@`%` SQL SECURITY DEFINER VIEW `admins` AS select 1"
+	require.Equal(t, "CREATE ALGORITHM=UNDEFINED SQL SECURITY DEFINER VIEW `admins` AS select 1",
+		mysqlDefinerRegExp.ReplaceAllString(stmt, ""))
+
+	stmt = "CREATE DEFINER=`app`@`10.0.0.%` FUNCTION `double_id`(id int) RETURNS int"
+	require.Equal(t, "CREATE FUNCTION `double_id`(id int) RETURNS int",
+		mysqlDefinerRegExp.ReplaceAllString(stmt, ""))
+}
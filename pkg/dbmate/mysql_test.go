@@ -3,7 +3,9 @@ package dbmate
 import (
 	"database/sql"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -61,6 +63,31 @@ func TestNormalizeMySQLURLCustomSpecialChars(t *testing.T) {
 	require.Equal(t, "duhfsd7s:123!@123!@@tcp(host:123)/foo?flag=on&multiStatements=true", s)
 }
 
+func TestMySQLMigrationsTable(t *testing.T) {
+	drv := MySQLDriver{}
+	require.Equal(t, "`schema_migrations`", drv.migrationsTable())
+
+	drv = drv.MigrationsTable("ops.dbmate_versions").(MySQLDriver)
+	require.Equal(t, "`ops`.`dbmate_versions`", drv.migrationsTable())
+
+	// tenants keep the table within the tenant database
+	u, err := url.Parse("mysql://root@host/dbmate")
+	require.NoError(t, err)
+	tenantDrv, tenantURL := drv.Tenant(u, "tenant1")
+	require.Equal(t, "`dbmate_versions`", tenantDrv.(MySQLDriver).migrationsTable())
+	require.Equal(t, "/tenant1", tenantURL.Path)
+}
+
+func TestMySQLDumpArgs(t *testing.T) {
+	u, err := url.Parse("mysql://root@host/dbmate")
+	require.NoError(t, err)
+
+	args := mysqldumpArgs(u, "audit_log", "sessions")
+	require.Equal(t, []string{"--opt", "--routines", "--no-data", "--skip-dump-date",
+		"--skip-add-drop-table", "--host=host", "--user=root", "--ignore-table=dbmate.audit_log",
+		"--ignore-table=dbmate.sessions", "dbmate"}, args)
+}
+
 func TestMySQLCreateDropDatabase(t *testing.T) {
 	drv := MySQLDriver{}
 	u := mySQLTestURL(t)
@@ -108,6 +135,13 @@ func TestMySQLDumpSchema(t *testing.T) {
 	defer mustClose(db)
 	err := drv.CreateMigrationsTable(db)
 	require.NoError(t, err)
+	_, err = db.Exec("create table users (id int auto_increment primary key, name text);\n" +
+		"insert into users (name) values ('alice');\n" +
+		"create view user_names as select name from users;\n" +
+		"create view alice as select * from user_names where name = 'alice';\n" +
+		"create function double_id(id int) returns int deterministic return id * 2;\n" +
+		"create trigger users_name before insert on users for each row set new.name = trim(new.name);")
+	require.NoError(t, err)
 
 	// insert migration
 	err = drv.InsertMigration(db, "abc1")
@@ -119,7 +153,14 @@ func TestMySQLDumpSchema(t *testing.T) {
 	schema, err := drv.DumpSchema(u, db)
 	require.NoError(t, err)
 	require.Contains(t, string(schema), "CREATE TABLE `schema_migrations`")
-	require.Contains(t, string(schema), "\n-- Dump completed\n\n"+
+	require.Contains(t, string(schema), "CREATE TABLE `users`")
+	require.NotContains(t, string(schema), "AUTO_INCREMENT=")
+	require.NotContains(t, string(schema), "DEFINER=")
+	require.Contains(t, string(schema), "-- Structure for function `double_id`")
+	require.Contains(t, string(schema), "-- Structure for trigger `users_name`")
+	require.True(t, strings.Index(string(schema), "VIEW `user_names`") <
+		strings.Index(string(schema), "VIEW `alice`"))
+	require.Contains(t, string(schema), "/*!40014 SET FOREIGN_KEY_CHECKS=1 */;\n\n"+
 		"--\n"+
 		"-- Dbmate schema migrations\n"+
 		"--\n\n"+
@@ -129,12 +170,35 @@ func TestMySQLDumpSchema(t *testing.T) {
 		"  ('abc2');\n"+
 		"UNLOCK TABLES;\n")
 
-	// DumpSchema should return error if command fails
-	u.Path = "/fakedb"
-	schema, err = drv.DumpSchema(u, db)
-	require.Nil(t, schema)
-	require.EqualError(t, err, "mysqldump: Got error: 1049: "+
-		"\"Unknown database 'fakedb'\" when selecting the database")
+	// the schema file can be loaded
+	_, err = db.Exec("drop trigger users_name; drop view alice; drop view user_names; " +
+		"drop function double_id; drop table users; drop table schema_migrations")
+	require.NoError(t, err)
+	_, err = db.Exec(string(schema))
+	require.NoError(t, err)
+}
+
+func TestMySQLLock(t *testing.T) {
+	drv := MySQLDriver{}
+	db := prepTestMySQLDB(t)
+	defer mustClose(db)
+	db.SetMaxOpenConns(1)
+
+	other, err := drv.Open(mySQLTestURL(t))
+	require.NoError(t, err)
+	defer mustClose(other)
+	other.SetMaxOpenConns(1)
+
+	require.NoError(t, drv.Lock(db, 0))
+
+	// another session times out waiting for the lock
+	err = drv.Lock(other, time.Second)
+	require.EqualError(t, err, "timed out after 1s waiting for the migrations lock, "+
+		"another migration is in progress")
+
+	require.NoError(t, drv.Unlock(db))
+	require.NoError(t, drv.Lock(other, time.Second))
+	require.NoError(t, drv.Unlock(other))
 }
 
 func TestMySQLDatabaseExists(t *testing.T) {
@@ -281,3 +345,104 @@ func TestMySQLPing(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "connect: connection refused")
 }
+
+func TestMySQLSessionSettingsSQL(t *testing.T) {
+	drv := MySQLDriver{}
+
+	statements, err := drv.SessionSettingsSQL(SessionSettings{LockTimeout: 1500 * time.Millisecond})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"set session lock_wait_timeout = 2",
+		"set session innodb_lock_wait_timeout = 2",
+	}, statements)
+
+	_, err = drv.SessionSettingsSQL(SessionSettings{StatementTimeout: time.Second})
+	require.EqualError(t, err, "statement timeout is not supported by the mysql driver")
+
+	require.Equal(t, []string{
+		"set session lock_wait_timeout = default",
+		"set session innodb_lock_wait_timeout = default",
+	}, drv.ResetSessionSettingsSQL(SessionSettings{LockTimeout: time.Second}))
+}
+
+func TestSplitMySQLDelimiter(t *testing.T) {
+	// statements ending with a semicolon are separate batches
+	contents := "create table users (\n  id int,\n  delimiter varchar(1)\n);\n"
+	require.Equal(t, []string{contents}, splitMySQLDelimiter(contents, ";"))
+	require.Equal(t, []string{
+		"-- migrate:up\ncreate table users (id int);\n",
+		"# it's\ninsert into users values (1, 'a\\';b', \"c;\");\n/* done; */\n",
+	}, splitMySQLDelimiter("-- migrate:up\ncreate table users (id int);\n"+
+		"# it's\ninsert into users values (1, 'a\\';b', \"c;\");\n/* done; */\n", ";"))
+	require.Equal(t, []string{}, splitMySQLDelimiter("-- migrate:up\n# nothing\n", ";"))
+	require.Equal(t, []string{"/*!40101 SET NAMES utf8 */;\n"},
+		splitMySQLDelimiter("/*!40101 SET NAMES utf8 */;\n", ";"))
+
+	batches := splitMySQLDelimiter("create table users (id int);\n\n"+
+		"DELIMITER $$\n"+
+		"create procedure add_user(id int)\nbegin\n  insert into users values (id);\nend $$\n"+
+		"create trigger users_id before insert on users for each row set new.id = abs(new.id)$$\n"+
+		"delimiter ;\n"+
+		"insert into users values (1);\n", ";")
+	require.Equal(t, []string{
+		"create table users (id int);\n\n",
+		"create procedure add_user(id int)\nbegin\n  insert into users values (id);\nend \n",
+		"create trigger users_id before insert on users for each row set new.id = abs(new.id)\n",
+		"insert into users values (1);\n",
+	}, batches)
+
+	// the delimiter option applies from the start of the migration
+	batches = splitMySQLDelimiter("-- migrate:up delimiter://\n"+
+		"create function one() returns int deterministic\nbegin\n  return 1;\nend//\n", "//")
+	require.Equal(t, []string{
+		"-- migrate:up delimiter://\ncreate function one() returns int deterministic\n" +
+			"begin\n  return 1;\nend\n",
+	}, batches)
+}
+
+func TestMySQLOnlineSchemaChangeArgs(t *testing.T) {
+	drv := MySQLDriver{}
+	u, err := url.Parse("mysql://root:pw@db:3306/app")
+	require.NoError(t, err)
+	stmt := alterStatement{Table: "users", Alter: "add column email text"}
+
+	args, err := drv.OnlineSchemaChangeArgs("gh-ost", u, stmt)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--host=db", "--port=3306", "--user=root", "--password=pw",
+		"--database=app", "--table=users", "--alter=add column email text", "--execute"}, args)
+
+	stmt.Database = "other"
+	args, err = drv.OnlineSchemaChangeArgs("pt-online-schema-change", u, stmt)
+	require.NoError(t, err)
+	require.Equal(t, []string{"--alter=add column email text", "--execute",
+		"D=other,t=users,h=db,P=3306,u=root,p=pw"}, args)
+
+	// commas in DSN values are escaped
+	u.User = url.UserPassword("root", "p,w")
+	args, err = drv.OnlineSchemaChangeArgs("pt-online-schema-change", u, stmt)
+	require.NoError(t, err)
+	require.Equal(t, `D=other,t=users,h=db,P=3306,u=root,p=p\,w`, args[2])
+
+	_, err = drv.OnlineSchemaChangeArgs("lhm", u, stmt)
+	require.EqualError(t, err, "unsupported online schema change tool: lhm")
+}
+
+func TestMySQLReplicationLag(t *testing.T) {
+	drv := MySQLDriver{}
+	db := prepTestMySQLDB(t)
+	defer mustClose(db)
+
+	// the test database is not a replica
+	lag, err := drv.ReplicationLag(db)
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), lag)
+}
+
+func TestMySQLConsoleCommand(t *testing.T) {
+	u, err := url.Parse("mysql://root:pw@db:3306/app")
+	require.NoError(t, err)
+
+	name, args := MySQLDriver{}.ConsoleCommand(u)
+	require.Equal(t, "mysql", name)
+	require.Equal(t, []string{"--host=db", "--port=3306", "--user=root", "--password=pw", "app"}, args)
+}
@@ -0,0 +1,106 @@
+package dbmate
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io/ioutil"
+	"net/url"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// mysqlTLSOptions are the URL options which configure TLS certificates. They
+// are understood by dbmate rather than go-sql-driver/mysql, which only accepts
+// a TLS config registered in code.
+var mysqlTLSOptions = []string{"tls-ca", "tls-cert", "tls-key"}
+
+// mysqlTLSURL returns a URL with the tls-ca, tls-cert, and tls-key options
+// replaced by a tls option naming a registered TLS config. URLs without these
+// options are returned unchanged.
+func mysqlTLSURL(u *url.URL) (*url.URL, error) {
+	query := u.Query()
+	ca, cert, key := query.Get("tls-ca"), query.Get("tls-cert"), query.Get("tls-key")
+	mode := query.Get("tls")
+	if ca == "" && cert == "" && key == "" {
+		if mode == "custom" {
+			return nil, errors.New("tls=custom requires the tls-ca option, or the tls-cert and tls-key options")
+		}
+		return u, nil
+	}
+
+	switch mode {
+	case "", "true", "custom", "skip-verify":
+	default:
+		return nil, fmt.Errorf("the tls-ca, tls-cert, and tls-key options can't be used with tls=%s", mode)
+	}
+
+	config, err := mysqlTLSConfig(ca, cert, key, mode == "skip-verify")
+	if err != nil {
+		return nil, err
+	}
+
+	// name the config after its options, so that each URL has its own config
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(mode + "\x00" + ca + "\x00" + cert + "\x00" + key))
+	name := fmt.Sprintf("dbmate-%x", h.Sum32())
+	if err := mysql.RegisterTLSConfig(name, config); err != nil {
+		return nil, err
+	}
+
+	for _, option := range mysqlTLSOptions {
+		query.Del(option)
+	}
+	query.Set("tls", name)
+
+	tlsURL := *u
+	tlsURL.RawQuery = query.Encode()
+
+	return &tlsURL, nil
+}
+
+// mysqlTLSConfig loads a CA certificate which verifies the server certificate,
+// and a client certificate and key, from PEM files
+func mysqlTLSConfig(ca, cert, key string, skipVerify bool) (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: skipVerify}
+
+	if ca != "" {
+		pem, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", ca)
+		}
+	}
+
+	if cert != "" || key != "" {
+		if cert == "" || key == "" {
+			return nil, errors.New("the tls-cert and tls-key options must be used together")
+		}
+		pair, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{pair}
+	}
+
+	return config, nil
+}
+
+// mysqlTLSArgs returns the mysql client arguments for the tls-ca, tls-cert, and
+// tls-key options
+func mysqlTLSArgs(u *url.URL) []string {
+	query := u.Query()
+	args := []string{}
+	for _, option := range mysqlTLSOptions {
+		if value := query.Get(option); value != "" {
+			args = append(args, "--ssl-"+option[len("tls-"):]+"="+value)
+		}
+	}
+
+	return args
+}
@@ -0,0 +1,89 @@
+package dbmate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestCertificate writes a self-signed certificate and its key to dir
+func writeTestCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "dbmate"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, "cert.pem")
+	keyPath := filepath.Join(dir, "key.pem")
+	err = ioutil.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	require.NoError(t, err)
+	err = ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	require.NoError(t, err)
+
+	return certPath, keyPath
+}
+
+func TestMySQLTLSURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+	cert, key := writeTestCertificate(t, dir)
+
+	// URLs without certificate options are unchanged
+	u, err := url.Parse("mysql://root@db/app?tls=skip-verify")
+	require.NoError(t, err)
+	tlsURL, err := mysqlTLSURL(u)
+	require.NoError(t, err)
+	require.Equal(t, u, tlsURL)
+
+	// certificate options are replaced by a registered config
+	u, err = url.Parse("mysql://root@db/app?tls=custom&tls-ca=" + cert +
+		"&tls-cert=" + cert + "&tls-key=" + key + "&allowCleartextPasswords=true")
+	require.NoError(t, err)
+	tlsURL, err = mysqlTLSURL(u)
+	require.NoError(t, err)
+	query := tlsURL.Query()
+	require.Regexp(t, "^dbmate-[0-9a-f]+$", query.Get("tls"))
+	require.Equal(t, "", query.Get("tls-ca"))
+	require.Equal(t, "true", query.Get("allowCleartextPasswords"))
+	require.Equal(t, []string{"--ssl-ca=" + cert, "--ssl-cert=" + cert, "--ssl-key=" + key},
+		mysqlTLSArgs(u))
+
+	_, err = mysqlTLSURL(&url.URL{Scheme: "mysql", RawQuery: "tls=custom"})
+	require.EqualError(t, err, "tls=custom requires the tls-ca option, or the tls-cert and tls-key options")
+
+	_, err = mysqlTLSURL(&url.URL{Scheme: "mysql", RawQuery: "tls=false&tls-ca=" + cert})
+	require.EqualError(t, err, "the tls-ca, tls-cert, and tls-key options can't be used with tls=false")
+
+	_, err = mysqlTLSURL(&url.URL{Scheme: "mysql", RawQuery: "tls-cert=" + cert})
+	require.EqualError(t, err, "the tls-cert and tls-key options must be used together")
+
+	_, err = mysqlTLSURL(&url.URL{Scheme: "mysql", RawQuery: "tls-ca=" + key})
+	require.EqualError(t, err, "no certificates found in "+key)
+}
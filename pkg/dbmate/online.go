@@ -0,0 +1,140 @@
+package dbmate
+
+import (
+	"fmt"
+	"net/url"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+// DefaultOnlineTool specifies the tool used for migrations marked `-- migrate:online`
+const DefaultOnlineTool = "gh-ost"
+
+// alterStatement is an ALTER TABLE statement which can be run by an online
+// schema change tool
+type alterStatement struct {
+	Database string
+	Table    string
+	Alter    string
+}
+
+// onlineSchemaChangeDriver is implemented by drivers which support online schema
+// change tools, such as gh-ost and pt-online-schema-change
+type onlineSchemaChangeDriver interface {
+	// OnlineSchemaChangeArgs returns the command line arguments for the tool
+	OnlineSchemaChangeArgs(tool string, u *url.URL, stmt alterStatement) ([]string, error)
+}
+
+var alterTableRegExp = regexp.MustCompile(
+	"(?is)^alter\\s+table\\s+(?:`?(\\w+)`?\\.)?`?(\\w+)`?\\s+(.+)$")
+
+// parseAlterStatements splits migration contents into ALTER TABLE statements, and
+// returns an error if there are any other statements. Statements which alter the
+// same table are combined, so that the tool copies each table only once, and
+// the table is not left partially migrated if a later statement fails.
+func parseAlterStatements(contents string) ([]alterStatement, error) {
+	statements := []alterStatement{}
+	tables := map[string]int{}
+	for _, s := range splitStatements(contents) {
+		s = strings.TrimSpace(trimSQLComments(s))
+		if s == "" {
+			continue
+		}
+
+		match := alterTableRegExp.FindStringSubmatch(s)
+		if match == nil {
+			return nil, fmt.Errorf("online migrations may only contain ALTER TABLE statements: %s", s)
+		}
+		stmt := alterStatement{
+			Database: match[1],
+			Table:    match[2],
+			Alter:    whitespaceRegExp.ReplaceAllString(strings.TrimSpace(match[3]), " "),
+		}
+
+		key := stmt.Database + "." + stmt.Table
+		if i, ok := tables[key]; ok {
+			statements[i].Alter += ", " + stmt.Alter
+			continue
+		}
+		tables[key] = len(statements)
+		statements = append(statements, stmt)
+	}
+
+	if len(statements) == 0 {
+		return nil, fmt.Errorf("online migration has no ALTER TABLE statements")
+	}
+
+	return statements, nil
+}
+
+// trimSQLComments removes `--` comment lines
+func trimSQLComments(s string) string {
+	lines := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		if !isCommentLine(line) {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// onlineTool returns the tool for a migration, or an empty string if the
+// migration should run normally
+func (db *DB) onlineTool(m Migration) string {
+	tool := m.Options.Online()
+	if tool == "true" {
+		tool = db.OnlineTool
+		if tool == "" {
+			tool = DefaultOnlineTool
+		}
+	}
+
+	if tool == "pt-osc" {
+		return "pt-online-schema-change"
+	}
+
+	return tool
+}
+
+// runOnlineMigration runs each ALTER TABLE statement with an online schema
+// change tool, streaming the tool output to the log
+func (db *DB) runOnlineMigration(tool string, m Migration) error {
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	onlineDrv, ok := drv.(onlineSchemaChangeDriver)
+	if !ok {
+		return fmt.Errorf("online migrations are not supported by the %s driver",
+			db.DatabaseURL.Scheme)
+	}
+
+	statements, err := parseAlterStatements(m.Contents)
+	if err != nil {
+		return err
+	}
+
+	path := db.OnlineToolPath
+	if path == "" {
+		path = tool
+	}
+
+	for _, stmt := range statements {
+		args, err := onlineDrv.OnlineSchemaChangeArgs(tool, db.DatabaseURL, stmt)
+		if err != nil {
+			return err
+		}
+
+		cmd := exec.Command(path, append(args, db.OnlineToolFlags...)...)
+		cmd.Stdout = db.Log
+		cmd.Stderr = db.Log
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed on table %s: %s", tool, stmt.Table, err)
+		}
+	}
+
+	return nil
+}
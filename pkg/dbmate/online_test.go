@@ -0,0 +1,106 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseAlterStatements(t *testing.T) {
+	statements, err := parseAlterStatements(`-- migrate:up online:gh-ost
+ALTER TABLE users ADD COLUMN email varchar(255),
+  ADD INDEX idx_email (email);
+-- add a column to another table
+alter table ` + "`app`.`posts`" + ` drop column legacy;
+`)
+	require.NoError(t, err)
+	require.Equal(t, []alterStatement{
+		{Table: "users", Alter: "ADD COLUMN email varchar(255), ADD INDEX idx_email (email)"},
+		{Database: "app", Table: "posts", Alter: "drop column legacy"},
+	}, statements)
+
+	// statements which alter the same table are combined
+	statements, err = parseAlterStatements("alter table users add column email text;\n" +
+		"alter table posts add column title text;\nalter table users add index idx_email (email);\n")
+	require.NoError(t, err)
+	require.Equal(t, []alterStatement{
+		{Table: "users", Alter: "add column email text, add index idx_email (email)"},
+		{Table: "posts", Alter: "add column title text"},
+	}, statements)
+
+	// semicolons in literals do not end a statement
+	statements, err = parseAlterStatements("alter table users add column sep varchar(1) default ';';\n")
+	require.NoError(t, err)
+	require.Equal(t, []alterStatement{{Table: "users", Alter: "add column sep varchar(1) default ';'"}}, statements)
+
+	_, err = parseAlterStatements("-- migrate:up\ncreate table users (id int);\n")
+	require.EqualError(t, err, "online migrations may only contain ALTER TABLE statements: "+
+		"create table users (id int)")
+
+	_, err = parseAlterStatements("-- migrate:up\n")
+	require.EqualError(t, err, "online migration has no ALTER TABLE statements")
+}
+
+func TestOnlineTool(t *testing.T) {
+	migration := func(online string) Migration {
+		m := NewMigration()
+		if online != "" {
+			m.Options.(migrationOptions)["online"] = online
+		}
+		return m
+	}
+
+	db := New(mySQLTestURL(t))
+	require.Equal(t, "", db.onlineTool(migration("")))
+	require.Equal(t, "gh-ost", db.onlineTool(migration("true")))
+	require.Equal(t, "pt-online-schema-change", db.onlineTool(migration("pt-osc")))
+
+	db.OnlineTool = "pt-online-schema-change"
+	require.Equal(t, "pt-online-schema-change", db.onlineTool(migration("true")))
+	require.Equal(t, "gh-ost", db.onlineTool(migration("gh-ost")))
+
+	// the tool may be set on the migration block
+	up, _, err := parseMigrationContents("-- migrate:up online:gh-ost\nalter table users add column email text;\n")
+	require.NoError(t, err)
+	require.Equal(t, "gh-ost", db.onlineTool(up))
+}
+
+func TestRunOnlineMigration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	// fake tool which prints its arguments
+	tool := filepath.Join(dir, "gh-ost")
+	err = ioutil.WriteFile(tool, []byte("#!/bin/sh\necho \"$@\"\n"), 0755)
+	require.NoError(t, err)
+
+	u, err := url.Parse("mysql://root:pw@db:3306/app")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.OnlineToolPath = tool
+	db.OnlineToolFlags = []string{"--allow-on-master"}
+
+	up, _, err := parseMigrationContents("-- migrate:online\n-- migrate:up\nalter table users add column email text;\n")
+	require.NoError(t, err)
+
+	err = db.runOnlineMigration(db.onlineTool(up), up)
+	require.NoError(t, err)
+	require.Equal(t, "--host=db --port=3306 --user=root --password=pw --database=app --table=users "+
+		"--alter=add column email text --execute --allow-on-master\n", buf.String())
+
+	db.DatabaseURL = sqliteTestURL(t)
+	err = db.runOnlineMigration("gh-ost", up)
+	require.EqualError(t, err, "online migrations are not supported by the sqlite3 driver")
+}
@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"database/sql"
 	"fmt"
+	"hash/fnv"
 	"net/url"
+	"os/exec"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -17,11 +22,159 @@ func init() {
 
 // PostgresDriver provides top level database functions
 type PostgresDriver struct {
+	// MigrationsSchema contains the schema_migrations table (default public)
+	MigrationsSchema string
+	// MigrationsTableName is the name of the migrations table (default schema_migrations)
+	MigrationsTableName string
+	// Schemas set the search_path of each connection, and limit the schema dump
+	// to these schemas (and the migrations schema)
+	Schemas []string
+	// DumpExcludeTables are table patterns which are left out of the schema dump
+	DumpExcludeTables []string
+	// DumpPrivileges includes grants and ownership in the schema dump
+	DumpPrivileges bool
+}
+
+// migrationsTable returns the qualified name of the schema_migrations table
+func (drv PostgresDriver) migrationsTable() string {
+	if drv.MigrationsTableName == "" {
+		return drv.qualifiedTable("schema_migrations")
+	}
+
+	return drv.qualifiedTable(pq.QuoteIdentifier(drv.MigrationsTableName))
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table. A
+// schema qualified name (e.g. ops.schema_migrations) also moves the other dbmate
+// tables to that schema.
+func (drv PostgresDriver) MigrationsTable(name string) Driver {
+	return drv.withMigrationsTable(name)
+}
+
+// WithPrivileges returns a driver which includes grants and ownership in the
+// schema dump
+func (drv PostgresDriver) WithPrivileges() Driver {
+	drv.DumpPrivileges = true
+
+	return drv
+}
+
+// ExcludeTables returns a driver which does not dump tables matching the
+// patterns. The patterns are passed to pg_dump with --exclude-table.
+func (drv PostgresDriver) ExcludeTables(patterns []string) Driver {
+	drv.DumpExcludeTables = patterns
+
+	return drv
+}
+
+// WithSchemas returns a driver which sets the search_path to the given schemas,
+// and only includes them in the schema dump. Migrations are tracked in the
+// first schema, unless the migrations table is qualified with a schema.
+func (drv PostgresDriver) WithSchemas(schemas []string) Driver {
+	return drv.withSchemas(schemas)
+}
+
+func (drv PostgresDriver) withSchemas(schemas []string) PostgresDriver {
+	drv.Schemas = schemas
+	if drv.MigrationsSchema == "" && len(schemas) > 0 {
+		drv.MigrationsSchema = schemas[0]
+	}
+
+	return drv
+}
+
+// dumpSchemas returns the schemas included in the schema dump, or nil for all
+// schemas. The migrations schema is always included.
+func (drv PostgresDriver) dumpSchemas() []string {
+	if len(drv.Schemas) == 0 {
+		return nil
+	}
+
+	migrationsSchema := drv.MigrationsSchema
+	if migrationsSchema == "" {
+		migrationsSchema = "public"
+	}
+	for _, schema := range drv.Schemas {
+		if schema == migrationsSchema {
+			return drv.Schemas
+		}
+	}
+
+	return append(append([]string{}, drv.Schemas...), migrationsSchema)
+}
+
+func (drv PostgresDriver) withMigrationsTable(name string) PostgresDriver {
+	schema, table := splitQualifiedName(name)
+	if schema != "" {
+		drv.MigrationsSchema = schema
+	}
+	if table != "schema_migrations" {
+		drv.MigrationsTableName = table
+	}
+
+	return drv
+}
+
+// runsTable returns the qualified name of the schema_migration_runs table
+func (drv PostgresDriver) runsTable() string {
+	return drv.qualifiedTable("schema_migration_runs")
+}
+
+// checksumsTable returns the qualified name of the schema_migration_checksums table
+func (drv PostgresDriver) checksumsTable() string {
+	return drv.qualifiedTable("schema_migration_checksums")
+}
+
+// qualifiedTable returns the name of a dbmate table in the migrations schema
+func (drv PostgresDriver) qualifiedTable(name string) string {
+	if drv.MigrationsSchema == "" {
+		return "public." + name
+	}
+
+	return pq.QuoteIdentifier(drv.MigrationsSchema) + "." + name
+}
+
+// Tenant returns a driver and URL which migrate a tenant schema, tracking its
+// migrations in a schema_migrations table within the schema
+func (drv PostgresDriver) Tenant(u *url.URL, tenant string) (Driver, *url.URL) {
+	tenantURL := *u
+	query := tenantURL.Query()
+	query.Set("options", "-csearch_path="+pq.QuoteIdentifier(tenant))
+	tenantURL.RawQuery = query.Encode()
+
+	return PostgresDriver{MigrationsSchema: tenant, MigrationsTableName: drv.MigrationsTableName,
+		DumpExcludeTables: drv.DumpExcludeTables, DumpPrivileges: drv.DumpPrivileges}, &tenantURL
+}
+
+// Info describes the postgres driver
+func (drv PostgresDriver) Info() DriverInfo {
+	return DriverInfo{
+		SchemaDump: true,
+		Binaries:   []string{"pg_dump", "pg_restore", "psql"},
+		URLOptions: []string{"sslmode", "sslcert", "sslkey", "sslrootcert", "connect_timeout",
+			"application_name", "options"},
+	}
 }
 
 // Open creates a new database connection
 func (drv PostgresDriver) Open(u *url.URL) (*sql.DB, error) {
-	return sql.Open("postgres", u.String())
+	if len(drv.Schemas) == 0 {
+		return sql.Open("postgres", u.String())
+	}
+
+	// set the search_path, unless the URL already sets it
+	schemaURL := *u
+	query := schemaURL.Query()
+	if options := query.Get("options"); !strings.Contains(options, "search_path") {
+		quoted := []string{}
+		for _, schema := range drv.Schemas {
+			quoted = append(quoted, pq.QuoteIdentifier(schema))
+		}
+		query.Set("options", strings.TrimSpace(options+" -csearch_path="+strings.Join(quoted, ",")))
+		schemaURL.RawQuery = query.Encode()
+	}
+
+	return sql.Open("postgres", schemaURL.String())
 }
 
 func (drv PostgresDriver) openPostgresDB(u *url.URL) (*sql.DB, error) {
@@ -35,7 +188,6 @@ func (drv PostgresDriver) openPostgresDB(u *url.URL) (*sql.DB, error) {
 // CreateDatabase creates the specified database
 func (drv PostgresDriver) CreateDatabase(u *url.URL) error {
 	name := databaseName(u)
-	fmt.Printf("Creating: %s\n", name)
 
 	db, err := drv.openPostgresDB(u)
 	if err != nil {
@@ -52,7 +204,6 @@ func (drv PostgresDriver) CreateDatabase(u *url.URL) error {
 // DropDatabase drops the specified database (if it exists)
 func (drv PostgresDriver) DropDatabase(u *url.URL) error {
 	name := databaseName(u)
-	fmt.Printf("Dropping: %s\n", name)
 
 	db, err := drv.openPostgresDB(u)
 	if err != nil {
@@ -66,10 +217,10 @@ func (drv PostgresDriver) DropDatabase(u *url.URL) error {
 	return err
 }
 
-func postgresSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
+func postgresSchemaMigrationsDump(db *sql.DB, table string) ([]byte, error) {
 	// load applied migrations
 	migrations, err := queryColumn(db,
-		"select quote_literal(version) from public.schema_migrations order by version asc")
+		"select quote_literal(version) from "+table+" order by version asc")
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +230,7 @@ func postgresSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
 	buf.WriteString("\n--\n-- Dbmate schema migrations\n--\n\n")
 
 	if len(migrations) > 0 {
-		buf.WriteString("INSERT INTO public.schema_migrations (version) VALUES\n    (" +
+		buf.WriteString("INSERT INTO " + table + " (version) VALUES\n    (" +
 			strings.Join(migrations, "),\n    (") +
 			");\n")
 	}
@@ -87,16 +238,54 @@ func postgresSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// DumpSchema returns the current database schema
+// DumpSchema returns the current database schema, using pg_dump if it is
+// installed, and otherwise a dump generated from the system catalogs
 func (drv PostgresDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	if _, err := exec.LookPath("pg_dump"); err != nil {
+		return drv.dumpCatalogSchema(db)
+	}
+
+	return drv.dumpSchemaWith("pg_dump", u, db)
+}
+
+// dumpCatalogSchema returns the current database schema, generated from the
+// system catalogs
+func (drv PostgresDriver) dumpCatalogSchema(db *sql.DB) ([]byte, error) {
+	schema, err := postgresCatalogDump(db, drv)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := postgresSchemaMigrationsDump(db, drv.migrationsTable())
+	if err != nil {
+		return nil, err
+	}
+
+	schema = append(schema, migrations...)
+	return trimLeadingSQLComments(schema)
+}
+
+// dumpSchemaWith returns the current database schema, using a pg_dump compatible
+// command with any additional arguments
+func (drv PostgresDriver) dumpSchemaWith(command string, u *url.URL, db *sql.DB,
+	args ...string) ([]byte, error) {
 	// load schema
-	schema, err := runCommand("pg_dump", "--format=plain", "--encoding=UTF8",
-		"--schema-only", "--no-privileges", "--no-owner", u.String())
+	args = append([]string{"--format=plain", "--encoding=UTF8", "--schema-only"}, args...)
+	if !drv.DumpPrivileges {
+		args = append(args, "--no-privileges", "--no-owner")
+	}
+	for _, schema := range drv.dumpSchemas() {
+		args = append(args, "--schema="+pq.QuoteIdentifier(schema))
+	}
+	for _, pattern := range drv.DumpExcludeTables {
+		args = append(args, "--exclude-table="+pattern)
+	}
+	schema, err := runCommand(command, append(args, u.String())...)
 	if err != nil {
 		return nil, err
 	}
 
-	migrations, err := postgresSchemaMigrationsDump(db)
+	migrations, err := postgresSchemaMigrationsDump(db, drv.migrationsTable())
 	if err != nil {
 		return nil, err
 	}
@@ -127,16 +316,39 @@ func (drv PostgresDriver) DatabaseExists(u *url.URL) (bool, error) {
 
 // CreateMigrationsTable creates the schema_migrations table
 func (drv PostgresDriver) CreateMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec("create table if not exists public.schema_migrations " +
-		"(version varchar(255) primary key)")
+	_, err := db.Exec("create table if not exists " + drv.migrationsTable() +
+		" (version varchar(255) primary key, checksum varchar(64), " +
+		strings.Join(metadataColumns("timestamptz"), ", ") + ")")
 
 	return err
 }
 
+// migrationsColumnExists returns whether the migrations table has a column, which
+// may be missing from a table created by an older version of dbmate
+func (drv PostgresDriver) migrationsColumnExists(db *sql.DB, column string) (bool, error) {
+	schema, table := drv.MigrationsSchema, drv.MigrationsTableName
+	if schema == "" {
+		schema = "public"
+	}
+	if table == "" {
+		table = "schema_migrations"
+	}
+	var columns int
+	err := db.QueryRow("select count(*) from information_schema.columns "+
+		"where table_schema = $1 and table_name = $2 and column_name = $3", schema, table, column).Scan(&columns)
+
+	return columns > 0, err
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv PostgresDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.migrationsColumnExists(db, "version")
+}
+
 // SelectMigrations returns a list of applied migrations
 // with an optional limit (in descending order)
 func (drv PostgresDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
-	query := "select version from public.schema_migrations order by version desc"
+	query := "select version from " + drv.migrationsTable() + " order by version desc"
 	if limit >= 0 {
 		query = fmt.Sprintf("%s limit %d", query, limit)
 	}
@@ -162,14 +374,365 @@ func (drv PostgresDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bo
 
 // InsertMigration adds a new migration record
 func (drv PostgresDriver) InsertMigration(db Transaction, version string) error {
-	_, err := db.Exec("insert into public.schema_migrations (version) values ($1)", version)
+	_, err := db.Exec("insert into "+drv.migrationsTable()+" (version) values ($1)", version)
 
 	return err
 }
 
 // DeleteMigration removes a migration record
 func (drv PostgresDriver) DeleteMigration(db Transaction, version string) error {
-	_, err := db.Exec("delete from public.schema_migrations where version = $1", version)
+	_, err := db.Exec("delete from "+drv.migrationsTable()+" where version = $1", version)
+
+	return err
+}
+
+// CreateChecksumsTable creates schema_migration_checksums, which records the
+// checksums of repeatable migrations, and adds the checksum column to a
+// migrations table created by an older version of dbmate
+func (drv PostgresDriver) CreateChecksumsTable(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists " + drv.checksumsTable() +
+		" (version varchar(255) primary key, checksum varchar(64) not null)")
+	if err != nil {
+		return err
+	}
+
+	exists, err := drv.migrationsColumnExists(db, "checksum")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = db.Exec("alter table " + drv.migrationsTable() + " add column checksum varchar(64)")
+
+	return err
+}
+
+// CreateMetadataColumns adds the metadata columns to a migrations table created by
+// an older version of dbmate
+func (drv PostgresDriver) CreateMetadataColumns(db *sql.DB) error {
+	return addMetadataColumns(db, drv.migrationsTable(), metadataColumns("timestamptz"), drv.migrationsColumnExists)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv PostgresDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	_, err := db.Exec("update "+drv.migrationsTable()+" set applied_at = $1, duration_ms = $2, "+
+		"applied_by = $3, hostname = $4, dbmate_version = $5 where version = $6",
+		append(metadataValues(meta), version)...)
+
+	return err
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv PostgresDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	exists, err := metadataColumnsExist(db, drv.migrationsColumnExists)
+	if err != nil || !exists {
+		return map[string]MigrationMetadata{}, err
+	}
+
+	return selectMetadata(db, metadataSelect+drv.migrationsTable()+" where applied_at is not null")
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv PostgresDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	exists, err := drv.migrationsColumnExists(db, "checksum")
+	if err != nil || !exists {
+		return map[string]string{}, err
+	}
+
+	return selectChecksums(db, "select version, checksum from "+drv.migrationsTable()+
+		" where checksum is not null")
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv PostgresDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return selectChecksums(db, "select version, checksum from "+drv.checksumsTable())
+}
+
+// InsertChecksum records the checksum of an applied migration in schema_migrations
+func (drv PostgresDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	_, err := db.Exec("update "+drv.migrationsTable()+" set checksum = $1 where version = $2",
+		checksum, version)
+
+	return err
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv PostgresDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	if _, err := db.Exec("delete from "+drv.checksumsTable()+" where version = $1", name); err != nil {
+		return err
+	}
+	_, err := db.Exec("insert into "+drv.checksumsTable()+" (version, checksum) values ($1, $2)",
+		name, checksum)
+
+	return err
+}
+
+// CreateRunsTable creates the schema_migration_runs table
+func (drv PostgresDriver) CreateRunsTable(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists " + drv.runsTable() + " (" +
+		"id bigserial primary key, " +
+		"run_id varchar(32) not null, " +
+		"version varchar(255) not null, " +
+		"direction varchar(4) not null, " +
+		"started_at timestamptz not null, " +
+		"duration_ms bigint not null, " +
+		"rows_affected bigint not null, " +
+		"lock_wait_ms bigint not null, " +
+		"success boolean not null, " +
+		"error text)")
+
+	return err
+}
+
+// InsertRun records a migration result in the schema_migration_runs table
+func (drv PostgresDriver) InsertRun(db *sql.DB, runID string, result MigrationResult) error {
+	_, err := db.Exec("insert into "+drv.runsTable()+" ("+runsInsertColumns+") "+
+		"values ($1, $2, $3, $4, $5, $6, $7, $8, $9)", runValues(runID, result)...)
+
+	return err
+}
+
+// SelectRunDirections returns the direction of the most recent successful run of
+// each version
+func (drv PostgresDriver) SelectRunDirections(db *sql.DB) (map[string]string, error) {
+	var exists bool
+	err := db.QueryRow("select to_regclass($1) is not null", drv.runsTable()).Scan(&exists)
+	if err != nil || !exists {
+		return nil, err
+	}
+
+	return selectRunDirections(db, "select version, direction from "+drv.runsTable()+
+		" where success order by id")
+}
+
+// Backup writes a pg_dump archive of the database
+func (drv PostgresDriver) Backup(u *url.URL, path string, schemaOnly bool) error {
+	args := []string{"--format=custom", "--file=" + path}
+	if schemaOnly {
+		args = append(args, "--schema-only")
+	}
+
+	_, err := runCommand("pg_dump", append(args, u.String())...)
+	return err
+}
+
+// Restore replaces the database contents with a pg_dump archive
+func (drv PostgresDriver) Restore(u *url.URL, path string) error {
+	_, err := runCommand("pg_restore", "--clean", "--if-exists", "--single-transaction",
+		"--dbname="+u.String(), path)
+	return err
+}
+
+// ConsoleCommand returns the psql command to connect to the database
+func (drv PostgresDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return "psql", []string{u.String()}
+}
+
+// postgresNoTransactionRegExp matches statements which postgres can't run
+// inside a transaction block. Values added to an enum can't be used in the same
+// transaction (and older versions can't add them in a transaction at all).
+var postgresNoTransactionRegExp = regexp.MustCompile(`(?im)^\s*(?:` +
+	`(?:create|drop)\s+(?:unique\s+)?index\s+concurrently|` +
+	`reindex\s[^;]*\bconcurrently|` +
+	`alter\s+table\s[^;]*\bdetach\s+partition\s[^;]*\bconcurrently|` +
+	`alter\s+type\s[^;]*\badd\s+value|` +
+	`vacuum|alter\s+system|` +
+	`(?:create|drop)\s+(?:database|tablespace))\b`)
+
+// NoTransactionStatement returns the first statement of migration contents which
+// postgres can't run inside a transaction, or an empty string
+func (drv PostgresDriver) NoTransactionStatement(contents string) string {
+	for _, stmt := range splitStatements(contents) {
+		if postgresNoTransactionRegExp.MatchString(trimSQLComments(stmt)) {
+			return stmt
+		}
+	}
+
+	return ""
+}
+
+// RetryableError returns whether an error was caused by a lock timeout or deadlock
+func (drv PostgresDriver) RetryableError(err error) bool {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return false
+	}
+
+	// lock_not_available, deadlock_detected
+	return pqErr.Code == "55P03" || pqErr.Code == "40P01"
+}
+
+// ErrorPosition returns the offset in query of the position reported by a
+// postgres error, which counts characters from 1
+func (drv PostgresDriver) ErrorPosition(err error, query string) (int, bool) {
+	pqErr, ok := err.(*pq.Error)
+	if !ok {
+		return 0, false
+	}
+	position, convErr := strconv.Atoi(pqErr.Position)
+	if convErr != nil || position < 1 {
+		return 0, false
+	}
+
+	for offset := range query {
+		if position--; position == 0 {
+			return offset, true
+		}
+	}
+
+	return 0, false
+}
+
+var concurrentIndexRegExp = regexp.MustCompile(
+	`(?i)create\s+(?:unique\s+)?index\s+concurrently\s+(?:if\s+not\s+exists\s+)?("?[\w.]+"?)`)
+
+// PrepareRetry drops any invalid indexes left behind by a failed
+// `create index concurrently`, so that the migration can be retried
+func (drv PostgresDriver) PrepareRetry(db *sql.DB, contents string) error {
+	for _, match := range concurrentIndexRegExp.FindAllStringSubmatch(contents, -1) {
+		name := match[1]
+
+		invalid := false
+		err := db.QueryRow("select not indisvalid from pg_index where indexrelid = to_regclass($1)",
+			name).Scan(&invalid)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if invalid {
+			if _, err := db.Exec("drop index concurrently if exists " + name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// LockTimeoutSQL returns statements to set and reset the session lock timeout
+func (drv PostgresDriver) LockTimeoutSQL(d time.Duration) (string, string) {
+	return fmt.Sprintf("set lock_timeout = %d", durationUnits(d, time.Millisecond)),
+		"reset lock_timeout"
+}
+
+// ReplicationLag returns the replay lag of a replica, or the highest replay lag
+// reported in pg_stat_replication when connected to a primary
+func (drv PostgresDriver) ReplicationLag(db *sql.DB) (time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := db.QueryRow(`select case when pg_is_in_recovery()
+		then extract(epoch from now() - pg_last_xact_replay_timestamp())
+		else (select extract(epoch from max(replay_lag)) from pg_stat_replication) end`).Scan(&seconds)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(seconds.Float64 * float64(time.Second)), nil
+}
+
+// Blockers returns sessions which hold locks on any of the tables, or have a
+// transaction open for longer than maxAge
+func (drv PostgresDriver) Blockers(db *sql.DB, tables []string, maxAge time.Duration) ([]Blocker, error) {
+	rows, err := db.Query(`select a.pid, coalesce(string_agg(distinct l.relation::regclass::text, ', '), ''),
+			coalesce(a.query, ''), coalesce(extract(epoch from now() - a.xact_start), 0)
+		from pg_stat_activity a
+		left join pg_locks l on l.pid = a.pid and l.granted
+			and l.relation = any(select to_regclass(t) from unnest($1::text[]) as t)
+		where a.pid <> pg_backend_pid() and a.backend_type = 'client backend'
+		group by a.pid, a.query, a.xact_start
+		having count(l.relation) > 0 or a.xact_start < now() - interval '1 millisecond' * $2::float8
+		order by a.xact_start`, pq.Array(tables), durationUnits(maxAge, time.Millisecond))
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	blockers := []Blocker{}
+	for rows.Next() {
+		var b Blocker
+		var seconds float64
+		if err := rows.Scan(&b.PID, &b.Table, &b.Query, &seconds); err != nil {
+			return nil, err
+		}
+		b.Age = time.Duration(seconds * float64(time.Second))
+		blockers = append(blockers, b)
+	}
+
+	return blockers, rows.Err()
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings
+func (drv PostgresDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	var statements []string
+	if s.LockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("set lock_timeout = %d",
+			durationUnits(s.LockTimeout, time.Millisecond)))
+	}
+	if s.StatementTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("set statement_timeout = %d",
+			durationUnits(s.StatementTimeout, time.Millisecond)))
+	}
+	if s.IdleInTransactionTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("set idle_in_transaction_session_timeout = %d",
+			durationUnits(s.IdleInTransactionTimeout, time.Millisecond)))
+	}
+
+	return statements, nil
+}
+
+// ResetSessionSettingsSQL returns the statements which reset session settings to
+// their defaults
+func (drv PostgresDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	var statements []string
+	if s.LockTimeout > 0 {
+		statements = append(statements, "reset lock_timeout")
+	}
+	if s.StatementTimeout > 0 {
+		statements = append(statements, "reset statement_timeout")
+	}
+	if s.IdleInTransactionTimeout > 0 {
+		statements = append(statements, "reset idle_in_transaction_session_timeout")
+	}
+
+	return statements
+}
+
+// migrationsLockKey returns the advisory lock key for the migrations table
+func (drv PostgresDriver) migrationsLockKey() int64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte("dbmate:" + drv.migrationsTable()))
+
+	return int64(h.Sum64())
+}
+
+// Lock acquires a session advisory lock keyed on the migrations table, waiting
+// for up to timeout (or indefinitely if zero)
+func (drv PostgresDriver) Lock(db *sql.DB, timeout time.Duration) error {
+	if timeout > 0 {
+		_, err := db.Exec(fmt.Sprintf("set lock_timeout = %d", durationUnits(timeout, time.Millisecond)))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := db.Exec("select pg_advisory_lock($1)", drv.migrationsLockKey())
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "55P03" {
+		return fmt.Errorf("timed out after %s waiting for the migrations lock, "+
+			"another migration is in progress", timeout)
+	}
+
+	return err
+}
+
+// Unlock releases the advisory lock
+func (drv PostgresDriver) Unlock(db *sql.DB) error {
+	_, err := db.Exec("select pg_advisory_unlock($1)", drv.migrationsLockKey())
 
 	return err
 }
@@ -0,0 +1,235 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// postgresCopyRegExp matches a COPY FROM stdin statement on a single line, as
+// written by pg_dump
+var postgresCopyRegExp = regexp.MustCompile(`(?i)^\s*copy\s+.*\bfrom\s+stdin\b([^;]*);\s*$`)
+
+// postgresCopyFormatRegExp matches COPY options which change the data format
+var postgresCopyFormatRegExp = regexp.MustCompile(`(?i)\b(csv|binary|delimiter)\b`)
+
+// postgresPreparer is a transaction (or database) which can prepare statements
+type postgresPreparer interface {
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// splitPostgresCopy splits migration contents into batches, so that each COPY
+// FROM stdin statement and its data (up to the \. terminator) is a separate
+// batch. Contents without COPY statements are returned as a single batch.
+func splitPostgresCopy(contents string) []string {
+	lines := strings.SplitAfter(contents, "\n")
+
+	batches := []string{}
+	var batch strings.Builder
+	flush := func() {
+		if strings.TrimSpace(trimSQLComments(batch.String())) != "" {
+			batches = append(batches, batch.String())
+		}
+		batch.Reset()
+	}
+
+	found := false
+	for i := 0; i < len(lines); i++ {
+		if !postgresCopyRegExp.MatchString(strings.TrimRight(lines[i], "\r\n")) {
+			batch.WriteString(lines[i])
+			continue
+		}
+
+		found = true
+		flush()
+		batch.WriteString(lines[i])
+		for i++; i < len(lines); i++ {
+			batch.WriteString(lines[i])
+			if strings.TrimRight(lines[i], "\r\n") == `\.` {
+				break
+			}
+		}
+		flush()
+	}
+	if !found {
+		return []string{contents}
+	}
+	flush()
+
+	return batches
+}
+
+// parsePostgresCopy returns the COPY statement of a batch and its data rows,
+// or an empty statement if the batch does not start with COPY FROM stdin
+func parsePostgresCopy(batch string) (string, [][]interface{}, error) {
+	lines := strings.Split(batch, "\n")
+	stmt := strings.TrimSpace(lines[0])
+	match := postgresCopyRegExp.FindStringSubmatch(stmt)
+	if match == nil {
+		return "", nil, nil
+	}
+	if postgresCopyFormatRegExp.MatchString(match[1]) {
+		return stmt, nil, fmt.Errorf("COPY FROM stdin only supports the default text format: %s", stmt)
+	}
+
+	rows := [][]interface{}{}
+	for _, line := range lines[1:] {
+		line = strings.TrimSuffix(line, "\r")
+		if line == `\.` {
+			return stmt, rows, nil
+		}
+		rows = append(rows, postgresCopyFields(line))
+	}
+
+	return stmt, nil, fmt.Errorf(`COPY FROM stdin data must end with a \. line: %s`, stmt)
+}
+
+// postgresCopyFields decodes a row of COPY text format data
+func postgresCopyFields(line string) []interface{} {
+	fields := []interface{}{}
+	for _, field := range strings.Split(line, "\t") {
+		if field == `\N` {
+			fields = append(fields, nil)
+		} else {
+			fields = append(fields, postgresCopyUnescape(field))
+		}
+	}
+
+	return fields
+}
+
+// postgresCopyUnescape decodes the backslash escapes of a COPY text format field
+func postgresCopyUnescape(field string) string {
+	if !strings.Contains(field, `\`) {
+		return field
+	}
+
+	var buf bytes.Buffer
+	for i := 0; i < len(field); i++ {
+		if field[i] != '\\' || i == len(field)-1 {
+			buf.WriteByte(field[i])
+			continue
+		}
+
+		i++
+		switch c := field[i]; c {
+		case 'b':
+			buf.WriteByte('\b')
+		case 'f':
+			buf.WriteByte('\f')
+		case 'n':
+			buf.WriteByte('\n')
+		case 'r':
+			buf.WriteByte('\r')
+		case 't':
+			buf.WriteByte('\t')
+		case 'v':
+			buf.WriteByte('\v')
+		case 'x':
+			digits := postgresCopyDigits(field[i+1:], 2, "0123456789abcdefABCDEF")
+			if digits == "" {
+				buf.WriteByte(c)
+				continue
+			}
+			value, _ := strconv.ParseUint(digits, 16, 8)
+			buf.WriteByte(byte(value))
+			i += len(digits)
+		case '0', '1', '2', '3', '4', '5', '6', '7':
+			digits := postgresCopyDigits(field[i:], 3, "01234567")
+			value, _ := strconv.ParseUint(digits, 8, 16)
+			buf.WriteByte(byte(value))
+			i += len(digits) - 1
+		default:
+			buf.WriteByte(c)
+		}
+	}
+
+	return buf.String()
+}
+
+// postgresCopyDigits returns up to max leading characters of s within digits
+func postgresCopyDigits(s string, max int, digits string) string {
+	n := 0
+	for n < len(s) && n < max && strings.IndexByte(digits, s[n]) >= 0 {
+		n++
+	}
+
+	return s[:n]
+}
+
+// postgresCopyIn streams rows to a COPY FROM stdin statement
+func postgresCopyIn(tx postgresPreparer, stmt string, rows [][]interface{}) error {
+	copyStmt, err := tx.Prepare(stmt)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = copyStmt.Close()
+	}()
+
+	for _, row := range rows {
+		if _, err := copyStmt.Exec(row...); err != nil {
+			return err
+		}
+	}
+
+	// flush the data and complete the COPY
+	_, err = copyStmt.Exec()
+
+	return err
+}
+
+// SplitBatches splits migration contents around COPY FROM stdin statements,
+// which are run separately to stream their data. Migrations with statements
+// which can't run inside a transaction are also split into statements, because
+// postgres runs a query with several statements in an implicit transaction.
+func (drv PostgresDriver) SplitBatches(contents string) []string {
+	batches := splitPostgresCopy(contents)
+	if drv.NoTransactionStatement(contents) == "" {
+		return batches
+	}
+
+	statements := []string{}
+	for _, batch := range batches {
+		if stmt, _, _ := parsePostgresCopy(batch); stmt != "" {
+			statements = append(statements, batch)
+		} else {
+			statements = append(statements, splitStatements(batch)...)
+		}
+	}
+
+	return statements
+}
+
+// ExecCopy runs a COPY FROM stdin statement, streaming its inline data with the
+// COPY protocol. COPY requires a transaction, so migrations which do not run in
+// a transaction load the data in a transaction of its own.
+func (drv PostgresDriver) ExecCopy(tx Transaction, batch string) (int64, bool, error) {
+	stmt, rows, err := parsePostgresCopy(batch)
+	if stmt == "" || err != nil {
+		return 0, stmt != "", err
+	}
+
+	if db, ok := tx.(*sql.DB); ok {
+		copyTx, err := db.Begin()
+		if err != nil {
+			return 0, true, err
+		}
+		if err := postgresCopyIn(copyTx, stmt, rows); err != nil {
+			_ = copyTx.Rollback()
+			return 0, true, err
+		}
+
+		return int64(len(rows)), true, copyTx.Commit()
+	}
+
+	preparer, ok := tx.(postgresPreparer)
+	if !ok {
+		return 0, true, fmt.Errorf("COPY FROM stdin is not supported by this connection")
+	}
+
+	return int64(len(rows)), true, postgresCopyIn(preparer, stmt, rows)
+}
@@ -0,0 +1,83 @@
+package dbmate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPostgresCopy(t *testing.T) {
+	// contents without COPY are a single batch
+	contents := "create table users (id int);\ninsert into users values (1);\n"
+	require.Equal(t, []string{contents}, splitPostgresCopy(contents))
+
+	batches := splitPostgresCopy("create table users (id int, name text);\n\n" +
+		"COPY public.users (id, name) FROM stdin;\n1\talice\n2\t\\N\n\\.\n\n" +
+		"-- comment\n\ncopy users from stdin;\n\\.\nselect 1;\n")
+	require.Equal(t, []string{
+		"create table users (id int, name text);\n\n",
+		"COPY public.users (id, name) FROM stdin;\n1\talice\n2\t\\N\n\\.\n",
+		"copy users from stdin;\n\\.\n",
+		"select 1;\n",
+	}, batches)
+}
+
+func TestPostgresSplitBatches(t *testing.T) {
+	drv := PostgresDriver{}
+
+	contents := "create table users (id int);\ninsert into users values (1);\n"
+	require.Equal(t, []string{contents}, drv.SplitBatches(contents))
+
+	// statements which can't run in a transaction are run separately
+	batches := drv.SplitBatches("alter table users add column email text;\n" +
+		"create index concurrently users_email on users (email);\n" +
+		"copy users (id) from stdin;\n2\n\\.\n")
+	require.Equal(t, []string{
+		"alter table users add column email text",
+		"create index concurrently users_email on users (email)",
+		"copy users (id) from stdin;\n2\n\\.\n",
+	}, batches)
+
+	// function bodies and literals may contain semicolons
+	batches = drv.SplitBatches("create function f() returns int as $$ begin return 1; end; $$ language plpgsql;\n" +
+		"create function g() returns text as 'select '';''' language sql;\n" +
+		"create index concurrently users_email on users (email);\n")
+	require.Equal(t, []string{
+		"create function f() returns int as $$ begin return 1; end; $$ language plpgsql",
+		"create function g() returns text as 'select '';''' language sql",
+		"create index concurrently users_email on users (email)",
+	}, batches)
+}
+
+func TestParsePostgresCopy(t *testing.T) {
+	stmt, rows, err := parsePostgresCopy("COPY public.users (id, name) FROM stdin;\n" +
+		"1\talice\n2\t\\N\n3\ttab\\there\r\n\\.\n")
+	require.NoError(t, err)
+	require.Equal(t, "COPY public.users (id, name) FROM stdin;", stmt)
+	require.Equal(t, [][]interface{}{
+		{"1", "alice"},
+		{"2", nil},
+		{"3", "tab\there"},
+	}, rows)
+
+	// other statements are not a COPY
+	stmt, _, err = parsePostgresCopy("select 1;\n")
+	require.NoError(t, err)
+	require.Equal(t, "", stmt)
+
+	_, _, err = parsePostgresCopy("COPY users FROM stdin;\n1\n")
+	require.EqualError(t, err, `COPY FROM stdin data must end with a \. line: COPY users FROM stdin;`)
+
+	_, _, err = parsePostgresCopy("COPY users FROM stdin WITH (FORMAT csv);\n1\n\\.\n")
+	require.EqualError(t, err, "COPY FROM stdin only supports the default text format: "+
+		"COPY users FROM stdin WITH (FORMAT csv);")
+}
+
+func TestPostgresCopyUnescape(t *testing.T) {
+	require.Equal(t, "plain", postgresCopyUnescape("plain"))
+	require.Equal(t, "a\\b", postgresCopyUnescape(`a\\b`))
+	require.Equal(t, "line\nbreak\r", postgresCopyUnescape(`line\nbreak\r`))
+	require.Equal(t, "AB", postgresCopyUnescape(`\101\x42`))
+	require.Equal(t, "x.", postgresCopyUnescape(`\x\.`))
+	require.Equal(t, `trailing\`, postgresCopyUnescape(`trailing\`))
+}
@@ -0,0 +1,716 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// postgresDumpHeader matches the session settings written by pg_dump
+const postgresDumpHeader = `SET statement_timeout = 0;
+SET lock_timeout = 0;
+SET idle_in_transaction_session_timeout = 0;
+SET client_encoding = 'UTF8';
+SET standard_conforming_strings = on;
+SELECT pg_catalog.set_config('search_path', '', false);
+SET check_function_bodies = false;
+SET xmloption = content;
+SET client_min_messages = warning;
+SET row_security = off;
+
+`
+
+func postgresQuoteLiteral(str string) string {
+	return "'" + strings.Replace(str, "'", "''", -1) + "'"
+}
+
+// postgresNamespaceFilter returns a condition which filters out system schemas,
+// or schemas which are not listed (if any are)
+func postgresNamespaceFilter(schemas []string) string {
+	if len(schemas) == 0 {
+		return `n.nspname <> 'information_schema' and n.nspname not like 'pg\_%'`
+	}
+
+	quoted := []string{}
+	for _, schema := range schemas {
+		quoted = append(quoted, postgresQuoteLiteral(schema))
+	}
+
+	return "n.nspname in (" + strings.Join(quoted, ", ") + ")"
+}
+
+// postgresNotExtensionMember returns a condition which filters out objects that
+// are created by an extension
+func postgresNotExtensionMember(catalog, oid string) string {
+	return fmt.Sprintf("not exists (select 1 from pg_depend e where e.classid = '%s'::regclass "+
+		"and e.objid = %s and e.deptype = 'e')", catalog, oid)
+}
+
+// postgresSequence contains the options of a sequence
+type postgresSequence struct {
+	dataType                          string
+	start, increment, min, max, cache int64
+	cycle                             bool
+}
+
+// options returns the sequence options, in the format written by pg_dump. The
+// data type is not included.
+func (s postgresSequence) options() []string {
+	typeMin, typeMax := int64(math.MinInt64), int64(math.MaxInt64)
+	switch s.dataType {
+	case "smallint":
+		typeMin, typeMax = math.MinInt16, math.MaxInt16
+	case "integer":
+		typeMin, typeMax = math.MinInt32, math.MaxInt32
+	}
+
+	defaultMin, defaultMax := int64(1), typeMax
+	if s.increment < 0 {
+		defaultMin, defaultMax = typeMin, -1
+	}
+
+	options := []string{
+		fmt.Sprintf("START WITH %d", s.start),
+		fmt.Sprintf("INCREMENT BY %d", s.increment),
+	}
+	if s.min == defaultMin {
+		options = append(options, "NO MINVALUE")
+	} else {
+		options = append(options, fmt.Sprintf("MINVALUE %d", s.min))
+	}
+	if s.max == defaultMax {
+		options = append(options, "NO MAXVALUE")
+	} else {
+		options = append(options, fmt.Sprintf("MAXVALUE %d", s.max))
+	}
+	options = append(options, fmt.Sprintf("CACHE %d", s.cache))
+	if s.cycle {
+		options = append(options, "CYCLE")
+	}
+
+	return options
+}
+
+// postgresDumpEntry is a statement in a schema dump
+type postgresDumpEntry struct {
+	name, kind, schema, stmt string
+}
+
+// postgresCatalogDumper generates a schema dump by querying the system catalogs
+type postgresCatalogDumper struct {
+	tx  *sql.Tx
+	buf bytes.Buffer
+	// namespaces filters the schemas which are dumped
+	namespaces string
+	// exclude are the patterns of tables which are not dumped
+	exclude []string
+	// withPrivileges includes ownership and grants
+	withPrivileges bool
+	// defaults are column defaults which use a sequence
+	defaults []postgresDumpEntry
+}
+
+// postgresCatalogDump returns the database schema in the format written by
+// pg_dump, for use when pg_dump is not installed. Schemas, extensions, types,
+// functions, tables, views, sequences, constraints, indexes, triggers, and
+// comments on tables and columns are included. It requires PostgreSQL 13 or later.
+// The dump options of the driver are respected: if schemas are listed, only
+// objects in those schemas are included, and tables, views, and sequences
+// matching the exclude patterns are left out, along with their indexes,
+// constraints, triggers, and owned sequences.
+func postgresCatalogDump(db *sql.DB, drv PostgresDriver) ([]byte, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	// qualify all names in the generated statements
+	if _, err := tx.Exec("set local search_path = ''"); err != nil {
+		return nil, err
+	}
+
+	d := &postgresCatalogDumper{
+		tx:             tx,
+		namespaces:     postgresNamespaceFilter(drv.dumpSchemas()),
+		exclude:        drv.DumpExcludeTables,
+		withPrivileges: drv.DumpPrivileges,
+	}
+	d.buf.WriteString(postgresDumpHeader)
+
+	for _, section := range []func() error{d.schemas, d.extensions, d.types, d.functions,
+		d.tables, d.views, d.sequences, d.columnDefaults, d.constraints, d.indexes,
+		d.triggers, d.foreignKeys, d.privileges} {
+		if err := section(); err != nil {
+			return nil, err
+		}
+	}
+
+	d.buf.WriteString("--\n-- PostgreSQL database dump complete\n--\n\n")
+
+	return d.buf.Bytes(), nil
+}
+
+// entry writes a statement with the comment header written by pg_dump
+func (d *postgresCatalogDumper) entry(name, kind, schema, stmt string) {
+	fmt.Fprintf(&d.buf, "--\n-- Name: %s; Type: %s; Schema: %s; Owner: -\n--\n\n%s\n\n\n",
+		name, kind, schema, stmt)
+}
+
+// excluded returns a condition which matches the relations (using the given
+// pg_class and pg_namespace aliases) which are excluded from the dump
+func (d *postgresCatalogDumper) excluded(class, namespace string) string {
+	conditions := []string{"false"}
+	for _, pattern := range d.exclude {
+		schema, table := splitQualifiedName(pattern)
+		condition := class + ".relname like " + postgresQuoteLiteral(likePattern(table))
+		if schema != "" {
+			condition += " and " + namespace + ".nspname like " + postgresQuoteLiteral(likePattern(schema))
+		}
+		conditions = append(conditions, "("+condition+")")
+	}
+
+	return "(" + strings.Join(conditions, " or ") + ")"
+}
+
+// query runs a catalog query and calls scan for each row
+func (d *postgresCatalogDumper) query(query string, scan func(*sql.Rows) error) error {
+	rows, err := d.tx.Query(query)
+	if err != nil {
+		return err
+	}
+	defer mustClose(rows)
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (d *postgresCatalogDumper) schemas() error {
+	return d.query(`select n.nspname, quote_ident(n.nspname) from pg_namespace n
+		where n.nspname <> 'public' and `+d.namespaces+`
+		and `+postgresNotExtensionMember("pg_namespace", "n.oid")+`
+		order by n.nspname`, func(rows *sql.Rows) error {
+		var name, quoted string
+		if err := rows.Scan(&name, &quoted); err != nil {
+			return err
+		}
+
+		d.entry(name, "SCHEMA", "-", "CREATE SCHEMA "+quoted+";")
+		return nil
+	})
+}
+
+func (d *postgresCatalogDumper) extensions() error {
+	return d.query(`select x.extname, quote_ident(x.extname), quote_ident(n.nspname),
+			coalesce(quote_literal(obj_description(x.oid, 'pg_extension')), '')
+		from pg_extension x join pg_namespace n on n.oid = x.extnamespace
+		where x.extname <> 'plpgsql'
+		order by x.extname`, func(rows *sql.Rows) error {
+		var name, quoted, schema, comment string
+		if err := rows.Scan(&name, &quoted, &schema, &comment); err != nil {
+			return err
+		}
+
+		d.entry(name, "EXTENSION", "-", "CREATE EXTENSION IF NOT EXISTS "+quoted+
+			" WITH SCHEMA "+schema+";")
+		if comment != "" {
+			d.entry("EXTENSION "+name, "COMMENT", "-", "COMMENT ON EXTENSION "+quoted+
+				" IS "+comment+";")
+		}
+		return nil
+	})
+}
+
+func (d *postgresCatalogDumper) types() error {
+	type pgType struct {
+		oid, relid           int64
+		schema, name, quoted string
+		kind                 string
+	}
+
+	types := []pgType{}
+	err := d.query(`select t.oid, t.typrelid, n.nspname, t.typname,
+			quote_ident(n.nspname) || '.' || quote_ident(t.typname), t.typtype
+		from pg_type t join pg_namespace n on n.oid = t.typnamespace
+		left join pg_class c on c.oid = t.typrelid
+		where (t.typtype in ('e', 'd') or (t.typtype = 'c' and c.relkind = 'c'))
+		and `+d.namespaces+` and `+postgresNotExtensionMember("pg_type", "t.oid")+`
+		order by n.nspname, t.typname`, func(rows *sql.Rows) error {
+		var t pgType
+		if err := rows.Scan(&t.oid, &t.relid, &t.schema, &t.name, &t.quoted, &t.kind); err != nil {
+			return err
+		}
+
+		types = append(types, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, t := range types {
+		var stmt string
+		switch t.kind {
+		case "e":
+			labels, err := queryColumn(d.tx, fmt.Sprintf("select quote_literal(enumlabel) "+
+				"from pg_enum where enumtypid = %d order by enumsortorder", t.oid))
+			if err != nil {
+				return err
+			}
+			stmt = "CREATE TYPE " + t.quoted + " AS ENUM (\n"
+			if len(labels) > 0 {
+				stmt += "    " + strings.Join(labels, ",\n    ") + "\n"
+			}
+			stmt += ");"
+		case "d":
+			var base, def string
+			var notNull bool
+			err := d.tx.QueryRow(`select format_type(typbasetype, typtypmod), typnotnull,
+				coalesce(typdefault, '') from pg_type where oid = $1`, t.oid).
+				Scan(&base, &notNull, &def)
+			if err != nil {
+				return err
+			}
+			stmt = "CREATE DOMAIN " + t.quoted + " AS " + base
+			if def != "" {
+				stmt += " DEFAULT " + def
+			}
+			if notNull {
+				stmt += " NOT NULL"
+			}
+			checks, err := queryColumn(d.tx, fmt.Sprintf("select 'CONSTRAINT ' || "+
+				"quote_ident(conname) || ' ' || pg_get_constraintdef(oid) from pg_constraint "+
+				"where contypid = %d and contype = 'c' order by conname", t.oid))
+			if err != nil {
+				return err
+			}
+			for _, check := range checks {
+				stmt += "\n\t" + check
+			}
+			stmt += ";"
+		default:
+			columns, err := queryColumn(d.tx, fmt.Sprintf("select quote_ident(attname) || ' ' || "+
+				"format_type(atttypid, atttypmod) from pg_attribute "+
+				"where attrelid = %d and attnum > 0 and not attisdropped order by attnum", t.relid))
+			if err != nil {
+				return err
+			}
+			stmt = "CREATE TYPE " + t.quoted + " AS (\n\t" + strings.Join(columns, ",\n\t") + "\n);"
+		}
+
+		kind := "TYPE"
+		if t.kind == "d" {
+			kind = "DOMAIN"
+		}
+		d.entry(t.name, kind, t.schema, stmt)
+	}
+
+	return nil
+}
+
+func (d *postgresCatalogDumper) functions() error {
+	return d.query(`select n.nspname, p.proname, pg_get_function_identity_arguments(p.oid),
+			p.prokind, pg_get_functiondef(p.oid)
+		from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+		where p.prokind in ('f', 'p') and `+d.namespaces+`
+		and `+postgresNotExtensionMember("pg_proc", "p.oid")+`
+		order by n.nspname, p.proname, 3`, func(rows *sql.Rows) error {
+		var schema, name, args, kind, def string
+		if err := rows.Scan(&schema, &name, &args, &kind, &def); err != nil {
+			return err
+		}
+
+		kindName := "FUNCTION"
+		if kind == "p" {
+			kindName = "PROCEDURE"
+		}
+		def = strings.Replace(strings.TrimSpace(def), "CREATE OR REPLACE ", "CREATE ", 1)
+		d.entry(name+"("+args+")", kindName, schema, def+";")
+		return nil
+	})
+}
+
+func (d *postgresCatalogDumper) tables() error {
+	type table struct {
+		oid                                  int64
+		schema, name, quoted, kind, persists string
+		partitionKey, bound, parent, comment string
+	}
+
+	tables := []table{}
+	err := d.query(`select c.oid, n.nspname, c.relname,
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname), c.relkind, c.relpersistence,
+			coalesce(pg_get_partkeydef(c.oid), ''),
+			case when c.relispartition then pg_get_expr(c.relpartbound, c.oid) else '' end,
+			coalesce((select quote_ident(pn.nspname) || '.' || quote_ident(pc.relname)
+				from pg_inherits i join pg_class pc on pc.oid = i.inhparent
+				join pg_namespace pn on pn.oid = pc.relnamespace
+				where i.inhrelid = c.oid and c.relispartition limit 1), ''),
+			coalesce(quote_literal(obj_description(c.oid, 'pg_class')), '')
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind in ('r', 'p') and `+d.namespaces+` and not `+d.excluded("c", "n")+`
+		and `+postgresNotExtensionMember("pg_class", "c.oid")+`
+		order by n.nspname, c.relname`, func(rows *sql.Rows) error {
+		var t table
+		if err := rows.Scan(&t.oid, &t.schema, &t.name, &t.quoted, &t.kind, &t.persists,
+			&t.partitionKey, &t.bound, &t.parent, &t.comment); err != nil {
+			return err
+		}
+
+		tables = append(tables, t)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(tables) > 0 {
+		d.buf.WriteString("SET default_tablespace = '';\n\nSET default_table_access_method = heap;\n\n")
+	}
+
+	for _, t := range tables {
+		lines, comments, err := d.tableColumns(t.oid, t.schema, t.name, t.quoted, t.kind)
+		if err != nil {
+			return err
+		}
+		checks, err := queryColumn(d.tx, fmt.Sprintf("select 'CONSTRAINT ' || "+
+			"quote_ident(conname) || ' ' || pg_get_constraintdef(oid) from pg_constraint "+
+			"where conrelid = %d and contype = 'c' and conislocal order by conname", t.oid))
+		if err != nil {
+			return err
+		}
+		for _, check := range checks {
+			lines = append(lines, "    "+check)
+		}
+
+		stmt := "CREATE TABLE "
+		if t.persists == "u" {
+			stmt = "CREATE UNLOGGED TABLE "
+		}
+		stmt += t.quoted + " (\n" + strings.Join(lines, ",\n") + "\n)"
+		if t.partitionKey != "" {
+			stmt += "\nPARTITION BY " + t.partitionKey
+		}
+		d.entry(t.name, "TABLE", t.schema, stmt+";")
+
+		if t.parent != "" {
+			d.entry(t.name, "TABLE ATTACH", t.schema, "ALTER TABLE ONLY "+t.parent+
+				" ATTACH PARTITION "+t.quoted+" "+t.bound+";")
+		}
+		if t.comment != "" {
+			d.entry("TABLE "+t.name, "COMMENT", t.schema, "COMMENT ON TABLE "+t.quoted+
+				" IS "+t.comment+";")
+		}
+		for _, comment := range comments {
+			d.entry(comment.name, comment.kind, comment.schema, comment.stmt)
+		}
+		if err := d.identityColumns(t.oid, t.schema, t.quoted); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// tableColumns returns the column definitions and column comments of a table.
+// Defaults which use a sequence are set after the sequences are created.
+func (d *postgresCatalogDumper) tableColumns(oid int64, schema, name, quoted,
+	kind string) ([]string, []postgresDumpEntry, error) {
+	only := "ONLY "
+	if kind == "p" {
+		only = ""
+	}
+
+	lines := []string{}
+	comments := []postgresDumpEntry{}
+	err := d.query(fmt.Sprintf(`select a.attname, quote_ident(a.attname),
+			format_type(a.atttypid, a.atttypmod), a.attnotnull,
+			coalesce(pg_get_expr(ad.adbin, ad.adrelid), ''), a.attgenerated,
+			coalesce((select ' COLLATE ' || quote_ident(cn.nspname) || '.' || quote_ident(co.collname)
+				from pg_collation co join pg_namespace cn on cn.oid = co.collnamespace
+				where co.oid = a.attcollation and a.attcollation <> t.typcollation), ''),
+			coalesce(quote_literal(col_description(a.attrelid, a.attnum)), '')
+		from pg_attribute a join pg_type t on t.oid = a.atttypid
+		left join pg_attrdef ad on ad.adrelid = a.attrelid and ad.adnum = a.attnum
+		where a.attrelid = %d and a.attnum > 0 and not a.attisdropped
+		order by a.attnum`, oid), func(rows *sql.Rows) error {
+		var column, quotedColumn, dataType, def, generated, collation, comment string
+		var notNull bool
+		if err := rows.Scan(&column, &quotedColumn, &dataType, &notNull, &def, &generated,
+			&collation, &comment); err != nil {
+			return err
+		}
+
+		line := "    " + quotedColumn + " " + dataType + collation
+		switch {
+		case generated == "s":
+			line += " GENERATED ALWAYS AS (" + def + ") STORED"
+		case strings.Contains(def, "nextval("):
+			d.defaults = append(d.defaults, postgresDumpEntry{name + " " + column, "DEFAULT", schema,
+				"ALTER TABLE " + only + quoted + " ALTER COLUMN " + quotedColumn + " SET DEFAULT " + def + ";"})
+		case def != "":
+			line += " DEFAULT " + def
+		}
+		if notNull {
+			line += " NOT NULL"
+		}
+		lines = append(lines, line)
+
+		if comment != "" {
+			comments = append(comments, postgresDumpEntry{"COLUMN " + name + "." + column, "COMMENT",
+				schema, "COMMENT ON COLUMN " + quoted + "." + quotedColumn + " IS " + comment + ";"})
+		}
+		return nil
+	})
+
+	return lines, comments, err
+}
+
+// identityColumns writes the identity sequence of each identity column in a table
+func (d *postgresCatalogDumper) identityColumns(oid int64, schema, quoted string) error {
+	return d.query(fmt.Sprintf(`select quote_ident(a.attname), a.attidentity, sc.relname,
+			quote_ident(sn.nspname) || '.' || quote_ident(sc.relname), format_type(s.seqtypid, null),
+			s.seqstart, s.seqincrement, s.seqmin, s.seqmax, s.seqcache, s.seqcycle
+		from pg_attribute a
+		join pg_depend dep on dep.refclassid = 'pg_class'::regclass and dep.refobjid = a.attrelid
+			and dep.refobjsubid = a.attnum and dep.classid = 'pg_class'::regclass and dep.deptype = 'i'
+		join pg_class sc on sc.oid = dep.objid and sc.relkind = 'S'
+		join pg_namespace sn on sn.oid = sc.relnamespace
+		join pg_sequence s on s.seqrelid = sc.oid
+		where a.attrelid = %d and a.attidentity <> ''
+		order by a.attnum`, oid), func(rows *sql.Rows) error {
+		var column, identity, name, sequence string
+		var seq postgresSequence
+		if err := rows.Scan(&column, &identity, &name, &sequence, &seq.dataType, &seq.start,
+			&seq.increment, &seq.min, &seq.max, &seq.cache, &seq.cycle); err != nil {
+			return err
+		}
+
+		generated := "ALWAYS"
+		if identity == "d" {
+			generated = "BY DEFAULT"
+		}
+		d.entry(name, "SEQUENCE", schema, "ALTER TABLE "+quoted+" ALTER COLUMN "+column+
+			" ADD GENERATED "+generated+" AS IDENTITY (\n    SEQUENCE NAME "+sequence+"\n    "+
+			strings.Join(seq.options(), "\n    ")+"\n);")
+		return nil
+	})
+}
+
+func (d *postgresCatalogDumper) views() error {
+	return d.query(`select n.nspname, c.relname,
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname), c.relkind,
+			pg_get_viewdef(c.oid), coalesce(quote_literal(obj_description(c.oid, 'pg_class')), '')
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind in ('v', 'm') and `+d.namespaces+` and not `+d.excluded("c", "n")+`
+		and `+postgresNotExtensionMember("pg_class", "c.oid")+`
+		order by c.oid`, func(rows *sql.Rows) error {
+		var schema, name, quoted, kind, def, comment string
+		if err := rows.Scan(&schema, &name, &quoted, &kind, &def, &comment); err != nil {
+			return err
+		}
+
+		if kind == "m" {
+			d.entry(name, "MATERIALIZED VIEW", schema, "CREATE MATERIALIZED VIEW "+quoted+
+				" AS\n"+strings.TrimSuffix(def, ";")+"\n  WITH NO DATA;")
+		} else {
+			d.entry(name, "VIEW", schema, "CREATE VIEW "+quoted+" AS\n"+def)
+		}
+		if comment != "" {
+			d.entry("VIEW "+name, "COMMENT", schema, "COMMENT ON VIEW "+quoted+" IS "+comment+";")
+		}
+		return nil
+	})
+}
+
+func (d *postgresCatalogDumper) sequences() error {
+	return d.query(`select n.nspname, c.relname,
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname), format_type(s.seqtypid, null),
+			s.seqstart, s.seqincrement, s.seqmin, s.seqmax, s.seqcache, s.seqcycle,
+			coalesce((select quote_ident(tn.nspname) || '.' || quote_ident(t.relname) || '.' ||
+					quote_ident(a.attname)
+				from pg_depend dep join pg_class t on t.oid = dep.refobjid
+				join pg_namespace tn on tn.oid = t.relnamespace
+				join pg_attribute a on a.attrelid = t.oid and a.attnum = dep.refobjsubid
+				where dep.classid = 'pg_class'::regclass and dep.objid = c.oid
+				and dep.refclassid = 'pg_class'::regclass and dep.deptype = 'a' limit 1), '')
+		from pg_class c join pg_namespace n on n.oid = c.relnamespace
+		join pg_sequence s on s.seqrelid = c.oid
+		where c.relkind = 'S' and `+d.namespaces+` and not `+d.excluded("c", "n")+`
+		and `+postgresNotExtensionMember("pg_class", "c.oid")+`
+		and not exists (select 1 from pg_depend dep where dep.classid = 'pg_class'::regclass
+			and dep.objid = c.oid and dep.deptype = 'i')
+		and not exists (select 1 from pg_depend dep join pg_class t on t.oid = dep.refobjid
+			join pg_namespace tn on tn.oid = t.relnamespace
+			where dep.classid = 'pg_class'::regclass and dep.objid = c.oid
+			and dep.refclassid = 'pg_class'::regclass and dep.deptype = 'a'
+			and `+d.excluded("t", "tn")+`)
+		order by n.nspname, c.relname`, func(rows *sql.Rows) error {
+		var schema, name, quoted, ownedBy string
+		var seq postgresSequence
+		if err := rows.Scan(&schema, &name, &quoted, &seq.dataType, &seq.start, &seq.increment,
+			&seq.min, &seq.max, &seq.cache, &seq.cycle, &ownedBy); err != nil {
+			return err
+		}
+
+		options := seq.options()
+		if seq.dataType != "bigint" {
+			options = append([]string{"AS " + seq.dataType}, options...)
+		}
+		d.entry(name, "SEQUENCE", schema, "CREATE SEQUENCE "+quoted+"\n    "+
+			strings.Join(options, "\n    ")+";")
+		if ownedBy != "" {
+			d.entry(name, "SEQUENCE OWNED BY", schema, "ALTER SEQUENCE "+quoted+
+				" OWNED BY "+ownedBy+";")
+		}
+		return nil
+	})
+}
+
+// columnDefaults writes the column defaults which use a sequence
+func (d *postgresCatalogDumper) columnDefaults() error {
+	for _, def := range d.defaults {
+		d.entry(def.name, def.kind, def.schema, def.stmt)
+	}
+
+	return nil
+}
+
+// tableConstraints writes primary key, unique, and exclusion constraints, or
+// foreign key constraints
+func (d *postgresCatalogDumper) tableConstraints(types, kind string) error {
+	return d.query(`select n.nspname, c.relname,
+			quote_ident(n.nspname) || '.' || quote_ident(c.relname), c.relkind,
+			con.conname, quote_ident(con.conname), pg_get_constraintdef(con.oid)
+		from pg_constraint con join pg_class c on c.oid = con.conrelid
+		join pg_namespace n on n.oid = c.relnamespace
+		where con.contype in (`+types+`) and con.conparentid = 0 and `+d.namespaces+`
+		and not `+d.excluded("c", "n")+`
+		and `+postgresNotExtensionMember("pg_class", "c.oid")+`
+		order by n.nspname, c.relname, con.conname`, func(rows *sql.Rows) error {
+		var schema, table, quoted, relkind, name, quotedName, def string
+		if err := rows.Scan(&schema, &table, &quoted, &relkind, &name, &quotedName, &def); err != nil {
+			return err
+		}
+
+		only := "ONLY "
+		if relkind == "p" {
+			only = ""
+		}
+		d.entry(table+" "+name, kind, schema, "ALTER TABLE "+only+quoted+
+			"\n    ADD CONSTRAINT "+quotedName+" "+def+";")
+		return nil
+	})
+}
+
+func (d *postgresCatalogDumper) constraints() error {
+	return d.tableConstraints("'p', 'u', 'x'", "CONSTRAINT")
+}
+
+func (d *postgresCatalogDumper) foreignKeys() error {
+	return d.tableConstraints("'f'", "FK CONSTRAINT")
+}
+
+func (d *postgresCatalogDumper) indexes() error {
+	return d.query(`select n.nspname, ic.relname, pg_get_indexdef(i.indexrelid)
+		from pg_index i join pg_class ic on ic.oid = i.indexrelid
+		join pg_class c on c.oid = i.indrelid
+		join pg_namespace n on n.oid = c.relnamespace
+		where c.relkind in ('r', 'p', 'm') and `+d.namespaces+` and not `+d.excluded("c", "n")+`
+		and `+postgresNotExtensionMember("pg_class", "c.oid")+`
+		and not exists (select 1 from pg_constraint con where con.conindid = i.indexrelid
+			and con.contype in ('p', 'u', 'x'))
+		and not exists (select 1 from pg_inherits inh where inh.inhrelid = i.indexrelid)
+		order by n.nspname, ic.relname`, func(rows *sql.Rows) error {
+		var schema, name, def string
+		if err := rows.Scan(&schema, &name, &def); err != nil {
+			return err
+		}
+
+		d.entry(name, "INDEX", schema, def+";")
+		return nil
+	})
+}
+
+func (d *postgresCatalogDumper) triggers() error {
+	return d.query(`select n.nspname, c.relname, t.tgname, pg_get_triggerdef(t.oid)
+		from pg_trigger t join pg_class c on c.oid = t.tgrelid
+		join pg_namespace n on n.oid = c.relnamespace
+		where not t.tgisinternal and t.tgparentid = 0 and `+d.namespaces+`
+		and not `+d.excluded("c", "n")+`
+		and `+postgresNotExtensionMember("pg_class", "c.oid")+`
+		order by n.nspname, c.relname, t.tgname`, func(rows *sql.Rows) error {
+		var schema, table, name, def string
+		if err := rows.Scan(&schema, &table, &name, &def); err != nil {
+			return err
+		}
+
+		d.entry(table+" "+name, "TRIGGER", schema, def+";")
+		return nil
+	})
+}
+
+// privileges writes the owner of each schema, table, view, sequence, and
+// function, and the privileges granted on them (except to the owner)
+func (d *postgresCatalogDumper) privileges() error {
+	if !d.withPrivileges {
+		return nil
+	}
+
+	return d.query(`select o.kind, o.name, o.schema, o.quoted,
+			quote_ident(pg_get_userbyid(o.owner)),
+			coalesce((select string_agg(g.stmt, E'\n' order by g.stmt) from (
+				select 'GRANT ' || string_agg(a.privilege_type, ',' order by a.privilege_type) ||
+					' ON ' || o.grantkind || ' ' || o.quoted || ' TO ' ||
+					case when a.grantee = 0 then 'PUBLIC'
+						else quote_ident(pg_get_userbyid(a.grantee)) end ||
+					case when a.is_grantable then ' WITH GRANT OPTION' else '' end || ';' as stmt
+				from aclexplode(o.acl) a where a.grantee <> o.owner
+				group by a.grantee, a.is_grantable) g), '')
+		from (
+			select 1 as ord, 'SCHEMA' as kind, 'SCHEMA' as grantkind, n.nspname as name,
+				'-' as schema, quote_ident(n.nspname) as quoted, n.nspowner as owner, n.nspacl as acl
+			from pg_namespace n
+			where n.nspname <> 'public' and `+d.namespaces+`
+			and `+postgresNotExtensionMember("pg_namespace", "n.oid")+`
+			union all
+			select 2, case c.relkind when 'S' then 'SEQUENCE' when 'v' then 'VIEW'
+					when 'm' then 'MATERIALIZED VIEW' else 'TABLE' end,
+				case c.relkind when 'S' then 'SEQUENCE' else 'TABLE' end, c.relname, n.nspname,
+				quote_ident(n.nspname) || '.' || quote_ident(c.relname), c.relowner, c.relacl
+			from pg_class c join pg_namespace n on n.oid = c.relnamespace
+			where c.relkind in ('r', 'p', 'v', 'm', 'S') and `+d.namespaces+`
+			and not `+d.excluded("c", "n")+`
+			and `+postgresNotExtensionMember("pg_class", "c.oid")+`
+			union all
+			select 3, case p.prokind when 'p' then 'PROCEDURE' else 'FUNCTION' end,
+				case p.prokind when 'p' then 'PROCEDURE' else 'FUNCTION' end,
+				p.proname || '(' || pg_get_function_identity_arguments(p.oid) || ')', n.nspname,
+				quote_ident(n.nspname) || '.' || quote_ident(p.proname) || '(' ||
+					pg_get_function_identity_arguments(p.oid) || ')', p.proowner, p.proacl
+			from pg_proc p join pg_namespace n on n.oid = p.pronamespace
+			where p.prokind in ('f', 'p') and `+d.namespaces+`
+			and `+postgresNotExtensionMember("pg_proc", "p.oid")+`
+		) o
+		order by o.ord, o.schema, o.name`, func(rows *sql.Rows) error {
+		var kind, name, schema, quoted, owner, grants string
+		if err := rows.Scan(&kind, &name, &schema, &quoted, &owner, &grants); err != nil {
+			return err
+		}
+
+		d.entry(kind+" "+name, "OWNER", schema, "ALTER "+kind+" "+quoted+" OWNER TO "+owner+";")
+		if grants != "" {
+			d.entry(kind+" "+name, "ACL", schema, grants)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,49 @@
+package dbmate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresSequenceOptions(t *testing.T) {
+	seq := postgresSequence{dataType: "integer", start: 1, increment: 1, min: 1,
+		max: 2147483647, cache: 1}
+	require.Equal(t, []string{"START WITH 1", "INCREMENT BY 1", "NO MINVALUE",
+		"NO MAXVALUE", "CACHE 1"}, seq.options())
+
+	seq = postgresSequence{dataType: "bigint", start: -1, increment: -1,
+		min: -9223372036854775808, max: -1, cache: 1}
+	require.Equal(t, []string{"START WITH -1", "INCREMENT BY -1", "NO MINVALUE",
+		"NO MAXVALUE", "CACHE 1"}, seq.options())
+
+	seq = postgresSequence{dataType: "smallint", start: 10, increment: 5, min: 10,
+		max: 1000, cache: 20, cycle: true}
+	require.Equal(t, []string{"START WITH 10", "INCREMENT BY 5", "MINVALUE 10",
+		"MAXVALUE 1000", "CACHE 20", "CYCLE"}, seq.options())
+}
+
+func TestPostgresCatalogDumperEntry(t *testing.T) {
+	d := &postgresCatalogDumper{}
+	d.entry("users", "TABLE", "public", "CREATE TABLE public.users (\n    id integer\n);")
+
+	require.Equal(t, "--\n"+
+		"-- Name: users; Type: TABLE; Schema: public; Owner: -\n"+
+		"--\n\n"+
+		"CREATE TABLE public.users (\n    id integer\n);\n\n\n", d.buf.String())
+}
+
+func TestPostgresNamespaceFilter(t *testing.T) {
+	require.Equal(t, `n.nspname <> 'information_schema' and n.nspname not like 'pg\_%'`,
+		postgresNamespaceFilter(nil))
+	require.Equal(t, `n.nspname in ('app', 'it''s')`, postgresNamespaceFilter([]string{"app", "it's"}))
+}
+
+func TestPostgresCatalogDumperExcluded(t *testing.T) {
+	d := &postgresCatalogDumper{}
+	require.Equal(t, "(false)", d.excluded("c", "n"))
+
+	d.exclude = []string{"pgbench_*", "topology.layer"}
+	require.Equal(t, `(false or (t.relname like 'pgbench\_%') or `+
+		`(t.relname like 'layer' and tn.nspname like 'topology'))`, d.excluded("t", "tn"))
+}
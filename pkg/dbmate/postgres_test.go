@@ -4,7 +4,9 @@ import (
 	"database/sql"
 	"net/url"
 	"testing"
+	"time"
 
+	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
 )
 
@@ -110,6 +112,151 @@ func TestPostgresDumpSchema(t *testing.T) {
 		"\"fakedb\" failed: FATAL:  database \"fakedb\" does not exist")
 }
 
+func TestPostgresCatalogDump(t *testing.T) {
+	drv := PostgresDriver{}
+
+	// prepare database
+	db := prepTestPostgresDB(t)
+	defer mustClose(db)
+	err := drv.CreateMigrationsTable(db)
+	require.NoError(t, err)
+	err = drv.InsertMigration(db, "abc1")
+	require.NoError(t, err)
+
+	_, err = db.Exec(`create type mood as enum ('sad', 'ok');
+		create table users (id serial primary key, name text not null default 'x',
+			feeling mood, check (name <> ''));
+		create table posts (id bigint generated always as identity,
+			user_id integer references users (id));
+		create index posts_user_id_idx on posts (user_id);
+		create view user_names as select name from users;
+		comment on table users is 'people';`)
+	require.NoError(t, err)
+
+	schema, err := drv.dumpCatalogSchema(db)
+	require.NoError(t, err)
+	require.Contains(t, string(schema), "CREATE TYPE public.mood AS ENUM (\n"+
+		"    'sad',\n"+
+		"    'ok'\n"+
+		");\n")
+	require.Contains(t, string(schema), "CREATE TABLE public.users (\n"+
+		"    id integer NOT NULL,\n"+
+		"    name text DEFAULT 'x'::text NOT NULL,\n"+
+		"    feeling public.mood,\n"+
+		"    CONSTRAINT users_name_check CHECK ((name <> ''::text))\n"+
+		");\n")
+	require.Contains(t, string(schema), "COMMENT ON TABLE public.users IS 'people';\n")
+	require.Contains(t, string(schema), "ALTER SEQUENCE public.users_id_seq "+
+		"OWNED BY public.users.id;\n")
+	require.Contains(t, string(schema), "ALTER TABLE ONLY public.users ALTER COLUMN id "+
+		"SET DEFAULT nextval('public.users_id_seq'::regclass);\n")
+	require.Contains(t, string(schema), "ALTER TABLE public.posts ALTER COLUMN id "+
+		"ADD GENERATED ALWAYS AS IDENTITY (\n    SEQUENCE NAME public.posts_id_seq\n")
+	require.Contains(t, string(schema), "ALTER TABLE ONLY public.users\n"+
+		"    ADD CONSTRAINT users_pkey PRIMARY KEY (id);\n")
+	require.Contains(t, string(schema), "CREATE INDEX posts_user_id_idx ON public.posts "+
+		"USING btree (user_id);\n")
+	require.Contains(t, string(schema), "ALTER TABLE ONLY public.posts\n"+
+		"    ADD CONSTRAINT posts_user_id_fkey FOREIGN KEY (user_id) REFERENCES public.users(id);\n")
+	require.Contains(t, string(schema), "CREATE VIEW public.user_names AS\n")
+	require.Contains(t, string(schema), "\n--\n"+
+		"-- PostgreSQL database dump complete\n"+
+		"--\n\n\n"+
+		"--\n"+
+		"-- Dbmate schema migrations\n"+
+		"--\n\n"+
+		"INSERT INTO public.schema_migrations (version) VALUES\n"+
+		"    ('abc1');\n")
+	require.NotContains(t, string(schema), "OWNER TO")
+
+	// include ownership and grants
+	_, err = db.Exec(`grant select, insert on users to public`)
+	require.NoError(t, err)
+	schema, err = drv.WithPrivileges().(PostgresDriver).dumpCatalogSchema(db)
+	require.NoError(t, err)
+	require.Regexp(t, `ALTER TABLE public\.users OWNER TO \w+;\n`, string(schema))
+	require.Contains(t, string(schema), "GRANT INSERT,SELECT ON TABLE public.users TO PUBLIC;\n")
+}
+
+func TestPostgresWithPrivileges(t *testing.T) {
+	drv := PostgresDriver{}.WithPrivileges().(PostgresDriver)
+	require.True(t, drv.DumpPrivileges)
+
+	// tenants keep the dump options
+	tenantDrv, _ := drv.Tenant(postgresTestURL(t), "tenant1")
+	require.True(t, tenantDrv.(PostgresDriver).DumpPrivileges)
+}
+
+func TestPostgresMigrationsTable(t *testing.T) {
+	drv := PostgresDriver{}
+	require.Equal(t, "public.schema_migrations", drv.migrationsTable())
+
+	drv = drv.withMigrationsTable("dbmate_versions")
+	require.Equal(t, `public."dbmate_versions"`, drv.migrationsTable())
+
+	drv = PostgresDriver{}.withMigrationsTable("ops.schema_migrations")
+	require.Equal(t, `"ops".schema_migrations`, drv.migrationsTable())
+	require.Equal(t, `"ops".schema_migration_runs`, drv.runsTable())
+
+	// tenants keep the table name within their own schema
+	tenantDrv, _ := PostgresDriver{}.withMigrationsTable("ops.versions").
+		Tenant(postgresTestURL(t), "tenant1")
+	require.Equal(t, `"tenant1"."versions"`, tenantDrv.(PostgresDriver).migrationsTable())
+}
+
+func TestPostgresSchemas(t *testing.T) {
+	drv := PostgresDriver{}.withSchemas([]string{"app", "audit"})
+	require.Equal(t, `"app".schema_migrations`, drv.migrationsTable())
+	require.Equal(t, []string{"app", "audit"}, drv.dumpSchemas())
+
+	// a qualified migrations table takes precedence, and is always dumped
+	drv = drv.withMigrationsTable("ops.schema_migrations")
+	require.Equal(t, `"ops".schema_migrations`, drv.migrationsTable())
+	require.Equal(t, []string{"app", "audit", "ops"}, drv.dumpSchemas())
+	require.Equal(t, []string{"app", "audit"}, drv.Schemas)
+
+	require.Nil(t, PostgresDriver{}.dumpSchemas())
+}
+
+func TestPostgresExcludeTables(t *testing.T) {
+	drv := PostgresDriver{}.ExcludeTables([]string{"pgbench_*"})
+	require.Equal(t, []string{"pgbench_*"}, drv.(PostgresDriver).DumpExcludeTables)
+
+	// tenants keep the exclude patterns
+	tenantDrv, _ := drv.(PostgresDriver).Tenant(postgresTestURL(t), "tenant1")
+	require.Equal(t, []string{"pgbench_*"}, tenantDrv.(PostgresDriver).DumpExcludeTables)
+}
+
+func TestPostgresMigrationsLockKey(t *testing.T) {
+	drv := PostgresDriver{}
+	require.Equal(t, drv.migrationsLockKey(), PostgresDriver{}.migrationsLockKey())
+	require.NotEqual(t, drv.migrationsLockKey(),
+		drv.withMigrationsTable("ops.schema_migrations").migrationsLockKey())
+}
+
+func TestPostgresLock(t *testing.T) {
+	drv := PostgresDriver{}
+	db := prepTestPostgresDB(t)
+	defer mustClose(db)
+	db.SetMaxOpenConns(1)
+
+	other, err := sql.Open("postgres", postgresTestURL(t).String())
+	require.NoError(t, err)
+	defer mustClose(other)
+	other.SetMaxOpenConns(1)
+
+	require.NoError(t, drv.Lock(db, 0))
+
+	// another session times out waiting for the lock
+	err = drv.Lock(other, 50*time.Millisecond)
+	require.EqualError(t, err, "timed out after 50ms waiting for the migrations lock, "+
+		"another migration is in progress")
+
+	require.NoError(t, drv.Unlock(db))
+	require.NoError(t, drv.Lock(other, 50*time.Millisecond))
+	require.NoError(t, drv.Unlock(other))
+}
+
 func TestPostgresDatabaseExists(t *testing.T) {
 	drv := PostgresDriver{}
 	u := postgresTestURL(t)
@@ -166,6 +313,36 @@ func TestPostgresCreateMigrationsTable(t *testing.T) {
 	require.NoError(t, err)
 }
 
+func TestPostgresExecCopy(t *testing.T) {
+	drv := PostgresDriver{}
+	db := prepTestPostgresDB(t)
+	defer mustClose(db)
+
+	contents := "create table users (id int, name text);\n" +
+		"COPY public.users (id, name) FROM stdin;\n1\talice\n2\t\\N\n3\ttab\\there\n\\.\n" +
+		"update users set name = 'bob' where id = 2;\n"
+
+	// copy within a transaction
+	tx, err := db.Begin()
+	require.NoError(t, err)
+	rows, err := execScript(drv, tx, contents)
+	require.NoError(t, err)
+	require.NoError(t, tx.Commit())
+	require.Equal(t, int64(4), rows)
+
+	names, err := queryColumn(db, "select name from users order by id")
+	require.NoError(t, err)
+	require.Equal(t, []string{"alice", "bob", "tab\there"}, names)
+
+	// copy without a transaction
+	_, err = execScript(drv, db, "COPY users (id) FROM stdin;\n4\n\\.\n")
+	require.NoError(t, err)
+	count := 0
+	err = db.QueryRow("select count(*) from users").Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+}
+
 func TestPostgresSelectMigrations(t *testing.T) {
 	drv := PostgresDriver{}
 	db := prepTestPostgresDB(t)
@@ -254,3 +431,164 @@ func TestPostgresPing(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "connect: connection refused")
 }
+
+func TestPostgresSessionSettingsSQL(t *testing.T) {
+	drv := PostgresDriver{}
+
+	statements, err := drv.SessionSettingsSQL(SessionSettings{})
+	require.NoError(t, err)
+	require.Empty(t, statements)
+
+	statements, err = drv.SessionSettingsSQL(SessionSettings{
+		LockTimeout:              5 * time.Second,
+		StatementTimeout:         10 * time.Minute,
+		IdleInTransactionTimeout: time.Minute,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"set lock_timeout = 5000",
+		"set statement_timeout = 600000",
+		"set idle_in_transaction_session_timeout = 60000",
+	}, statements)
+
+	require.Equal(t, []string{"reset lock_timeout", "reset statement_timeout"},
+		drv.ResetSessionSettingsSQL(SessionSettings{LockTimeout: time.Second, StatementTimeout: time.Second}))
+}
+
+func TestPostgresRetryableError(t *testing.T) {
+	drv := PostgresDriver{}
+	require.True(t, drv.RetryableError(&pq.Error{Code: "55P03"}))
+	require.True(t, drv.RetryableError(&pq.Error{Code: "40P01"}))
+	require.False(t, drv.RetryableError(&pq.Error{Code: "42601"}))
+	require.False(t, drv.RetryableError(sql.ErrNoRows))
+}
+
+func TestPostgresErrorPosition(t *testing.T) {
+	drv := PostgresDriver{}
+	query := "select 'é';\nselec 1;"
+
+	position, ok := drv.ErrorPosition(&pq.Error{Position: "12"}, query)
+	require.True(t, ok)
+	require.Equal(t, "\nselec 1;", query[position:])
+
+	_, ok = drv.ErrorPosition(&pq.Error{}, query)
+	require.False(t, ok)
+	_, ok = drv.ErrorPosition(&pq.Error{Position: "100"}, query)
+	require.False(t, ok)
+	_, ok = drv.ErrorPosition(sql.ErrNoRows, query)
+	require.False(t, ok)
+}
+
+func TestPostgresNoTransactionStatement(t *testing.T) {
+	drv := PostgresDriver{}
+
+	require.Equal(t, "create unique index concurrently users_email on users (email)",
+		drv.NoTransactionStatement("create unique index concurrently users_email on users (email);"))
+	require.Equal(t, "DROP INDEX CONCURRENTLY users_id",
+		drv.NoTransactionStatement("create table users (id int);\nDROP INDEX CONCURRENTLY users_id;"))
+	require.NotEmpty(t, drv.NoTransactionStatement("reindex index concurrently users_email;"))
+	require.NotEmpty(t, drv.NoTransactionStatement("alter table events detach partition events_2020 concurrently;"))
+	require.NotEmpty(t, drv.NoTransactionStatement("alter type status add value 'archived';"))
+	require.NotEmpty(t, drv.NoTransactionStatement("vacuum analyze users;"))
+	require.Empty(t, drv.NoTransactionStatement("create index users_id on users (id);"))
+	require.Empty(t, drv.NoTransactionStatement("alter type status rename value 'old' to 'new';"))
+	require.Empty(t, drv.NoTransactionStatement("-- vacuum later\nanalyze users;"))
+	require.Empty(t, drv.NoTransactionStatement("insert into jobs (name) values ('vacuum');"))
+}
+
+func TestPostgresCheckTransaction(t *testing.T) {
+	drv := PostgresDriver{}
+	result := MigrationResult{Filename: "1_status.sql", Direction: "up"}
+
+	// statements which can't run inside a transaction require transaction:false
+	m, _, err := parseMigrationContents("-- migrate:up\ncreate table users (id int);\n" +
+		"alter type status\n  add value 'archived';\n")
+	require.NoError(t, err)
+	err = checkTransaction(drv, m, result)
+	require.EqualError(t, err, `1_status.sql: can't run "alter type status" inside a transaction, `+
+		`add "-- migrate:up transaction:false" to run the migration outside of one`)
+
+	m, _, err = parseMigrationContents("-- migrate:up\ncreate index users_id on users (id);\n")
+	require.NoError(t, err)
+	require.NoError(t, checkTransaction(drv, m, result))
+}
+
+func TestPostgresLockTimeoutSQL(t *testing.T) {
+	set, reset := PostgresDriver{}.LockTimeoutSQL(5 * time.Second)
+	require.Equal(t, "set lock_timeout = 5000", set)
+	require.Equal(t, "reset lock_timeout", reset)
+}
+
+func TestPostgresPrepareRetry(t *testing.T) {
+	drv := PostgresDriver{}
+	db := prepTestPostgresDB(t)
+	defer mustClose(db)
+
+	_, err := db.Exec("create table users (id int, email text)")
+	require.NoError(t, err)
+	_, err = db.Exec("create index concurrently users_email on users (email)")
+	require.NoError(t, err)
+	// mark the index invalid, as if create index concurrently had failed
+	_, err = db.Exec("update pg_index set indisvalid = false where indexrelid = 'users_email'::regclass")
+	require.NoError(t, err)
+
+	err = drv.PrepareRetry(db, "create index concurrently if not exists users_email on users (email);\n"+
+		"create index concurrently users_id on users (id);")
+	require.NoError(t, err)
+
+	exists := true
+	err = db.QueryRow("select to_regclass('users_email') is not null").Scan(&exists)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestPostgresReplicationLag(t *testing.T) {
+	drv := PostgresDriver{}
+	db := prepTestPostgresDB(t)
+	defer mustClose(db)
+
+	// the test database has no replicas
+	lag, err := drv.ReplicationLag(db)
+	require.NoError(t, err)
+	require.Equal(t, time.Duration(0), lag)
+}
+
+func TestPostgresBlockers(t *testing.T) {
+	drv := PostgresDriver{}
+	db := prepTestPostgresDB(t)
+	defer mustClose(db)
+
+	_, err := db.Exec("create table users (id integer)")
+	require.NoError(t, err)
+
+	// a second session holds a lock on the users table
+	other, err := drv.Open(postgresTestURL(t))
+	require.NoError(t, err)
+	defer mustClose(other)
+	tx, err := other.Begin()
+	require.NoError(t, err)
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	_, err = tx.Exec("lock table users in access share mode")
+	require.NoError(t, err)
+
+	blockers, err := drv.Blockers(db, []string{"users", "missing"}, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, blockers, 1)
+	require.Equal(t, "users", blockers[0].Table)
+	require.Equal(t, "lock table users in access share mode", blockers[0].Query)
+
+	blockers, err = drv.Blockers(db, []string{"missing"}, time.Hour)
+	require.NoError(t, err)
+	require.Len(t, blockers, 0)
+}
+
+func TestPostgresConsoleCommand(t *testing.T) {
+	u, err := url.Parse("postgres://bob:secret@db:5432/app?sslmode=disable")
+	require.NoError(t, err)
+
+	name, args := PostgresDriver{}.ConsoleCommand(u)
+	require.Equal(t, "psql", name)
+	require.Equal(t, []string{"postgres://bob:secret@db:5432/app?sslmode=disable"}, args)
+}
@@ -0,0 +1,150 @@
+package dbmate
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// RepairProblem is a kind of inconsistency between schema_migrations and the
+// migration files
+type RepairProblem string
+
+const (
+	// MissingFile means a version is recorded as applied, but has no migration file
+	MissingFile RepairProblem = "missing file"
+	// DuplicateVersion means several migration files share a version
+	DuplicateVersion RepairProblem = "duplicate version"
+	// MissingRecord means the most recent run of a migration file applied it
+	// (according to schema_migration_runs), but it is not recorded in
+	// schema_migrations
+	MissingRecord RepairProblem = "missing record"
+)
+
+// RepairIssue describes an inconsistency found by Repair
+type RepairIssue struct {
+	Problem   RepairProblem
+	Version   string
+	Filenames []string
+}
+
+// String describes the issue for the repair output
+func (i RepairIssue) String() string {
+	switch i.Problem {
+	case MissingFile:
+		return fmt.Sprintf("version %s is recorded as applied, but has no migration file", i.Version)
+	case DuplicateVersion:
+		return fmt.Sprintf("version %s is used by %s", i.Version, strings.Join(i.Filenames, ", "))
+	default:
+		return fmt.Sprintf("%s was applied, but is not recorded in schema_migrations", i.Filenames[0])
+	}
+}
+
+// Fixable returns whether Repair can fix the issue. Duplicate versions must be
+// fixed by renaming the migration files.
+func (i RepairIssue) Fixable() bool {
+	return i.Problem != DuplicateVersion
+}
+
+// Repair finds inconsistencies between schema_migrations and the migration files,
+// and fixes each one for which confirm returns true. Records without a migration
+// file are removed, and migrations which were applied (according to the runs
+// recorded with RecordRuns) but have no record are recorded again.
+func (db *DB) Repair(confirm func(RepairIssue) bool) error {
+	files, err := db.migrationFiles(regexp.MustCompile(`^\d.*\.sql$`))
+	if err != nil {
+		return err
+	}
+
+	drv, sqlDB, err := db.openDatabaseForMigration()
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	applied, err := drv.SelectMigrations(sqlDB, -1)
+	if err != nil {
+		return err
+	}
+
+	ran := map[string]bool{}
+	if runsDrv, ok := drv.(runsDriver); ok {
+		directions, err := runsDrv.SelectRunDirections(sqlDB)
+		if err != nil {
+			return err
+		}
+		for ver, direction := range directions {
+			ran[ver] = direction == "up"
+		}
+	}
+
+	issues := findRepairIssues(files, applied, ran)
+	if len(issues) == 0 {
+		fmt.Fprintln(db.Log, "No problems found")
+		return nil
+	}
+
+	unresolved := 0
+	for _, issue := range issues {
+		fmt.Fprintf(db.Log, "Found: %s\n", issue)
+		if !issue.Fixable() {
+			fmt.Fprintln(db.Log, "  rename the migration files so that each version is unique")
+			unresolved++
+			continue
+		}
+		if !confirm(issue) {
+			unresolved++
+			continue
+		}
+
+		if issue.Problem == MissingFile {
+			fmt.Fprintf(db.Log, "Removing: version %s from schema_migrations\n", issue.Version)
+			err = drv.DeleteMigration(sqlDB, issue.Version)
+		} else {
+			fmt.Fprintf(db.Log, "Recording: %s in schema_migrations\n", issue.Filenames[0])
+			err = drv.InsertMigration(sqlDB, issue.Version)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	if unresolved > 0 {
+		return fmt.Errorf("%d problems were not repaired", unresolved)
+	}
+
+	return nil
+}
+
+// findRepairIssues compares the migration files with the applied versions, and
+// the versions whose most recent run applied them, returning the issues ordered
+// by version
+func findRepairIssues(files []string, applied, ran map[string]bool) []RepairIssue {
+	byVersion := map[string][]string{}
+	for _, filename := range files {
+		ver := migrationVersion(filename)
+		byVersion[ver] = append(byVersion[ver], filename)
+	}
+
+	issues := []RepairIssue{}
+	for ver, filenames := range byVersion {
+		switch {
+		case len(filenames) > 1:
+			issues = append(issues, RepairIssue{Problem: DuplicateVersion, Version: ver, Filenames: filenames})
+		case !applied[ver] && ran[ver]:
+			issues = append(issues, RepairIssue{Problem: MissingRecord, Version: ver, Filenames: filenames})
+		}
+	}
+	for ver := range applied {
+		if len(byVersion[ver]) == 0 {
+			issues = append(issues, RepairIssue{Problem: MissingFile, Version: ver})
+		}
+	}
+
+	sort.Slice(issues, func(i, j int) bool {
+		return issues[i].Version < issues[j].Version
+	})
+
+	return issues
+}
@@ -0,0 +1,97 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindRepairIssues(t *testing.T) {
+	files := []string{"1_users.sql", "2_posts.sql", "3_a.sql", "3_b.sql", "5_tags.sql"}
+	applied := map[string]bool{"1": true, "4": true}
+	ran := map[string]bool{"1": true, "2": true, "5": false, "9": true}
+
+	issues := findRepairIssues(files, applied, ran)
+	require.Equal(t, []RepairIssue{
+		{Problem: MissingRecord, Version: "2", Filenames: []string{"2_posts.sql"}},
+		{Problem: DuplicateVersion, Version: "3", Filenames: []string{"3_a.sql", "3_b.sql"}},
+		{Problem: MissingFile, Version: "4"},
+	}, issues)
+
+	require.Equal(t, "2_posts.sql was applied, but is not recorded in schema_migrations", issues[0].String())
+	require.Equal(t, "version 3 is used by 3_a.sql, 3_b.sql", issues[1].String())
+	require.Equal(t, "version 4 is recorded as applied, but has no migration file", issues[2].String())
+	require.True(t, issues[0].Fixable())
+	require.False(t, issues[1].Fixable())
+	require.True(t, issues[2].Fixable())
+}
+
+func TestRepair(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "repair.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	db.RecordRuns = true
+
+	for _, name := range []string{"1_users", "2_posts", "3_comments"} {
+		err = ioutil.WriteFile(filepath.Join(dir, name+".sql"),
+			[]byte("-- migrate:up\ncreate table "+name[2:]+" (id integer);\n"), 0644)
+		require.NoError(t, err)
+	}
+	err = db.Migrate()
+	require.NoError(t, err)
+
+	never := func(RepairIssue) bool { return false }
+	buf.Reset()
+	err = db.Repair(never)
+	require.NoError(t, err)
+	require.Equal(t, "No problems found\n", buf.String())
+
+	// a hand edit to schema_migrations, and a deleted migration file
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("delete from schema_migrations where version = '2'")
+	require.NoError(t, err)
+	err = os.Remove(filepath.Join(dir, "3_comments.sql"))
+	require.NoError(t, err)
+
+	buf.Reset()
+	err = db.Repair(never)
+	require.EqualError(t, err, "2 problems were not repaired")
+	require.Equal(t, "Found: 2_posts.sql was applied, but is not recorded in schema_migrations\n"+
+		"Found: version 3 is recorded as applied, but has no migration file\n", buf.String())
+
+	buf.Reset()
+	err = db.Repair(func(RepairIssue) bool { return true })
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "Recording: 2_posts.sql in schema_migrations\n")
+	require.Contains(t, buf.String(), "Removing: version 3 from schema_migrations\n")
+
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	require.True(t, status[0].Applied)
+	require.True(t, status[1].Applied)
+
+	buf.Reset()
+	err = db.Repair(never)
+	require.NoError(t, err)
+	require.Equal(t, "No problems found\n", buf.String())
+}
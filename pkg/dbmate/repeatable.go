@@ -0,0 +1,108 @@
+package dbmate
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// repeatableMigrationRegExp matches repeatable migration files, such as
+// R__views.sql, which are applied again whenever their contents change
+var repeatableMigrationRegExp = regexp.MustCompile(`^R__.*\.sql$`)
+
+// repeatableName returns the name which a repeatable migration is recorded by,
+// e.g. R__views for R__views.sql
+func repeatableName(filename string) string {
+	return strings.TrimSuffix(filepath.ToSlash(filename), ".sql")
+}
+
+// parseRepeatableMigration parses a repeatable migration. The whole file is
+// applied, unless it defines a `-- migrate:up` block, and options may be set
+// with file level directives such as `-- migrate:transaction false`.
+func parseRepeatableMigration(contents string) (Migration, error) {
+	if upRegExp.MatchString(contents) {
+		up, _, err := parseMigrationContents(contents)
+		return up, err
+	}
+
+	m := NewMigration()
+	m.Contents = contents
+	applyMigrationDirectives(m.Options, parseMigrationDirectives(contents))
+
+	return m, nil
+}
+
+// applyRepeatable applies each repeatable migration which has not been applied,
+// or whose checksum differs from the checksum recorded when it was last applied.
+// Repeatable migrations run in name order, after the versioned migrations, and
+// should be idempotent (e.g. create or replace view).
+func (db *DB) applyRepeatable(drv Driver, sqlDB *sql.DB) error {
+	files, err := db.migrationFiles(repeatableMigrationRegExp)
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	checksumDrv, ok := drv.(checksumDriver)
+	if !ok {
+		return fmt.Errorf("repeatable migrations are not supported by the %s driver", db.DatabaseURL.Scheme)
+	}
+
+	var recorded map[string]string
+	if db.DryRun {
+		recorded = db.dryRunChecksums(drv)
+	} else if recorded, err = checksumDrv.SelectRepeatableChecksums(sqlDB); err != nil {
+		return err
+	}
+
+	for _, filename := range files {
+		path := filepath.Join(db.MigrationsDir, filename)
+		name := repeatableName(filename)
+		checksum, err := db.migrationChecksum(path)
+		if err != nil {
+			return err
+		}
+		if recorded[name] == checksum {
+			continue
+		}
+
+		data, err := db.readFile(path)
+		if err != nil {
+			return err
+		}
+		contents := normalizeMigration(string(data))
+		selected, err := selectDriverBlocks(contents, db.DatabaseURL.Scheme)
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		m, err := parseRepeatableMigration(selected)
+		if err != nil {
+			return fmt.Errorf("%s: %s", filename, err)
+		}
+		m.Line = contentsLine(contents, m.Contents)
+
+		if db.DryRun {
+			fmt.Fprintf(db.Log, "Applying: %s (dry run)\n", filename)
+			db.printDryRun(drv, m, "record checksum of "+name+" in schema_migration_checksums")
+			continue
+		}
+
+		fmt.Fprintf(db.Log, "Applying: %s\n", filename)
+
+		result := MigrationResult{
+			Version:   name,
+			Filename:  filename,
+			Direction: "up",
+		}
+		err = db.execMigration(drv, sqlDB, m, result, func(tx Transaction, _ MigrationResult) error {
+			// replace the checksum recorded when the migration was last applied
+			return checksumDrv.InsertRepeatableChecksum(tx, name, checksum)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRepeatableMigration(t *testing.T) {
+	m, err := parseRepeatableMigration("-- migrate:transaction false\ncreate view v as select 1;\n")
+	require.NoError(t, err)
+	require.Equal(t, "-- migrate:transaction false\ncreate view v as select 1;\n", m.Contents)
+	require.False(t, m.Options.Transaction())
+
+	// an up block is applied without the rest of the file
+	m, err = parseRepeatableMigration("-- migrate:up transaction:false\ncreate view v as select 1;\n" +
+		"-- migrate:down\ndrop view v;\n")
+	require.NoError(t, err)
+	require.Equal(t, "-- migrate:up transaction:false\ncreate view v as select 1;\n", m.Contents)
+	require.False(t, m.Options.Transaction())
+
+	require.Equal(t, "R__views", repeatableName("R__views.sql"))
+	require.Equal(t, "reports/R__views", repeatableName(filepath.Join("reports", "R__views.sql")))
+}
+
+func TestRepeatableMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "repeatable.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	write := func(name, contents string) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+	write("1_users.sql", "-- migrate:up\ncreate table users (id integer, name text);\n"+
+		"-- migrate:down\ndrop table users;\n")
+	write("R__user_names.sql", "drop view if exists user_names;\ncreate view user_names as select name from users;\n")
+
+	// repeatable migrations are applied after versioned migrations
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Applying: 1_users.sql\nApplying: R__user_names.sql\n", buf.String())
+
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("select name from user_names")
+	require.NoError(t, err)
+
+	// unchanged repeatable migrations are not applied again
+	buf.Reset()
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "", buf.String())
+
+	// changed repeatable migrations are applied again, and the checksum replaced
+	write("R__user_names.sql", "drop view if exists user_names;\n"+
+		"create view user_names as select id, name from users;\n")
+	db.DryRun = true
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "Applying: R__user_names.sql (dry run)\n")
+	require.Contains(t, buf.String(), "-- record checksum of R__user_names in schema_migration_checksums\n")
+
+	buf.Reset()
+	db.DryRun = false
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Applying: R__user_names.sql\n", buf.String())
+	_, err = sqlDB.Exec("select id from user_names")
+	require.NoError(t, err)
+
+	checksums, err := SQLiteDriver{}.SelectRepeatableChecksums(sqlDB)
+	require.NoError(t, err)
+	current, err := db.migrationChecksum(filepath.Join(dir, "R__user_names.sql"))
+	require.NoError(t, err)
+	require.Equal(t, current, checksums["R__user_names"])
+
+	// repeatable migrations are not recorded as versions
+	applied, err := SQLiteDriver{}.SelectMigrations(sqlDB, -1)
+	require.NoError(t, err)
+	require.Equal(t, map[string]bool{"1": true}, applied)
+
+	// failed repeatable migrations are applied again next time
+	write("R__user_names.sql", "create view user_names as select missing from users;\n")
+	err = db.Migrate()
+	require.Error(t, err)
+	checksums, err = SQLiteDriver{}.SelectRepeatableChecksums(sqlDB)
+	require.NoError(t, err)
+	require.Equal(t, current, checksums["R__user_names"])
+}
@@ -0,0 +1,73 @@
+package dbmate
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// checkReplicationLag waits until the replication lag is below MaxReplicationLag,
+// for up to ReplicationLagWait. The lag is checked on each of ReplicaURLs if set,
+// or using the migration connection otherwise.
+func (db *DB) checkReplicationLag(drv Driver, sqlDB *sql.DB) error {
+	if db.MaxReplicationLag == 0 {
+		return nil
+	}
+
+	lagDrv, ok := drv.(replicationLagDriver)
+	if !ok {
+		return fmt.Errorf("replication lag checks are not supported by the %s driver",
+			db.DatabaseURL.Scheme)
+	}
+
+	deadline := time.Now().Add(db.ReplicationLagWait)
+	for {
+		name, lag, err := db.maxReplicationLag(lagDrv, sqlDB)
+		if err != nil {
+			return fmt.Errorf("unable to check replication lag: %s", err)
+		}
+		if lag <= db.MaxReplicationLag {
+			return nil
+		}
+
+		if time.Now().After(deadline) {
+			return fmt.Errorf("replication lag on %s is %s (maximum %s)", name, lag, db.MaxReplicationLag)
+		}
+
+		fmt.Fprintf(db.Log, "Waiting: replication lag on %s is %s (maximum %s)\n",
+			name, lag, db.MaxReplicationLag)
+		time.Sleep(db.WaitInterval)
+	}
+}
+
+// maxReplicationLag returns the database with the highest replication lag
+func (db *DB) maxReplicationLag(drv replicationLagDriver, sqlDB *sql.DB) (string, time.Duration, error) {
+	if len(db.ReplicaURLs) == 0 {
+		lag, err := drv.ReplicationLag(sqlDB)
+		return databaseName(db.DatabaseURL), lag, err
+	}
+
+	name, max := "", time.Duration(-1)
+	for _, u := range db.ReplicaURLs {
+		lag, err := replicaLag(drv, u)
+		if err != nil {
+			return "", 0, fmt.Errorf("%s: %s", u.Host, err)
+		}
+		if lag > max {
+			name, max = u.Host, lag
+		}
+	}
+
+	return name, max, nil
+}
+
+func replicaLag(drv replicationLagDriver, u *url.URL) (time.Duration, error) {
+	sqlDB, err := GetDriverOpen(u)
+	if err != nil {
+		return 0, err
+	}
+	defer mustClose(sqlDB)
+
+	return drv.ReplicationLag(sqlDB)
+}
@@ -0,0 +1,104 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// lagTestDriver is a sqlite driver which reports a sequence of replication lags
+type lagTestDriver struct {
+	SQLiteDriver
+	lags []time.Duration
+}
+
+func (drv *lagTestDriver) ReplicationLag(db *sql.DB) (time.Duration, error) {
+	lag := drv.lags[0]
+	if len(drv.lags) > 1 {
+		drv.lags = drv.lags[1:]
+	}
+
+	return lag, nil
+}
+
+func TestCheckReplicationLag(t *testing.T) {
+	drv := &lagTestDriver{}
+	RegisterDriver(drv, "sqlite-lag")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-lag:///" + filepath.Join(dir, "lag.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	db.WaitInterval = time.Millisecond
+	db.MaxReplicationLag = 10 * time.Second
+	err = ioutil.WriteFile(filepath.Join(dir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n"), 0644)
+	require.NoError(t, err)
+
+	// aborts if the lag does not drop within the wait time
+	drv.lags = []time.Duration{time.Minute}
+	err = db.Migrate()
+	require.EqualError(t, err, "replication lag on "+databaseName(u)+" is 1m0s (maximum 10s)")
+	require.Equal(t, "", buf.String())
+
+	// waits for the lag to drop
+	drv.lags = []time.Duration{time.Minute, 30 * time.Second, time.Second}
+	db.ReplicationLagWait = time.Minute
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Waiting: replication lag on "+databaseName(u)+" is 1m0s (maximum 10s)\n"+
+		"Waiting: replication lag on "+databaseName(u)+" is 30s (maximum 10s)\n"+
+		"Applying: 1_users.sql\n", buf.String())
+
+	// redo checks the lag before rolling back
+	err = ioutil.WriteFile(filepath.Join(dir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n-- migrate:down\ndrop table users;\n"), 0644)
+	require.NoError(t, err)
+	buf.Reset()
+	db.ReplicationLagWait = 0
+	drv.lags = []time.Duration{time.Minute}
+	err = db.Redo()
+	require.EqualError(t, err, "replication lag on "+databaseName(u)+" is 1m0s (maximum 10s)")
+	require.Equal(t, "", buf.String())
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.True(t, status[0].Applied)
+
+	drv.lags = []time.Duration{time.Second}
+	err = db.Redo()
+	require.NoError(t, err)
+	require.Equal(t, "Rolling back: 1_users.sql\nApplying: 1_users.sql\n", buf.String())
+
+	// replicas are checked individually
+	replica, err := url.Parse("sqlite-lag:///" + filepath.Join(dir, "replica.sqlite3"))
+	require.NoError(t, err)
+	db.ReplicaURLs = []*url.URL{replica}
+	db.ReplicationLagWait = 0
+	drv.lags = []time.Duration{time.Minute}
+	name, lag, err := db.maxReplicationLag(drv, nil)
+	require.NoError(t, err)
+	require.Equal(t, replica.Host, name)
+	require.Equal(t, time.Minute, lag)
+
+	db.DatabaseURL = sqliteTestURL(t)
+	err = db.checkReplicationLag(SQLiteDriver{}, nil)
+	require.EqualError(t, err, "replication lag checks are not supported by the sqlite3 driver")
+}
@@ -0,0 +1,112 @@
+package dbmate
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+)
+
+// runsInsertColumns lists the columns written to the schema_migration_runs table
+const runsInsertColumns = "run_id, version, direction, started_at, duration_ms, " +
+	"rows_affected, lock_wait_ms, success, error"
+
+// runsDriver is implemented by drivers which can record migration metrics in a
+// schema_migration_runs table
+type runsDriver interface {
+	// CreateRunsTable creates the schema_migration_runs table if it does not exist
+	CreateRunsTable(*sql.DB) error
+	// InsertRun records the result of applying or rolling back a migration
+	InsertRun(db *sql.DB, runID string, result MigrationResult) error
+	// SelectRunDirections returns the direction of the most recent successful run
+	// of each version, or nil if the schema_migration_runs table does not exist
+	SelectRunDirections(*sql.DB) (map[string]string, error)
+}
+
+// newRunID returns a random identifier which groups the migrations of a run
+func newRunID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
+
+// startRun starts a new run. The schema_migration_runs table is created when the
+// first migration of the run is recorded, so commands which don't apply or roll
+// back a migration don't change the schema.
+func (db *DB) startRun(drv Driver) error {
+	if _, ok := drv.(runsDriver); !ok {
+		return fmt.Errorf("recording runs is not supported by the %s driver", db.DatabaseURL.Scheme)
+	}
+
+	db.runID = newRunID()
+	db.runsTableCreated = false
+
+	return nil
+}
+
+// recordRun writes a migration result to the schema_migration_runs table.
+// Failures are printed as warnings, since the migration itself has completed.
+func (db *DB) recordRun(drv Driver, sqlDB *sql.DB, result MigrationResult) {
+	runsDrv, ok := drv.(runsDriver)
+	if !ok {
+		return
+	}
+
+	if !db.runsTableCreated {
+		if err := runsDrv.CreateRunsTable(sqlDB); err != nil {
+			fmt.Fprintf(db.Log, "Warning: unable to create schema_migration_runs: %s\n", err)
+			return
+		}
+		db.runsTableCreated = true
+	}
+
+	if err := runsDrv.InsertRun(sqlDB, db.runID, result); err != nil {
+		fmt.Fprintf(db.Log, "Warning: unable to record migration run: %s\n", err)
+	}
+}
+
+// selectRunDirections reads a query returning version and direction columns,
+// ordered by when each migration ran, into a map of the latest direction
+func selectRunDirections(db *sql.DB, query string) (map[string]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	directions := map[string]string{}
+	for rows.Next() {
+		var version, direction string
+		if err := rows.Scan(&version, &direction); err != nil {
+			return nil, err
+		}
+
+		directions[version] = direction
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return directions, nil
+}
+
+// runValues returns the values for runsInsertColumns
+func runValues(runID string, result MigrationResult) []interface{} {
+	errMessage := sql.NullString{}
+	if result.Err != nil {
+		errMessage = sql.NullString{String: result.Err.Error(), Valid: true}
+	}
+
+	return []interface{}{
+		runID,
+		result.Version,
+		result.Direction,
+		result.StartedAt.UTC(),
+		result.Duration.Milliseconds(),
+		result.RowsAffected,
+		result.LockWait.Milliseconds(),
+		result.Err == nil,
+		errMessage,
+	}
+}
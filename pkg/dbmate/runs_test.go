@@ -0,0 +1,124 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRecordRuns(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "runs.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	db.RecordRuns = true
+	migrations := map[string]string{
+		"1_users.sql": "-- migrate:up\ncreate table users (id integer primary key);\n" +
+			"insert into users (id) values (1), (2), (3);\n" +
+			"-- migrate:down\ndrop table users;\n",
+		"2_fail.sql": "-- migrate:up\ninsert into missing (id) values (1);\n",
+	}
+	for name, contents := range migrations {
+		err = ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	err = db.Migrate()
+	require.EqualError(t, err, "2_fail.sql: statement 1, line 2: no such table: missing")
+	runID := db.runID
+	require.Len(t, runID, 32)
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	require.NotEqual(t, runID, db.runID)
+
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+
+	rows, err := sqlDB.Query("select run_id, version, direction, rows_affected, success, " +
+		"coalesce(error, '') from schema_migration_runs order by id")
+	require.NoError(t, err)
+	defer mustClose(rows)
+
+	type run struct {
+		runID, version, direction string
+		rowsAffected              int64
+		success                   bool
+		err                       string
+	}
+	runs := []run{}
+	for rows.Next() {
+		r := run{}
+		require.NoError(t, rows.Scan(&r.runID, &r.version, &r.direction, &r.rowsAffected, &r.success, &r.err))
+		runs = append(runs, r)
+	}
+	require.NoError(t, rows.Err())
+
+	require.Equal(t, []run{
+		{runID, "1", "up", 3, true, ""},
+		{runID, "2", "up", 0, false, "2_fail.sql: statement 1, line 2: no such table: missing"},
+		{db.runID, "1", "down", 0, true, ""},
+	}, runs)
+}
+
+func TestRecordRunsCreatesTable(t *testing.T) {
+	u := sqliteTestURL(t)
+	db := newTestDB(t, u)
+	db.RecordRuns = true
+
+	err := db.Drop()
+	require.NoError(t, err)
+
+	sqlDB, err := GetDriverOpen(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	runsTables := func() []string {
+		names, err := queryColumn(sqlDB, "select name from sqlite_master where name = 'schema_migration_runs'")
+		require.NoError(t, err)
+		return names
+	}
+
+	// the table is not created until a run records a migration
+	err = db.Baseline("")
+	require.NoError(t, err)
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Empty(t, runsTables())
+
+	_, err = sqlDB.Exec("delete from schema_migrations")
+	require.NoError(t, err)
+	err = db.Migrate()
+	require.NoError(t, err)
+	require.Equal(t, []string{"schema_migration_runs"}, runsTables())
+}
+
+// plainTestDriver only implements the Driver interface
+type plainTestDriver struct {
+	Driver
+}
+
+func TestRecordRunsUnsupported(t *testing.T) {
+	db := newTestDB(t, sqliteTestURL(t))
+	db.RecordRuns = true
+	db.driver = plainTestDriver{SQLiteDriver{}}
+
+	err := db.Migrate()
+	require.EqualError(t, err, "recording runs is not supported by the sqlite3 driver")
+}
@@ -0,0 +1,253 @@
+package dbmate
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSeedsDir specifies the default directory for seed files
+const DefaultSeedsDir = "./db/seeds"
+
+// Seed runs the seed files in SeedsDir, followed by those in the subdirectory
+// for the Environment (if set), e.g. db/seeds/development. Files run in name
+// order, each in a transaction, and should be idempotent, since seeds are run
+// again on each invocation.
+func (db *DB) Seed() error {
+	re := regexp.MustCompile(`\.sql$`)
+	files, err := listFiles(db.SeedsDir, re)
+	if err != nil {
+		return fmt.Errorf("could not find seeds directory `%s`", db.SeedsDir)
+	}
+
+	if db.Environment != "" {
+		envFiles, err := listFiles(filepath.Join(db.SeedsDir, db.Environment), re)
+		if err == nil {
+			for _, name := range envFiles {
+				files = append(files, filepath.Join(db.Environment, name))
+			}
+		}
+	}
+
+	if len(files) == 0 {
+		return fmt.Errorf("no seed files found")
+	}
+
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	for _, name := range files {
+		contents, err := ioutil.ReadFile(filepath.Join(db.SeedsDir, name))
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(db.Log, "Seeding: %s\n", name)
+		db.logSQL(string(contents))
+
+		err = doTransaction(sqlDB, func(tx Transaction) error {
+			_, err := execScript(drv, tx, string(contents))
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("seed %s failed: %s", name, err)
+		}
+	}
+
+	return nil
+}
+
+// SeedTable configures how rows are sampled from a table when generating seeds
+type SeedTable struct {
+	Name  string `yaml:"name"`
+	Where string `yaml:"where"`
+	Limit int    `yaml:"limit"`
+	// Columns maps column names to masking rules, see maskValue
+	Columns map[string]string `yaml:"columns"`
+}
+
+// GenerateSeeds samples rows from each table into a seed file in dir, masking
+// columns according to the table rules. Files are numbered in the order of the
+// tables, so that they can be loaded without violating foreign keys.
+func (db *DB) GenerateSeeds(dir string, tables []SeedTable) error {
+	for _, table := range tables {
+		for column, rule := range table.Columns {
+			if !validMaskRule(rule) {
+				return fmt.Errorf("invalid masking rule for %s.%s: %s", table.Name, column, rule)
+			}
+		}
+	}
+
+	drv, err := db.GetDriver()
+	if err != nil {
+		return err
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	if err := ensureDir(dir); err != nil {
+		return err
+	}
+
+	for i, table := range tables {
+		path := filepath.Join(dir, fmt.Sprintf("%03d_%s.sql", i+1, table.Name))
+		fmt.Fprintf(db.Log, "Writing: %s\n", path)
+
+		contents, err := seedTable(sqlDB, table)
+		if err != nil {
+			return fmt.Errorf("unable to sample %s: %s", table.Name, err)
+		}
+
+		if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// seedTable returns insert statements for the sampled rows of a table
+func seedTable(sqlDB *sql.DB, table SeedTable) ([]byte, error) {
+	query := "select * from " + table.Name
+	if table.Where != "" {
+		query += " where " + table.Where
+	}
+	if table.Limit > 0 {
+		query += " limit " + strconv.Itoa(table.Limit)
+	}
+
+	rows, err := sqlDB.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("-- generated by dbmate seed generate\n")
+
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		literals := make([]string, len(columns))
+		for i, column := range columns {
+			literals[i] = maskValue(table.Columns[column], values[i])
+		}
+
+		fmt.Fprintf(&buf, "insert into %s (%s) values (%s);\n", table.Name,
+			strings.Join(columns, ", "), strings.Join(literals, ", "))
+	}
+
+	return buf.Bytes(), rows.Err()
+}
+
+// validMaskRule returns whether a masking rule is supported
+func validMaskRule(rule string) bool {
+	switch rule {
+	case "", "keep", "null", "hash", "email", "name", "redact":
+		return true
+	}
+
+	return strings.HasPrefix(rule, "value:")
+}
+
+// maskValue applies a masking rule to a value, and returns it as an SQL literal.
+// Masked values are derived from a hash of the original, so that equal values
+// (such as foreign keys or unique columns) remain equal after masking.
+//
+//	keep          the original value (default)
+//	null          NULL
+//	hash          a hash of the original value
+//	email         an example.com email address
+//	name          a placeholder name
+//	redact        the string "REDACTED"
+//	value:VALUE   a fixed value
+func maskValue(rule string, value interface{}) string {
+	if value == nil && !strings.HasPrefix(rule, "value:") {
+		return "NULL"
+	}
+
+	switch rule {
+	case "", "keep":
+		return sqlLiteral(value)
+	case "null":
+		return "NULL"
+	case "hash":
+		return sqlLiteral(maskHash(value))
+	case "email":
+		return sqlLiteral("user_" + maskHash(value)[:12] + "@example.com")
+	case "name":
+		return sqlLiteral("Name " + maskHash(value)[:8])
+	case "redact":
+		return sqlLiteral("REDACTED")
+	}
+
+	return sqlLiteral(strings.TrimPrefix(rule, "value:"))
+}
+
+func maskHash(value interface{}) string {
+	sum := sha256.Sum256([]byte(fmt.Sprint(literalString(value))))
+	return hex.EncodeToString(sum[:])
+}
+
+// literalString converts byte slices to strings, as returned by some drivers
+func literalString(value interface{}) interface{} {
+	if b, ok := value.([]byte); ok {
+		return string(b)
+	}
+
+	return value
+}
+
+// sqlLiteral formats a scanned value as an SQL literal
+func sqlLiteral(value interface{}) string {
+	switch v := literalString(value).(type) {
+	case nil:
+		return "NULL"
+	case int64, float64:
+		return fmt.Sprint(v)
+	case bool:
+		if v {
+			return "TRUE"
+		}
+		return "FALSE"
+	case time.Time:
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	default:
+		return sqlLiteral(fmt.Sprint(v))
+	}
+}
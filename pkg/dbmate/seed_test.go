@@ -0,0 +1,154 @@
+package dbmate
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaskValue(t *testing.T) {
+	require.Equal(t, "'alice@example.org'", maskValue("", []byte("alice@example.org")))
+	require.Equal(t, "'it''s'", maskValue("keep", "it's"))
+	require.Equal(t, "42", maskValue("", int64(42)))
+	require.Equal(t, "TRUE", maskValue("", true))
+	require.Equal(t, "'2020-01-02 03:04:05'",
+		maskValue("", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)))
+	require.Equal(t, "NULL", maskValue("email", nil))
+	require.Equal(t, "NULL", maskValue("null", "alice"))
+	require.Equal(t, "'REDACTED'", maskValue("redact", "alice"))
+	require.Equal(t, "'secret'", maskValue("value:secret", nil))
+
+	// masked values are deterministic
+	email := maskValue("email", "alice@example.org")
+	require.Regexp(t, `^'user_[0-9a-f]{12}@example.com'$`, email)
+	require.Equal(t, email, maskValue("email", []byte("alice@example.org")))
+	require.NotEqual(t, email, maskValue("email", "bob@example.org"))
+	require.Regexp(t, `^'Name [0-9a-f]{8}'$`, maskValue("name", "Alice"))
+	require.Regexp(t, `^'[0-9a-f]{64}'$`, maskValue("hash", int64(1)))
+}
+
+func TestGenerateSeeds(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "prod.sqlite3"))
+	require.NoError(t, err)
+
+	sqlDB, err := SQLiteDriver{}.Open(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec(`create table users (id integer, email text, name text, bio text);
+		insert into users values (1, 'alice@example.org', 'Alice', 'hi'),
+			(2, 'bob@example.org', 'Bob', null), (3, 'carol@example.org', 'Carol', 'hey');`)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	seedsDir := filepath.Join(dir, "seeds")
+	err = db.GenerateSeeds(seedsDir, []SeedTable{{
+		Name:    "users",
+		Where:   "id < 3",
+		Limit:   10,
+		Columns: map[string]string{"email": "email", "name": "redact", "bio": "null"},
+	}})
+	require.NoError(t, err)
+	require.Equal(t, "Writing: "+filepath.Join(seedsDir, "001_users.sql")+"\n", buf.String())
+
+	contents, err := ioutil.ReadFile(filepath.Join(seedsDir, "001_users.sql"))
+	require.NoError(t, err)
+	require.Regexp(t, `^-- generated by dbmate seed generate
+insert into users \(id, email, name, bio\) values \(1, 'user_[0-9a-f]{12}@example.com', 'REDACTED', NULL\);
+insert into users \(id, email, name, bio\) values \(2, 'user_[0-9a-f]{12}@example.com', 'REDACTED', NULL\);
+$`, string(contents))
+	require.NotContains(t, string(contents), "alice")
+
+	err = db.GenerateSeeds(seedsDir, []SeedTable{{
+		Name:    "users",
+		Columns: map[string]string{"email": "scramble"},
+	}})
+	require.EqualError(t, err, "invalid masking rule for users.email: scramble")
+}
+
+func TestSeed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "seed.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.SeedsDir = filepath.Join(dir, "seeds")
+
+	err = db.Seed()
+	require.EqualError(t, err, "could not find seeds directory `"+db.SeedsDir+"`")
+
+	err = os.MkdirAll(filepath.Join(db.SeedsDir, "development"), 0755)
+	require.NoError(t, err)
+	err = db.Seed()
+	require.EqualError(t, err, "no seed files found")
+
+	sqlDB, err := SQLiteDriver{}.Open(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("create table users (id integer primary key, name text)")
+	require.NoError(t, err)
+
+	seeds := map[string]string{
+		"001_admin.sql":             "insert or ignore into users values (1, 'admin');",
+		"002_rename.sql":            "update users set name = 'root' where id = 1;",
+		"development/001_users.sql": "insert or ignore into users values (2, 'dev');",
+		"test/001_users.sql":        "insert or ignore into users values (3, 'test');",
+	}
+	for name, contents := range seeds {
+		err = os.MkdirAll(filepath.Dir(filepath.Join(db.SeedsDir, name)), 0755)
+		require.NoError(t, err)
+		err = ioutil.WriteFile(filepath.Join(db.SeedsDir, name), []byte(contents), 0644)
+		require.NoError(t, err)
+	}
+
+	// shared seeds run before the seeds for the environment, and may be run repeatedly
+	db.Environment = "development"
+	for i := 0; i < 2; i++ {
+		buf.Reset()
+		err = db.Seed()
+		require.NoError(t, err)
+		require.Equal(t, "Seeding: 001_admin.sql\nSeeding: 002_rename.sql\n"+
+			"Seeding: development/001_users.sql\n", buf.String())
+	}
+
+	var names string
+	err = sqlDB.QueryRow("select group_concat(name, ',') from (select name from users order by id)").
+		Scan(&names)
+	require.NoError(t, err)
+	require.Equal(t, "root,dev", names)
+
+	// a failed seed is rolled back
+	err = ioutil.WriteFile(filepath.Join(db.SeedsDir, "003_broken.sql"),
+		[]byte("insert into users values (4, 'x'); insert into missing values (1);"), 0644)
+	require.NoError(t, err)
+	db.Environment = ""
+	err = db.Seed()
+	require.EqualError(t, err, "seed 003_broken.sql failed: no such table: missing")
+
+	var count int
+	err = sqlDB.QueryRow("select count(*) from users").Scan(&count)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+}
@@ -0,0 +1,121 @@
+package dbmate
+
+import (
+	"regexp"
+	"strings"
+)
+
+// dollarQuoteRegExp matches a postgres dollar quote, such as $$ or $body$
+var dollarQuoteRegExp = regexp.MustCompile(`^\$(?:[A-Za-z_]\w*)?\$`)
+
+// schemaStatements splits SQL into statements, including any preceding comments
+// and blank lines. A semicolon only ends a statement outside of quoted strings and
+// identifiers (single and double quotes, MySQL backticks, and postgres dollar
+// quotes), and outside of `--` and `/* */` comments. The statements join to form
+// the SQL again.
+func schemaStatements(schema string) []string {
+	return splitSQL(schema, false)
+}
+
+// mysqlStatements splits MySQL into statements like schemaStatements, except that
+// backslashes escape characters in strings, # starts a comment, and there are no
+// dollar quotes
+func mysqlStatements(contents string) []string {
+	return splitSQL(contents, true)
+}
+
+func splitSQL(schema string, mysql bool) []string {
+	statements := []string{}
+	start := 0
+	for i := 0; i < len(schema); {
+		switch c := schema[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			i = quoteEnd(schema, i, mysql && c != '`')
+		case strings.HasPrefix(schema[i:], "--") || (mysql && c == '#'):
+			if end := strings.IndexByte(schema[i:], '\n'); end >= 0 {
+				i += end
+			} else {
+				i = len(schema)
+			}
+		case strings.HasPrefix(schema[i:], "/*"):
+			if end := strings.Index(schema[i+2:], "*/"); end >= 0 {
+				i += end + 4
+			} else {
+				i = len(schema)
+			}
+		case !mysql && c == '$' && (i == 0 || !isIdentifierByte(schema[i-1])):
+			i = dollarQuoteEnd(schema, i)
+		case c == ';':
+			i = semicolonEnd(schema, i)
+			statements = append(statements, schema[start:i])
+			start = i
+		default:
+			i++
+		}
+	}
+	if start < len(schema) {
+		statements = append(statements, schema[start:])
+	}
+
+	return statements
+}
+
+// quoteEnd returns the offset after the string or identifier starting with the
+// quote at offset i. Quotes are escaped by doubling them, and backslashes also
+// escape characters if backslashes is set (as in MySQL strings), or in postgres
+// escape strings, such as E'it\'s'.
+func quoteEnd(s string, i int, backslashes bool) int {
+	quote := s[i]
+	escapes := backslashes || quote == '\'' && i > 0 && (s[i-1] == 'e' || s[i-1] == 'E') &&
+		(i == 1 || !isIdentifierByte(s[i-2]))
+	for j := i + 1; j < len(s); j++ {
+		switch {
+		case escapes && s[j] == '\\':
+			j++
+		case s[j] == quote && j+1 < len(s) && s[j+1] == quote:
+			j++
+		case s[j] == quote:
+			return j + 1
+		}
+	}
+
+	return len(s)
+}
+
+// dollarQuoteEnd returns the offset after the dollar quoted string starting at
+// offset i, or i+1 if the dollar sign does not start a dollar quote (such as a
+// parameter like $1)
+func dollarQuoteEnd(s string, i int) int {
+	tag := dollarQuoteRegExp.FindString(s[i:])
+	if tag == "" {
+		return i + 1
+	}
+	end := strings.Index(s[i+len(tag):], tag)
+	if end < 0 {
+		return len(s)
+	}
+
+	return i + len(tag) + end + len(tag)
+}
+
+// semicolonEnd returns the offset at which the statement ending with the
+// semicolon at offset i ends, which includes the rest of the line if it is blank
+func semicolonEnd(s string, i int) int {
+	for j := i + 1; j < len(s); j++ {
+		switch s[j] {
+		case ' ', '\t', '\r':
+			continue
+		case '\n':
+			return j + 1
+		}
+		break
+	}
+
+	return i + 1
+}
+
+// isIdentifierByte returns whether c may be part of an unquoted identifier
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+		c >= 0x80
+}
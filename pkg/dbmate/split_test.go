@@ -0,0 +1,68 @@
+package dbmate
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSchemaStatements(t *testing.T) {
+	schema := "SET x = 1;\n\n-- Name: f\nCREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n  RETURN 1;\nEND;\n$body$;\n" +
+		"CREATE TABLE a (\n  id integer\n);\n-- trailing"
+	require.Equal(t, []string{
+		"SET x = 1;\n",
+		"\n-- Name: f\nCREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n  RETURN 1;\nEND;\n$body$;\n",
+		"CREATE TABLE a (\n  id integer\n);\n",
+		"-- trailing",
+	}, schemaStatements(schema))
+}
+
+func TestSchemaStatementsQuoting(t *testing.T) {
+	cases := []struct {
+		name     string
+		sql      string
+		expected []string
+	}{
+		{"statements on one line", "select 1; select 2;",
+			[]string{"select 1;", " select 2;"}},
+		{"single quotes", "insert into t values ('a;\nb', 'it''s;');\nselect 1;",
+			[]string{"insert into t values ('a;\nb', 'it''s;');\n", "select 1;"}},
+		{"escape strings", "select E'it\\'s;', e'\\\\';\nselect 1;",
+			[]string{"select E'it\\'s;', e'\\\\';\n", "select 1;"}},
+		{"backslashes in standard strings", "select 'C:\\';\nselect 1;",
+			[]string{"select 'C:\\';\n", "select 1;"}},
+		{"double quotes", "create table \"a;b\" (id int);\nselect 1;",
+			[]string{"create table \"a;b\" (id int);\n", "select 1;"}},
+		{"backticks", "create table `a;b` (id int);\nselect 1;",
+			[]string{"create table `a;b` (id int);\n", "select 1;"}},
+		{"line comments", "-- drop; everything\nselect 1; -- one;\nselect 2;",
+			[]string{"-- drop; everything\nselect 1;", " -- one;\nselect 2;"}},
+		{"block comments", "/* a;\nb; */ select 1;\nselect 2;",
+			[]string{"/* a;\nb; */ select 1;\n", "select 2;"}},
+		{"dollar quotes", "do $$ begin perform 1; end $$;\ndo $fn$ select '$$;' $fn$;",
+			[]string{"do $$ begin perform 1; end $$;\n", "do $fn$ select '$$;' $fn$;"}},
+		{"parameters", "prepare p as select $1; select 2;",
+			[]string{"prepare p as select $1;", " select 2;"}},
+		{"dollar signs in identifiers", "select a$b$; select 2;",
+			[]string{"select a$b$;", " select 2;"}},
+		{"unterminated quote", "select 'a; select 2;",
+			[]string{"select 'a; select 2;"}},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			statements := schemaStatements(c.sql)
+			require.Equal(t, c.expected, statements)
+			require.Equal(t, c.sql, strings.Join(statements, ""))
+		})
+	}
+}
+
+func TestSplitStatements(t *testing.T) {
+	require.Equal(t, []string{
+		"-- users\ncreate table users (id int, sep text default ';')",
+		"create trigger t before insert on users for each row execute function f()",
+	}, splitStatements("-- users\ncreate table users (id int, sep text default ';');\n\n"+
+		"create trigger t before insert on users for each row execute function f();\n-- trailing\n"))
+}
@@ -1,17 +1,15 @@
-// +build cgo
-
 package dbmate
 
 import (
 	"bytes"
 	"database/sql"
+	"errors"
 	"fmt"
 	"net/url"
 	"os"
 	"regexp"
 	"strings"
-
-	_ "github.com/mattn/go-sqlite3" // sqlite driver for database/sql
+	"time"
 )
 
 func init() {
@@ -21,6 +19,111 @@ func init() {
 
 // SQLiteDriver provides top level database functions
 type SQLiteDriver struct {
+	// MigrationsTableName is the name of the migrations table (default schema_migrations)
+	MigrationsTableName string
+	// Pragmas are PRAGMAs (e.g. foreign_keys=on) applied to every connection,
+	// unless the URL sets the same option
+	Pragmas []string
+}
+
+// sqlitePragmas are the PRAGMAs which can be set with URL options or Pragmas.
+// The sqlite driver applies them each time it opens a connection, so that they
+// also hold for connections opened by the connection pool.
+var sqlitePragmas = []string{"foreign_keys", "journal_mode", "busy_timeout", "synchronous"}
+
+// sqlitePragmaValueRegExp matches the values which PRAGMAs may be set to
+var sqlitePragmaValueRegExp = regexp.MustCompile(`^-?\w+$`)
+
+// migrationsTable returns the quoted name of the schema_migrations table
+func (drv SQLiteDriver) migrationsTable() string {
+	if drv.MigrationsTableName == "" {
+		return "schema_migrations"
+	}
+
+	schema, table := splitQualifiedName(drv.MigrationsTableName)
+	if schema == "" {
+		return sqliteQuoteIdentifier(table)
+	}
+
+	return sqliteQuoteIdentifier(schema) + "." + sqliteQuoteIdentifier(table)
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table
+func (drv SQLiteDriver) MigrationsTable(name string) Driver {
+	drv.MigrationsTableName = name
+
+	return drv
+}
+
+// WithPragmas returns a driver which applies the PRAGMAs to every connection
+func (drv SQLiteDriver) WithPragmas(pragmas []string) Driver {
+	drv.Pragmas = pragmas
+
+	return drv
+}
+
+// pragmas returns the PRAGMAs set by the driver and URL, by name
+func (drv SQLiteDriver) pragmas(u *url.URL) (map[string]string, error) {
+	supported := map[string]bool{}
+	for _, name := range sqlitePragmas {
+		supported[name] = true
+	}
+
+	pragmas := map[string]string{}
+	for _, pragma := range drv.Pragmas {
+		parts := strings.SplitN(pragma, "=", 2)
+		name := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid sqlite pragma %q, expected name=value", pragma)
+		}
+		if !supported[name] {
+			return nil, fmt.Errorf("the %s pragma is not supported, only %s can be set",
+				name, strings.Join(sqlitePragmas, ", "))
+		}
+		pragmas[name] = strings.TrimSpace(parts[1])
+	}
+
+	query := u.Query()
+	for _, name := range sqlitePragmas {
+		if value := query.Get(name); value != "" {
+			pragmas[name] = value
+		}
+	}
+
+	for name, value := range pragmas {
+		if !sqlitePragmaValueRegExp.MatchString(value) {
+			return nil, fmt.Errorf("invalid value %q for the %s pragma", value, name)
+		}
+	}
+
+	return pragmas, nil
+}
+
+// dsn returns the data source name of the database, with the options which set
+// its PRAGMAs
+func (drv SQLiteDriver) dsn(u *url.URL) (string, error) {
+	pragmas, err := drv.pragmas(u)
+	if err != nil {
+		return "", err
+	}
+	options := sqlitePragmaOptions(pragmas)
+
+	dsn := sqlitePath(u)
+	if name, ok := sqliteMemoryName(u); ok {
+		dsn = sqliteMemoryDSN(name)
+	}
+	if len(options) == 0 {
+		return dsn, nil
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&" + options.Encode(), nil
+	}
+
+	return dsn + "?" + options.Encode(), nil
+}
+
+func sqliteQuoteIdentifier(str string) string {
+	return `"` + strings.Replace(str, `"`, `""`, -1) + `"`
 }
 
 func sqlitePath(u *url.URL) string {
@@ -31,15 +134,31 @@ func sqlitePath(u *url.URL) string {
 	return str
 }
 
-// Open creates a new database connection
+// Info describes the sqlite driver, whose URL options set PRAGMAs
+func (drv SQLiteDriver) Info() DriverInfo {
+	return DriverInfo{
+		SchemaDump: true,
+		Binaries:   []string{"sqlite3"},
+		URLOptions: sqlitePragmas,
+	}
+}
+
+// Open creates a new database connection, which applies the configured PRAGMAs
 func (drv SQLiteDriver) Open(u *url.URL) (*sql.DB, error) {
-	return sql.Open("sqlite3", sqlitePath(u))
+	dsn, err := drv.dsn(u)
+	if err != nil {
+		return nil, err
+	}
+
+	if name, ok := sqliteMemoryName(u); ok {
+		return openSQLiteMemory(name, dsn)
+	}
+
+	return sql.Open(sqliteDriverName, dsn)
 }
 
 // CreateDatabase creates the specified database
 func (drv SQLiteDriver) CreateDatabase(u *url.URL) error {
-	fmt.Printf("Creating: %s\n", sqlitePath(u))
-
 	db, err := drv.Open(u)
 	if err != nil {
 		return err
@@ -49,10 +168,14 @@ func (drv SQLiteDriver) CreateDatabase(u *url.URL) error {
 	return db.Ping()
 }
 
-// DropDatabase drops the specified database (if it exists)
+// DropDatabase drops the specified database (if it exists), with the files left
+// by journal_mode=wal. In-memory databases are discarded.
 func (drv SQLiteDriver) DropDatabase(u *url.URL) error {
+	if name, ok := sqliteMemoryName(u); ok {
+		return dropSQLiteMemory(name)
+	}
+
 	path := sqlitePath(u)
-	fmt.Printf("Dropping: %s\n", path)
 
 	exists, err := drv.DatabaseExists(u)
 	if err != nil {
@@ -62,13 +185,19 @@ func (drv SQLiteDriver) DropDatabase(u *url.URL) error {
 		return nil
 	}
 
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	return os.Remove(path)
 }
 
-func sqliteSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
+func sqliteSchemaMigrationsDump(db *sql.DB, table string) ([]byte, error) {
 	// load applied migrations
 	migrations, err := queryColumn(db,
-		"select quote(version) from schema_migrations order by version asc")
+		"select quote(version) from "+table+" order by version asc")
 	if err != nil {
 		return nil, err
 	}
@@ -78,7 +207,7 @@ func sqliteSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
 	buf.WriteString("-- Dbmate schema migrations\n")
 
 	if len(migrations) > 0 {
-		buf.WriteString("INSERT INTO schema_migrations (version) VALUES\n  (" +
+		buf.WriteString("INSERT INTO " + table + " (version) VALUES\n  (" +
 			strings.Join(migrations, "),\n  (") +
 			");\n")
 	}
@@ -86,15 +215,21 @@ func sqliteSchemaMigrationsDump(db *sql.DB) ([]byte, error) {
 	return buf.Bytes(), nil
 }
 
-// DumpSchema returns the current database schema
+// DumpSchema returns the current database schema. In-memory databases can't be
+// opened by the sqlite3 command, so their schema is read from sqlite_master.
 func (drv SQLiteDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
-	path := sqlitePath(u)
-	schema, err := runCommand("sqlite3", path, ".schema")
+	var schema []byte
+	var err error
+	if _, ok := sqliteMemoryName(u); ok {
+		schema, err = sqliteMasterSchema(db)
+	} else {
+		schema, err = runCommand("sqlite3", sqlitePath(u), ".schema")
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	migrations, err := sqliteSchemaMigrationsDump(db)
+	migrations, err := sqliteSchemaMigrationsDump(db, drv.migrationsTable())
 	if err != nil {
 		return nil, err
 	}
@@ -105,6 +240,10 @@ func (drv SQLiteDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
 
 // DatabaseExists determines whether the database exists
 func (drv SQLiteDriver) DatabaseExists(u *url.URL) (bool, error) {
+	if name, ok := sqliteMemoryName(u); ok {
+		return sqliteMemoryExists(name), nil
+	}
+
 	_, err := os.Stat(sqlitePath(u))
 	if os.IsNotExist(err) {
 		return false, nil
@@ -118,16 +257,39 @@ func (drv SQLiteDriver) DatabaseExists(u *url.URL) (bool, error) {
 
 // CreateMigrationsTable creates the schema_migrations table
 func (drv SQLiteDriver) CreateMigrationsTable(db *sql.DB) error {
-	_, err := db.Exec("create table if not exists schema_migrations " +
-		"(version varchar(255) primary key)")
+	_, err := db.Exec("create table if not exists " + drv.migrationsTable() + " " +
+		"(version varchar(255) primary key, checksum varchar(64), " +
+		strings.Join(metadataColumns("datetime"), ", ") + ")")
 
 	return err
 }
 
+// migrationsColumnExists returns whether the migrations table has a column, which
+// may be missing from a table created by an older version of dbmate
+func (drv SQLiteDriver) migrationsColumnExists(db *sql.DB, column string) (bool, error) {
+	schema, table := splitQualifiedName(drv.MigrationsTableName)
+	if schema == "" {
+		schema = "main"
+	}
+	if table == "" {
+		table = "schema_migrations"
+	}
+	var columns int
+	err := db.QueryRow("select count(*) from pragma_table_info(?, ?) where name = ?",
+		table, schema, column).Scan(&columns)
+
+	return columns > 0, err
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv SQLiteDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.migrationsColumnExists(db, "version")
+}
+
 // SelectMigrations returns a list of applied migrations
 // with an optional limit (in descending order)
 func (drv SQLiteDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
-	query := "select version from schema_migrations order by version desc"
+	query := "select version from " + drv.migrationsTable() + " order by version desc"
 	if limit >= 0 {
 		query = fmt.Sprintf("%s limit %d", query, limit)
 	}
@@ -153,18 +315,180 @@ func (drv SQLiteDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool
 
 // InsertMigration adds a new migration record
 func (drv SQLiteDriver) InsertMigration(db Transaction, version string) error {
-	_, err := db.Exec("insert into schema_migrations (version) values (?)", version)
+	_, err := db.Exec("insert into "+drv.migrationsTable()+" (version) values (?)", version)
 
 	return err
 }
 
 // DeleteMigration removes a migration record
 func (drv SQLiteDriver) DeleteMigration(db Transaction, version string) error {
-	_, err := db.Exec("delete from schema_migrations where version = ?", version)
+	_, err := db.Exec("delete from "+drv.migrationsTable()+" where version = ?", version)
 
 	return err
 }
 
+// CreateChecksumsTable creates schema_migration_checksums, which records the
+// checksums of repeatable migrations, and adds the checksum column to a
+// migrations table created by an older version of dbmate
+func (drv SQLiteDriver) CreateChecksumsTable(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists schema_migration_checksums " +
+		"(version varchar(255) primary key, checksum varchar(64) not null)")
+	if err != nil {
+		return err
+	}
+
+	exists, err := drv.migrationsColumnExists(db, "checksum")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = db.Exec("alter table " + drv.migrationsTable() + " add column checksum varchar(64)")
+
+	return err
+}
+
+// CreateMetadataColumns adds the metadata columns to a migrations table created by
+// an older version of dbmate
+func (drv SQLiteDriver) CreateMetadataColumns(db *sql.DB) error {
+	return addMetadataColumns(db, drv.migrationsTable(), metadataColumns("datetime"), drv.migrationsColumnExists)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv SQLiteDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	_, err := db.Exec("update "+drv.migrationsTable()+" set applied_at = ?, duration_ms = ?, "+
+		"applied_by = ?, hostname = ?, dbmate_version = ? where version = ?",
+		append(metadataValues(meta), version)...)
+
+	return err
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv SQLiteDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	exists, err := metadataColumnsExist(db, drv.migrationsColumnExists)
+	if err != nil || !exists {
+		return map[string]MigrationMetadata{}, err
+	}
+
+	return selectMetadata(db, metadataSelect+drv.migrationsTable()+" where applied_at is not null")
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv SQLiteDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	exists, err := drv.migrationsColumnExists(db, "checksum")
+	if err != nil || !exists {
+		return map[string]string{}, err
+	}
+
+	return selectChecksums(db, "select version, checksum from "+drv.migrationsTable()+
+		" where checksum is not null")
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv SQLiteDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return selectChecksums(db, "select version, checksum from schema_migration_checksums")
+}
+
+// InsertChecksum records the checksum of an applied migration in schema_migrations
+func (drv SQLiteDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	_, err := db.Exec("update "+drv.migrationsTable()+" set checksum = ? where version = ?",
+		checksum, version)
+
+	return err
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv SQLiteDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	if _, err := db.Exec("delete from schema_migration_checksums where version = ?", name); err != nil {
+		return err
+	}
+	_, err := db.Exec("insert into schema_migration_checksums (version, checksum) values (?, ?)",
+		name, checksum)
+
+	return err
+}
+
+// CreateRunsTable creates the schema_migration_runs table
+func (drv SQLiteDriver) CreateRunsTable(db *sql.DB) error {
+	_, err := db.Exec("create table if not exists schema_migration_runs (" +
+		"id integer primary key autoincrement, " +
+		"run_id varchar(32) not null, " +
+		"version varchar(255) not null, " +
+		"direction varchar(4) not null, " +
+		"started_at datetime not null, " +
+		"duration_ms integer not null, " +
+		"rows_affected integer not null, " +
+		"lock_wait_ms integer not null, " +
+		"success boolean not null, " +
+		"error text)")
+
+	return err
+}
+
+// InsertRun records a migration result in the schema_migration_runs table
+func (drv SQLiteDriver) InsertRun(db *sql.DB, runID string, result MigrationResult) error {
+	_, err := db.Exec("insert into schema_migration_runs ("+runsInsertColumns+") "+
+		"values (?, ?, ?, ?, ?, ?, ?, ?, ?)", runValues(runID, result)...)
+
+	return err
+}
+
+// SelectRunDirections returns the direction of the most recent successful run of
+// each version
+func (drv SQLiteDriver) SelectRunDirections(db *sql.DB) (map[string]string, error) {
+	var tables int
+	err := db.QueryRow("select count(*) from sqlite_master " +
+		"where type = 'table' and name = 'schema_migration_runs'").Scan(&tables)
+	if err != nil || tables == 0 {
+		return nil, err
+	}
+
+	return selectRunDirections(db, "select version, direction from schema_migration_runs "+
+		"where success order by id")
+}
+
+// Backup copies the database file
+func (drv SQLiteDriver) Backup(u *url.URL, path string, schemaOnly bool) error {
+	if schemaOnly {
+		return errors.New("schema only backups are not supported by the sqlite driver")
+	}
+
+	return copyFile(sqlitePath(u), path)
+}
+
+// Restore replaces the database file with a backup
+func (drv SQLiteDriver) Restore(u *url.URL, path string) error {
+	return copyFile(path, sqlitePath(u))
+}
+
+// ConsoleCommand returns the sqlite3 command to open the database file
+func (drv SQLiteDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return "sqlite3", []string{sqlitePath(u)}
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings.
+// SQLite has no lock timeout as such, so this sets how long to wait on a busy database.
+func (drv SQLiteDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	if s.StatementTimeout > 0 {
+		return nil, errors.New("statement timeout is not supported by the sqlite driver")
+	}
+	if s.IdleInTransactionTimeout > 0 {
+		return nil, errors.New("idle in transaction timeout is not supported by the sqlite driver")
+	}
+
+	var statements []string
+	if s.LockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("pragma busy_timeout = %d",
+			durationUnits(s.LockTimeout, time.Millisecond)))
+	}
+
+	return statements, nil
+}
+
 // Ping verifies a connection to the database. Due to the way SQLite works, by
 // testing whether the database is valid, it will automatically create the database
 // if it does not already exist.
@@ -0,0 +1,24 @@
+//go:build cgo
+// +build cgo
+
+package dbmate
+
+import (
+	"net/url"
+
+	_ "github.com/mattn/go-sqlite3" // sqlite driver for database/sql
+)
+
+// sqliteDriverName is the database/sql driver which opens sqlite databases.
+// Builds with cgo use mattn/go-sqlite3.
+const sqliteDriverName = "sqlite3"
+
+// sqlitePragmaOptions returns the go-sqlite3 DSN options which set PRAGMAs
+func sqlitePragmaOptions(pragmas map[string]string) url.Values {
+	options := url.Values{}
+	for name, value := range pragmas {
+		options.Set("_"+name, value)
+	}
+
+	return options
+}
@@ -0,0 +1,16 @@
+//go:build cgo
+// +build cgo
+
+package dbmate
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLitePragmaOptions(t *testing.T) {
+	options := sqlitePragmaOptions(map[string]string{"journal_mode": "wal", "foreign_keys": "on"})
+	require.Equal(t, url.Values{"_foreign_keys": {"on"}, "_journal_mode": {"wal"}}, options)
+}
@@ -0,0 +1,100 @@
+package dbmate
+
+import (
+	"database/sql"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// sqliteMemoryDatabases holds a connection to each in-memory database, because
+// sqlite discards an in-memory database when its last connection is closed
+var sqliteMemoryDatabases = map[string]*sql.DB{}
+var sqliteMemoryLock sync.Mutex
+
+// SQLiteMemoryURL returns the URL of a named in-memory sqlite database, for
+// running migrations from Go tests. Each name is a separate database, which
+// lasts until it is dropped or the process exits.
+func SQLiteMemoryURL(name string) *url.URL {
+	return &url.URL{Scheme: "sqlite", Host: ":memory:", Path: "/" + name}
+}
+
+// sqliteMemoryName returns the name of an in-memory database URL, such as
+// sqlite://:memory: (or sqlite://:memory:/name), and whether it is in-memory
+func sqliteMemoryName(u *url.URL) (string, bool) {
+	if u.Host != ":memory:" && sqlitePath(u) != ":memory:" {
+		return "", false
+	}
+
+	name := "dbmate"
+	if u.Host == ":memory:" && u.Path != "" {
+		name = strings.TrimPrefix(u.Path, "/")
+	}
+
+	return name, true
+}
+
+// sqliteMemoryDSN returns the DSN of an in-memory database, which is shared by
+// all connections in the process
+func sqliteMemoryDSN(name string) string {
+	return "file:" + url.PathEscape(name) + "?mode=memory&cache=shared"
+}
+
+// openSQLiteMemory opens a connection to an in-memory database with the DSN,
+// creating the database if necessary
+func openSQLiteMemory(name, dsn string) (*sql.DB, error) {
+	sqliteMemoryLock.Lock()
+	defer sqliteMemoryLock.Unlock()
+
+	if _, ok := sqliteMemoryDatabases[name]; !ok {
+		keep, err := sql.Open(sqliteDriverName, sqliteMemoryDSN(name))
+		if err != nil {
+			return nil, err
+		}
+		if err := keep.Ping(); err != nil {
+			mustClose(keep)
+			return nil, err
+		}
+		sqliteMemoryDatabases[name] = keep
+	}
+
+	return sql.Open(sqliteDriverName, dsn)
+}
+
+// dropSQLiteMemory discards an in-memory database
+func dropSQLiteMemory(name string) error {
+	sqliteMemoryLock.Lock()
+	defer sqliteMemoryLock.Unlock()
+
+	keep, ok := sqliteMemoryDatabases[name]
+	if !ok {
+		return nil
+	}
+	delete(sqliteMemoryDatabases, name)
+
+	return keep.Close()
+}
+
+// sqliteMemoryExists returns whether an in-memory database has been created
+func sqliteMemoryExists(name string) bool {
+	sqliteMemoryLock.Lock()
+	defer sqliteMemoryLock.Unlock()
+
+	_, ok := sqliteMemoryDatabases[name]
+	return ok
+}
+
+// sqliteMasterSchema returns the schema of a database from sqlite_master, in
+// the format written by the sqlite3 .schema command
+func sqliteMasterSchema(db *sql.DB) ([]byte, error) {
+	statements, err := queryColumn(db, "select sql || ';' from sqlite_master "+
+		"where sql is not null and name not like 'sqlite\\_%' escape '\\' order by rowid")
+	if err != nil {
+		return nil, err
+	}
+	if len(statements) == 0 {
+		return nil, nil
+	}
+
+	return []byte(strings.Join(statements, "\n") + "\n"), nil
+}
@@ -0,0 +1,79 @@
+package dbmate
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteMemoryName(t *testing.T) {
+	for input, expected := range map[string]string{
+		"sqlite://:memory:?cache=shared": "dbmate",
+		"sqlite:///:memory:":             "dbmate",
+		"sqlite://:memory:/test":         "test",
+	} {
+		u, err := url.Parse(input)
+		require.NoError(t, err)
+		name, ok := sqliteMemoryName(u)
+		require.True(t, ok, input)
+		require.Equal(t, expected, name, input)
+	}
+
+	_, ok := sqliteMemoryName(sqliteTestURL(t))
+	require.False(t, ok)
+	require.Equal(t, "sqlite://:memory:/test", SQLiteMemoryURL("test").String())
+}
+
+func TestSQLiteMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u := SQLiteMemoryURL("memory-test")
+	db := New(u)
+	db.Log = ioutil.Discard
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	db.SchemaFile = filepath.Join(dir, "schema.sql")
+	require.NoError(t, os.MkdirAll(db.MigrationsDir, 0755))
+	err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n-- migrate:down\ndrop table users;\n"), 0644)
+	require.NoError(t, err)
+
+	// the database is shared by every connection, and lasts until it is dropped
+	require.NoError(t, db.CreateAndMigrate())
+	drv := SQLiteDriver{}
+	exists, err := drv.DatabaseExists(u)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	sqlDB, err := drv.Open(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("insert into users (id) values (1)")
+	require.NoError(t, err)
+
+	// the schema file is read from sqlite_master
+	schema, err := ioutil.ReadFile(db.SchemaFile)
+	require.NoError(t, err)
+	require.Equal(t, "CREATE TABLE schema_migrations (version varchar(255) primary key, checksum varchar(64), "+
+		"applied_at datetime, duration_ms bigint, applied_by varchar(255), hostname varchar(255), "+
+		"dbmate_version varchar(32));\n"+
+		"CREATE TABLE schema_migration_checksums (version varchar(255) primary key, checksum varchar(64) not null);\n"+
+		"CREATE TABLE users (id integer);\n"+
+		"-- Dbmate schema migrations\n"+
+		"INSERT INTO schema_migrations (version) VALUES\n"+
+		"  ('1');\n", string(schema))
+
+	require.NoError(t, db.Rollback())
+	require.NoError(t, db.Drop())
+	exists, err = drv.DatabaseExists(u)
+	require.NoError(t, err)
+	require.False(t, exists)
+}
@@ -0,0 +1,33 @@
+//go:build !cgo
+// +build !cgo
+
+package dbmate
+
+import (
+	"net/url"
+	"sort"
+
+	_ "modernc.org/sqlite" // pure Go sqlite driver for database/sql
+)
+
+// sqliteDriverName is the database/sql driver which opens sqlite databases.
+// Builds without cgo (CGO_ENABLED=0) use modernc.org/sqlite, so that dbmate can
+// be built as a static binary, and cross-compiled without a C toolchain.
+const sqliteDriverName = "sqlite"
+
+// sqlitePragmaOptions returns the modernc.org/sqlite DSN options which set
+// PRAGMAs, in the order of their names
+func sqlitePragmaOptions(pragmas map[string]string) url.Values {
+	names := []string{}
+	for name := range pragmas {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	options := url.Values{}
+	for _, name := range names {
+		options.Add("_pragma", name+"="+pragmas[name])
+	}
+
+	return options
+}
@@ -1,5 +1,3 @@
-// +build cgo
-
 package dbmate
 
 import (
@@ -7,6 +5,7 @@ import (
 	"net/url"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -242,7 +241,104 @@ func TestSQLitePing(t *testing.T) {
 		require.NoError(t, err)
 	}()
 
-	// ping database should fail
+	// ping database should fail (the error detail depends on the sqlite driver)
 	err = drv.Ping(u)
-	require.EqualError(t, err, "unable to open database file")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unable to open database file")
+}
+
+func TestSQLiteSessionSettings(t *testing.T) {
+	u := sqliteTestURL(t)
+	db := newTestDB(t, u)
+	db.LockTimeout = 5 * time.Second
+
+	err := db.Drop()
+	require.NoError(t, err)
+
+	_, sqlDB, err := db.openDatabaseForMigration()
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+
+	timeout := 0
+	err = sqlDB.QueryRow("pragma busy_timeout").Scan(&timeout)
+	require.NoError(t, err)
+	require.Equal(t, 5000, timeout)
+
+	// unsupported settings return an error
+	db.StatementTimeout = time.Second
+	_, _, err = db.openDatabaseForMigration()
+	require.EqualError(t, err, "statement timeout is not supported by the sqlite driver")
+}
+
+func TestSQLiteConsoleCommand(t *testing.T) {
+	u, err := url.Parse("sqlite:////tmp/app.sqlite3")
+	require.NoError(t, err)
+
+	name, args := SQLiteDriver{}.ConsoleCommand(u)
+	require.Equal(t, "sqlite3", name)
+	require.Equal(t, []string{"/tmp/app.sqlite3"}, args)
+}
+
+func TestSQLitePragmas(t *testing.T) {
+	u, err := url.Parse("sqlite3:////tmp/dbmate.sqlite3?foreign_keys=on&busy_timeout=2000")
+	require.NoError(t, err)
+	db := newTestDB(t, u)
+	db.SQLitePragmas = []string{"journal_mode=wal", "busy_timeout=1000"}
+
+	err = db.Drop()
+	require.NoError(t, err)
+	defer func() {
+		err := db.Drop()
+		require.NoError(t, err)
+	}()
+
+	drv, err := db.GetDriver()
+	require.NoError(t, err)
+	sqlDB, err := drv.Open(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+
+	// every connection in the pool applies the pragmas, and URL options win
+	sqlDB.SetMaxIdleConns(0)
+	for i := 0; i < 2; i++ {
+		foreignKeys, timeout, mode := 0, 0, ""
+		err = sqlDB.QueryRow("pragma foreign_keys").Scan(&foreignKeys)
+		require.NoError(t, err)
+		require.Equal(t, 1, foreignKeys)
+		err = sqlDB.QueryRow("pragma busy_timeout").Scan(&timeout)
+		require.NoError(t, err)
+		require.Equal(t, 2000, timeout)
+		err = sqlDB.QueryRow("pragma journal_mode").Scan(&mode)
+		require.NoError(t, err)
+		require.Equal(t, "wal", mode)
+	}
+
+	// foreign keys are enforced in migrations
+	_, err = sqlDB.Exec("create table users (id integer primary key)")
+	require.NoError(t, err)
+	_, err = sqlDB.Exec("create table posts (user_id integer references users (id))")
+	require.NoError(t, err)
+	_, err = sqlDB.Exec("insert into posts (user_id) values (1)")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "FOREIGN KEY constraint failed")
+}
+
+func TestSQLitePragmasInvalid(t *testing.T) {
+	u := sqliteTestURL(t)
+
+	_, err := SQLiteDriver{Pragmas: []string{"foreign_keys"}}.Open(u)
+	require.EqualError(t, err, `invalid sqlite pragma "foreign_keys", expected name=value`)
+
+	_, err = SQLiteDriver{Pragmas: []string{"journal_mode=wal; drop table users"}}.Open(u)
+	require.EqualError(t, err, `invalid value "wal; drop table users" for the journal_mode pragma`)
+
+	_, err = SQLiteDriver{Pragmas: []string{"cache_size=100"}}.Open(u)
+	require.EqualError(t, err, "the cache_size pragma is not supported, only "+
+		"foreign_keys, journal_mode, busy_timeout, synchronous can be set")
+
+	// pragmas are not supported by other drivers
+	db := New(postgresTestURL(t))
+	db.SQLitePragmas = []string{"foreign_keys=on"}
+	_, err = db.GetDriver()
+	require.EqualError(t, err, "pragmas are not supported by the postgres driver")
 }
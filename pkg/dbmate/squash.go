@@ -0,0 +1,144 @@
+package dbmate
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// squashExcludeRegExp matches schema dump statements which must not be part of a
+// squashed migration, because dbmate creates these tables itself
+var squashExcludeRegExp = regexp.MustCompile(
+	`(?i)\bschema_migration(?:s|_checksums|_runs)\b|\bsqlite_sequence\b`)
+
+// Squash consolidates the migrations before the specified version into a single
+// migration generated from a schema dump. The new migration takes the version of
+// the last squashed migration, so that databases which have already applied it
+// treat it as applied. The squashed files are moved to archiveDir (which must be
+// outside of the migrations directory), and their versions (other than the last)
+// are removed from schema_migrations.
+//
+// The schema dump must match the squashed migrations, so the database must have
+// applied every migration before the cutoff, and none after it.
+func (db *DB) Squash(before, archiveDir string) error {
+	// migrations in other directories (such as vendored migrations) can't be
+	// squashed into MigrationsDir
+	if len(db.MigrationsDirs) > 0 {
+		return fmt.Errorf("squash does not support multiple migrations directories")
+	}
+	if db.FS != nil {
+		return fmt.Errorf("migrations can't be squashed in DB.FS")
+	}
+
+	// migrations are found in subdirectories, so they can't be archived there
+	if rel, err := filepath.Rel(db.MigrationsDir, archiveDir); err != nil || !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("archive directory `%s` must be outside of the migrations directory", archiveDir)
+	}
+
+	files, err := db.findMigrationFiles(db.MigrationsDir, regexp.MustCompile(`^\d.*\.sql$`))
+	if err != nil {
+		return err
+	}
+
+	squashed := []string{}
+	for _, filename := range files {
+		if migrationVersion(filename) < before {
+			squashed = append(squashed, filename)
+		}
+	}
+	if len(squashed) == 0 {
+		return fmt.Errorf("no migrations found before version %s", before)
+	}
+
+	if err := db.beforeMigrate(); err != nil {
+		return err
+	}
+
+	drv, sqlDB, err := db.openDatabaseForMigration()
+	if err != nil {
+		return err
+	}
+	defer mustClose(sqlDB)
+
+	applied, err := drv.SelectMigrations(sqlDB, -1)
+	if err != nil {
+		return err
+	}
+	for _, filename := range files {
+		isSquashed := migrationVersion(filename) < before
+		if isSquashed && !applied[migrationVersion(filename)] {
+			return fmt.Errorf("can't squash: migration %s has not been applied", filename)
+		}
+		if !isSquashed && applied[migrationVersion(filename)] {
+			return fmt.Errorf("can't squash: migration %s has been applied, so the schema "+
+				"includes changes after the cutoff", filename)
+		}
+	}
+
+	schema, err := drv.DumpSchema(db.DatabaseURL, sqlDB)
+	if err != nil {
+		return err
+	}
+
+	last := squashed[len(squashed)-1]
+	version := migrationVersion(last)
+	filename := version + "_squashed_migrations.sql"
+	contents := []byte(fmt.Sprintf("-- migrate:up\n-- squashed %d migrations, up to and including %s\n\n%s\n"+
+		"-- migrate:down\n", len(squashed), last, squashSchema(string(schema))))
+	sum := sha256.Sum256(contents)
+
+	fmt.Fprintf(db.Log, "Squashing: %d migrations into %s\n", len(squashed), filename)
+
+	err = doTransaction(sqlDB, func(tx Transaction) error {
+		for _, f := range squashed[:len(squashed)-1] {
+			if err := drv.DeleteMigration(tx, migrationVersion(f)); err != nil {
+				return err
+			}
+		}
+
+		return db.recordChecksum(drv, tx, version, hex.EncodeToString(sum[:]))
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, f := range squashed {
+		if err := ensureDir(filepath.Dir(filepath.Join(archiveDir, f))); err != nil {
+			return err
+		}
+		if err := os.Rename(filepath.Join(db.MigrationsDir, f), filepath.Join(archiveDir, f)); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(db.Log, "Archived %d migrations to %s\n", len(squashed), archiveDir)
+
+	path := filepath.Join(db.MigrationsDir, filename)
+	fmt.Fprintf(db.Log, "Writing: %s\n", path)
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		return err
+	}
+
+	// automatically update schema file, silence errors
+	if db.AutoDumpSchema {
+		_ = db.DumpSchema()
+	}
+
+	return nil
+}
+
+// squashSchema removes the statements for the dbmate tables from a schema dump
+func squashSchema(schema string) string {
+	var buf strings.Builder
+	for _, stmt := range schemaStatements(schema) {
+		if !squashExcludeRegExp.MatchString(trimSQLComments(stmt)) {
+			buf.WriteString(stmt)
+		}
+	}
+
+	return strings.TrimSpace(buf.String()) + "\n"
+}
@@ -0,0 +1,134 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// squashTestDriver is a sqlite driver which dumps the schema without the sqlite3 command
+type squashTestDriver struct {
+	SQLiteDriver
+}
+
+func (drv squashTestDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	statements, err := queryColumn(db, "select sql || ';' from sqlite_master where sql is not null order by rowid")
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := sqliteSchemaMigrationsDump(db, "schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(strings.Join(statements, "\n")+"\n"), migrations...), nil
+}
+
+func TestSquashSchema(t *testing.T) {
+	schema := "CREATE TABLE schema_migrations (version varchar(255) primary key);\n" +
+		"CREATE TABLE users (id integer);\n" +
+		"CREATE TABLE schema_migration_checksums (version varchar(255), checksum text);\n" +
+		"CREATE TABLE sqlite_sequence(name,seq);\n" +
+		"CREATE INDEX users_id ON users (id);\n" +
+		"-- Dbmate schema migrations\nINSERT INTO schema_migrations (version) VALUES\n  ('1'),\n  ('2');\n"
+	require.Equal(t, "CREATE TABLE users (id integer);\nCREATE INDEX users_id ON users (id);\n",
+		squashSchema(schema))
+}
+
+func TestSquash(t *testing.T) {
+	RegisterDriver(squashTestDriver{}, "sqlite-squash")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite-squash:///" + filepath.Join(dir, "squash.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := New(u)
+	db.Log = &buf
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	archiveDir := filepath.Join(dir, "archive")
+	err = os.Mkdir(db.MigrationsDir, 0755)
+	require.NoError(t, err)
+
+	for _, name := range []string{"1_users", "2_posts", "3_comments"} {
+		err = ioutil.WriteFile(filepath.Join(db.MigrationsDir, name+".sql"),
+			[]byte("-- migrate:up\ncreate table "+name[2:]+" (id integer);\n"+
+				"-- migrate:down\ndrop table "+name[2:]+";\n"), 0644)
+		require.NoError(t, err)
+	}
+
+	err = db.Squash("3", filepath.Join(db.MigrationsDir, "archive"))
+	require.EqualError(t, err, "archive directory `"+filepath.Join(db.MigrationsDir, "archive")+
+		"` must be outside of the migrations directory")
+
+	err = db.Squash("1", archiveDir)
+	require.EqualError(t, err, "no migrations found before version 1")
+
+	err = db.Squash("3", archiveDir)
+	require.EqualError(t, err, "can't squash: migration 1_users.sql has not been applied")
+
+	err = db.Migrate()
+	require.NoError(t, err)
+	err = db.Squash("3", archiveDir)
+	require.EqualError(t, err, "can't squash: migration 3_comments.sql has been applied, "+
+		"so the schema includes changes after the cutoff")
+
+	err = db.Rollback()
+	require.NoError(t, err)
+	buf.Reset()
+	err = db.Squash("3", archiveDir)
+	require.NoError(t, err)
+	require.Equal(t, "Squashing: 2 migrations into 2_squashed_migrations.sql\n"+
+		"Archived 2 migrations to "+archiveDir+"\n"+
+		"Writing: "+filepath.Join(db.MigrationsDir, "2_squashed_migrations.sql")+"\n", buf.String())
+
+	contents, err := ioutil.ReadFile(filepath.Join(db.MigrationsDir, "2_squashed_migrations.sql"))
+	require.NoError(t, err)
+	require.Equal(t, "-- migrate:up\n-- squashed 2 migrations, up to and including 2_posts.sql\n\n"+
+		"CREATE TABLE users (id integer);\nCREATE TABLE posts (id integer);\n\n-- migrate:down\n",
+		string(contents))
+
+	archived, err := db.findMigrationFiles(archiveDir, regexp.MustCompile(`\.sql$`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"1_users.sql", "2_posts.sql"}, archived)
+
+	// the squashed migration is applied, and its checksum is recorded
+	status, err := db.Status()
+	require.NoError(t, err)
+	require.Len(t, status, 2)
+	require.Equal(t, "2_squashed_migrations.sql", status[0].Filename)
+	require.True(t, status[0].Applied)
+	require.False(t, status[1].Applied)
+
+	checksums, err := db.Verify()
+	require.NoError(t, err)
+	require.Len(t, checksums, 1)
+	require.False(t, checksums[0].Modified())
+	require.NotEmpty(t, checksums[0].Recorded)
+
+	// a fresh database is created from the squashed migration
+	u, err = url.Parse("sqlite-squash:///" + filepath.Join(dir, "fresh.sqlite3"))
+	require.NoError(t, err)
+	fresh := New(u)
+	fresh.Log = &buf
+	fresh.AutoDumpSchema = false
+	fresh.MigrationsDir = db.MigrationsDir
+	err = fresh.CreateAndMigrate()
+	require.NoError(t, err)
+}
@@ -0,0 +1,47 @@
+package dbmate
+
+import (
+	"fmt"
+)
+
+// DiscoverTenants runs a query which returns one tenant name per row
+func (db *DB) DiscoverTenants(query string) ([]string, error) {
+	drv, err := db.GetDriver()
+	if err != nil {
+		return nil, err
+	}
+
+	sqlDB, err := drv.Open(db.DatabaseURL)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(sqlDB)
+
+	tenants, err := queryColumn(sqlDB, query)
+	if err != nil {
+		return nil, fmt.Errorf("unable to discover tenants: %s", err)
+	}
+
+	return tenants, nil
+}
+
+// ForTenant returns a copy of the database which migrates a single tenant (a
+// schema in Postgres, or a database in MySQL). Each tenant tracks its applied
+// migrations separately. The schema file is not dumped for tenants.
+func (db *DB) ForTenant(tenant string) (*DB, error) {
+	drv, err := db.GetDriver()
+	if err != nil {
+		return nil, err
+	}
+
+	tenantDrv, ok := drv.(tenantDriver)
+	if !ok {
+		return nil, fmt.Errorf("tenants are not supported by the %s driver", db.DatabaseURL.Scheme)
+	}
+
+	tenantDB := *db
+	tenantDB.driver, tenantDB.DatabaseURL = tenantDrv.Tenant(db.DatabaseURL, tenant)
+	tenantDB.AutoDumpSchema = false
+
+	return &tenantDB, nil
+}
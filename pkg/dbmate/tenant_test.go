@@ -0,0 +1,67 @@
+package dbmate
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestForTenant(t *testing.T) {
+	u, err := url.Parse("postgres://postgres:pw@db:5432/app?sslmode=disable")
+	require.NoError(t, err)
+
+	db := New(u)
+	tenantDB, err := db.ForTenant("Acme")
+	require.NoError(t, err)
+	require.Equal(t, "postgres://postgres:pw@db:5432/app?"+
+		"options=-csearch_path%3D%22Acme%22&sslmode=disable", tenantDB.DatabaseURL.String())
+	require.Equal(t, PostgresDriver{MigrationsSchema: "Acme"}, tenantDB.driver)
+	require.False(t, tenantDB.AutoDumpSchema)
+	require.True(t, db.AutoDumpSchema)
+	require.Equal(t, "postgres://postgres:pw@db:5432/app?sslmode=disable", db.DatabaseURL.String())
+
+	drv, err := tenantDB.GetDriver()
+	require.NoError(t, err)
+	require.Equal(t, `"Acme".schema_migrations`, drv.(PostgresDriver).migrationsTable())
+	require.Equal(t, `"Acme".schema_migration_runs`, drv.(PostgresDriver).runsTable())
+
+	db = New(mySQLTestURL(t))
+	tenantDB, err = db.ForTenant("acme")
+	require.NoError(t, err)
+	require.Equal(t, "/acme", tenantDB.DatabaseURL.Path)
+	require.Equal(t, MySQLDriver{}, tenantDB.driver)
+
+	db = New(sqliteTestURL(t))
+	_, err = db.ForTenant("acme")
+	require.EqualError(t, err, "tenants are not supported by the sqlite3 driver")
+}
+
+func TestDiscoverTenants(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "tenants.sqlite3"))
+	require.NoError(t, err)
+
+	sqlDB, err := SQLiteDriver{}.Open(u)
+	require.NoError(t, err)
+	defer mustClose(sqlDB)
+	_, err = sqlDB.Exec("create table tenants (name text); insert into tenants values ('acme'), ('globex');")
+	require.NoError(t, err)
+
+	db := New(u)
+	tenants, err := db.DiscoverTenants("select name from tenants order by name")
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme", "globex"}, tenants)
+
+	_, err = db.DiscoverTenants("select name from accounts")
+	require.EqualError(t, err, "unable to discover tenants: no such table: accounts")
+}
@@ -0,0 +1,300 @@
+package dbmate
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"time"
+)
+
+func init() {
+	RegisterDriver(TiDBDriver{}, "tidb")
+}
+
+// tidbDDLRegExp matches DDL statements, which tidb always runs outside of a
+// transaction
+var tidbDDLRegExp = regexp.MustCompile(`(?im)^\s*(?:create|alter|drop|rename|truncate)\b`)
+
+// tidbDDLPollInterval is the time to wait between checks for running DDL jobs
+const tidbDDLPollInterval = time.Second
+
+// TiDBDriver provides top level database functions. TiDB speaks the mysql
+// protocol, so most functions are provided by the mysql driver.
+type TiDBDriver struct {
+	mysql MySQLDriver
+}
+
+// tidbMySQLURL returns the mysql URL used to connect to tidb
+func tidbMySQLURL(u *url.URL) *url.URL {
+	mysqlURL := *u
+	mysqlURL.Scheme = "mysql"
+
+	// set default port
+	if u.Port() == "" {
+		mysqlURL.Host = u.Hostname() + ":4000"
+	}
+
+	return &mysqlURL
+}
+
+// Info describes the tidb driver
+func (drv TiDBDriver) Info() DriverInfo {
+	info := drv.mysql.Info()
+	info.Binaries = []string{"mysql"}
+
+	return info
+}
+
+// Open creates a new database connection
+func (drv TiDBDriver) Open(u *url.URL) (*sql.DB, error) {
+	return drv.mysql.Open(tidbMySQLURL(u))
+}
+
+// Tenant returns a driver and URL which migrate a tenant database
+func (drv TiDBDriver) Tenant(u *url.URL, tenant string) (Driver, *url.URL) {
+	mysqlDrv, tenantURL := drv.mysql.Tenant(u, tenant)
+	drv.mysql = mysqlDrv.(MySQLDriver)
+
+	return drv, tenantURL
+}
+
+// CreateDatabase creates the specified database
+func (drv TiDBDriver) CreateDatabase(u *url.URL) error {
+	return drv.mysql.CreateDatabase(tidbMySQLURL(u))
+}
+
+// DropDatabase drops the specified database (if it exists)
+func (drv TiDBDriver) DropDatabase(u *url.URL) error {
+	return drv.mysql.DropDatabase(tidbMySQLURL(u))
+}
+
+// DumpSchema returns the current database schema. mysqldump does not handle
+// tidb specific table options, so the schema is generated with show create.
+func (drv TiDBDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	excluded, err := mysqlExcludedTables(db, drv.mysql.DumpExcludeTables)
+	if err != nil {
+		return nil, err
+	}
+	skip := map[string]bool{}
+	for _, name := range excluded {
+		skip[name] = true
+	}
+
+	rows, err := db.Query("select table_name, table_type from information_schema.tables " +
+		"where table_schema = database() order by table_type, table_name")
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	type table struct {
+		name, kind string
+	}
+	tables := []table{}
+	for rows.Next() {
+		var t table
+		if err := rows.Scan(&t.name, &t.kind); err != nil {
+			return nil, err
+		}
+		if !skip[t.name] {
+			tables = append(tables, t)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var schema bytes.Buffer
+	for i, t := range tables {
+		var name, stmt, charset, collation string
+		if t.kind == "VIEW" {
+			err = db.QueryRow("show create view "+mysqlQuoteIdentifier(t.name)).
+				Scan(&name, &stmt, &charset, &collation)
+		} else {
+			err = db.QueryRow("show create table "+mysqlQuoteIdentifier(t.name)).
+				Scan(&name, &stmt)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if i > 0 {
+			schema.WriteString("\n")
+		}
+		schema.WriteString(mysqlAutoIncrementRegExp.ReplaceAllString(stmt, "") + ";\n")
+	}
+
+	migrations, err := mysqlSchemaMigrationsDump(db, drv.mysql.migrationsTable())
+	if err != nil {
+		return nil, err
+	}
+	schema.Write(migrations)
+
+	return schema.Bytes(), nil
+}
+
+// DatabaseExists determines whether the database exists
+func (drv TiDBDriver) DatabaseExists(u *url.URL) (bool, error) {
+	return drv.mysql.DatabaseExists(tidbMySQLURL(u))
+}
+
+// ExcludeTables returns a driver which does not dump tables matching the patterns
+func (drv TiDBDriver) ExcludeTables(patterns []string) Driver {
+	drv.mysql.DumpExcludeTables = patterns
+
+	return drv
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table
+func (drv TiDBDriver) MigrationsTable(name string) Driver {
+	drv.mysql.MigrationsTableName = name
+
+	return drv
+}
+
+// CreateMigrationsTable creates the schema_migrations table
+func (drv TiDBDriver) CreateMigrationsTable(db *sql.DB) error {
+	return drv.mysql.CreateMigrationsTable(db)
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv TiDBDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.mysql.MigrationsTableExists(db)
+}
+
+// SelectMigrations returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv TiDBDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.mysql.SelectMigrations(db, limit)
+}
+
+// InsertMigration adds a new migration record
+func (drv TiDBDriver) InsertMigration(db Transaction, version string) error {
+	return drv.mysql.InsertMigration(db, version)
+}
+
+// DeleteMigration removes a migration record
+func (drv TiDBDriver) DeleteMigration(db Transaction, version string) error {
+	return drv.mysql.DeleteMigration(db, version)
+}
+
+// CreateChecksumsTable adds the checksum column to the migrations table
+func (drv TiDBDriver) CreateChecksumsTable(db *sql.DB) error {
+	return drv.mysql.CreateChecksumsTable(db)
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv TiDBDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.mysql.SelectRepeatableChecksums(db)
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv TiDBDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.mysql.SelectMigrationChecksums(db)
+}
+
+// CreateMetadataColumns adds the metadata columns to the migrations table
+func (drv TiDBDriver) CreateMetadataColumns(db *sql.DB) error {
+	return drv.mysql.CreateMetadataColumns(db)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv TiDBDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	return drv.mysql.UpdateMigrationMetadata(db, version, meta)
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv TiDBDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	return drv.mysql.SelectMigrationMetadata(db)
+}
+
+// InsertChecksum records the checksum of an applied migration
+func (drv TiDBDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	return drv.mysql.InsertChecksum(db, version, checksum)
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv TiDBDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	return drv.mysql.InsertRepeatableChecksum(db, name, checksum)
+}
+
+// ConsoleCommand returns the mysql command to connect to the database
+func (drv TiDBDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return drv.mysql.ConsoleCommand(tidbMySQLURL(u))
+}
+
+// NoTransaction returns whether migration contents include DDL statements. tidb
+// commits DDL immediately in its own transaction, so a migration which mixes DDL
+// with other statements can't be rolled back as a whole.
+func (drv TiDBDriver) NoTransaction(contents string) bool {
+	return tidbDDLRegExp.MatchString(trimSQLComments(contents))
+}
+
+// WaitForDDL waits until tidb has no DDL jobs which are still running
+func (drv TiDBDriver) WaitForDDL(db *sql.DB) error {
+	for {
+		running := 0
+		err := db.QueryRow("select count(*) from information_schema.ddl_jobs " +
+			"where state not in ('synced', 'cancelled', 'rollback done')").Scan(&running)
+		if err != nil || running == 0 {
+			return err
+		}
+
+		time.Sleep(tidbDDLPollInterval)
+	}
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings.
+// The statement timeout is applied to select statements only.
+func (drv TiDBDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	if s.IdleInTransactionTimeout > 0 {
+		return nil, errors.New("idle in transaction timeout is not supported by the tidb driver")
+	}
+
+	var statements []string
+	if s.LockTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("set session innodb_lock_wait_timeout = %d",
+			durationUnits(s.LockTimeout, time.Second)))
+	}
+	if s.StatementTimeout > 0 {
+		statements = append(statements, fmt.Sprintf("set session max_execution_time = %d",
+			durationUnits(s.StatementTimeout, time.Millisecond)))
+	}
+
+	return statements, nil
+}
+
+// ResetSessionSettingsSQL returns the statements which reset session settings to
+// the global values
+func (drv TiDBDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	var statements []string
+	if s.LockTimeout > 0 {
+		statements = append(statements, "set session innodb_lock_wait_timeout = default")
+	}
+	if s.StatementTimeout > 0 {
+		statements = append(statements, "set session max_execution_time = default")
+	}
+
+	return statements
+}
+
+// Lock acquires the mysql named lock held while migrating
+func (drv TiDBDriver) Lock(db *sql.DB, timeout time.Duration) error {
+	return drv.mysql.Lock(db, timeout)
+}
+
+// Unlock releases the named lock
+func (drv TiDBDriver) Unlock(db *sql.DB) error {
+	return drv.mysql.Unlock(db)
+}
+
+// Ping verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv TiDBDriver) Ping(u *url.URL) error {
+	return drv.mysql.Ping(tidbMySQLURL(u))
+}
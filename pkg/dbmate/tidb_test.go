@@ -0,0 +1,67 @@
+package dbmate
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTiDBMySQLURL(t *testing.T) {
+	u, err := url.Parse("tidb://root@host/dbmate")
+	require.NoError(t, err)
+
+	mysqlURL := tidbMySQLURL(u)
+	require.Equal(t, "mysql://root@host:4000/dbmate", mysqlURL.String())
+	require.Equal(t, "root@tcp(host:4000)/dbmate?multiStatements=true", normalizeMySQLURL(mysqlURL))
+
+	u, err = url.Parse("tidb://root@host:1234/dbmate")
+	require.NoError(t, err)
+	require.Equal(t, "mysql://root@host:1234/dbmate", tidbMySQLURL(u).String())
+}
+
+func TestTiDBNoTransaction(t *testing.T) {
+	drv := TiDBDriver{}
+
+	require.True(t, drv.NoTransaction("create table users (id int);\ninsert into users values (1);"))
+	require.True(t, drv.NoTransaction("ALTER TABLE users ADD INDEX (id);"))
+	require.False(t, drv.NoTransaction("insert into users (name) values ('create');"))
+	require.False(t, drv.NoTransaction("-- drop the old rows\ndelete from users;"))
+}
+
+func TestTiDBSessionSettingsSQL(t *testing.T) {
+	drv := TiDBDriver{}
+
+	statements, err := drv.SessionSettingsSQL(SessionSettings{
+		LockTimeout:      1500 * time.Millisecond,
+		StatementTimeout: 30 * time.Second,
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"set session innodb_lock_wait_timeout = 2",
+		"set session max_execution_time = 30000",
+	}, statements)
+
+	_, err = drv.SessionSettingsSQL(SessionSettings{IdleInTransactionTimeout: time.Second})
+	require.EqualError(t, err, "idle in transaction timeout is not supported by the tidb driver")
+
+	require.Equal(t, []string{"set session max_execution_time = default"},
+		drv.ResetSessionSettingsSQL(SessionSettings{StatementTimeout: time.Second}))
+}
+
+func TestTiDBAutoIncrementRegExp(t *testing.T) {
+	stmt := "CREATE TABLE `users` (\n  `id` bigint NOT NULL AUTO_INCREMENT\n) " +
+		"ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 AUTO_INCREMENT=30001"
+	require.Equal(t, "CREATE TABLE `users` (\n  `id` bigint NOT NULL AUTO_INCREMENT\n) "+
+		"ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", mysqlAutoIncrementRegExp.ReplaceAllString(stmt, ""))
+}
+
+func TestTiDBConsoleCommand(t *testing.T) {
+	u, err := url.Parse("tidb://root@host/dbmate")
+	require.NoError(t, err)
+
+	name, args := TiDBDriver{}.ConsoleCommand(u)
+	require.Equal(t, "mysql", name)
+	require.Equal(t, []string{"--host=host", "--port=4000", "--user=root", "dbmate"}, args)
+}
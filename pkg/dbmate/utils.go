@@ -11,6 +11,7 @@ import (
 	"os"
 	"os/exec"
 	"strings"
+	"time"
 	"unicode"
 )
 
@@ -40,6 +41,38 @@ func ensureDir(dir string) error {
 	return nil
 }
 
+// copyFile copies the contents of a file, replacing dst if it exists
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer mustClose(in)
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// durationUnits converts a duration into a whole number of units, rounding up
+// e.g. durationUnits(1500*time.Millisecond, time.Second) == 2
+func durationUnits(d, unit time.Duration) int64 {
+	n := int64(d / unit)
+	if d%unit != 0 {
+		n++
+	}
+
+	return n
+}
+
 // runCommand runs a command and returns the stdout if successful
 func runCommand(name string, args ...string) ([]byte, error) {
 	var stdout, stderr bytes.Buffer
@@ -61,6 +94,34 @@ func runCommand(name string, args ...string) ([]byte, error) {
 	return stdout.Bytes(), nil
 }
 
+// splitQualifiedName splits a table name (or pattern) into the schema (or
+// database) and table, e.g. ops.schema_migrations
+func splitQualifiedName(name string) (string, string) {
+	parts := strings.SplitN(name, ".", 2)
+	if len(parts) < 2 {
+		return "", parts[0]
+	}
+
+	return parts[0], parts[1]
+}
+
+// likePattern converts a table pattern using the * and ? wildcards into a SQL
+// like pattern
+func likePattern(pattern string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`, "*", "%", "?", "_").
+		Replace(pattern)
+}
+
+// preferCommand returns the preferred command if it is installed, and otherwise
+// the fallback command
+func preferCommand(preferred, fallback string) string {
+	if _, err := exec.LookPath(preferred); err == nil {
+		return preferred
+	}
+
+	return fallback
+}
+
 // trimLeadingSQLComments removes sql comments and blank lines from the beginning of text
 // generally when performing sql dumps these contain host-specific information such as
 // client/server version numbers
@@ -101,10 +162,15 @@ func trimLeadingSQLComments(data []byte) ([]byte, error) {
 	return out.Bytes(), nil
 }
 
+// queryer can represent a database or open transaction
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
 // queryColumn runs a SQL statement and returns a slice of strings
 // it is assumed that the statement returns only one column
 // e.g. schema_migrations table
-func queryColumn(db *sql.DB, query string) ([]string, error) {
+func queryColumn(db queryer, query string) ([]string, error) {
 	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
@@ -127,3 +193,40 @@ func queryColumn(db *sql.DB, query string) ([]string, error) {
 
 	return result, nil
 }
+
+// selectChecksums reads a query returning version and checksum columns into a map
+func selectChecksums(db *sql.DB, query string) (map[string]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer mustClose(rows)
+
+	checksums := map[string]string{}
+	for rows.Next() {
+		var version, checksum string
+		if err := rows.Scan(&version, &checksum); err != nil {
+			return nil, err
+		}
+
+		checksums[version] = checksum
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return checksums, nil
+}
+
+// splitStatements splits SQL into statements without trailing semicolons, for
+// drivers which only run a single statement per query
+func splitStatements(contents string) []string {
+	statements := []string{}
+	for _, stmt := range schemaStatements(contents) {
+		if strings.TrimSpace(trimSQLComments(stmt)) != "" {
+			statements = append(statements, strings.TrimSuffix(strings.TrimSpace(stmt), ";"))
+		}
+	}
+
+	return statements
+}
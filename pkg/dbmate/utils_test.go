@@ -3,6 +3,7 @@ package dbmate
 import (
 	"net/url"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -23,6 +24,17 @@ func TestDatabaseName_Empty(t *testing.T) {
 	require.Equal(t, "", name)
 }
 
+func TestLikePattern(t *testing.T) {
+	require.Equal(t, "pgbench%", likePattern("pgbench*"))
+	require.Equal(t, `events\_y____`, likePattern("events_y????"))
+	require.Equal(t, `100\%`, likePattern("100%"))
+}
+
+func TestPreferCommand(t *testing.T) {
+	require.Equal(t, "psql", preferCommand("dbmate-missing-ysqlsh", "psql"))
+	require.Equal(t, "go", preferCommand("go", "psql"))
+}
+
 func TestTrimLeadingSQLComments(t *testing.T) {
 	in := "--\n" +
 		"-- foo\n\n" +
@@ -33,3 +45,10 @@ func TestTrimLeadingSQLComments(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, "real stuff\n-- end\n", string(out))
 }
+
+func TestDurationUnits(t *testing.T) {
+	require.Equal(t, int64(0), durationUnits(0, time.Second))
+	require.Equal(t, int64(1), durationUnits(time.Second, time.Second))
+	require.Equal(t, int64(2), durationUnits(1500*time.Millisecond, time.Second))
+	require.Equal(t, int64(1), durationUnits(time.Microsecond, time.Millisecond))
+}
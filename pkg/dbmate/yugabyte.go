@@ -0,0 +1,232 @@
+package dbmate
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func init() {
+	RegisterDriver(YugabyteDriver{}, "yugabyte")
+}
+
+// yugabyteAutoRetries is the number of times a migration is retried after a
+// transaction conflict, unless the retry option is set
+const yugabyteAutoRetries = 3
+
+// YugabyteDriver provides top level database functions for YSQL, the postgres
+// compatible API of YugabyteDB. Most functions are provided by the postgres driver.
+type YugabyteDriver struct {
+	postgres PostgresDriver
+}
+
+// yugabytePostgresURL returns the postgres URL used to connect to yugabyte
+func yugabytePostgresURL(u *url.URL) *url.URL {
+	postgresURL := *u
+	postgresURL.Scheme = "postgres"
+
+	// set default port
+	if u.Port() == "" {
+		postgresURL.Host = u.Hostname() + ":5433"
+	}
+
+	return &postgresURL
+}
+
+// Info describes the yugabyte driver
+func (drv YugabyteDriver) Info() DriverInfo {
+	info := drv.postgres.Info()
+	info.Binaries = []string{"ysql_dump", "ysqlsh"}
+
+	return info
+}
+
+// Open creates a new database connection
+func (drv YugabyteDriver) Open(u *url.URL) (*sql.DB, error) {
+	return drv.postgres.Open(yugabytePostgresURL(u))
+}
+
+// CreateDatabase creates the specified database
+func (drv YugabyteDriver) CreateDatabase(u *url.URL) error {
+	return drv.postgres.CreateDatabase(yugabytePostgresURL(u))
+}
+
+// DropDatabase drops the specified database (if it exists)
+func (drv YugabyteDriver) DropDatabase(u *url.URL) error {
+	return drv.postgres.DropDatabase(yugabytePostgresURL(u))
+}
+
+// DumpSchema returns the current database schema, using ysql_dump if it is
+// installed (pg_dump may not support the yugabyte server version)
+func (drv YugabyteDriver) DumpSchema(u *url.URL, db *sql.DB) ([]byte, error) {
+	return drv.postgres.dumpSchemaWith(preferCommand("ysql_dump", "pg_dump"),
+		yugabytePostgresURL(u), db)
+}
+
+// DatabaseExists determines whether the database exists
+func (drv YugabyteDriver) DatabaseExists(u *url.URL) (bool, error) {
+	return drv.postgres.DatabaseExists(yugabytePostgresURL(u))
+}
+
+// SplitBatches splits migration contents around COPY FROM stdin statements
+func (drv YugabyteDriver) SplitBatches(contents string) []string {
+	return drv.postgres.SplitBatches(contents)
+}
+
+// ExecCopy runs a COPY FROM stdin statement, streaming its inline data
+func (drv YugabyteDriver) ExecCopy(tx Transaction, batch string) (int64, bool, error) {
+	return drv.postgres.ExecCopy(tx, batch)
+}
+
+// WithPrivileges returns a driver which includes grants and ownership in the
+// schema dump
+func (drv YugabyteDriver) WithPrivileges() Driver {
+	drv.postgres.DumpPrivileges = true
+
+	return drv
+}
+
+// ExcludeTables returns a driver which does not dump tables matching the patterns
+func (drv YugabyteDriver) ExcludeTables(patterns []string) Driver {
+	drv.postgres.DumpExcludeTables = patterns
+
+	return drv
+}
+
+// WithSchemas returns a driver which sets the search_path to the given schemas,
+// and only includes them in the schema dump
+func (drv YugabyteDriver) WithSchemas(schemas []string) Driver {
+	drv.postgres = drv.postgres.withSchemas(schemas)
+
+	return drv
+}
+
+// MigrationsTable returns a driver which tracks migrations in the named table
+func (drv YugabyteDriver) MigrationsTable(name string) Driver {
+	drv.postgres = drv.postgres.withMigrationsTable(name)
+
+	return drv
+}
+
+// CreateMigrationsTable creates the schema_migrations table
+func (drv YugabyteDriver) CreateMigrationsTable(db *sql.DB) error {
+	return drv.postgres.CreateMigrationsTable(db)
+}
+
+// MigrationsTableExists returns whether the migrations table exists
+func (drv YugabyteDriver) MigrationsTableExists(db *sql.DB) (bool, error) {
+	return drv.postgres.MigrationsTableExists(db)
+}
+
+// SelectMigrations returns a list of applied migrations
+// with an optional limit (in descending order)
+func (drv YugabyteDriver) SelectMigrations(db *sql.DB, limit int) (map[string]bool, error) {
+	return drv.postgres.SelectMigrations(db, limit)
+}
+
+// InsertMigration adds a new migration record
+func (drv YugabyteDriver) InsertMigration(db Transaction, version string) error {
+	return drv.postgres.InsertMigration(db, version)
+}
+
+// DeleteMigration removes a migration record
+func (drv YugabyteDriver) DeleteMigration(db Transaction, version string) error {
+	return drv.postgres.DeleteMigration(db, version)
+}
+
+// CreateChecksumsTable adds the checksum column to the migrations table
+func (drv YugabyteDriver) CreateChecksumsTable(db *sql.DB) error {
+	return drv.postgres.CreateChecksumsTable(db)
+}
+
+// SelectRepeatableChecksums returns the checksums of the repeatable migrations by
+// name, as they were last applied
+func (drv YugabyteDriver) SelectRepeatableChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.postgres.SelectRepeatableChecksums(db)
+}
+
+// SelectMigrationChecksums returns the checksums recorded in schema_migrations
+// by version
+func (drv YugabyteDriver) SelectMigrationChecksums(db *sql.DB) (map[string]string, error) {
+	return drv.postgres.SelectMigrationChecksums(db)
+}
+
+// CreateMetadataColumns adds the metadata columns to the migrations table
+func (drv YugabyteDriver) CreateMetadataColumns(db *sql.DB) error {
+	return drv.postgres.CreateMetadataColumns(db)
+}
+
+// UpdateMigrationMetadata records the metadata of an applied migration
+func (drv YugabyteDriver) UpdateMigrationMetadata(db Transaction, version string, meta MigrationMetadata) error {
+	return drv.postgres.UpdateMigrationMetadata(db, version, meta)
+}
+
+// SelectMigrationMetadata returns the recorded migration metadata by version
+func (drv YugabyteDriver) SelectMigrationMetadata(db *sql.DB) (map[string]MigrationMetadata, error) {
+	return drv.postgres.SelectMigrationMetadata(db)
+}
+
+// InsertChecksum records the checksum of an applied migration
+func (drv YugabyteDriver) InsertChecksum(db Transaction, version, checksum string) error {
+	return drv.postgres.InsertChecksum(db, version, checksum)
+}
+
+// InsertRepeatableChecksum replaces the checksum of an applied repeatable migration
+func (drv YugabyteDriver) InsertRepeatableChecksum(db Transaction, name, checksum string) error {
+	return drv.postgres.InsertRepeatableChecksum(db, name, checksum)
+}
+
+// ConsoleCommand returns the ysqlsh (or psql) command to connect to the database
+func (drv YugabyteDriver) ConsoleCommand(u *url.URL) (string, []string) {
+	return preferCommand("ysqlsh", "psql"), []string{yugabytePostgresURL(u).String()}
+}
+
+// RetryableError returns whether an error was caused by a transaction conflict,
+// lock timeout, or deadlock
+func (drv YugabyteDriver) RetryableError(err error) bool {
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "40001" {
+		return true
+	}
+
+	return drv.postgres.RetryableError(err)
+}
+
+// ErrorPosition returns the offset in query of the position reported by an error
+func (drv YugabyteDriver) ErrorPosition(err error, query string) (int, bool) {
+	return drv.postgres.ErrorPosition(err, query)
+}
+
+// PrepareRetry drops any invalid indexes left behind by a failed
+// `create index concurrently`, so that the migration can be retried
+func (drv YugabyteDriver) PrepareRetry(db *sql.DB, contents string) error {
+	return drv.postgres.PrepareRetry(db, contents)
+}
+
+// LockTimeoutSQL returns statements to set and reset the session lock timeout
+func (drv YugabyteDriver) LockTimeoutSQL(d time.Duration) (string, string) {
+	return drv.postgres.LockTimeoutSQL(d)
+}
+
+// AutoRetries returns the number of times a migration is retried after a
+// transaction conflict, which yugabyte reports as a serialization failure
+func (drv YugabyteDriver) AutoRetries() int {
+	return yugabyteAutoRetries
+}
+
+// SessionSettingsSQL returns the statements required to apply session settings
+func (drv YugabyteDriver) SessionSettingsSQL(s SessionSettings) ([]string, error) {
+	return drv.postgres.SessionSettingsSQL(s)
+}
+
+// ResetSessionSettingsSQL returns the statements which reset session settings
+func (drv YugabyteDriver) ResetSessionSettingsSQL(s SessionSettings) []string {
+	return drv.postgres.ResetSessionSettingsSQL(s)
+}
+
+// Ping verifies a connection to the database server. It does not verify whether the
+// specified database exists.
+func (drv YugabyteDriver) Ping(u *url.URL) error {
+	return drv.postgres.Ping(yugabytePostgresURL(u))
+}
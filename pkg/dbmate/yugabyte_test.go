@@ -0,0 +1,32 @@
+package dbmate
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/require"
+)
+
+func TestYugabytePostgresURL(t *testing.T) {
+	u, err := url.Parse("yugabyte://yugabyte@host/dbmate?sslmode=disable")
+	require.NoError(t, err)
+
+	require.Equal(t, "postgres://yugabyte@host:5433/dbmate?sslmode=disable",
+		yugabytePostgresURL(u).String())
+
+	u, err = url.Parse("yugabyte://yugabyte@host:5432/dbmate")
+	require.NoError(t, err)
+	require.Equal(t, "postgres://yugabyte@host:5432/dbmate", yugabytePostgresURL(u).String())
+}
+
+func TestYugabyteRetryableError(t *testing.T) {
+	drv := YugabyteDriver{}
+
+	require.True(t, drv.RetryableError(&pq.Error{Code: "40001"}))
+	require.True(t, drv.RetryableError(&pq.Error{Code: "55P03"}))
+	require.False(t, drv.RetryableError(&pq.Error{Code: "42P01"}))
+	require.False(t, drv.RetryableError(errors.New("conflict")))
+	require.Equal(t, yugabyteAutoRetries, drv.AutoRetries())
+}
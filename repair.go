@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// repairMigrations runs the repair command, asking before each fix unless --auto is set
+func repairMigrations(db *dbmate.DB, c *cli.Context) error {
+	if c.Bool("auto") {
+		return db.Repair(func(dbmate.RepairIssue) bool { return true })
+	}
+
+	return db.Repair(confirmRepair(db.Log, os.Stdin))
+}
+
+// confirmRepair returns a function which asks whether to fix each issue,
+// treating anything other than "y" or "yes" (including end of input) as no
+func confirmRepair(w io.Writer, r io.Reader) func(dbmate.RepairIssue) bool {
+	reader := bufio.NewReader(r)
+	return func(dbmate.RepairIssue) bool {
+		fmt.Fprint(w, "Repair? [y/N] ")
+		answer, err := reader.ReadString('\n')
+		if err != nil && answer == "" {
+			fmt.Fprintln(w)
+			return false
+		}
+
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfirmRepair(t *testing.T) {
+	var buf bytes.Buffer
+	confirm := confirmRepair(&buf, strings.NewReader("y\nno\n YES \n\n"))
+	issue := dbmate.RepairIssue{Problem: dbmate.MissingFile, Version: "1"}
+
+	require.True(t, confirm(issue))
+	require.False(t, confirm(issue))
+	require.True(t, confirm(issue))
+	require.False(t, confirm(issue))
+	// end of input
+	require.False(t, confirm(issue))
+	require.Equal(t, strings.Repeat("Repair? [y/N] ", 5)+"\n", buf.String())
+}
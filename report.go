@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// runReport summarizes a single dbmate command invocation
+type runReport struct {
+	Command      string
+	Driver       string
+	DatabaseHost string
+	Database     string
+	// Hostname and User identify who ran the command
+	Hostname   string
+	User       string
+	StartedAt  time.Time
+	Duration   time.Duration
+	Migrations []dbmate.MigrationResult
+	Err        error
+}
+
+// Applied returns the number of migrations which completed successfully
+func (r runReport) Applied() int {
+	n := 0
+	for _, m := range r.Migrations {
+		if m.Err == nil {
+			n++
+		}
+	}
+
+	return n
+}
+
+// newRunReport creates a report for the current command
+func newRunReport(c *cli.Context, u *url.URL) runReport {
+	hostname, _ := os.Hostname()
+	username := ""
+	if current, err := user.Current(); err == nil {
+		username = current.Username
+	}
+
+	return runReport{
+		Command:      c.Command.Name,
+		Driver:       u.Scheme,
+		DatabaseHost: u.Hostname(),
+		Database:     strings.TrimPrefix(u.Path, "/"),
+		Hostname:     hostname,
+		User:         username,
+		StartedAt:    time.Now(),
+	}
+}
+
+// reporter publishes a run report to an external system
+type reporter func(runReport) error
+
+// reporters returns the reporters enabled by the command line options
+func reporters(c *cli.Context) ([]reporter, error) {
+	var rs []reporter
+	if format := c.GlobalString("output"); format != "" {
+		r, err := annotationReporter(format, os.Stdout, migrationsDirs(c)[0])
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, r)
+	}
+	if path := c.GlobalString("audit-log"); path != "" {
+		rs = append(rs, auditReporter(path))
+	}
+	if addr := c.GlobalString("statsd-addr"); addr != "" {
+		rs = append(rs, statsdReporter(addr, c.GlobalString("metrics-prefix")))
+	}
+	if u := c.GlobalString("pushgateway-url"); u != "" {
+		rs = append(rs, pushgatewayReporter(u, c.GlobalString("metrics-job")))
+	}
+	for _, u := range c.GlobalStringSlice("webhook-url") {
+		rs = append(rs, webhookReporter(u, genericWebhookPayload))
+	}
+	for _, u := range c.GlobalStringSlice("slack-webhook-url") {
+		rs = append(rs, webhookReporter(u, slackWebhookPayload))
+	}
+	if tracer := newOTLPTracer(c.GlobalString("otlp-endpoint")); tracer.endpoint != "" {
+		rs = append(rs, tracer.Report)
+	}
+	if dsn := c.GlobalString("sentry-dsn"); dsn != "" {
+		client, err := newSentryClient(dsn)
+		if err != nil {
+			return nil, err
+		}
+		rs = append(rs, client.Report)
+	}
+	if env := c.GlobalString("environment"); env != "" && env == c.GlobalString("incident-environment") {
+		if key := c.GlobalString("pagerduty-routing-key"); key != "" {
+			rs = append(rs, pagerDutyReporter(pagerDutyEventsURL, key, env))
+		}
+		if key := c.GlobalString("opsgenie-api-key"); key != "" {
+			rs = append(rs, opsgenieReporter(c.GlobalString("opsgenie-api-url"), key, env))
+		}
+	}
+
+	return rs, nil
+}
+
+// runReported runs a command, collecting migration results into the report, and
+// publishes the report when the command completes
+func runReported(db *dbmate.DB, rs []reporter, report runReport, f func() error) runReport {
+	db.OnMigration = func(r dbmate.MigrationResult) {
+		report.Migrations = append(report.Migrations, r)
+	}
+
+	err := f()
+	report.Duration = time.Since(report.StartedAt)
+	report.Err = err
+	publishReport(db.Log, rs, report)
+
+	return report
+}
+
+// publishReport sends the report to each reporter. Reporting failures are
+// printed as warnings, and never cause the command to fail.
+func publishReport(w io.Writer, rs []reporter, report runReport) {
+	for _, r := range rs {
+		if err := r(report); err != nil {
+			fmt.Fprintf(w, "Warning: %s\n", err)
+		}
+	}
+}
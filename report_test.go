@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunReportApplied(t *testing.T) {
+	require.Equal(t, 2, testReport().Applied())
+	require.Equal(t, 0, runReport{}.Applied())
+}
+
+func TestPublishReport(t *testing.T) {
+	var buf bytes.Buffer
+	published := 0
+
+	publishReport(&buf, []reporter{
+		func(r runReport) error {
+			published++
+			return errors.New("unable to send metrics: timeout")
+		},
+		func(r runReport) error {
+			published++
+			return nil
+		},
+	}, testReport())
+
+	require.Equal(t, 2, published)
+	require.Equal(t, "Warning: unable to send metrics: timeout\n", buf.String())
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// scaffoldDriver contains the connection defaults used when scaffolding a project
+type scaffoldDriver struct {
+	URL  string
+	Port string
+}
+
+var scaffoldDrivers = map[string]scaffoldDriver{
+	"postgres": {
+		URL:  "postgres://postgres@127.0.0.1:5432/myapp_development?sslmode=disable",
+		Port: "5432",
+	},
+	"mysql": {
+		URL:  "mysql://root@127.0.0.1:3306/myapp_development",
+		Port: "3306",
+	},
+	"sqlite": {
+		URL: "sqlite:///db/myapp_development.sqlite3",
+	},
+}
+
+// initAction scaffolds a project. It is not wrapped by action, since it does not
+// use the database, so no lease, schedule or run reporting applies.
+func initAction(c *cli.Context) error {
+	db := dbmate.New(nil)
+	db.MigrationsDir = migrationsDirs(c)[0]
+	db.SchemaFile = c.GlobalString("schema-file")
+
+	return initProject(db, c)
+}
+
+// initProject creates the migrations directory, a starter .env file, a config file,
+// and a sample migration. Existing files are left untouched.
+func initProject(db *dbmate.DB, c *cli.Context) error {
+	driver := c.Args().First()
+	if driver == "" {
+		driver = "postgres"
+	}
+
+	defaults, ok := scaffoldDrivers[driver]
+	if !ok {
+		return fmt.Errorf("unsupported driver: %s", driver)
+	}
+
+	if err := os.MkdirAll(db.MigrationsDir, 0755); err != nil {
+		return fmt.Errorf("unable to create directory `%s`", db.MigrationsDir)
+	}
+
+	if err := writeScaffoldFile(db.Log, ".env", dotEnvTemplate(c, driver, defaults)); err != nil {
+		return err
+	}
+
+	if err := writeScaffoldFile(db.Log, c.GlobalString("config"), configTemplate(db)); err != nil {
+		return err
+	}
+
+	// only create a sample migration in an empty migrations directory
+	existing, err := filepath.Glob(filepath.Join(db.MigrationsDir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	if len(existing) > 0 {
+		return nil
+	}
+
+	return db.NewMigration("init")
+}
+
+// writeScaffoldFile writes a file unless it already exists
+func writeScaffoldFile(log io.Writer, path string, contents []byte) error {
+	if _, err := os.Stat(path); err == nil {
+		fmt.Fprintf(log, "Skipping: %s (already exists)\n", path)
+		return nil
+	}
+
+	fmt.Fprintf(log, "Creating: %s\n", path)
+
+	return ioutil.WriteFile(path, contents, 0644)
+}
+
+// dotEnvTemplate returns the starter .env file. The variables which dbmate uses to
+// construct a URL each hold the name of another variable containing the value, so
+// the alternative is shown as pairs of variables.
+func dotEnvTemplate(c *cli.Context, driver string, defaults scaffoldDriver) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s=%q\n", c.GlobalString("env"), defaults.URL)
+
+	buf.WriteString("\n# Alternatively, if the URL variable is unset, dbmate constructs the URL\n" +
+		"# from the following variables. Each one holds the name of the variable\n" +
+		"# which contains the value:\n")
+	for _, v := range []struct{ flag, name, value string }{
+		{"drivervar", "MYAPP_DB_DRIVER", driver},
+		{"hostvar", "MYAPP_DB_HOST", "127.0.0.1"},
+		{"dbportvar", "MYAPP_DB_PORT", defaults.Port},
+		{"dbnamevar", "MYAPP_DB_NAME", "myapp_development"},
+		{"uservar", "MYAPP_DB_USER", ""},
+		{"passvar", "MYAPP_DB_PASSWORD", ""},
+	} {
+		fmt.Fprintf(&buf, "# %s=%s\n# %s=%s\n", c.GlobalString(v.flag), v.name, v.name, v.value)
+	}
+
+	return buf.Bytes()
+}
+
+func configTemplate(db *dbmate.DB) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("# dbmate configuration\n" +
+		"# keys correspond to global command line options, which take precedence\n")
+	fmt.Fprintf(&buf, "migrations-dir: %s\n", db.MigrationsDir)
+	fmt.Fprintf(&buf, "schema-file: %s\n", db.SchemaFile)
+
+	return buf.Bytes()
+}
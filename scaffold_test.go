@@ -0,0 +1,66 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInitProject(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	err = os.Chdir(dir)
+	require.NoError(t, err)
+	defer func() {
+		err := os.Chdir(cwd)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("mysql://example.org/db")
+	require.NoError(t, err)
+	ctx := testContext(t, u)
+	db := dbmate.New(u)
+
+	err = initProject(db, ctx)
+	require.NoError(t, err)
+
+	env, err := ioutil.ReadFile(".env")
+	require.NoError(t, err)
+	require.Contains(t, string(env), "DATABASE_URL=\"postgres://")
+	require.Contains(t, string(env), "# DATABASE_HOST=MYAPP_DB_HOST\n# MYAPP_DB_HOST=127.0.0.1\n")
+	require.Contains(t, string(env), "# DATABASE_PORT=MYAPP_DB_PORT\n# MYAPP_DB_PORT=5432\n")
+
+	config, err := ioutil.ReadFile("dbmate.yml")
+	require.NoError(t, err)
+	require.Contains(t, string(config), "migrations-dir: ./db/migrations\n")
+
+	migrations, err := filepath.Glob("db/migrations/*_init.sql")
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+
+	// running again does not overwrite files or add migrations
+	err = ioutil.WriteFile(".env", []byte("custom"), 0644)
+	require.NoError(t, err)
+	err = initProject(db, ctx)
+	require.NoError(t, err)
+
+	env, err = ioutil.ReadFile(".env")
+	require.NoError(t, err)
+	require.Equal(t, "custom", string(env))
+
+	migrations, err = filepath.Glob("db/migrations/*.sql")
+	require.NoError(t, err)
+	require.Len(t, migrations, 1)
+}
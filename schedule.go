@@ -0,0 +1,187 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// scheduleTimeFormat is used to print when a maintenance window opens
+const scheduleTimeFormat = "Mon 2006-01-02 15:04 MST"
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// maintenanceWindow is a weekly window in which migrations may be applied,
+// such as "Sat 02:00-04:00 Asia/Kolkata" or "Mon-Fri 22:00-02:00"
+type maintenanceWindow struct {
+	value    string
+	days     [7]bool
+	start    int // minutes after midnight
+	end      int
+	location *time.Location
+	now      func() time.Time
+	sleep    func(time.Duration)
+}
+
+// parseSchedule parses a window of the form "[DAYS] HH:MM-HH:MM [TIMEZONE]".
+// DAYS is a comma separated list of days or day ranges, and defaults to every
+// day. TIMEZONE defaults to UTC. Windows which end before they start continue
+// into the following day.
+func parseSchedule(value string) (*maintenanceWindow, error) {
+	w := &maintenanceWindow{value: value, location: time.UTC, now: time.Now, sleep: time.Sleep}
+
+	fields := strings.Fields(value)
+	if len(fields) > 0 && !isDigit(fields[0][0]) {
+		if err := w.parseDays(fields[0]); err != nil {
+			return nil, err
+		}
+		fields = fields[1:]
+	} else {
+		w.days = [7]bool{true, true, true, true, true, true, true}
+	}
+
+	if len(fields) == 0 || len(fields) > 2 {
+		return nil, fmt.Errorf("invalid schedule `%s` (expected \"[DAYS] HH:MM-HH:MM [TIMEZONE]\")", value)
+	}
+
+	times := strings.Split(fields[0], "-")
+	if len(times) != 2 {
+		return nil, fmt.Errorf("invalid schedule `%s`: expected a time range like 02:00-04:00", value)
+	}
+	var err error
+	if w.start, err = parseClock(times[0]); err != nil || w.start == 24*60 {
+		return nil, fmt.Errorf("invalid schedule `%s`: invalid start time %s", value, times[0])
+	}
+	if w.end, err = parseClock(times[1]); err != nil {
+		return nil, fmt.Errorf("invalid schedule `%s`: %s", value, err)
+	}
+	if w.start == w.end {
+		return nil, fmt.Errorf("invalid schedule `%s`: window is empty", value)
+	}
+
+	if len(fields) == 2 {
+		if w.location, err = time.LoadLocation(fields[1]); err != nil {
+			return nil, fmt.Errorf("invalid schedule `%s`: %s", value, err)
+		}
+	}
+
+	return w, nil
+}
+
+func (w *maintenanceWindow) parseDays(value string) error {
+	for _, part := range strings.Split(value, ",") {
+		bounds := strings.Split(part, "-")
+		if len(bounds) > 2 {
+			return fmt.Errorf("invalid schedule `%s`: invalid day range %s", w.value, part)
+		}
+
+		first, ok := weekdays[strings.ToLower(bounds[0])]
+		if !ok {
+			return fmt.Errorf("invalid schedule `%s`: invalid day %s", w.value, bounds[0])
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, ok = weekdays[strings.ToLower(bounds[1])]; !ok {
+				return fmt.Errorf("invalid schedule `%s`: invalid day %s", w.value, bounds[1])
+			}
+		}
+
+		// ranges may wrap around the end of the week, such as Fri-Mon
+		for day := first; ; day = (day + 1) % 7 {
+			w.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseClock returns the minutes after midnight of a HH:MM time
+func parseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time %s (expected HH:MM)", value)
+	}
+
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil || hours < 0 || hours > 24 {
+		return 0, fmt.Errorf("invalid time %s (expected HH:MM)", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || minutes < 0 || minutes > 59 || (hours == 24 && minutes > 0) {
+		return 0, fmt.Errorf("invalid time %s (expected HH:MM)", value)
+	}
+
+	return hours*60 + minutes, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// contains returns whether the window is open at the given time
+func (w *maintenanceWindow) contains(t time.Time) bool {
+	t = t.In(w.location)
+	minute := t.Hour()*60 + t.Minute()
+	today := t.Weekday()
+	yesterday := (today + 6) % 7
+
+	if w.start < w.end {
+		return w.days[today] && minute >= w.start && minute < w.end
+	}
+
+	// the window continues past midnight
+	return (w.days[today] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// nextOpen returns when the window next opens after the given time
+func (w *maintenanceWindow) nextOpen(t time.Time) time.Time {
+	t = t.In(w.location)
+	for i := 0; i <= 7; i++ {
+		day := t.AddDate(0, 0, i)
+		open := time.Date(day.Year(), day.Month(), day.Day(), w.start/60, w.start%60, 0, 0, w.location)
+		if w.days[open.Weekday()] && open.After(t) {
+			return open
+		}
+	}
+
+	// unreachable, since at least one day is always set
+	return t
+}
+
+// wait returns immediately if the window is open. Otherwise it waits for the
+// window to open if wait is set, or returns an error.
+func (w *maintenanceWindow) wait(log io.Writer, wait bool) error {
+	now := w.now()
+	if w.contains(now) {
+		return nil
+	}
+
+	next := w.nextOpen(now)
+	if !wait {
+		return fmt.Errorf("outside of the maintenance window %s (next opens %s)",
+			w.value, next.Format(scheduleTimeFormat))
+	}
+
+	fmt.Fprintf(log, "Waiting: maintenance window %s opens %s\n", w.value, next.Format(scheduleTimeFormat))
+	w.sleep(next.Sub(now))
+
+	if !w.contains(w.now()) {
+		return errors.New("maintenance window did not open")
+	}
+
+	return nil
+}
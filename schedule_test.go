@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	w, err := parseSchedule("Sat 02:00-04:00 Asia/Kolkata")
+	require.NoError(t, err)
+	require.Equal(t, [7]bool{time.Saturday: true}, w.days)
+	require.Equal(t, 120, w.start)
+	require.Equal(t, 240, w.end)
+	require.Equal(t, "Asia/Kolkata", w.location.String())
+
+	w, err = parseSchedule("Fri-Mon,wed 22:00-24:00")
+	require.NoError(t, err)
+	require.Equal(t, [7]bool{true, true, false, true, false, true, true}, w.days)
+	require.Equal(t, 1440, w.end)
+	require.Equal(t, time.UTC, w.location)
+
+	w, err = parseSchedule("22:00-02:00")
+	require.NoError(t, err)
+	require.Equal(t, [7]bool{true, true, true, true, true, true, true}, w.days)
+
+	cases := map[string]string{
+		"":                      "invalid schedule `` (expected \"[DAYS] HH:MM-HH:MM [TIMEZONE]\")",
+		"Sat":                   "invalid schedule `Sat` (expected \"[DAYS] HH:MM-HH:MM [TIMEZONE]\")",
+		"Caturday 02:00-04:00":  "invalid schedule `Caturday 02:00-04:00`: invalid day Caturday",
+		"Sat 02:00":             "invalid schedule `Sat 02:00`: expected a time range like 02:00-04:00",
+		"Sat 2am-04:00":         "invalid schedule `Sat 2am-04:00`: invalid start time 2am",
+		"Sat 02:00-25:00":       "invalid schedule `Sat 02:00-25:00`: invalid time 25:00 (expected HH:MM)",
+		"Sat 02:00-02:00":       "invalid schedule `Sat 02:00-02:00`: window is empty",
+		"Sat 02:00-04:00 Mars/": "invalid schedule `Sat 02:00-04:00 Mars/`: unknown time zone Mars/",
+	}
+	for value, expected := range cases {
+		_, err := parseSchedule(value)
+		require.EqualError(t, err, expected, value)
+	}
+}
+
+func TestMaintenanceWindowContains(t *testing.T) {
+	w, err := parseSchedule("Sat 02:00-04:00 Asia/Kolkata")
+	require.NoError(t, err)
+
+	// Saturday 2020-01-04 02:00 in Kolkata is Friday 20:30 UTC
+	require.False(t, w.contains(time.Date(2020, 1, 3, 20, 29, 0, 0, time.UTC)))
+	require.True(t, w.contains(time.Date(2020, 1, 3, 20, 30, 0, 0, time.UTC)))
+	require.True(t, w.contains(time.Date(2020, 1, 3, 22, 29, 0, 0, time.UTC)))
+	require.False(t, w.contains(time.Date(2020, 1, 3, 22, 30, 0, 0, time.UTC)))
+	require.False(t, w.contains(time.Date(2020, 1, 4, 20, 30, 0, 0, time.UTC)))
+
+	// overnight windows belong to the day they start
+	w, err = parseSchedule("Fri 22:00-02:00")
+	require.NoError(t, err)
+	require.True(t, w.contains(time.Date(2020, 1, 3, 23, 0, 0, 0, time.UTC)))
+	require.True(t, w.contains(time.Date(2020, 1, 4, 1, 59, 0, 0, time.UTC)))
+	require.False(t, w.contains(time.Date(2020, 1, 4, 2, 0, 0, 0, time.UTC)))
+	require.False(t, w.contains(time.Date(2020, 1, 4, 23, 0, 0, 0, time.UTC)))
+	require.False(t, w.contains(time.Date(2020, 1, 3, 1, 0, 0, 0, time.UTC)))
+}
+
+func TestMaintenanceWindowNextOpen(t *testing.T) {
+	w, err := parseSchedule("Sat 02:00-04:00")
+	require.NoError(t, err)
+
+	// Wednesday
+	next := w.nextOpen(time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC))
+	require.Equal(t, time.Date(2020, 1, 4, 2, 0, 0, 0, time.UTC), next)
+
+	// later on Saturday, so the following week
+	next = w.nextOpen(time.Date(2020, 1, 4, 3, 0, 0, 0, time.UTC))
+	require.Equal(t, time.Date(2020, 1, 11, 2, 0, 0, 0, time.UTC), next)
+}
+
+func TestMaintenanceWindowWait(t *testing.T) {
+	w, err := parseSchedule("Sat 02:00-04:00")
+	require.NoError(t, err)
+
+	now := time.Date(2020, 1, 4, 1, 30, 0, 0, time.UTC)
+	slept := time.Duration(0)
+	w.now = func() time.Time { return now }
+	w.sleep = func(d time.Duration) {
+		slept += d
+		now = now.Add(d)
+	}
+
+	var out bytes.Buffer
+	err = w.wait(&out, false)
+	require.EqualError(t, err, "outside of the maintenance window Sat 02:00-04:00 (next opens Sat 2020-01-04 02:00 UTC)")
+	require.Equal(t, time.Duration(0), slept)
+
+	err = w.wait(&out, true)
+	require.NoError(t, err)
+	require.Equal(t, 30*time.Minute, slept)
+	require.Equal(t, "Waiting: maintenance window Sat 02:00-04:00 opens Sat 2020-01-04 02:00 UTC\n", out.String())
+
+	// already open
+	out.Reset()
+	err = w.wait(&out, false)
+	require.NoError(t, err)
+	require.Equal(t, "", out.String())
+}
+
+func TestScheduleCommands(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.MkdirAll(migrationsDir, 0755))
+	err = ioutil.WriteFile(filepath.Join(migrationsDir, "1_users.sql"),
+		[]byte("-- migrate:up\ncreate table users (id integer);\n-- migrate:down\ndrop table users;\n"), 0644)
+	require.NoError(t, err)
+	schemaFile := filepath.Join(dir, "schema.sql")
+	err = ioutil.WriteFile(schemaFile, []byte("create table users (id integer);\n"), 0644)
+	require.NoError(t, err)
+
+	dbURL := "sqlite:///" + filepath.Join(dir, "schedule.sqlite3")
+	err = os.Setenv("DATABASE_URL", dbURL)
+	require.NoError(t, err)
+	defer func() {
+		err := os.Unsetenv("DATABASE_URL")
+		require.NoError(t, err)
+	}()
+
+	// a window which is closed today
+	closed := time.Now().UTC().AddDate(0, 0, 3).Weekday().String()[:3] + " 00:00-24:00"
+	run := func(args ...string) error {
+		app := NewApp()
+		return app.Run(append([]string{"dbmate", "--migrations-dir", migrationsDir,
+			"--schema-file", schemaFile, "--schedule", closed}, args...))
+	}
+
+	for _, args := range [][]string{
+		{"up"}, {"migrate"}, {"rollback"}, {"redo"}, {"baseline"}, {"load"},
+		{"squash", "--before", "2", "--archive-dir", filepath.Join(dir, "archive")},
+		{"shards", "migrate", "--shard", dbURL},
+		{"canary", "migrate", "--canary", dbURL, "--target", dbURL},
+	} {
+		err := run(args...)
+		require.Error(t, err, strings.Join(args, " "))
+		require.Contains(t, err.Error(), "outside of the maintenance window", strings.Join(args, " "))
+	}
+
+	// other commands are not restricted
+	err = run("status")
+	require.NoError(t, err)
+}
+
+func TestScheduleServer(t *testing.T) {
+	s, log, _ := testServer(t)
+
+	w, err := parseSchedule("Sat 02:00-04:00")
+	require.NoError(t, err)
+	now := time.Date(2020, 1, 4, 3, 30, 0, 0, time.UTC)
+	w.now = func() time.Time { return now }
+	s.db.BeforeMigrate = func() error {
+		return w.wait(s.db.Log, false)
+	}
+
+	res := serverRequest(s, http.MethodPost, "/migrate", "secret")
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, log.String(), "Applying: 20151129054053_test_migration.sql\n")
+
+	// the server keeps running after the window closes, but each request which
+	// migrates is checked
+	now = now.Add(time.Hour)
+	res = serverRequest(s, http.MethodPost, "/rollback", "secret")
+	require.Equal(t, http.StatusInternalServerError, res.Code)
+	require.Contains(t, log.String(), "Error: outside of the maintenance window Sat 02:00-04:00 "+
+		"(next opens Sat 2020-01-11 02:00 UTC)\n")
+	require.NotContains(t, log.String(), "Rolling back")
+
+	res = serverRequest(s, http.MethodGet, "/status", "secret")
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Contains(t, res.Body.String(), `"applied":true`)
+}
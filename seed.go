@@ -0,0 +1,66 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v2"
+)
+
+// seedRules is the format of the --anonymize rules file
+type seedRules struct {
+	Tables []dbmate.SeedTable `yaml:"tables"`
+}
+
+// generateSeeds samples and masks data from the --from-env database into seed files
+func generateSeeds(db *dbmate.DB, c *cli.Context) error {
+	env := c.String("from-env")
+	if env == "" {
+		return errors.New("please specify the source database with --from-env")
+	}
+	value := os.Getenv(env)
+	if value == "" {
+		return fmt.Errorf("environment variable %s is not set", env)
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+
+	path := c.String("anonymize")
+	if path == "" {
+		return errors.New("please specify a rules file with --anonymize")
+	}
+	tables, err := loadSeedRules(path)
+	if err != nil {
+		return err
+	}
+
+	source := dbmate.New(u)
+	source.Log = db.Log
+
+	return source.GenerateSeeds(c.String("dir"), tables)
+}
+
+// loadSeedRules reads the tables to sample from a rules file
+func loadSeedRules(path string) ([]dbmate.SeedTable, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read rules file `%s`: %s", path, err)
+	}
+
+	rules := seedRules{}
+	if err := yaml.UnmarshalStrict(data, &rules); err != nil {
+		return nil, fmt.Errorf("unable to parse rules file `%s`: %s", path, err)
+	}
+	if len(rules.Tables) == 0 {
+		return nil, fmt.Errorf("rules file `%s` does not list any tables", path)
+	}
+
+	return rules.Tables, nil
+}
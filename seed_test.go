@@ -0,0 +1,55 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadSeedRules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	path := filepath.Join(dir, "rules.yml")
+	err = ioutil.WriteFile(path, []byte(`tables:
+  - name: users
+    where: deleted_at is null
+    limit: 100
+    columns:
+      email: email
+      phone: "null"
+  - name: posts
+`), 0644)
+	require.NoError(t, err)
+
+	tables, err := loadSeedRules(path)
+	require.NoError(t, err)
+	require.Equal(t, []dbmate.SeedTable{
+		{
+			Name:    "users",
+			Where:   "deleted_at is null",
+			Limit:   100,
+			Columns: map[string]string{"email": "email", "phone": "null"},
+		},
+		{Name: "posts"},
+	}, tables)
+
+	err = ioutil.WriteFile(path, []byte("tables:\n  - name: users\n    colums: {}\n"), 0644)
+	require.NoError(t, err)
+	_, err = loadSeedRules(path)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "field colums not found")
+
+	err = ioutil.WriteFile(path, []byte("tables: []\n"), 0644)
+	require.NoError(t, err)
+	_, err = loadSeedRules(path)
+	require.EqualError(t, err, "rules file `"+path+"` does not list any tables")
+}
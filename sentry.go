@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+)
+
+// sentryMaxStatementLength limits the size of SQL attached to Sentry events
+const sentryMaxStatementLength = 4096
+
+var urlPasswordRegExp = regexp.MustCompile(`(\w+://[^:/@\s]*:)[^@\s]*@`)
+
+// stringLiteralRegExp matches a single quoted SQL string, in which quotes are
+// escaped by doubling them or (in MySQL) with a backslash
+var stringLiteralRegExp = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+
+// scrubSecrets removes passwords from any URLs in a string
+func scrubSecrets(s string) string {
+	return urlPasswordRegExp.ReplaceAllString(s, "${1}********@")
+}
+
+// scrubStatement removes secrets from SQL. String literals are removed as well
+// as URL passwords, since they may contain passwords, such as in CREATE ROLE
+// ... PASSWORD '...' or IDENTIFIED BY '...'.
+func scrubStatement(s string) string {
+	return stringLiteralRegExp.ReplaceAllString(scrubSecrets(s), "'********'")
+}
+
+// sentryClient sends events to the Sentry store API
+type sentryClient struct {
+	storeURL    string
+	auth        string
+	environment string
+}
+
+// newSentryClient parses a Sentry DSN, e.g. https://public@sentry.example.com/1
+func newSentryClient(dsn string) (*sentryClient, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sentry dsn: %s", err)
+	}
+
+	projectID := strings.TrimPrefix(u.Path[strings.LastIndex(u.Path, "/"):], "/")
+	if u.User == nil || u.User.Username() == "" || projectID == "" {
+		return nil, errors.New("invalid sentry dsn: missing public key or project id")
+	}
+
+	auth := fmt.Sprintf("Sentry sentry_version=7, sentry_client=dbmate/%s, sentry_key=%s",
+		dbmate.Version, u.User.Username())
+	if secret, ok := u.User.Password(); ok {
+		auth += ", sentry_secret=" + secret
+	}
+
+	basePath := strings.TrimSuffix(u.Path, "/"+projectID)
+	storeURL := fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, basePath, projectID)
+
+	return &sentryClient{
+		storeURL:    storeURL,
+		auth:        auth,
+		environment: os.Getenv("SENTRY_ENVIRONMENT"),
+	}, nil
+}
+
+// Report sends an event to Sentry if the command failed
+func (s *sentryClient) Report(report runReport) error {
+	if report.Err == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(s.event(report))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", s.storeURL, bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("unable to report error to sentry: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Sentry-Auth", s.auth)
+
+	client := http.Client{Timeout: metricsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to report error to sentry: %s", err)
+	}
+	defer mustClose(resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unable to report error to sentry: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// event builds the Sentry event for a failed run
+func (s *sentryClient) event(report runReport) map[string]interface{} {
+	message := scrubSecrets(report.Err.Error())
+
+	tags := map[string]string{
+		"command":       report.Command,
+		"driver":        report.Driver,
+		"database":      report.Database,
+		"database_host": report.DatabaseHost,
+	}
+	extra := map[string]interface{}{
+		"user":             report.User,
+		"duration_seconds": report.Duration.Seconds(),
+	}
+
+	// attach the failing migration, if any
+	for _, m := range report.Migrations {
+		if m.Err == nil {
+			continue
+		}
+
+		// only the failed statement is attached, if it is known
+		statement := m.Contents
+		var stmtErr *dbmate.StatementError
+		if errors.As(m.Err, &stmtErr) && stmtErr.Query != "" {
+			statement = stmtErr.Query
+		}
+		statement = scrubStatement(statement)
+		if len(statement) > sentryMaxStatementLength {
+			statement = statement[:sentryMaxStatementLength] + "..."
+		}
+
+		tags["version"] = m.Version
+		tags["direction"] = m.Direction
+		extra["filename"] = m.Filename
+		extra["statement"] = statement
+	}
+
+	event := map[string]interface{}{
+		"event_id":    randomHex(16),
+		"timestamp":   time.Now().UTC().Format("2006-01-02T15:04:05"),
+		"level":       "error",
+		"logger":      "dbmate",
+		"platform":    "other",
+		"release":     "dbmate@" + dbmate.Version,
+		"server_name": report.Hostname,
+		"message":     map[string]string{"formatted": message},
+		"exception": map[string]interface{}{
+			"values": []map[string]string{{"type": "MigrationError", "value": message}},
+		},
+		"tags":  tags,
+		"extra": extra,
+	}
+	if s.environment != "" {
+		event["environment"] = s.environment
+	}
+
+	return event
+}
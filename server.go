@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// serverShutdownTimeout is how long to wait for in-flight requests on shutdown
+const serverShutdownTimeout = 30 * time.Second
+
+// server exposes migration commands over HTTP
+type server struct {
+	db        *dbmate.DB
+	token     string
+	newReport func(command string) runReport
+	reporters []reporter
+
+	// mu ensures only one migration command runs at a time
+	mu sync.Mutex
+}
+
+// statusMigration describes a migration in the /status response
+type statusMigration struct {
+	Version  string `json:"version"`
+	Filename string `json:"filename"`
+	Applied  bool   `json:"applied"`
+}
+
+// serve runs the HTTP server until interrupted
+func serve(db *dbmate.DB, c *cli.Context) error {
+	token := c.String("token")
+	if token == "" {
+		return errors.New("serve requires an API token (--token or DBMATE_SERVE_TOKEN)")
+	}
+
+	s, err := newServer(db, c, token)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{
+		Addr:    c.String("addr"),
+		Handler: s.handler(),
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		done <- httpServer.Shutdown(ctx)
+	}()
+
+	fmt.Fprintf(db.Log, "Listening on %s\n", httpServer.Addr)
+	if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+
+	return <-done
+}
+
+// newServer creates a server which publishes a report for each command, requiring
+// requests to send token as a bearer token. serve always sets a token. Only the
+// lambda handler passes an empty token, which disables authentication, since its
+// invocations are authorized by IAM or API Gateway.
+func newServer(db *dbmate.DB, c *cli.Context, token string) (*server, error) {
+	rs, err := reporters(c)
+	if err != nil {
+		return nil, err
+	}
+
+	return &server{
+		db:    db,
+		token: token,
+		newReport: func(command string) runReport {
+			report := newRunReport(c, db.DatabaseURL)
+			report.Command = command
+			return report
+		},
+		reporters: rs,
+	}, nil
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.Handle("/status", s.authorize(http.MethodGet, s.status))
+	mux.Handle("/migrate", s.authorize(http.MethodPost, s.run("migrate", s.db.Migrate)))
+	mux.Handle("/rollback", s.authorize(http.MethodPost, s.run("rollback", s.db.Rollback)))
+
+	return mux
+}
+
+// authorize requires the given method and a valid bearer token (if configured)
+func (s *server) authorize(method string, h http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+			return
+		}
+
+		header := r.Header.Get("Authorization")
+		bearer := strings.HasPrefix(header, "Bearer ")
+		token := strings.TrimPrefix(header, "Bearer ")
+		if s.token != "" && (!bearer || subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized"})
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+func (s *server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+func (s *server) status(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	results, err := s.db.Status()
+	s.mu.Unlock()
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": err.Error()})
+		return
+	}
+
+	migrations := []statusMigration{}
+	for _, m := range results {
+		migrations = append(migrations, statusMigration{
+			Version:  m.Version,
+			Filename: m.Filename,
+			Applied:  m.Applied,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{"migrations": migrations})
+}
+
+// run executes a migration command, publishing a report as the CLI would
+func (s *server) run(command string, f func() error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		report := runReported(s.db, s.reporters, s.newReport(command), f)
+
+		code := http.StatusOK
+		if report.Err != nil {
+			fmt.Fprintf(s.db.Log, "Error: %s\n", report.Err)
+			code = http.StatusInternalServerError
+		}
+
+		writeJSON(w, code, genericWebhookPayload(report))
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
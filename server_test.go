@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func testServer(t *testing.T) (*server, *bytes.Buffer, *[]runReport) {
+	dir, err := filepath.Abs("testdata/db/migrations")
+	require.NoError(t, err)
+
+	u, err := url.Parse("sqlite3:////tmp/dbmate_serve.sqlite3")
+	require.NoError(t, err)
+	require.NoError(t, os.RemoveAll("/tmp/dbmate_serve.sqlite3"))
+
+	var log bytes.Buffer
+	db := dbmate.New(u)
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	db.Log = &log
+
+	var reported []runReport
+	s := &server{
+		db:    db,
+		token: "secret",
+		newReport: func(command string) runReport {
+			return runReport{Command: command}
+		},
+		reporters: []reporter{func(r runReport) error {
+			reported = append(reported, r)
+			return nil
+		}},
+	}
+
+	return s, &log, &reported
+}
+
+func serverRequest(s *server, method, path, token string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	s.handler().ServeHTTP(w, req)
+
+	return w
+}
+
+func TestServerHealthz(t *testing.T) {
+	s, _, _ := testServer(t)
+
+	w := serverRequest(s, http.MethodGet, "/healthz", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"status":"ok"}`, w.Body.String())
+}
+
+func TestServerAuthorize(t *testing.T) {
+	s, _, _ := testServer(t)
+
+	w := serverRequest(s, http.MethodGet, "/status", "")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serverRequest(s, http.MethodPost, "/migrate", "wrong")
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// the token must be sent with the Bearer scheme
+	req := httptest.NewRequest(http.MethodGet, "/status", nil)
+	req.Header.Set("Authorization", "secret")
+	w = httptest.NewRecorder()
+	s.handler().ServeHTTP(w, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = serverRequest(s, http.MethodGet, "/status", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serverRequest(s, http.MethodGet, "/migrate", "secret")
+	require.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	require.Equal(t, http.MethodPost, w.Header().Get("Allow"))
+}
+
+func TestServerMigrateAndRollback(t *testing.T) {
+	s, log, reported := testServer(t)
+
+	w := serverRequest(s, http.MethodGet, "/status", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"migrations":[{"version":"20151129054053",`+
+		`"filename":"20151129054053_test_migration.sql","applied":false}]}`, w.Body.String())
+
+	w = serverRequest(s, http.MethodPost, "/migrate", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, log.String(), "Applying: 20151129054053_test_migration.sql\n")
+
+	var body map[string]interface{}
+	err := json.Unmarshal(w.Body.Bytes(), &body)
+	require.NoError(t, err)
+	require.Equal(t, "migrate", body["command"])
+	require.Equal(t, "success", body["status"])
+	require.Len(t, body["migrations"], 1)
+	require.Len(t, *reported, 1)
+	require.Equal(t, "migrate", (*reported)[0].Command)
+
+	w = serverRequest(s, http.MethodGet, "/status", "secret")
+	require.Contains(t, w.Body.String(), `"applied":true`)
+
+	w = serverRequest(s, http.MethodPost, "/rollback", "secret")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// nothing left to roll back
+	w = serverRequest(s, http.MethodPost, "/rollback", "secret")
+	require.Equal(t, http.StatusInternalServerError, w.Code)
+	require.Contains(t, w.Body.String(), `"status":"failure"`)
+	require.Contains(t, log.String(), "Error: can't rollback: no migrations have been applied\n")
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// shardResult records the state of a shard in the shard report
+type shardResult struct {
+	Shard   string   `json:"shard"`
+	Status  string   `json:"status"`
+	Applied []string `json:"applied"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// shardRun applies pending migrations across a fleet of shards
+type shardRun struct {
+	db         *dbmate.DB
+	shards     []*dbmate.DB
+	strategy   string
+	reportFile string
+	results    []shardResult
+}
+
+// migrateShards runs the shards migrate command
+func migrateShards(db *dbmate.DB, c *cli.Context) error {
+	urls := c.StringSlice("shard")
+	if len(urls) == 0 {
+		return errors.New("please specify shards with --shard")
+	}
+
+	run := &shardRun{db: db, strategy: c.String("strategy"), reportFile: c.String("report")}
+	for i, value := range urls {
+		// shards share a schema, so it is only dumped from the first shard
+		shard, err := newShard(db, value, i == 0)
+		if err != nil {
+			return err
+		}
+		run.shards = append(run.shards, shard)
+	}
+
+	return run.migrate()
+}
+
+// newShard returns a copy of the database for a shard URL, expanding
+// environment variables in the URL
+func newShard(db *dbmate.DB, value string, dumpSchema bool) (*dbmate.DB, error) {
+	u, err := url.Parse(os.ExpandEnv(value))
+	if err != nil {
+		return nil, err
+	}
+
+	shard := *db
+	shard.DatabaseURL = u
+	shard.AutoDumpSchema = db.AutoDumpSchema && dumpSchema
+
+	return &shard, nil
+}
+
+// shardName identifies a shard in the output, without credentials
+func shardName(u *url.URL) string {
+	return u.Host + u.Path
+}
+
+func (r *shardRun) migrate() error {
+	r.results = make([]shardResult, len(r.shards))
+	for i, shard := range r.shards {
+		r.results[i] = shardResult{Shard: shardName(shard.DatabaseURL), Status: "pending", Applied: []string{}}
+
+		result := &r.results[i]
+		onMigration := shard.OnMigration
+		shard.OnMigration = func(m dbmate.MigrationResult) {
+			if onMigration != nil {
+				onMigration(m)
+			}
+			if m.Err == nil {
+				result.Applied = append(result.Applied, m.Version)
+			}
+		}
+	}
+
+	var err error
+	switch r.strategy {
+	case "", "lockstep":
+		err = r.lockstep()
+	case "sequential":
+		err = r.sequential()
+	default:
+		return fmt.Errorf("invalid strategy: %s (expected lockstep or sequential)", r.strategy)
+	}
+
+	if err := r.writeReport(); err != nil {
+		return err
+	}
+
+	return err
+}
+
+// lockstep applies each pending version to every shard before the next version
+func (r *shardRun) lockstep() error {
+	pending := make([]map[string]bool, len(r.shards))
+	versions := []string{}
+	seen := map[string]bool{}
+	for i, shard := range r.shards {
+		status, err := shard.Status()
+		if err != nil {
+			return r.fail(i, fmt.Errorf("unable to read status: %s", err))
+		}
+
+		pending[i] = map[string]bool{}
+		for _, m := range status {
+			if m.Applied {
+				continue
+			}
+			pending[i][m.Version] = true
+			if !seen[m.Version] {
+				seen[m.Version] = true
+				versions = append(versions, m.Version)
+			}
+		}
+	}
+
+	for _, version := range versions {
+		fmt.Fprintf(r.db.Log, "Version: %s\n", version)
+		for i, shard := range r.shards {
+			if !pending[i][version] {
+				continue
+			}
+
+			fmt.Fprintf(r.db.Log, "Shard: %s\n", r.results[i].Shard)
+			if err := shard.MigrateTo(version); err != nil {
+				return r.fail(i, err)
+			}
+		}
+	}
+
+	return r.succeed()
+}
+
+// sequential applies all pending migrations to each shard in turn
+func (r *shardRun) sequential() error {
+	for i, shard := range r.shards {
+		fmt.Fprintf(r.db.Log, "Shard: %s\n", r.results[i].Shard)
+		if err := shard.Migrate(); err != nil {
+			return r.fail(i, err)
+		}
+		r.results[i].Status = "success"
+	}
+
+	return r.succeed()
+}
+
+func (r *shardRun) succeed() error {
+	for i := range r.results {
+		r.results[i].Status = "success"
+	}
+	fmt.Fprintf(r.db.Log, "Migrated %d shards\n", len(r.shards))
+
+	return nil
+}
+
+// fail halts the fleet after a shard fails
+func (r *shardRun) fail(i int, err error) error {
+	r.results[i].Status = "failure"
+	r.results[i].Error = err.Error()
+	fmt.Fprintf(r.db.Log, "Halting: shard %s failed\n", r.results[i].Shard)
+
+	return fmt.Errorf("shard %s: %s", r.results[i].Shard, err)
+}
+
+// writeReport saves the state of each shard
+func (r *shardRun) writeReport() error {
+	if r.reportFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.reportFile, append(data, '\n'), 0644)
+}
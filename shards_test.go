@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func testShardRun(t *testing.T, dir string, strategy string) (*shardRun, *bytes.Buffer) {
+	var buf bytes.Buffer
+	db := dbmate.New(nil)
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	db.Log = &buf
+
+	run := &shardRun{db: db, strategy: strategy, reportFile: filepath.Join(dir, "shards.json")}
+	for _, name := range []string{"shard1", "shard2"} {
+		shard := *db
+		shard.DatabaseURL = &url.URL{Scheme: "sqlite", Path: "/" + filepath.Join(dir, name+".sqlite3")}
+		run.shards = append(run.shards, &shard)
+	}
+
+	return run, &buf
+}
+
+func TestMigrateShards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.Mkdir(migrationsDir, 0755))
+	writeTestMigration(t, migrationsDir, "1_users.sql", "create table users (id integer);")
+	writeTestMigration(t, migrationsDir, "2_posts.sql", "create table posts (id integer);")
+
+	name := func(shard string) string {
+		return "/" + filepath.Join(dir, shard+".sqlite3")
+	}
+
+	// each version is applied to all shards before the next
+	run, buf := testShardRun(t, dir, "lockstep")
+	err = run.migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Version: 1\n"+
+		"Shard: "+name("shard1")+"\nApplying: 1_users.sql\n"+
+		"Shard: "+name("shard2")+"\nApplying: 1_users.sql\n"+
+		"Version: 2\n"+
+		"Shard: "+name("shard1")+"\nApplying: 2_posts.sql\n"+
+		"Shard: "+name("shard2")+"\nApplying: 2_posts.sql\n"+
+		"Migrated 2 shards\n", buf.String())
+
+	// the first failure halts the fleet
+	writeTestMigration(t, migrationsDir, "3_fail.sql", "create table users (id integer);")
+	writeTestMigration(t, migrationsDir, "4_comments.sql", "create table comments (id integer);")
+	run, buf = testShardRun(t, dir, "lockstep")
+	err = run.migrate()
+	require.EqualError(t, err, "shard "+name("shard1")+": 3_fail.sql: statement 1, line 2: table users already exists")
+	require.Equal(t, "Version: 3\n"+
+		"Shard: "+name("shard1")+"\nApplying: 3_fail.sql\n"+
+		"Halting: shard "+name("shard1")+" failed\n", buf.String())
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "shards.json"))
+	require.NoError(t, err)
+	var results []shardResult
+	require.NoError(t, json.Unmarshal(data, &results))
+	require.Equal(t, []shardResult{
+		{Shard: name("shard1"), Status: "failure", Applied: []string{}, Error: "3_fail.sql: statement 1, line 2: table users already exists"},
+		{Shard: name("shard2"), Status: "pending", Applied: []string{}},
+	}, results)
+
+	// sequential applies all migrations to one shard at a time
+	require.NoError(t, os.Remove(filepath.Join(migrationsDir, "3_fail.sql")))
+	run, buf = testShardRun(t, dir, "sequential")
+	err = run.migrate()
+	require.NoError(t, err)
+	require.Equal(t, "Shard: "+name("shard1")+"\nApplying: 4_comments.sql\n"+
+		"Shard: "+name("shard2")+"\nApplying: 4_comments.sql\n"+
+		"Migrated 2 shards\n", buf.String())
+	require.Equal(t, []string{"4"}, run.results[1].Applied)
+
+	run, _ = testShardRun(t, dir, "parallel")
+	err = run.migrate()
+	require.EqualError(t, err, "invalid strategy: parallel (expected lockstep or sequential)")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+)
+
+// snapshotHook returns a function which runs a shell command before risky
+// migrations, e.g. to create a cloud database snapshot. The command should
+// block until the snapshot is complete, and describes the migration using
+// environment variables.
+func snapshotHook(command string, log io.Writer) func(dbmate.MigrationResult) error {
+	return func(m dbmate.MigrationResult) error {
+		id := fmt.Sprintf("dbmate-%s-%d", m.Version, time.Now().Unix())
+		fmt.Fprintf(log, "Snapshotting: %s\n", id)
+
+		cmd := exec.Command("sh", "-c", command)
+		cmd.Env = append(os.Environ(),
+			"DBMATE_SNAPSHOT_ID="+id,
+			"DBMATE_MIGRATION_VERSION="+m.Version,
+			"DBMATE_MIGRATION_FILENAME="+m.Filename,
+		)
+		cmd.Stdout = log
+		cmd.Stderr = log
+
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("snapshot command failed: %s", err)
+		}
+
+		return nil
+	}
+}
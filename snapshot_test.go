@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshotHook(t *testing.T) {
+	var buf bytes.Buffer
+	hook := snapshotHook(`echo "$DBMATE_MIGRATION_VERSION $DBMATE_MIGRATION_FILENAME $DBMATE_SNAPSHOT_ID"`, &buf)
+
+	err := hook(dbmate.MigrationResult{Version: "2", Filename: "2_drop_users.sql"})
+	require.NoError(t, err)
+	require.Regexp(t, regexp.MustCompile(`^Snapshotting: dbmate-2-\d+\n2 2_drop_users.sql dbmate-2-\d+\n$`),
+		buf.String())
+
+	hook = snapshotHook("exit 3", &buf)
+	err = hook(dbmate.MigrationResult{Version: "2"})
+	require.EqualError(t, err, "snapshot command failed: exit status 3")
+}
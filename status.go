@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// showStatus prints the status of each migration in the requested format
+func showStatus(db *dbmate.DB, c *cli.Context) error {
+	format := c.String("output")
+	switch format {
+	case "", "text":
+	case "terraform-external":
+		// the external data source protocol requires stdout to contain only the result
+		db.Log = os.Stderr
+	default:
+		return fmt.Errorf("unsupported output format: %s", format)
+	}
+
+	results, err := db.Status()
+	if err != nil {
+		if c.Bool("exit-code") {
+			return cli.NewExitError(err.Error(), 2)
+		}
+		return err
+	}
+
+	if format == "terraform-external" {
+		err = json.NewEncoder(os.Stdout).Encode(terraformStatus(results))
+	} else {
+		printStatus(os.Stdout, results, c.Bool("verbose") || c.GlobalBool("verbose"))
+	}
+	if err != nil || !c.Bool("exit-code") {
+		return err
+	}
+
+	return checkPending(results)
+}
+
+// checkPending returns an error which exits with status 1 if any migrations are pending
+func checkPending(results []dbmate.MigrationStatus) error {
+	pending := 0
+	for _, m := range results {
+		if !m.Applied {
+			pending++
+		}
+	}
+
+	if pending > 0 {
+		return cli.NewExitError(fmt.Sprintf("%d pending migrations", pending), 1)
+	}
+
+	return nil
+}
+
+// printStatus writes a human readable list of migrations, and if verbose, when,
+// how long, and by whom each migration was applied
+func printStatus(w io.Writer, results []dbmate.MigrationStatus, verbose bool) {
+	applied := 0
+	for _, m := range results {
+		mark := " "
+		if m.Applied {
+			mark = "X"
+			applied++
+		}
+		if verbose && m.Metadata != nil {
+			fmt.Fprintf(w, "[%s] %s (%s)\n", mark, m.Filename, formatMetadata(*m.Metadata))
+			continue
+		}
+		fmt.Fprintf(w, "[%s] %s\n", mark, m.Filename)
+	}
+
+	fmt.Fprintf(w, "\nApplied: %d\n", applied)
+	fmt.Fprintf(w, "Pending: %d\n", len(results)-applied)
+}
+
+// formatMetadata describes when, how long, and by whom a migration was applied
+func formatMetadata(meta dbmate.MigrationMetadata) string {
+	by := meta.AppliedBy
+	if meta.Hostname != "" {
+		by += "@" + meta.Hostname
+	}
+
+	return fmt.Sprintf("applied %s in %s by %s with dbmate %s", meta.AppliedAt.Format(time.RFC3339),
+		meta.Duration, by, meta.DbmateVersion)
+}
+
+// databaseVersion describes the current database version
+type databaseVersion struct {
+	Version           string   `json:"version"`
+	Applied           int      `json:"applied"`
+	Pending           int      `json:"pending"`
+	PendingMigrations []string `json:"pending_migrations"`
+}
+
+// currentVersion returns the latest applied version and the pending migrations
+func currentVersion(results []dbmate.MigrationStatus) databaseVersion {
+	v := databaseVersion{PendingMigrations: []string{}}
+	for _, m := range results {
+		if m.Applied {
+			v.Version = m.Version
+			v.Applied++
+		} else {
+			v.PendingMigrations = append(v.PendingMigrations, m.Version)
+		}
+	}
+	v.Pending = len(v.PendingMigrations)
+
+	return v
+}
+
+// showVersion prints the current database version, as text or json
+func showVersion(db *dbmate.DB, c *cli.Context) error {
+	results, err := db.Status()
+	if err != nil {
+		return err
+	}
+
+	v := currentVersion(results)
+	if c.Bool("json") {
+		return json.NewEncoder(os.Stdout).Encode(v)
+	}
+
+	printVersion(os.Stdout, v)
+
+	return nil
+}
+
+// printVersion writes a human readable database version
+func printVersion(w io.Writer, v databaseVersion) {
+	version := v.Version
+	if version == "" {
+		version = "none"
+	}
+
+	fmt.Fprintf(w, "Version: %s\n", version)
+	fmt.Fprintf(w, "Pending: %d\n", v.Pending)
+}
+
+// terraformStatus returns the result object for a Terraform external data
+// source, which only supports string values
+func terraformStatus(results []dbmate.MigrationStatus) map[string]string {
+	version := ""
+	applied := 0
+	pending := []string{}
+	for _, m := range results {
+		if m.Applied {
+			version = m.Version
+			applied++
+		} else {
+			pending = append(pending, m.Version)
+		}
+	}
+
+	return map[string]string{
+		"version":            version,
+		"applied":            fmt.Sprint(applied),
+		"pending":            fmt.Sprint(len(pending)),
+		"pending_migrations": strings.Join(pending, ","),
+		"up_to_date":         fmt.Sprint(len(pending) == 0),
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+	"github.com/urfave/cli"
+)
+
+func testStatus() []dbmate.MigrationStatus {
+	return []dbmate.MigrationStatus{
+		{Version: "1", Filename: "1_users.sql", Applied: true},
+		{Version: "2", Filename: "2_posts.sql", Applied: true},
+		{Version: "3", Filename: "3_comments.sql"},
+	}
+}
+
+func TestPrintStatus(t *testing.T) {
+	var buf bytes.Buffer
+	printStatus(&buf, testStatus(), false)
+	require.Equal(t, "[X] 1_users.sql\n"+
+		"[X] 2_posts.sql\n"+
+		"[ ] 3_comments.sql\n"+
+		"\n"+
+		"Applied: 2\n"+
+		"Pending: 1\n", buf.String())
+}
+
+func TestPrintStatusVerbose(t *testing.T) {
+	results := testStatus()
+	results[1].Metadata = &dbmate.MigrationMetadata{
+		AppliedAt:     time.Date(2026, 10, 14, 12, 30, 0, 0, time.UTC),
+		Duration:      1500 * time.Millisecond,
+		AppliedBy:     "deploy",
+		Hostname:      "ci-1",
+		DbmateVersion: "1.6.0",
+	}
+
+	var buf bytes.Buffer
+	printStatus(&buf, results, true)
+	require.Equal(t, "[X] 1_users.sql\n"+
+		"[X] 2_posts.sql (applied 2026-10-14T12:30:00Z in 1.5s by deploy@ci-1 with dbmate 1.6.0)\n"+
+		"[ ] 3_comments.sql\n"+
+		"\n"+
+		"Applied: 2\n"+
+		"Pending: 1\n", buf.String())
+}
+
+func TestTerraformStatus(t *testing.T) {
+	require.Equal(t, map[string]string{
+		"version":            "2",
+		"applied":            "2",
+		"pending":            "1",
+		"pending_migrations": "3",
+		"up_to_date":         "false",
+	}, terraformStatus(testStatus()))
+
+	require.Equal(t, map[string]string{
+		"version":            "",
+		"applied":            "0",
+		"pending":            "0",
+		"pending_migrations": "",
+		"up_to_date":         "true",
+	}, terraformStatus(nil))
+}
+
+func TestCheckPending(t *testing.T) {
+	err := checkPending(testStatus())
+	require.EqualError(t, err, "1 pending migrations")
+	require.Equal(t, 1, err.(cli.ExitCoder).ExitCode())
+
+	err = checkPending(testStatus()[:2])
+	require.NoError(t, err)
+}
+
+func TestCurrentVersion(t *testing.T) {
+	v := currentVersion(testStatus())
+	require.Equal(t, databaseVersion{
+		Version:           "2",
+		Applied:           2,
+		Pending:           1,
+		PendingMigrations: []string{"3"},
+	}, v)
+
+	var buf bytes.Buffer
+	printVersion(&buf, v)
+	require.Equal(t, "Version: 2\nPending: 1\n", buf.String())
+
+	buf.Reset()
+	printVersion(&buf, currentVersion(nil))
+	require.Equal(t, "Version: none\nPending: 0\n", buf.String())
+}
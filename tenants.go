@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// tenantResult records the outcome of migrating a tenant in the tenant report
+type tenantResult struct {
+	Tenant  string   `json:"tenant"`
+	Status  string   `json:"status"`
+	Applied []string `json:"applied"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// tenantRun applies pending migrations to each tenant in turn
+type tenantRun struct {
+	db              *dbmate.DB
+	continueOnError bool
+	reportFile      string
+	results         []tenantResult
+}
+
+// migrateTenants runs the tenants migrate command
+func migrateTenants(db *dbmate.DB, c *cli.Context) error {
+	tenants := c.StringSlice("tenant")
+	if query := c.String("tenant-query"); query != "" {
+		discovered, err := db.DiscoverTenants(query)
+		if err != nil {
+			return err
+		}
+		tenants = append(tenants, discovered...)
+	}
+	if len(tenants) == 0 {
+		return errors.New("please specify tenants with --tenant or --tenant-query")
+	}
+
+	run := &tenantRun{
+		db:              db,
+		continueOnError: c.Bool("continue-on-error"),
+		reportFile:      c.String("report"),
+	}
+	if path := c.String("resume"); path != "" {
+		if err := run.resume(path); err != nil {
+			return err
+		}
+	}
+
+	return run.migrate(tenants)
+}
+
+// resume loads a previous report, so that tenants which were migrated
+// successfully are skipped
+func (r *tenantRun) resume(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var previous []tenantResult
+	if err := json.Unmarshal(data, &previous); err != nil {
+		return fmt.Errorf("unable to parse tenant report `%s`: %s", path, err)
+	}
+
+	for _, result := range previous {
+		if result.Status == "success" {
+			r.results = append(r.results, result)
+		}
+	}
+
+	return nil
+}
+
+func (r *tenantRun) migrate(tenants []string) error {
+	done := map[string]bool{}
+	for _, result := range r.results {
+		done[result.Tenant] = true
+	}
+
+	migrated := 0
+	failed := []tenantResult{}
+	for _, tenant := range tenants {
+		if done[tenant] {
+			fmt.Fprintf(r.db.Log, "Skipping: tenant %s (already migrated)\n", tenant)
+			migrated++
+			continue
+		}
+
+		fmt.Fprintf(r.db.Log, "Tenant: %s\n", tenant)
+		result := r.migrateTenant(tenant)
+		r.results = append(r.results, result)
+		if result.Status == "success" {
+			migrated++
+		} else {
+			fmt.Fprintf(r.db.Log, "Error: %s\n", result.Error)
+			failed = append(failed, result)
+		}
+
+		if err := r.writeReport(); err != nil {
+			return err
+		}
+		if len(failed) > 0 && !r.continueOnError {
+			break
+		}
+	}
+
+	fmt.Fprintf(r.db.Log, "Migrated %d of %d tenants\n", migrated, len(tenants))
+	for _, result := range failed {
+		fmt.Fprintf(r.db.Log, "Failed: %s (%s)\n", result.Tenant, result.Error)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d tenants failed", len(failed), len(tenants))
+	}
+
+	return nil
+}
+
+func (r *tenantRun) migrateTenant(tenant string) tenantResult {
+	result := tenantResult{Tenant: tenant, Status: "success", Applied: []string{}}
+
+	db, err := r.db.ForTenant(tenant)
+	if err == nil {
+		onMigration := db.OnMigration
+		db.OnMigration = func(m dbmate.MigrationResult) {
+			if onMigration != nil {
+				onMigration(m)
+			}
+			if m.Err == nil {
+				result.Applied = append(result.Applied, m.Version)
+			}
+		}
+		err = db.Migrate()
+	}
+
+	if err != nil {
+		result.Status = "failure"
+		result.Error = err.Error()
+	}
+
+	return result
+}
+
+// writeReport saves the results so far, so that an interrupted run can be resumed
+func (r *tenantRun) writeReport() error {
+	if r.reportFile == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(r.results, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.reportFile, append(data, '\n'), 0644)
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantTestDriver stores each tenant in a separate sqlite database file
+type tenantTestDriver struct {
+	dbmate.SQLiteDriver
+}
+
+func (drv tenantTestDriver) Tenant(u *url.URL, tenant string) (dbmate.Driver, *url.URL) {
+	tenantURL := *u
+	tenantURL.Path = "/" + filepath.Join(filepath.Dir(u.Path), tenant+".sqlite3")
+
+	return drv.SQLiteDriver, &tenantURL
+}
+
+func TestMigrateTenants(t *testing.T) {
+	dbmate.RegisterDriver(tenantTestDriver{}, "sqlite-tenants")
+
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	migrationsDir := filepath.Join(dir, "migrations")
+	require.NoError(t, os.Mkdir(migrationsDir, 0755))
+	writeTestMigration(t, migrationsDir, "1_users.sql", "create table users (id integer);")
+
+	u, err := url.Parse("sqlite-tenants:///" + filepath.Join(dir, "main.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := dbmate.New(u)
+	db.MigrationsDir = migrationsDir
+	db.Log = &buf
+
+	// a tenant which already has a conflicting users table fails
+	broken, err := dbmate.SQLiteDriver{}.Open(&url.URL{Scheme: "sqlite",
+		Path: "/" + filepath.Join(dir, "globex.sqlite3")})
+	require.NoError(t, err)
+	_, err = broken.Exec("create table users (name text)")
+	require.NoError(t, err)
+	mustClose(broken)
+
+	report := filepath.Join(dir, "tenants.json")
+	run := &tenantRun{db: db, continueOnError: true, reportFile: report}
+	err = run.migrate([]string{"acme", "globex", "initech"})
+	require.EqualError(t, err, "1 of 3 tenants failed")
+	require.Equal(t, "Tenant: acme\n"+
+		"Applying: 1_users.sql\n"+
+		"Tenant: globex\n"+
+		"Applying: 1_users.sql\n"+
+		"Error: 1_users.sql: statement 1, line 2: table users already exists\n"+
+		"Tenant: initech\n"+
+		"Applying: 1_users.sql\n"+
+		"Migrated 2 of 3 tenants\n"+
+		"Failed: globex (1_users.sql: statement 1, line 2: table users already exists)\n", buf.String())
+
+	data, err := ioutil.ReadFile(report)
+	require.NoError(t, err)
+	var results []tenantResult
+	require.NoError(t, json.Unmarshal(data, &results))
+	require.Equal(t, []tenantResult{
+		{Tenant: "acme", Status: "success", Applied: []string{"1"}},
+		{Tenant: "globex", Status: "failure", Applied: []string{}, Error: "1_users.sql: statement 1, line 2: table users already exists"},
+		{Tenant: "initech", Status: "success", Applied: []string{"1"}},
+	}, results)
+
+	// resuming skips tenants which succeeded
+	require.NoError(t, os.Remove(filepath.Join(dir, "globex.sqlite3")))
+	buf.Reset()
+	run = &tenantRun{db: db, reportFile: report}
+	require.NoError(t, run.resume(report))
+	err = run.migrate([]string{"acme", "globex", "initech"})
+	require.NoError(t, err)
+	require.Equal(t, "Skipping: tenant acme (already migrated)\n"+
+		"Tenant: globex\n"+
+		"Applying: 1_users.sql\n"+
+		"Skipping: tenant initech (already migrated)\n"+
+		"Migrated 3 of 3 tenants\n", buf.String())
+
+	// without --continue-on-error, the first failure stops the run
+	buf.Reset()
+	run = &tenantRun{db: dbmate.New(&url.URL{Scheme: "sqlite", Path: "/tmp/x.sqlite3"})}
+	run.db.Log = &buf
+	err = run.migrate([]string{"acme", "globex"})
+	require.EqualError(t, err, "1 of 2 tenants failed")
+	require.Equal(t, "Tenant: acme\n"+
+		"Error: tenants are not supported by the sqlite driver\n"+
+		"Migrated 0 of 2 tenants\n"+
+		"Failed: acme (tenants are not supported by the sqlite driver)\n", buf.String())
+}
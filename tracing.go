@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// OTLP span kinds and status codes
+const (
+	otlpSpanKindInternal = 1
+	otlpSpanKindClient   = 3
+	otlpStatusOK         = 1
+	otlpStatusError      = 2
+)
+
+// otlpDBSystems maps URL schemes to OpenTelemetry db.system values
+var otlpDBSystems = map[string]string{
+	"postgres":   "postgresql",
+	"postgresql": "postgresql",
+	"mysql":      "mysql",
+	"sqlite":     "sqlite",
+	"sqlite3":    "sqlite",
+}
+
+var traceparentRegExp = regexp.MustCompile(`^[0-9a-f]{2}-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes"`
+	Status            otlpStatus      `json:"status"`
+}
+
+// otlpTracer exports a run report as OpenTelemetry spans using OTLP/HTTP (json)
+type otlpTracer struct {
+	endpoint    string
+	headers     map[string]string
+	serviceName string
+	// traceparent links the run to a parent trace (e.g. the triggering deploy)
+	traceparent string
+}
+
+// newOTLPTracer configures a tracer using the standard OpenTelemetry environment
+// variables. OTEL_EXPORTER_OTLP_TRACES_ENDPOINT takes precedence over endpoint.
+func newOTLPTracer(endpoint string) *otlpTracer {
+	if endpoint != "" {
+		endpoint = strings.TrimRight(endpoint, "/") + "/v1/traces"
+	}
+	if v := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); v != "" {
+		endpoint = v
+	}
+
+	serviceName := os.Getenv("OTEL_SERVICE_NAME")
+	if serviceName == "" {
+		serviceName = "dbmate"
+	}
+
+	return &otlpTracer{
+		endpoint:    endpoint,
+		headers:     parseOTLPHeaders(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS")),
+		serviceName: serviceName,
+		traceparent: os.Getenv("TRACEPARENT"),
+	}
+}
+
+// parseOTLPHeaders parses headers in the format "key1=value1,key2=value2"
+func parseOTLPHeaders(s string) map[string]string {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) != "" {
+			headers[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return headers
+}
+
+// Report exports the run report
+func (t *otlpTracer) Report(report runReport) error {
+	payload, err := t.payload(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", t.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("unable to export traces: %s", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+
+	client := http.Client{Timeout: metricsTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to export traces: %s", err)
+	}
+	defer mustClose(resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("unable to export traces: %s", resp.Status)
+	}
+
+	return nil
+}
+
+// payload builds the OTLP request body for a run report. The run is represented by
+// a root span, with a child span for each migration.
+func (t *otlpTracer) payload(report runReport) ([]byte, error) {
+	traceID, parentID := "", ""
+	if m := traceparentRegExp.FindStringSubmatch(t.traceparent); m != nil {
+		traceID, parentID = m[1], m[2]
+	} else {
+		traceID = randomHex(16)
+	}
+
+	attrs := []otlpAttribute{
+		otlpAttr("db.system", otlpDBSystems[report.Driver]),
+		otlpAttr("db.name", report.Database),
+		otlpAttr("dbmate.command", report.Command),
+	}
+	if report.DatabaseHost != "" {
+		attrs = append(attrs, otlpAttr("net.peer.name", report.DatabaseHost))
+	}
+
+	root := otlpSpan{
+		TraceID:           traceID,
+		SpanID:            randomHex(8),
+		ParentSpanID:      parentID,
+		Name:              "dbmate " + report.Command,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: otlpTime(report.StartedAt),
+		EndTimeUnixNano:   otlpTime(report.StartedAt.Add(report.Duration)),
+		Attributes:        attrs,
+		Status:            newOTLPStatus(report.Err),
+	}
+	spans := []otlpSpan{root}
+
+	for _, m := range report.Migrations {
+		spans = append(spans, otlpSpan{
+			TraceID:           traceID,
+			SpanID:            randomHex(8),
+			ParentSpanID:      root.SpanID,
+			Name:              fmt.Sprintf("dbmate %s %s", m.Direction, m.Version),
+			Kind:              otlpSpanKindClient,
+			StartTimeUnixNano: otlpTime(m.StartedAt),
+			EndTimeUnixNano:   otlpTime(m.StartedAt.Add(m.Duration)),
+			Attributes: append([]otlpAttribute{
+				otlpAttr("dbmate.version", m.Version),
+				otlpAttr("dbmate.filename", m.Filename),
+				otlpAttr("dbmate.direction", m.Direction),
+			}, attrs[:2]...),
+			Status: newOTLPStatus(m.Err),
+		})
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{
+				"attributes": []otlpAttribute{otlpAttr("service.name", t.serviceName)},
+			},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]string{"name": "dbmate"},
+				"spans": spans,
+			}},
+		}},
+	})
+}
+
+func otlpAttr(key, value string) otlpAttribute {
+	return otlpAttribute{Key: key, Value: otlpValue{StringValue: value}}
+}
+
+func otlpTime(t time.Time) string {
+	return fmt.Sprint(t.UnixNano())
+}
+
+func newOTLPStatus(err error) otlpStatus {
+	if err != nil {
+		return otlpStatus{Code: otlpStatusError, Message: err.Error()}
+	}
+
+	return otlpStatus{Code: otlpStatusOK}
+}
+
+// randomHex returns n random bytes, hex encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+
+	return hex.EncodeToString(b)
+}
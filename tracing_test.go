@@ -0,0 +1,102 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOTLPHeaders(t *testing.T) {
+	require.Equal(t, map[string]string{}, parseOTLPHeaders(""))
+	require.Equal(t, map[string]string{
+		"api-key": "secret",
+		"x-team":  "db=ops",
+	}, parseOTLPHeaders("api-key=secret, x-team=db=ops,invalid"))
+}
+
+func TestNewOTLPTracer(t *testing.T) {
+	tracer := newOTLPTracer("")
+	require.Equal(t, "", tracer.endpoint)
+	require.Equal(t, "dbmate", tracer.serviceName)
+
+	tracer = newOTLPTracer("http://collector:4318/")
+	require.Equal(t, "http://collector:4318/v1/traces", tracer.endpoint)
+
+	err := os.Setenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "http://traces:4318/custom")
+	require.NoError(t, err)
+	defer func() {
+		err := os.Unsetenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+		require.NoError(t, err)
+	}()
+
+	tracer = newOTLPTracer("http://collector:4318")
+	require.Equal(t, "http://traces:4318/custom", tracer.endpoint)
+}
+
+func TestOTLPTracerPayload(t *testing.T) {
+	tracer := &otlpTracer{
+		serviceName: "orders",
+		traceparent: "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01",
+	}
+
+	report := testReport()
+	report.Driver = "postgres"
+	report.Database = "orders"
+
+	data, err := tracer.payload(report)
+	require.NoError(t, err)
+
+	var payload struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []otlpSpan
+			}
+		}
+	}
+	err = json.Unmarshal(data, &payload)
+	require.NoError(t, err)
+
+	spans := payload.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, spans, 4)
+
+	root := spans[0]
+	require.Equal(t, "dbmate migrate", root.Name)
+	require.Equal(t, "0af7651916cd43dd8448eb211c80319c", root.TraceID)
+	require.Equal(t, "b7ad6b7169203331", root.ParentSpanID)
+	require.Len(t, root.SpanID, 16)
+	require.Equal(t, otlpAttr("db.system", "postgresql"), root.Attributes[0])
+	require.Equal(t, otlpStatus{Code: otlpStatusError, Message: "syntax error"}, root.Status)
+
+	require.Equal(t, "dbmate up 1", spans[1].Name)
+	require.Equal(t, root.TraceID, spans[1].TraceID)
+	require.Equal(t, root.SpanID, spans[1].ParentSpanID)
+	require.Equal(t, otlpStatusOK, spans[1].Status.Code)
+	require.Equal(t, otlpStatusError, spans[3].Status.Code)
+}
+
+func TestOTLPTracerReport(t *testing.T) {
+	var apiKey string
+	var body map[string]interface{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiKey = r.Header.Get("api-key")
+		data, _ := ioutil.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+	}))
+	defer server.Close()
+
+	tracer := &otlpTracer{
+		endpoint:    server.URL + "/v1/traces",
+		headers:     map[string]string{"api-key": "secret"},
+		serviceName: "dbmate",
+	}
+
+	err := tracer.Report(testReport())
+	require.NoError(t, err)
+	require.Equal(t, "secret", apiKey)
+	require.Contains(t, body, "resourceSpans")
+}
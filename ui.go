@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// uiHelp describes the commands accepted by the interactive ui
+const uiHelp = `Commands:
+  a N   apply pending migrations up to and including N
+  r [N] roll back migration N and every migration applied after it (default: the latest)
+  v N   view the SQL of migration N
+  l     list migrations
+  q     quit
+`
+
+// migrationUI is an interactive prompt which lists migrations, and applies,
+// rolls back, or shows individual migrations
+type migrationUI struct {
+	db     *dbmate.DB
+	in     *bufio.Reader
+	out    io.Writer
+	status []dbmate.MigrationStatus
+}
+
+// runUI runs the ui command
+func runUI(db *dbmate.DB, c *cli.Context) error {
+	ui := &migrationUI{db: db, in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	return ui.run()
+}
+
+func (ui *migrationUI) run() error {
+	if err := ui.list(); err != nil {
+		return err
+	}
+	fmt.Fprint(ui.out, "\n"+uiHelp)
+
+	for {
+		fmt.Fprint(ui.out, "\ndbmate> ")
+		line, err := ui.in.ReadString('\n')
+		if err != nil && line == "" {
+			fmt.Fprintln(ui.out)
+			return nil
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "q", "quit", "exit":
+			return nil
+		case "l", "list":
+			err = ui.list()
+		case "a", "apply":
+			err = ui.apply(fields[1:])
+		case "r", "rollback":
+			err = ui.rollback(fields[1:])
+		case "v", "view":
+			err = ui.view(fields[1:])
+		default:
+			fmt.Fprint(ui.out, uiHelp)
+		}
+
+		// errors are reported, and the session continues
+		if err != nil {
+			fmt.Fprintf(ui.out, "Error: %s\n", err)
+		}
+	}
+}
+
+// list refreshes and prints the migrations, numbered from 1
+func (ui *migrationUI) list() error {
+	status, err := ui.db.Status()
+	if err != nil {
+		return err
+	}
+	ui.status = status
+
+	for i, m := range status {
+		mark := " "
+		if m.Applied {
+			mark = "X"
+		}
+		fmt.Fprintf(ui.out, "%3d [%s] %s\n", i+1, mark, m.Filename)
+	}
+
+	return nil
+}
+
+// migration returns the index of the migration numbered by args[0]
+func (ui *migrationUI) migration(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("please specify a migration number")
+	}
+
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 || n > len(ui.status) {
+		return 0, fmt.Errorf("invalid migration number: %s", args[0])
+	}
+
+	return n - 1, nil
+}
+
+func (ui *migrationUI) apply(args []string) error {
+	i, err := ui.migration(args)
+	if err != nil {
+		return err
+	}
+
+	m := ui.status[i]
+	if m.Applied {
+		return fmt.Errorf("%s has already been applied", m.Filename)
+	}
+
+	pending := 0
+	for _, s := range ui.status[:i+1] {
+		if !s.Applied {
+			pending++
+		}
+	}
+
+	if ui.confirm(fmt.Sprintf("Apply %d migrations up to and including %s?", pending, m.Filename)) {
+		if err := ui.db.MigrateTo(m.Version); err != nil {
+			return err
+		}
+	}
+
+	return ui.list()
+}
+
+func (ui *migrationUI) rollback(args []string) error {
+	i := -1
+	if len(args) == 0 {
+		for j, s := range ui.status {
+			if s.Applied {
+				i = j
+			}
+		}
+		if i < 0 {
+			return fmt.Errorf("no migrations have been applied")
+		}
+	} else {
+		var err error
+		if i, err = ui.migration(args); err != nil {
+			return err
+		}
+	}
+
+	m := ui.status[i]
+	if !m.Applied {
+		return fmt.Errorf("%s has not been applied", m.Filename)
+	}
+
+	steps := 0
+	for _, s := range ui.status[i:] {
+		if s.Applied {
+			steps++
+		}
+	}
+
+	if ui.confirm(fmt.Sprintf("Roll back %d migrations, down to and including %s?", steps, m.Filename)) {
+		if err := ui.db.RollbackSteps(steps); err != nil {
+			return err
+		}
+	}
+
+	return ui.list()
+}
+
+func (ui *migrationUI) view(args []string) error {
+	i, err := ui.migration(args)
+	if err != nil {
+		return err
+	}
+
+	contents, err := ioutil.ReadFile(filepath.Join(ui.db.MigrationsDir, ui.status[i].Filename))
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(ui.out, "-- %s\n%s", ui.status[i].Filename, contents)
+	if len(contents) > 0 && contents[len(contents)-1] != '\n' {
+		fmt.Fprintln(ui.out)
+	}
+
+	return nil
+}
+
+// confirm asks a yes or no question, treating anything other than "y" or "yes" as no
+func (ui *migrationUI) confirm(question string) bool {
+	fmt.Fprintf(ui.out, "%s [y/N] ", question)
+	answer, _ := ui.in.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
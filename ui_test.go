@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrationUI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "ui.sqlite3"))
+	require.NoError(t, err)
+
+	var log bytes.Buffer
+	db := dbmate.New(u)
+	db.Log = &log
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	for _, name := range []string{"1_users", "2_posts", "3_comments"} {
+		writeTestMigration(t, dir, name+".sql", "create table "+name[2:]+" (id integer);")
+	}
+
+	input := strings.Join([]string{
+		"v 1",
+		"a 2", "n",
+		"a 2", "y",
+		"a 1",
+		"r 1", "y",
+		"r",
+		"a 9",
+		"x",
+		"q",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	ui := &migrationUI{db: db, in: bufio.NewReader(strings.NewReader(input)), out: &out}
+	err = ui.run()
+	require.NoError(t, err)
+
+	output := out.String()
+	require.True(t, strings.HasPrefix(output, "  1 [ ] 1_users.sql\n  2 [ ] 2_posts.sql\n  3 [ ] 3_comments.sql\n"))
+	require.Contains(t, output, "-- 1_users.sql\n-- migrate:up\ncreate table users (id integer);\n")
+	require.Contains(t, output, "Apply 2 migrations up to and including 2_posts.sql? [y/N] ")
+	require.Contains(t, output, "  1 [X] 1_users.sql\n  2 [X] 2_posts.sql\n  3 [ ] 3_comments.sql\n")
+	require.Contains(t, output, "Error: 1_users.sql has already been applied\n")
+	require.Contains(t, output, "Roll back 2 migrations, down to and including 1_users.sql? [y/N] ")
+	require.Contains(t, output, "Error: no migrations have been applied\n")
+	require.Contains(t, output, "Error: invalid migration number: 9\n")
+	require.Contains(t, output, "  v N   view the SQL of migration N\n")
+
+	// the migrations were applied once, and rolled back
+	require.Equal(t, 2, strings.Count(log.String(), "Applying: "))
+	require.Equal(t, 2, strings.Count(log.String(), "Rolling back: "))
+
+	status, err := db.Status()
+	require.NoError(t, err)
+	for _, m := range status {
+		require.False(t, m.Applied)
+	}
+}
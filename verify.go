@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+)
+
+// verifyChecksums reports applied migrations which were edited after being
+// applied, and fails if there are any
+func verifyChecksums(db *dbmate.DB) error {
+	results, err := db.Verify()
+	if err != nil {
+		return err
+	}
+
+	modified, unverified := 0, 0
+	for _, r := range results {
+		switch {
+		case r.Modified():
+			fmt.Fprintf(db.Log, "Modified: %s\n", r.Filename)
+			modified++
+		case r.Recorded == "":
+			fmt.Fprintf(db.Log, "Unverified: %s (no checksum was recorded when it was applied)\n", r.Filename)
+			unverified++
+		}
+	}
+
+	fmt.Fprintf(db.Log, "Verified %d applied migrations", len(results)-modified-unverified)
+	if unverified > 0 {
+		fmt.Fprintf(db.Log, " (%d unverified)", unverified)
+	}
+	fmt.Fprintln(db.Log)
+
+	if modified > 0 {
+		return fmt.Errorf("%d applied migrations have been modified", modified)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifyChecksums(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	writeTestMigration(t, dir, "1_users.sql", "create table users (id integer);")
+	writeTestMigration(t, dir, "2_posts.sql", "create table posts (id integer);")
+
+	u, err := url.Parse("sqlite:///" + filepath.Join(dir, "verify.sqlite3"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	db := dbmate.New(u)
+	db.AutoDumpSchema = false
+	db.MigrationsDir = dir
+	db.Log = &buf
+	require.NoError(t, db.Migrate())
+
+	// pending migrations are not verified
+	writeTestMigration(t, dir, "3_comments.sql", "create table comments (id integer);")
+
+	buf.Reset()
+	err = verifyChecksums(db)
+	require.NoError(t, err)
+	require.Equal(t, "Verified 2 applied migrations\n", buf.String())
+
+	writeTestMigration(t, dir, "2_posts.sql", "create table posts (id integer, title text);")
+
+	buf.Reset()
+	err = verifyChecksums(db)
+	require.EqualError(t, err, "1 applied migrations have been modified")
+	require.Equal(t, "Modified: 2_posts.sql\nVerified 1 applied migrations\n", buf.String())
+}
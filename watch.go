@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/urfave/cli"
+)
+
+// watcher polls the migrations directory for new migrations
+type watcher struct {
+	db        *dbmate.DB
+	apply     bool
+	newReport func() runReport
+	reporters []reporter
+
+	// files lists the migration files at the last successful check
+	files string
+	// reported tracks pending migrations which have already been printed
+	reported map[string]bool
+}
+
+// watchMigrations checks for pending migrations whenever the migrations
+// directory changes, until interrupted
+func watchMigrations(db *dbmate.DB, c *cli.Context) error {
+	rs, err := reporters(c)
+	if err != nil {
+		return err
+	}
+
+	w := &watcher{
+		db:    db,
+		apply: c.Bool("apply"),
+		newReport: func() runReport {
+			report := newRunReport(c, db.DatabaseURL)
+			report.Command = "migrate"
+			return report
+		},
+		reporters: rs,
+		reported:  map[string]bool{},
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+
+	fmt.Fprintf(db.Log, "Watching: %s\n", db.MigrationsDir)
+	for {
+		if err := w.check(); err != nil {
+			fmt.Fprintf(db.Log, "Error: %s\n", err)
+		}
+
+		select {
+		case <-sig:
+			return nil
+		case <-time.After(c.Duration("interval")):
+		}
+	}
+}
+
+// check looks for pending migrations if the directory has changed, and applies
+// them if enabled. Errors reading the database are retried on the next check,
+// while failed migrations are only retried once the directory changes again.
+func (w *watcher) check() error {
+	files, err := watchedFiles(w.db.MigrationsDir)
+	if err != nil {
+		return err
+	}
+
+	current := strings.Join(files, "\n")
+	if current == w.files {
+		return nil
+	}
+
+	status, err := w.db.Status()
+	if err != nil {
+		return err
+	}
+	w.files = current
+
+	pending := false
+	for _, m := range status {
+		if !m.Applied {
+			pending = true
+		}
+	}
+	if !pending {
+		return nil
+	}
+
+	if !w.apply {
+		for _, m := range status {
+			if !m.Applied && !w.reported[m.Filename] {
+				fmt.Fprintf(w.db.Log, "Pending: %s\n", m.Filename)
+				w.reported[m.Filename] = true
+			}
+		}
+		return nil
+	}
+
+	report := runReported(w.db, w.reporters, w.newReport(), w.db.Migrate)
+	if report.Err != nil {
+		fmt.Fprintf(w.db.Log, "Error: %s\n", report.Err)
+	}
+
+	return nil
+}
+
+// watchedFiles returns the sql files in the migrations directory and its
+// subdirectories. This also picks up files in a mounted ConfigMap, which are
+// symlinks into hidden directories (which are skipped).
+func watchedFiles(dir string) ([]string, error) {
+	files := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && path != dir && strings.HasPrefix(info.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if !info.IsDir() && filepath.Ext(path) == ".sql" {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return files, nil
+	}
+
+	return files, err
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/amacneil/dbmate/pkg/dbmate"
+	"github.com/stretchr/testify/require"
+)
+
+func testWatcher(t *testing.T, apply bool) (*watcher, *bytes.Buffer, *[]runReport, func()) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+
+	u, err := url.Parse("sqlite3:///" + filepath.Join(dir, "watch.sqlite3"))
+	require.NoError(t, err)
+
+	var log bytes.Buffer
+	db := dbmate.New(u)
+	db.AutoDumpSchema = false
+	db.MigrationsDir = filepath.Join(dir, "migrations")
+	db.Log = &log
+	require.NoError(t, os.Mkdir(db.MigrationsDir, 0755))
+
+	var reported []runReport
+	w := &watcher{
+		db:        db,
+		apply:     apply,
+		newReport: func() runReport { return runReport{Command: "migrate"} },
+		reporters: []reporter{func(r runReport) error {
+			reported = append(reported, r)
+			return nil
+		}},
+		reported: map[string]bool{},
+	}
+
+	return w, &log, &reported, func() {
+		require.NoError(t, os.RemoveAll(dir))
+	}
+}
+
+func writeTestMigration(t *testing.T, dir, name, up string) {
+	contents := "-- migrate:up\n" + up + "\n-- migrate:down\n"
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644)
+	require.NoError(t, err)
+}
+
+func TestWatcherReport(t *testing.T) {
+	w, log, reported, cleanup := testWatcher(t, false)
+	defer cleanup()
+
+	writeTestMigration(t, w.db.MigrationsDir, "1_users.sql", "create table users (id integer);")
+	require.NoError(t, w.check())
+	require.NoError(t, w.check())
+	require.Equal(t, "Pending: 1_users.sql\n", log.String())
+	require.Len(t, *reported, 0)
+
+	writeTestMigration(t, w.db.MigrationsDir, "2_posts.sql", "create table posts (id integer);")
+	require.NoError(t, w.check())
+	require.Equal(t, "Pending: 1_users.sql\nPending: 2_posts.sql\n", log.String())
+}
+
+func TestWatcherApply(t *testing.T) {
+	w, log, reported, cleanup := testWatcher(t, true)
+	defer cleanup()
+
+	// empty directory
+	require.NoError(t, w.check())
+	require.Equal(t, "", log.String())
+
+	writeTestMigration(t, w.db.MigrationsDir, "1_users.sql", "create table users (id integer);")
+	require.NoError(t, w.check())
+	require.Equal(t, "Applying: 1_users.sql\n", log.String())
+	require.Len(t, *reported, 1)
+	require.Equal(t, 1, (*reported)[0].Applied())
+
+	// nothing changed
+	require.NoError(t, w.check())
+	require.Len(t, *reported, 1)
+
+	// failed migrations are reported, and not retried until the directory changes
+	writeTestMigration(t, w.db.MigrationsDir, "2_posts.sql", "not valid sql;")
+	require.NoError(t, w.check())
+	require.NoError(t, w.check())
+	require.Len(t, *reported, 2)
+	require.Error(t, (*reported)[1].Err)
+	require.Contains(t, log.String(), "Error: ")
+}
+
+func TestWatchedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dbmate")
+	require.NoError(t, err)
+	defer func() {
+		err := os.RemoveAll(dir)
+		require.NoError(t, err)
+	}()
+
+	files, err := watchedFiles(filepath.Join(dir, "missing"))
+	require.NoError(t, err)
+	require.Empty(t, files)
+
+	writeTestMigration(t, dir, "1_users.sql", "create table users (id integer);")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "data"), 0755))
+	writeTestMigration(t, filepath.Join(dir, "data"), "2_backfill.sql", "select 1;")
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0755))
+	writeTestMigration(t, filepath.Join(dir, "..data"), "1_users.sql", "create table users (id integer);")
+
+	files, err = watchedFiles(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(dir, "1_users.sql"), filepath.Join(dir, "data", "2_backfill.sql")}, files)
+}